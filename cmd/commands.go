@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/auth"
+	"github.com/Petro-vich/transaction_processing_go/internal/config"
+	"github.com/Petro-vich/transaction_processing_go/internal/hashchain"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/logger/sl"
+	"github.com/Petro-vich/transaction_processing_go/internal/service/archiver"
+	"github.com/Petro-vich/transaction_processing_go/internal/service/backup"
+	"github.com/Petro-vich/transaction_processing_go/internal/service/checkpoint"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage/sqlite"
+)
+
+const commandsUsage = `usage: transaction-service [command]
+
+Without a command the HTTP server is started.
+
+Commands:
+  migrate up        apply all pending migrations
+  migrate down      roll back the latest migration
+  migrate to N      migrate up or down to version N
+  migrate version   print the current and latest schema versions
+  backup            take an online backup into the backup directory
+  backup list       list existing backups, newest first
+  restore FILE      replace the database with a backup; the service must be stopped
+  archive [DAYS]    move transactions older than DAYS (default archive.retention_days)
+                    into monthly archive files
+  keys create NAME SCOPE[,SCOPE...]
+                    issue an API key; the key is printed once
+  keys list         list API keys
+  keys revoke ID    revoke an API key
+  chain verify      verify the transaction hash chain and the checkpoints;
+                    exits with 2 when the chain is broken
+  chain checkpoint  sign the chain head with chain.checkpoint_key_file
+  chain keygen FILE write a new checkpoint key to FILE
+
+Scopes: balance:read, transactions:read, transfers:write, wallets:write, metrics:read, admin`
+
+// runCommand executes an administrative subcommand and returns the exit code.
+func runCommand(cfg *config.Config, log *slog.Logger, args []string) int {
+	var err error
+	switch args[0] {
+	case "migrate":
+		err = migrateCommand(cfg, log, args[1:])
+	case "backup":
+		err = backupCommand(cfg, log, args[1:])
+	case "restore":
+		err = restoreCommand(cfg, log, args[1:])
+	case "archive":
+		err = archiveCommand(cfg, log, args[1:])
+	case "keys":
+		err = keysCommand(cfg, log, args[1:])
+	case "chain":
+		err = chainCommand(cfg, log, args[1:])
+	default:
+		err = fmt.Errorf("unknown command %q", args[0])
+	}
+
+	if errors.Is(err, errChainBroken) {
+		return 2
+	}
+	if err != nil {
+		log.Error("command failed", slog.String("command", args[0]), sl.Err(err))
+		fmt.Println(commandsUsage)
+		return 1
+	}
+	return 0
+}
+
+func migrateCommand(cfg *config.Config, log *slog.Logger, args []string) error {
+	if cfg.Storage != config.StorageSQLite {
+		return fmt.Errorf("migrations are only supported by the %s storage", config.StorageSQLite)
+	}
+	if len(args) == 0 {
+		return errors.New("migrate requires up, down, to or version")
+	}
+
+	st, err := sqlite.Open(cfg.StoragePath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	ctx := context.Background()
+
+	current, err := st.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		err = st.Migrate(ctx)
+	case "down":
+		if current == 0 {
+			return errors.New("no migrations to roll back")
+		}
+		err = st.MigrateTo(ctx, current-1)
+	case "to":
+		if len(args) != 2 {
+			return errors.New("migrate to requires a version")
+		}
+		target, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		err = st.MigrateTo(ctx, target)
+	case "version":
+		fmt.Printf("current: %d\nlatest: %d\n", current, sqlite.LatestVersion())
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	version, err := st.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	log.Info("migration finished", slog.Int("from", current), slog.Int("to", version))
+	return nil
+}
+
+func backupCommand(cfg *config.Config, log *slog.Logger, args []string) error {
+	if cfg.Storage != config.StorageSQLite {
+		return fmt.Errorf("backups are only supported by the %s storage", config.StorageSQLite)
+	}
+
+	st, err := sqlite.Open(cfg.StoragePath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	svc := backup.New(st, cfg.Backup)
+
+	if len(args) > 0 {
+		if args[0] != "list" {
+			return fmt.Errorf("unknown backup command %q", args[0])
+		}
+		backups, err := svc.List()
+		if err != nil {
+			return err
+		}
+		for _, b := range backups {
+			fmt.Printf("%s\t%d\t%s\n", b.CreatedAt.Format(time.RFC3339), b.Size, b.Path)
+		}
+		return nil
+	}
+
+	info, err := svc.Create(context.Background())
+	if err != nil {
+		return err
+	}
+
+	log.Info("backup created", slog.String("path", info.Path), slog.Int64("size", info.Size))
+	return nil
+}
+
+func restoreCommand(cfg *config.Config, log *slog.Logger, args []string) error {
+	if cfg.Storage != config.StorageSQLite {
+		return fmt.Errorf("restore is only supported by the %s storage", config.StorageSQLite)
+	}
+	if len(args) != 1 {
+		return errors.New("restore requires a backup file")
+	}
+
+	if err := backup.Restore(context.Background(), args[0], cfg.StoragePath); err != nil {
+		return err
+	}
+
+	// Backups do not include the archive files, so transactions archived
+	// only after the backup was taken survive just in those files.
+	archives, err := sqlite.ArchiveFiles(cfg.Archive.Dir)
+	if err != nil {
+		log.Warn("failed to list archive files", slog.String("dir", cfg.Archive.Dir), sl.Err(err))
+	} else if len(archives) > 0 {
+		log.Warn("archive files are not part of the backup and were left as they are",
+			slog.String("dir", cfg.Archive.Dir), slog.Int("files", len(archives)))
+	}
+
+	log.Info("database restored", slog.String("from", args[0]), slog.String("to", cfg.StoragePath))
+	return nil
+}
+
+func archiveCommand(cfg *config.Config, log *slog.Logger, args []string) error {
+	if cfg.Storage != config.StorageSQLite {
+		return fmt.Errorf("archiving is only supported by the %s storage", config.StorageSQLite)
+	}
+
+	archiveCfg := cfg.Archive
+	if len(args) > 0 {
+		days, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid number of days %q", args[0])
+		}
+		archiveCfg.RetentionDays = days
+	}
+	if archiveCfg.RetentionDays <= 0 {
+		return errors.New("archive requires a positive number of days")
+	}
+
+	st, err := openSQLite(cfg)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	report, err := archiver.New(st, archiveCfg, log).RunOnce(context.Background())
+	if err != nil {
+		return err
+	}
+
+	log.Info("transactions archived", slog.Int("moved", report.Moved), slog.Any("files", report.Files))
+	return nil
+}
+
+func keysCommand(cfg *config.Config, log *slog.Logger, args []string) error {
+	if cfg.Storage != config.StorageSQLite {
+		return fmt.Errorf("API keys are only supported by the %s storage", config.StorageSQLite)
+	}
+	if len(args) == 0 {
+		return errors.New("keys requires create, list or revoke")
+	}
+
+	st, err := openSQLite(cfg)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	svc := auth.NewService(st)
+	ctx := context.Background()
+
+	switch args[0] {
+	case "create":
+		if len(args) != 3 {
+			return errors.New("keys create requires a name and scopes")
+		}
+		scopes, err := auth.ParseScopes(strings.Split(args[2], ","))
+		if err != nil {
+			return err
+		}
+		token, key, err := svc.Issue(ctx, args[1], scopes)
+		if err != nil {
+			return err
+		}
+		log.Info("API key issued", slog.String("id", key.ID), slog.String("name", key.Name))
+		fmt.Println(token)
+	case "list":
+		keys, err := svc.List(ctx)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			status := "active"
+			if k.RevokedAt != nil {
+				status = "revoked " + k.RevokedAt.Format(time.RFC3339)
+			}
+			scopes := make([]string, len(k.Scopes))
+			for i, s := range k.Scopes {
+				scopes[i] = string(s)
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, strings.Join(scopes, ","), k.CreatedAt.Format(time.RFC3339), status)
+		}
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New("keys revoke requires a key id")
+		}
+		if err := svc.Revoke(ctx, args[1]); err != nil {
+			return err
+		}
+		log.Info("API key revoked", slog.String("id", args[1]))
+	default:
+		return fmt.Errorf("unknown keys command %q", args[0])
+	}
+	return nil
+}
+
+// errChainBroken is returned by chain verify for a broken chain, which is
+// reported on stdout rather than as a failed command.
+var errChainBroken = errors.New("transaction chain is broken")
+
+func chainCommand(cfg *config.Config, log *slog.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New("chain requires verify, checkpoint or keygen")
+	}
+	if args[0] == "keygen" {
+		if len(args) != 2 {
+			return errors.New("chain keygen requires a file")
+		}
+		_, key, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			return err
+		}
+		// O_EXCL keeps an existing key, which would invalidate the checkpoints signed with it.
+		f, err := os.OpenFile(args[1], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(f, hex.EncodeToString(key)); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		log.Info("checkpoint key written", slog.String("file", args[1]),
+			slog.String("public_key", hex.EncodeToString(key.Public().(ed25519.PublicKey))))
+		return nil
+	}
+
+	if cfg.Storage != config.StorageSQLite {
+		return fmt.Errorf("the hash chain is only supported by the %s storage", config.StorageSQLite)
+	}
+
+	var key ed25519.PrivateKey
+	if cfg.Chain.CheckpointKeyFile != "" {
+		var err error
+		if key, err = hashchain.LoadKey(cfg.Chain.CheckpointKeyFile); err != nil {
+			return err
+		}
+	}
+
+	st, err := openSQLite(cfg)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "verify":
+		var pub ed25519.PublicKey
+		if key != nil {
+			pub = key.Public().(ed25519.PublicKey)
+		}
+		report, err := st.VerifyChain(ctx, pub)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("checked: %d\nunchained: %d\ncheckpoints: %d\nhead: %d %s\n",
+			report.Checked, report.Unchained, report.Checkpoints, report.Head.LastID, report.Head.Hash)
+		if !report.Valid {
+			fmt.Printf("broken at %d: %s\n", report.Broken.ID, report.Broken.Reason)
+			return errChainBroken
+		}
+		fmt.Println("valid")
+	case "checkpoint":
+		if key == nil {
+			return errors.New("chain checkpoint requires chain.checkpoint_key_file")
+		}
+		cp, created, err := checkpoint.New(st, key, cfg.Chain, log).RunOnce(ctx)
+		if err != nil {
+			return err
+		}
+		if !created {
+			log.Info("chain unchanged since the last checkpoint", slog.Int("last_id", cp.Head.LastID))
+			return nil
+		}
+		log.Info("chain checkpoint signed", slog.Int("id", cp.ID), slog.Int("last_id", cp.Head.LastID),
+			slog.String("hash", cp.Head.Hash))
+	default:
+		return fmt.Errorf("unknown chain command %q", args[0])
+	}
+	return nil
+}
+
+// openSQLite opens the database and migrates it when auto_migrate is set.
+// Otherwise the schema must already be at the latest version.
+func openSQLite(cfg *config.Config) (*sqlite.Storage, error) {
+	var (
+		st  *sqlite.Storage
+		err error
+	)
+	if cfg.AutoMigrate {
+		st, err = sqlite.New(cfg.StoragePath)
+	} else {
+		st, err = sqlite.Open(cfg.StoragePath)
+		if err == nil {
+			if err = st.CheckSchema(context.Background()); err != nil {
+				st.Close()
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	st.UseArchive(cfg.Archive.Dir)
+	return st, nil
+}
@@ -1,16 +1,49 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/Petro-vich/transaction_processing_go/internal/auth"
 	"github.com/Petro-vich/transaction_processing_go/internal/config"
+	"github.com/Petro-vich/transaction_processing_go/internal/hashchain"
+	"github.com/Petro-vich/transaction_processing_go/internal/health"
 	httpserver "github.com/Petro-vich/transaction_processing_go/internal/http-server"
 	"github.com/Petro-vich/transaction_processing_go/internal/lib/logger/sl"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/ratelimit"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/tlsreload"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/tracing"
+	"github.com/Petro-vich/transaction_processing_go/internal/metrics"
+	"github.com/Petro-vich/transaction_processing_go/internal/risk"
+	"github.com/Petro-vich/transaction_processing_go/internal/screening"
+	"github.com/Petro-vich/transaction_processing_go/internal/service/archiver"
+	"github.com/Petro-vich/transaction_processing_go/internal/service/checkpoint"
 	"github.com/Petro-vich/transaction_processing_go/internal/service/wallet"
+	"github.com/Petro-vich/transaction_processing_go/internal/signing"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage/cache"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage/journal"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage/memory"
 	"github.com/Petro-vich/transaction_processing_go/internal/storage/sqlite"
 )
 
+// repository is a storage backend selected by the configuration.
+type repository interface {
+	storage.Repository
+	IsEmpty() bool
+	Close() error
+}
+
 func main() {
 
 	cfg := config.Load()
@@ -18,27 +51,419 @@ func main() {
 	log.Info("Start of the program")
 	log.Debug("debug messages are enabled")
 
-	storage, err := sqlite.New(cfg.StoragePath)
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(cfg, log, os.Args[1:]))
+	}
+
+	flushTraces, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Error("failed to set up tracing", sl.Err(err))
+		os.Exit(1)
+	}
+	if cfg.Tracing.Exporter != config.TracingNone {
+		log.Info("tracing enabled", slog.String("exporter", cfg.Tracing.Exporter),
+			slog.Float64("sample_ratio", cfg.Tracing.SampleRatio))
+	}
+
+	storage, err := newStorage(cfg, log)
 
 	if err != nil {
 		log.Error("failed to init storage", sl.Err(err))
 		os.Exit(1)
 	}
+	log.Info("storage initialized", slog.String("storage", cfg.Storage))
+
+	if _, ok := storage.(auth.KeyStore); cfg.Auth.Enabled && !ok {
+		log.Error("API key authentication requires the sqlite storage", slog.String("storage", cfg.Storage))
+		os.Exit(1)
+	}
+
+	var opts []httpserver.Option
+	if cfg.Transfers.RequireSignatures {
+		nonces, ok := storage.(signing.NonceStore)
+		if !ok {
+			log.Error("signed transfers are not supported by the storage", slog.String("storage", cfg.Storage))
+			os.Exit(1)
+		}
+		opts = append(opts, httpserver.WithSignedTransfers(nonces))
+		log.Info("signed transfers are required")
+	}
+	if cfg.Auth.JWT.Enabled {
+		verifier, err := auth.NewJWTVerifier(cfg.Auth.JWT)
+		if err != nil {
+			log.Error("failed to load JWT verification keys", sl.Err(err))
+			os.Exit(1)
+		}
+		opts = append(opts, httpserver.WithJWT(verifier))
+		log.Info("JWT bearer tokens are accepted")
+	}
+
+	// Background services run until shutdown, after the server drained.
+	bg := newWorkers()
+
+	if cfg.Archive.RetentionDays > 0 {
+		if a, ok := storage.(archiver.Archiver); ok {
+			bg.Go(archiver.New(a, cfg.Archive, log).Run)
+			log.Info("archiving enabled", slog.Int("retention_days", cfg.Archive.RetentionDays))
+		} else {
+			log.Warn("archiving is not supported by the storage", slog.String("storage", cfg.Storage))
+		}
+	}
+
+	if cfg.Chain.CheckpointKeyFile != "" {
+		store, ok := storage.(checkpoint.Store)
+		if !ok {
+			log.Error("chain checkpoints are not supported by the storage", slog.String("storage", cfg.Storage))
+			os.Exit(1)
+		}
+		key, err := hashchain.LoadKey(cfg.Chain.CheckpointKeyFile)
+		if err != nil {
+			log.Error("failed to load checkpoint key", sl.Err(err))
+			os.Exit(1)
+		}
+		bg.Go(checkpoint.New(store, key, cfg.Chain, log).Run)
+		opts = append(opts, httpserver.WithChainKey(key.Public().(ed25519.PublicKey)))
+		log.Info("chain checkpoints enabled", slog.Duration("interval", cfg.Chain.CheckpointInterval))
+	}
+
+	if cfg.TLS.Enabled {
+		tlsOpts, err := withTLS(cfg.TLS, log)
+		if err != nil {
+			log.Error("failed to set up TLS", sl.Err(err))
+			os.Exit(1)
+		}
+		opts = append(opts, tlsOpts...)
+	}
+	opts = append(opts, httpserver.WithRateLimits(
+		newLimiter(bg, cfg.RateLimit.Client, cfg.RateLimit.CleanupInterval),
+		newLimiter(bg, cfg.RateLimit.Wallet, cfg.RateLimit.CleanupInterval),
+	))
+
+	var m *metrics.Metrics
+	if cfg.Metrics.Enabled {
+		m = newMetrics(storage)
+		opts = append(opts, httpserver.WithMetrics(m))
+		log.Info("metrics enabled", slog.String("path", "/metrics"))
+	}
 
-	if storage.IsEmpty() {
+	repo := withCache(withMetrics(storage, m), cfg, log)
+	// Approved reviews are sent through sender, so they are screened too.
+	var sender risk.Sender = repo
+	if cfg.Screening.Enabled {
+		screener, err := newScreener(bg, storage, cfg.Screening, log)
+		if err != nil {
+			log.Error("failed to set up address screening", slog.String("storage", cfg.Storage), sl.Err(err))
+			os.Exit(1)
+		}
+		sender = screener.Guard(repo)
+		opts = append(opts, httpserver.WithScreening(screener))
+	}
+	if len(cfg.Risk.Rules) > 0 {
+		svc, err := newRiskService(storage, repo, sender, cfg.Risk)
+		if err != nil {
+			log.Error("failed to set up risk rules", slog.String("storage", cfg.Storage), sl.Err(err))
+			os.Exit(1)
+		}
+		// Reviews approved before a stop that left their transfers
+		// unfinished are finished before requests are served.
+		recovered, err := svc.Recover(context.Background())
+		if err != nil {
+			log.Error("failed to finish approved reviews", sl.Err(err))
+			os.Exit(1)
+		}
+		if recovered > 0 {
+			log.Info("finished approved reviews", slog.Int("reviews", recovered))
+		}
+		opts = append(opts, httpserver.WithRisk(svc))
+		log.Info("risk rules enabled", slog.Int("rules", len(cfg.Risk.Rules)))
+	}
+
+	checker := newHealth(storage, cfg)
+	opts = append(opts, httpserver.WithHealth(checker))
+
+	server := httpserver.New(repo, cfg, log, opts...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	served := make(chan error, 1)
+	go func() { served <- server.Start() }()
+	log.Info("Starting server:", slog.String("address", cfg.Address))
+
+	// Probes are answered from here on, but /readyz fails until the
+	// starter wallets are in place. Starter wallets have no keypairs, so
+	// they could never send signed transfers.
+	if storage.IsEmpty() && !cfg.Transfers.RequireSignatures {
 		WallServ := wallet.NewService(storage)
-		if err := WallServ.InitWall(10); err != nil {
+		if err := WallServ.InitWall(context.Background(), 10); err != nil {
 			log.Error("failed to init pool wallets", sl.Err(err))
 		}
 		log.Info("the starter set of wallets has been added")
 	}
+	checker.MarkStarted()
+	log.Info("service is ready")
 
-	server := httpserver.New(storage, cfg, log)
-	log.Info("Starting server:", slog.String("address", cfg.Address))
-	if err := server.Start(); err != nil {
+	select {
+	case err := <-served:
 		log.Error("failed to start server", sl.Err(err))
+		bg.Stop(context.Background())
+		storage.Close()
+		flushTraces(context.Background())
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+	// A second signal kills the process without waiting.
+	stop()
 
+	log.Info("shutting down", slog.Duration("timeout", cfg.ShutdownTimeout))
+	if err := shutdown(server, bg, storage, flushTraces, cfg.ShutdownTimeout); err != nil {
+		log.Error("shutdown was not clean", sl.Err(err))
 		os.Exit(1)
 	}
+	log.Info("server stopped")
+}
+
+// drainer is the HTTP server as seen by shutdown.
+type drainer interface {
+	Shutdown(ctx context.Context) error
+	Wait(ctx context.Context) error
+}
+
+// shutdown drains in-flight requests, stops the background workers, closes
+// the storage and flushes pending spans. Every step gets its own timeout;
+// requests still running after the draining one are cut off. The storage is
+// left open when handlers or workers have not returned in time, so that they
+// never run against a closed storage.
+func shutdown(server drainer, bg *workers, st io.Closer, flushTraces func(context.Context) error, timeout time.Duration) error {
+	var errs []error
+	step := func(name string, run func(context.Context) error) bool {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		if err := run(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			return false
+		}
+		return true
+	}
+
+	step("draining requests", server.Shutdown)
+	handlersDone := step("waiting for cut off requests", server.Wait)
+	workersDone := step("stopping background workers", bg.Stop)
+	if handlersDone && workersDone {
+		if err := st.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing storage: %w", err))
+		}
+	} else {
+		errs = append(errs, errors.New("storage left open: requests or workers are still running"))
+	}
+	step("flushing traces", flushTraces)
+	return errors.Join(errs...)
+}
+
+// workers runs background services until Stop is called.
+type workers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newWorkers() *workers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &workers{ctx: ctx, cancel: cancel}
+}
+
+// Go runs run in a goroutine with a context cancelled by Stop.
+func (w *workers) Go(run func(ctx context.Context)) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		run(w.ctx)
+	}()
+}
+
+// Stop cancels the workers and waits for them to return until ctx is done.
+func (w *workers) Stop(ctx context.Context) error {
+	w.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// newHealth returns the readiness checks of the configured storage: the
+// database answers and is at the latest schema version, the storage
+// directory is writable and the maintenance file is absent.
+func newHealth(st repository, cfg *config.Config) *health.Checker {
+	checker := health.New(cfg.Health.CheckTimeout)
+
+	switch st := st.(type) {
+	case *sqlite.Storage:
+		checker.Add("database", st.Ping)
+		checker.Add("migrations", st.CheckSchema)
+		if lock, ok := sqlite.LockPath(cfg.StoragePath); ok {
+			checker.Add("disk", health.Writable(filepath.Dir(lock)))
+		}
+	case *journal.Storage:
+		checker.Add("disk", health.Writable(cfg.StoragePath))
+	}
+
+	if cfg.Health.MaintenanceFile != "" {
+		checker.Add("maintenance", health.Maintenance(cfg.Health.MaintenanceFile))
+	}
+	return checker
+}
+
+func newStorage(cfg *config.Config, log *slog.Logger) (repository, error) {
+	switch cfg.Storage {
+	case config.StorageSQLite:
+		return openSQLite(cfg)
+	case config.StorageMemory:
+		return memory.New(), nil
+	case config.StorageJournal:
+		st, err := journal.New(cfg.StoragePath, cfg.SnapshotEvery)
+		if err != nil {
+			return nil, err
+		}
+		st.UseLogger(log)
+		return st, nil
+	default:
+		return nil, fmt.Errorf("unknown storage %q", cfg.Storage)
+	}
+}
+
+// newMetrics returns the metrics of the service including the total funds
+// and the connection pool of st when it has them.
+func newMetrics(st repository) *metrics.Metrics {
+	m := metrics.New()
+	if src, ok := st.(metrics.FundsSource); ok {
+		m.RegisterFunds(src)
+	}
+	if src, ok := st.(metrics.PoolSource); ok {
+		m.RegisterPool(src)
+	}
+	return m
+}
+
+// withMetrics wraps repo so its operations are recorded in m unless
+// metrics are disabled.
+func withMetrics(repo storage.Repository, m *metrics.Metrics) storage.Repository {
+	if m == nil {
+		return repo
+	}
+	return m.Wrap(repo)
+}
+
+// withCache wraps repo with the balance cache unless it is disabled.
+func withCache(repo storage.Repository, cfg *config.Config, log *slog.Logger) storage.Repository {
+	if cfg.Cache.Size <= 0 {
+		return repo
+	}
+
+	log.Info("balance cache enabled", slog.Int("size", cfg.Cache.Size), slog.Duration("ttl", cfg.Cache.TTL))
+	return cache.New(repo, cfg.Cache.Size, cfg.Cache.TTL)
+}
+
+// newRiskService evaluates transfers with the rules of cfg against the
+// history in repo, queuing held ones in st and executing approved ones
+// with sender.
+func newRiskService(st repository, repo storage.Repository, sender risk.Sender, cfg config.Risk) (*risk.Service, error) {
+	engine, err := risk.NewEngine(cfg, repo)
+	if err != nil {
+		return nil, err
+	}
+	reviews, _ := st.(risk.ReviewStore)
+	return risk.NewService(engine, reviews, sender)
+}
+
+// newScreener loads the screening lists, which then are read again on
+// SIGHUP and every reload interval.
+func newScreener(bg *workers, st repository, cfg config.Screening, log *slog.Logger) (*screening.Screener, error) {
+	store, ok := st.(screening.Store)
+	if !ok {
+		return nil, fmt.Errorf("address screening is not supported by the storage")
+	}
+
+	screener := screening.New(store, cfg, log)
+	stats, err := screener.Load(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	log.Info("address screening enabled", slog.Int("block", stats.Block), slog.Int("allow", stats.Allow),
+		slog.Duration("reload_interval", cfg.ReloadInterval))
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			screener.Reload(context.Background())
+		}
+	}()
+	bg.Go(screener.Run)
+
+	return screener, nil
+}
+
+// withTLS loads the certificates, reloads them on SIGHUP and maps client
+// certificate common names to scopes.
+func withTLS(cfg config.TLS, log *slog.Logger) ([]httpserver.Option, error) {
+	if len(cfg.Clients) > 0 && cfg.ClientCAFile == "" {
+		return nil, fmt.Errorf("tls.clients requires tls.client_ca_file")
+	}
+
+	clients := make(map[string][]auth.Scope, len(cfg.Clients))
+	for cn, names := range cfg.Clients {
+		scopes, err := auth.ParseScopes(names)
+		if err != nil {
+			return nil, fmt.Errorf("tls client %q: %w", cn, err)
+		}
+		clients[cn] = scopes
+	}
+
+	reloader, err := tlsreload.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := reloader.Reload(); err != nil {
+				log.Error("failed to reload TLS certificates, keeping the previous ones", sl.Err(err))
+				continue
+			}
+			log.Info("TLS certificates reloaded")
+		}
+	}()
+
+	log.Info("TLS enabled", slog.String("min_version", cfg.MinVersion),
+		slog.Bool("client_certificates", cfg.ClientCAFile != ""))
+
+	opts := []httpserver.Option{httpserver.WithTLS(reloader)}
+	if len(clients) > 0 {
+		opts = append(opts, httpserver.WithClientCertificates(clients))
+	}
+	return opts, nil
+}
+
+// newLimiter returns nil for a disabled limit and otherwise a limiter whose
+// idle buckets are dropped every cleanup interval.
+func newLimiter(bg *workers, limit config.Limit, cleanup time.Duration) *ratelimit.Limiter {
+	if limit.Rate <= 0 {
+		return nil
+	}
 
+	l := ratelimit.New(limit.Rate, limit.Burst)
+	bg.Go(func(ctx context.Context) { l.Run(ctx, cleanup) })
+	return l
 }
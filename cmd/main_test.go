@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// idleServer has no requests to drain.
+type idleServer struct{}
+
+func (idleServer) Shutdown(context.Context) error { return nil }
+func (idleServer) Wait(context.Context) error     { return nil }
+
+// closer records whether Close was called.
+type closer struct {
+	closed bool
+}
+
+func (c *closer) Close() error {
+	c.closed = true
+	return nil
+}
+
+func noTraces(context.Context) error { return nil }
+
+// Тесты для остановки сервиса
+func TestShutdown(t *testing.T) {
+	t.Run("Closes the storage after the workers", func(t *testing.T) {
+		bg := newWorkers()
+		stopped := false
+		bg.Go(func(ctx context.Context) {
+			<-ctx.Done()
+			stopped = true
+		})
+		st := &closer{}
+
+		require.NoError(t, shutdown(idleServer{}, bg, st, noTraces, time.Second))
+		assert.True(t, stopped)
+		assert.True(t, st.closed)
+	})
+
+	t.Run("Keeps the storage open while a worker is busy", func(t *testing.T) {
+		bg := newWorkers()
+		release := make(chan struct{})
+		bg.Go(func(context.Context) {
+			// The worker ignores the cancellation past the timeout.
+			<-release
+		})
+		defer close(release)
+		st := &closer{}
+
+		err := shutdown(idleServer{}, bg, st, noTraces, 50*time.Millisecond)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Contains(t, err.Error(), "stopping background workers")
+		assert.Contains(t, err.Error(), "storage left open")
+		assert.False(t, st.closed)
+	})
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/address"
+	"github.com/Petro-vich/transaction_processing_go/internal/client"
+	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
+	"github.com/Petro-vich/transaction_processing_go/internal/service/importer"
+)
+
+// Exit codes returned by walletctl.
+const (
+	exitOK           = 0
+	exitError        = 1
+	exitUsage        = 2
+	exitNotFound     = 3
+	exitInsufficient = 4
+	exitInvalid      = 5
+	exitConflict     = 6
+	exitServer       = 7
+	exitUnavailable  = 8
+	exitAuth         = 9
+	exitDenied       = 10
+	exitHeld         = 11
+	exitBlocked      = 12
+)
+
+const usage = `Usage: walletctl [global flags] <command> [args]
+
+Commands:
+  balance <address>             show wallet balance
+  send [-key-file F] [-nonce N] <from> <to> <amount>
+                                transfer funds between wallets, signed with the key in F
+  history [-count N] [address]  show the latest transactions, of one wallet if given
+  create-wallet [amount]        create a wallet, empty unless an admin key sets the balance
+  tail [-count N] [-interval D] print new transactions as they appear
+  import [-dry-run] [-report F] <file.csv>
+                                import transfers from a from,to,amount,reference CSV
+
+Global flags:
+`
+
+type app struct {
+	client *client.Client
+	out    io.Writer
+	format string
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("walletctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	baseURL := flags.String("url", envOr("WALLETCTL_URL", "http://localhost:8080"), "API base URL (env WALLETCTL_URL)")
+	format := flags.String("output", "table", "output format: table or json")
+	timeout := flags.Duration("timeout", 10*time.Second, "HTTP request timeout")
+	apiKey := flags.String("api-key", os.Getenv("WALLETCTL_API_KEY"), "API key (env WALLETCTL_API_KEY)")
+	tlsCA := flags.String("tls-ca", os.Getenv("WALLETCTL_TLS_CA"), "PEM bundle of CAs trusted for the server (env WALLETCTL_TLS_CA)")
+	tlsCert := flags.String("tls-cert", os.Getenv("WALLETCTL_TLS_CERT"), "PEM client certificate (env WALLETCTL_TLS_CERT)")
+	tlsKey := flags.String("tls-key", os.Getenv("WALLETCTL_TLS_KEY"), "PEM key of the client certificate (env WALLETCTL_TLS_KEY)")
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(stderr, "unknown output format %q\n", *format)
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	a := &app{
+		client: client.New(*baseURL, *timeout),
+		out:    stdout,
+		format: *format,
+	}
+	a.client.SetAPIKey(*apiKey)
+	if *tlsCA != "" || *tlsCert != "" || *tlsKey != "" {
+		cfg, err := tlsConfig(*tlsCA, *tlsCert, *tlsKey)
+		if err != nil {
+			fmt.Fprintf(stderr, "walletctl: %v\n", err)
+			return exitUsage
+		}
+		a.client.SetTLSConfig(cfg)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cmd, cmdArgs := flags.Arg(0), flags.Args()[1:]
+
+	var err error
+	switch cmd {
+	case "balance":
+		err = a.balance(ctx, cmdArgs)
+	case "send":
+		err = a.send(ctx, cmdArgs)
+	case "history":
+		err = a.history(ctx, cmdArgs)
+	case "create-wallet":
+		err = a.createWallet(ctx, cmdArgs)
+	case "tail":
+		err = a.tail(ctx, cmdArgs)
+	case "import":
+		err = a.importCSV(ctx, cmdArgs)
+	default:
+		err = usageError(fmt.Sprintf("unknown command %q", cmd))
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "walletctl: %v\n", err)
+	}
+	return exitCode(err)
+}
+
+func (a *app) balance(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return usageError("balance requires <address>")
+	}
+
+	balance, err := a.client.GetBalance(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	return a.print(map[string]any{"address": args[0], "balance": balance}, func(w io.Writer) {
+		printBalance(w, args[0], balance)
+	})
+}
+
+// send transfers funds. With -key-file the transfer is signed with the
+// hex encoded private key in that file, using the next nonce of the wallet
+// unless -nonce is given.
+func (a *app) send(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("send", flag.ContinueOnError)
+	keyFile := flags.String("key-file", "", "file with the hex encoded private key of the sending wallet")
+	nonce := flags.Int64("nonce", 0, "nonce of a signed transfer (default: the next one)")
+	if err := flags.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	args = flags.Args()
+	if len(args) != 3 {
+		return usageError("send requires <from> <to> <amount>")
+	}
+
+	amount, err := strconv.ParseFloat(args[2], 64)
+	if err != nil {
+		return usageError(fmt.Sprintf("invalid amount %q", args[2]))
+	}
+
+	if *keyFile == "" {
+		err = a.client.SendMoney(ctx, args[0], args[1], amount)
+	} else {
+		err = a.sendSigned(ctx, args[0], args[1], amount, *keyFile, *nonce)
+	}
+	if err != nil {
+		return err
+	}
+
+	return a.print(map[string]any{"status": "OK", "from": args[0], "to": args[1], "amount": amount}, func(w io.Writer) {
+		fmt.Fprintf(w, "sent %s from %s to %s\n", formatAmount(amount), args[0], args[1])
+	})
+}
+
+func (a *app) sendSigned(ctx context.Context, from, to string, amount float64, keyFile string, nonce int64) error {
+	raw, err := os.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil || len(key) != ed25519.PrivateKeySize {
+		return usageError(fmt.Sprintf("%s does not contain a hex encoded Ed25519 private key", keyFile))
+	}
+
+	// The signature covers the stored hex form of the addresses.
+	from, err = address.Normalize(from)
+	if err != nil {
+		return usageError(fmt.Sprintf("invalid from address: %v", err))
+	}
+	to, err = address.Normalize(to)
+	if err != nil {
+		return usageError(fmt.Sprintf("invalid to address: %v", err))
+	}
+
+	if nonce == 0 {
+		last, err := a.client.GetNonce(ctx, from)
+		if err != nil {
+			return err
+		}
+		nonce = last + 1
+	}
+
+	return a.client.SendSigned(ctx, from, to, amount, nonce, ed25519.PrivateKey(key))
+}
+
+func (a *app) history(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	count := flags.Int("count", 10, "number of transactions")
+	if err := flags.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+
+	if flags.NArg() > 1 {
+		return usageError("history accepts at most one <address>")
+	}
+
+	var (
+		transactions []transaction.Request
+		err          error
+	)
+	if flags.NArg() == 1 {
+		transactions, err = a.client.GetHistory(ctx, flags.Arg(0), *count)
+	} else {
+		transactions, err = a.client.GetLast(ctx, *count)
+	}
+	if err != nil {
+		return err
+	}
+
+	return a.print(transactions, func(w io.Writer) {
+		printTransactions(w, transactions, true)
+	})
+}
+
+func (a *app) createWallet(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return usageError("create-wallet takes at most one <amount>")
+	}
+
+	var amount float64
+	if len(args) == 1 {
+		var err error
+		if amount, err = strconv.ParseFloat(args[0], 64); err != nil {
+			return usageError(fmt.Sprintf("invalid amount %q", args[0]))
+		}
+	}
+
+	wallet, err := a.client.CreateWallet(ctx, amount)
+	if err != nil {
+		return err
+	}
+
+	return a.print(wallet, func(w io.Writer) {
+		printBalance(w, wallet.Address, wallet.Balance)
+		if wallet.ChecksumAddress != "" {
+			fmt.Fprintf(w, "\nchecksummed address:\n%s\n", wallet.ChecksumAddress)
+		}
+		if wallet.PrivateKey != "" {
+			fmt.Fprintf(w, "\nprivate key (shown once, keep it secret):\n%s\n", wallet.PrivateKey)
+		}
+	})
+}
+
+// tail polls the latest transactions and prints the ones not seen before
+// until the context is cancelled.
+func (a *app) tail(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("tail", flag.ContinueOnError)
+	count := flags.Int("count", 20, "number of transactions fetched per poll")
+	interval := flags.Duration("interval", 2*time.Second, "poll interval")
+	if err := flags.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+
+	lastSeen := -1
+	header := true
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	for {
+		transactions, err := a.client.GetLast(ctx, *count)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		fresh := newTransactions(transactions, lastSeen)
+		if len(fresh) > 0 {
+			lastSeen = fresh[len(fresh)-1].Id
+			if a.format == "json" {
+				for _, tr := range fresh {
+					a.printJSON(tr)
+				}
+			} else {
+				printTransactions(a.out, fresh, header)
+				header = false
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// importCSV uploads a CSV file and prints the per-row report. With -report
+// the report is also written as CSV to the given file.
+func (a *app) importCSV(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "validate the file without executing transfers")
+	reportPath := flags.String("report", "", "write the per-row report as CSV to this file")
+	if err := flags.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if flags.NArg() != 1 {
+		return usageError("import requires <file.csv>")
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	report, importErr := a.client.Import(ctx, file, *dryRun)
+	if report.Rows == nil {
+		return importErr
+	}
+
+	if *reportPath != "" {
+		if err := writeReport(*reportPath, report); err != nil {
+			return err
+		}
+	}
+
+	if err := a.print(report, func(w io.Writer) {
+		printReport(w, report)
+	}); err != nil {
+		return err
+	}
+
+	if importErr != nil {
+		return importErr
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("%d of %d transfers failed", report.Failed, report.Total)
+	}
+	return nil
+}
+
+func writeReport(path string, report importer.Report) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := report.WriteCSV(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// tlsConfig trusts the CAs in caFile in addition to the system ones and
+// presents the client certificate in certFile and keyFile.
+func tlsConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("-tls-cert and -tls-key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+// exitCode derives the process exit code from the API error response.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	var usageErr usageError
+	if errors.As(err, &usageErr) {
+		return exitUsage
+	}
+
+	if errors.Is(err, client.ErrTransferHeld) {
+		return exitHeld
+	}
+
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return exitUnavailable
+		}
+		var netErr interface{ Timeout() bool }
+		if errors.As(err, &netErr) {
+			return exitUnavailable
+		}
+		return exitError
+	}
+
+	switch apiErr.Code {
+	case "not_found":
+		return exitNotFound
+	case "insufficient_funds":
+		return exitInsufficient
+	case "bad_request", "validation_failed":
+		return exitInvalid
+	case "conflict", "nonce_reused":
+		return exitConflict
+	case "unauthorized", "forbidden", "invalid_signature":
+		return exitAuth
+	case "rate_limited":
+		return exitUnavailable
+	case "transfer_denied":
+		return exitDenied
+	case "address_blocked":
+		return exitBlocked
+	}
+
+	switch {
+	case apiErr.StatusCode == 404:
+		return exitNotFound
+	case apiErr.StatusCode == 409:
+		return exitConflict
+	case apiErr.StatusCode >= 500:
+		return exitServer
+	case apiErr.StatusCode >= 400:
+		return exitInvalid
+	default:
+		return exitError
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
+	"github.com/Petro-vich/transaction_processing_go/internal/service/importer"
+)
+
+// print writes v as JSON or renders it with table depending on the output format.
+func (a *app) print(v any, table func(w io.Writer)) error {
+	if a.format == "json" {
+		return a.printJSON(v)
+	}
+
+	table(a.out)
+	return nil
+}
+
+func (a *app) printJSON(v any) error {
+	enc := json.NewEncoder(a.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func printBalance(w io.Writer, address string, balance float64) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ADDRESS\tBALANCE")
+	fmt.Fprintf(tw, "%s\t%s\n", address, formatAmount(balance))
+	tw.Flush()
+}
+
+func printTransactions(w io.Writer, transactions []transaction.Request, header bool) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if header {
+		fmt.Fprintln(tw, "ID\tCREATED AT\tFROM\tTO\tAMOUNT")
+	}
+	for _, tr := range transactions {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n",
+			tr.Id, tr.Created_at.Format(time.RFC3339), tr.From, tr.To, formatAmount(tr.Amount))
+	}
+	tw.Flush()
+}
+
+func printReport(w io.Writer, report importer.Report) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LINE\tREFERENCE\tAMOUNT\tSTATUS\tERROR")
+	for _, res := range report.Rows {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", res.Line, res.Reference, formatAmount(res.Amount), res.Status, res.Error)
+	}
+	tw.Flush()
+
+	mode := "executed"
+	if report.DryRun {
+		mode = "dry run"
+	}
+	fmt.Fprintf(w, "%s: %d rows, %d succeeded, %d failed\n", mode, report.Total, report.Succeeded, report.Failed)
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', -1, 64)
+}
+
+// newTransactions returns transactions with an id greater than lastSeen
+// in ascending id order.
+func newTransactions(transactions []transaction.Request, lastSeen int) []transaction.Request {
+	fresh := make([]transaction.Request, 0, len(transactions))
+	for _, tr := range transactions {
+		if tr.Id > lastSeen {
+			fresh = append(fresh, tr)
+		}
+	}
+
+	sort.Slice(fresh, func(i, j int) bool {
+		return fresh[i].Id < fresh[j].Id
+	})
+	return fresh
+}
@@ -0,0 +1,107 @@
+// Package address parses and formats wallet addresses. An address is 32
+// bytes, stored as 64 lowercase hex characters and shown to people in a
+// checksummed bech32m encoding with the "tpw" prefix, so a mistyped
+// character is rejected instead of naming another wallet.
+package address
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Size is the length of an address in bytes.
+const Size = 32
+
+// Prefix is the human-readable part of the checksummed encoding.
+const Prefix = "tpw"
+
+var (
+	ErrInvalid  = errors.New("invalid wallet address")
+	ErrChecksum = fmt.Errorf("%w: checksum mismatch", ErrInvalid)
+)
+
+// Address is a wallet address.
+type Address [Size]byte
+
+// Parse accepts 64 hex characters in any case or the checksummed encoding.
+func Parse(s string) (Address, error) {
+	var a Address
+
+	if len(s) == 2*Size {
+		if _, err := hex.Decode(a[:], []byte(s)); err != nil {
+			return Address{}, fmt.Errorf("%w: not hex", ErrInvalid)
+		}
+		return a, nil
+	}
+
+	if !strings.HasPrefix(strings.ToLower(s), Prefix+"1") {
+		return Address{}, fmt.Errorf("%w: expected 64 hex characters or a %s1 address", ErrInvalid, Prefix)
+	}
+	data, err := decodeBech32m(s)
+	if err != nil {
+		return Address{}, err
+	}
+	if len(data) != Size {
+		return Address{}, fmt.Errorf("%w: expected %d bytes, got %d", ErrInvalid, Size, len(data))
+	}
+	copy(a[:], data)
+	return a, nil
+}
+
+// Normalize parses s and returns its hex form, the one kept in storage.
+func Normalize(s string) (string, error) {
+	a, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+	return a.Hex(), nil
+}
+
+// IsCanonical reports whether s is an address in its stored form: 64
+// lowercase hex characters.
+func IsCanonical(s string) bool {
+	if len(s) != 2*Size {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Generate returns a random address.
+func Generate() (Address, error) {
+	var a Address
+	if _, err := rand.Read(a[:]); err != nil {
+		return Address{}, err
+	}
+	return a, nil
+}
+
+// FromPublicKey returns the address of the wallet owned by pub.
+func FromPublicKey(pub ed25519.PublicKey) Address {
+	var a Address
+	copy(a[:], pub)
+	return a
+}
+
+// Bytes returns a copy of the address bytes.
+func (a Address) Bytes() []byte {
+	return append([]byte(nil), a[:]...)
+}
+
+// Hex returns the stored form of a.
+func (a Address) Hex() string {
+	return hex.EncodeToString(a[:])
+}
+
+// String returns the checksummed encoding of a.
+func (a Address) String() string {
+	return encodeBech32m(a[:])
+}
@@ -0,0 +1,92 @@
+package address
+
+import (
+	"crypto/ed25519"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sequential() Address {
+	var a Address
+	for i := range a {
+		a[i] = byte(i)
+	}
+	return a
+}
+
+func TestString(t *testing.T) {
+	// Computed with the reference implementation of BIP 350.
+	assert.Equal(t, "tpw1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqgfy7lw", Address{}.String())
+	assert.Equal(t, "tpw1qqqsyqcyq5rqwzqfpg9scrgwpugpzysnzs23v9ccrydpk8qarc0spa0ulh", sequential().String())
+}
+
+func TestParse(t *testing.T) {
+	a := sequential()
+
+	for name, s := range map[string]string{
+		"hex":              a.Hex(),
+		"uppercase hex":    strings.ToUpper(a.Hex()),
+		"checksummed":      a.String(),
+		"uppercase bech32": strings.ToUpper(a.String()),
+	} {
+		parsed, err := Parse(s)
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, a, parsed, name)
+		}
+	}
+
+	normalized, err := Normalize(a.String())
+	require.NoError(t, err)
+	assert.Equal(t, a.Hex(), normalized)
+	assert.True(t, IsCanonical(normalized))
+	assert.False(t, IsCanonical(strings.ToUpper(normalized)))
+}
+
+func TestParseErrors(t *testing.T) {
+	valid := sequential().String()
+
+	for name, s := range map[string]string{
+		"empty":           "",
+		"not hex":         strings.Repeat("z", 64),
+		"short hex":       strings.Repeat("a", 63),
+		"other prefix":    "bc1" + valid[4:],
+		"mixed case":      "TPW1" + valid[4:],
+		"invalid char":    valid[:10] + "b" + valid[11:],
+		"truncated":       valid[:len(valid)-1],
+		"too short":       "tpw1qqq",
+		"20 bytes bech32": "tpw1" + encodeBech32m(make([]byte, 20))[4:],
+	} {
+		_, err := Parse(s)
+		assert.ErrorIs(t, err, ErrInvalid, name)
+	}
+}
+
+func TestChecksumCatchesTypos(t *testing.T) {
+	valid := sequential().String()
+
+	for i := len(Prefix) + 1; i < len(valid); i++ {
+		for _, c := range charset {
+			if byte(c) == valid[i] {
+				continue
+			}
+			typo := valid[:i] + string(c) + valid[i+1:]
+			_, err := Parse(typo)
+			require.ErrorIs(t, err, ErrChecksum, typo)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	a, err := Generate()
+	require.NoError(t, err)
+	b, err := Generate()
+	require.NoError(t, err)
+	assert.NotEqual(t, a, b)
+
+	pub, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(pub), FromPublicKey(pub).Bytes())
+}
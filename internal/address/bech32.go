@@ -0,0 +1,118 @@
+package address
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The bech32m encoding of BIP 350, limited to the fixed prefix.
+
+const charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+const (
+	bech32mConst   = 0x2bc830a3
+	checksumLength = 6
+)
+
+var generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i, g := range generator {
+			if (top>>i)&1 == 1 {
+				chk ^= g
+			}
+		}
+	}
+	return chk
+}
+
+func prefixExpand() []byte {
+	out := make([]byte, 0, 2*len(Prefix)+1)
+	for i := 0; i < len(Prefix); i++ {
+		out = append(out, Prefix[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(Prefix); i++ {
+		out = append(out, Prefix[i]&31)
+	}
+	return out
+}
+
+func encodeBech32m(data []byte) string {
+	values := convertBits(data, 8, 5, true)
+
+	mod := polymod(append(append(prefixExpand(), values...), make([]byte, checksumLength)...)) ^ bech32mConst
+	for i := 0; i < checksumLength; i++ {
+		values = append(values, byte(mod>>(5*(5-i)))&31)
+	}
+
+	var b strings.Builder
+	b.WriteString(Prefix)
+	b.WriteByte('1')
+	for _, v := range values {
+		b.WriteByte(charset[v])
+	}
+	return b.String()
+}
+
+func decodeBech32m(s string) ([]byte, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return nil, fmt.Errorf("%w: mixed case", ErrInvalid)
+	}
+	s = strings.ToLower(s)
+
+	body := s[len(Prefix)+1:]
+	if len(body) < checksumLength {
+		return nil, fmt.Errorf("%w: too short", ErrInvalid)
+	}
+
+	values := make([]byte, len(body))
+	for i := 0; i < len(body); i++ {
+		v := strings.IndexByte(charset, body[i])
+		if v < 0 {
+			return nil, fmt.Errorf("%w: invalid character %q", ErrInvalid, body[i])
+		}
+		values[i] = byte(v)
+	}
+
+	if polymod(append(prefixExpand(), values...)) != bech32mConst {
+		return nil, ErrChecksum
+	}
+
+	data := convertBits(values[:len(values)-checksumLength], 5, 8, false)
+	if data == nil {
+		return nil, fmt.Errorf("%w: invalid padding", ErrInvalid)
+	}
+	return data, nil
+}
+
+// convertBits regroups data of from-bit values into to-bit values. Without
+// pad it returns nil when the leftover bits are not zero padding.
+func convertBits(data []byte, from, to uint, pad bool) []byte {
+	var (
+		acc  uint32
+		bits uint
+		out  []byte
+	)
+	maxv := uint32(1)<<to - 1
+	for _, v := range data {
+		acc = acc<<from | uint32(v)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&maxv))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxv != 0 {
+		return nil
+	}
+	return out
+}
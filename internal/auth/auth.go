@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Scope grants access to a group of API endpoints.
+type Scope string
+
+const (
+	ScopeBalanceRead      Scope = "balance:read"
+	ScopeTransactionsRead Scope = "transactions:read"
+	ScopeTransfersWrite   Scope = "transfers:write"
+	ScopeWalletsWrite     Scope = "wallets:write"
+	ScopeMetricsRead      Scope = "metrics:read"
+	// ScopeAdmin grants every other scope as well.
+	ScopeAdmin Scope = "admin"
+)
+
+// Scopes lists every known scope.
+var Scopes = []Scope{ScopeBalanceRead, ScopeTransactionsRead, ScopeTransfersWrite, ScopeWalletsWrite, ScopeMetricsRead, ScopeAdmin}
+
+// ParseScopes validates scope names.
+func ParseScopes(names []string) ([]Scope, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+
+	scopes := make([]Scope, 0, len(names))
+	for _, name := range names {
+		scope := Scope(strings.TrimSpace(name))
+		if !slices.Contains(Scopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q", name)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	// KeyID is the id of the API key; empty for bearer tokens.
+	KeyID  string
+	Name   string
+	Scopes []Scope
+	// Wallets restricts the principal to the listed wallet addresses.
+	// Nil means every wallet, as for API keys.
+	Wallets []string
+}
+
+// Has reports whether the principal was granted scope.
+func (p Principal) Has(scope Scope) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// Restricted reports whether the principal may only act on its own wallets.
+func (p Principal) Restricted() bool {
+	return p.Wallets != nil
+}
+
+// Owns reports whether the principal may act on the wallet at address.
+func (p Principal) Owns(address string) bool {
+	if !p.Restricted() {
+		return true
+	}
+	return slices.ContainsFunc(p.Wallets, func(w string) bool {
+		return strings.EqualFold(w, address)
+	})
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal stored in ctx by WithPrincipal.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/address"
+	"github.com/Petro-vich/transaction_processing_go/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrInvalidToken = errors.New("invalid or expired bearer token")
+
+// minHMACSecret is the shortest accepted HS256 secret, the size of the hash.
+const minHMACSecret = 32
+
+// bearerScopes are granted to tokens without a "scope" claim.
+var bearerScopes = []Scope{ScopeBalanceRead, ScopeTransactionsRead, ScopeTransfersWrite}
+
+// Claims are the JWT claims understood by the service. Wallets lists the
+// addresses the caller owns, as hex or in the checksummed encoding; Scope optionally narrows or widens the
+// default bearer scopes as a space separated list. The admin scope is
+// ignored unless the verifier allows it.
+type Claims struct {
+	jwt.RegisteredClaims
+	Wallets []string `json:"wallets"`
+	Scope   string   `json:"scope,omitempty"`
+}
+
+type verificationKey struct {
+	alg string
+	key any
+}
+
+// JWTVerifier verifies bearer tokens against the configured keys.
+type JWTVerifier struct {
+	// keys are indexed by "kid"; the key from hmac_secret or
+	// public_key_file has the empty id.
+	keys       map[string]verificationKey
+	parser     *jwt.Parser
+	allowAdmin bool
+}
+
+func NewJWTVerifier(cfg config.JWT) (*JWTVerifier, error) {
+	const op = "auth.NewJWTVerifier"
+
+	v := &JWTVerifier{keys: make(map[string]verificationKey), allowAdmin: cfg.AllowAdmin}
+
+	if cfg.HMACSecret != "" && cfg.PublicKeyFile != "" {
+		return nil, fmt.Errorf("%s: hmac_secret and public_key_file are mutually exclusive", op)
+	}
+	if cfg.HMACSecret != "" {
+		if len(cfg.HMACSecret) < minHMACSecret {
+			return nil, fmt.Errorf("%s: hmac_secret must be at least %d bytes", op, minHMACSecret)
+		}
+		v.keys[""] = verificationKey{alg: jwt.SigningMethodHS256.Alg(), key: []byte(cfg.HMACSecret)}
+	}
+	if cfg.PublicKeyFile != "" {
+		key, err := loadPublicKey(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		v.keys[""] = key
+	}
+	if cfg.JWKSFile != "" {
+		if err := v.loadJWKS(cfg.JWKSFile); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if len(v.keys) == 0 {
+		return nil, fmt.Errorf("%s: no verification key configured", op)
+	}
+
+	var methods []string
+	for _, key := range v.keys {
+		if !slices.Contains(methods, key.alg) {
+			methods = append(methods, key.alg)
+		}
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	v.parser = jwt.NewParser(opts...)
+
+	return v, nil
+}
+
+// Verify checks the signature and registered claims of token and returns
+// a principal restricted to the wallets listed in its claims.
+func (v *JWTVerifier) Verify(token string) (Principal, error) {
+	const op = "auth.Verify"
+
+	var claims Claims
+	if _, err := v.parser.ParseWithClaims(token, &claims, v.keyFunc); err != nil {
+		return Principal{}, fmt.Errorf("%s: %w: %w", op, ErrInvalidToken, err)
+	}
+
+	scopes := bearerScopes
+	if claims.Scope != "" {
+		scopes = nil
+		for _, name := range strings.Fields(claims.Scope) {
+			// Scopes of other services may share the token.
+			scope := Scope(name)
+			if scope == ScopeAdmin && !v.allowAdmin {
+				continue
+			}
+			if slices.Contains(Scopes, scope) && !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+
+	// Wallets may be listed in either address form; they are compared
+	// with requests in the stored hex form.
+	wallets := make([]string, 0, len(claims.Wallets))
+	for _, w := range claims.Wallets {
+		adr, err := address.Normalize(w)
+		if err != nil {
+			return Principal{}, fmt.Errorf("%s: %w: wallets claim: %w", op, ErrInvalidToken, err)
+		}
+		wallets = append(wallets, adr)
+	}
+
+	return Principal{Name: claims.Subject, Scopes: scopes, Wallets: wallets}, nil
+}
+
+func (v *JWTVerifier) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := v.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	// Each key verifies exactly one algorithm, so an RSA public key can
+	// never be used as an HMAC secret.
+	if token.Method.Alg() != key.alg {
+		return nil, fmt.Errorf("key %q does not verify %s", kid, token.Method.Alg())
+	}
+	return key.key, nil
+}
+
+func loadPublicKey(path string) (verificationKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return verificationKey{}, err
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return verificationKey{}, fmt.Errorf("%s: no PEM block found", path)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return verificationKey{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return verificationKey{alg: jwt.SigningMethodRS256.Alg(), key: pub}, nil
+	case ed25519.PublicKey:
+		return verificationKey{alg: jwt.SigningMethodEdDSA.Alg(), key: pub}, nil
+	default:
+		return verificationKey{}, fmt.Errorf("%s: unsupported public key type %T", path, pub)
+	}
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	K   string `json:"k"`
+}
+
+func (v *JWTVerifier) loadJWKS(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if jwk.Kid == "" {
+			return fmt.Errorf("%s: key without kid", path)
+		}
+		if _, ok := v.keys[jwk.Kid]; ok {
+			return fmt.Errorf("%s: duplicate kid %q", path, jwk.Kid)
+		}
+
+		key, err := parseJWK(jwk)
+		if err != nil {
+			return fmt.Errorf("%s: key %q: %w", path, jwk.Kid, err)
+		}
+		if jwk.Alg != "" && jwk.Alg != key.alg {
+			return fmt.Errorf("%s: key %q: unsupported alg %q", path, jwk.Kid, jwk.Alg)
+		}
+		v.keys[jwk.Kid] = key
+	}
+	return nil
+}
+
+func parseJWK(jwk jsonWebKey) (verificationKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return verificationKey{}, fmt.Errorf("modulus: %w", err)
+		}
+		e, err := decode(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return verificationKey{}, fmt.Errorf("invalid exponent")
+		}
+		pub := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		return verificationKey{alg: jwt.SigningMethodRS256.Alg(), key: pub}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return verificationKey{}, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return verificationKey{}, fmt.Errorf("invalid Ed25519 public key")
+		}
+		return verificationKey{alg: jwt.SigningMethodEdDSA.Alg(), key: ed25519.PublicKey(x)}, nil
+	case "oct":
+		k, err := decode(jwk.K)
+		if err != nil || len(k) < minHMACSecret {
+			return verificationKey{}, fmt.Errorf("symmetric key must be at least %d bytes", minHMACSecret)
+		}
+		return verificationKey{alg: jwt.SigningMethodHS256.Alg(), key: k}, nil
+	default:
+		return verificationKey{}, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
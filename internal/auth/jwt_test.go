@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/address"
+	"github.com/Petro-vich/transaction_processing_go/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+var (
+	walletA = strings.Repeat("aa", 32)
+	walletB = strings.Repeat("bb", 32)
+)
+
+func newClaims(wallets ...string) Claims {
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user-1",
+			Issuer:    "identity",
+			Audience:  jwt.ClaimStrings{"wallets"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Wallets: wallets,
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, claims Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func writePublicKey(t *testing.T, pub any) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	return writeFile(t, "key.pem", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+}
+
+func TestJWTVerifierHMAC(t *testing.T) {
+	v, err := NewJWTVerifier(config.JWT{HMACSecret: testSecret, Issuer: "identity", Audience: "wallets"})
+	require.NoError(t, err)
+
+	t.Run("Valid", func(t *testing.T) {
+		p, err := v.Verify(sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", newClaims(walletA, walletB)))
+		require.NoError(t, err)
+		assert.Equal(t, "user-1", p.Name)
+		assert.Equal(t, []string{walletA, walletB}, p.Wallets)
+		assert.True(t, p.Owns(strings.ToUpper(walletA)))
+		assert.False(t, p.Owns(strings.Repeat("cc", 32)))
+		assert.True(t, p.Has(ScopeTransfersWrite))
+		assert.False(t, p.Has(ScopeWalletsWrite))
+	})
+
+	t.Run("Checksummed wallets", func(t *testing.T) {
+		adr, err := address.Parse(walletA)
+		require.NoError(t, err)
+		p, err := v.Verify(sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", newClaims(adr.String())))
+		require.NoError(t, err)
+		assert.Equal(t, []string{walletA}, p.Wallets)
+
+		_, err = v.Verify(sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", newClaims("not-a-wallet")))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("No wallets owns nothing", func(t *testing.T) {
+		p, err := v.Verify(sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", newClaims()))
+		require.NoError(t, err)
+		assert.True(t, p.Restricted())
+		assert.False(t, p.Owns(walletA))
+	})
+
+	t.Run("Scope claim", func(t *testing.T) {
+		claims := newClaims(walletA)
+		claims.Scope = "balance:read openid"
+		p, err := v.Verify(sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", claims))
+		require.NoError(t, err)
+		assert.Equal(t, []Scope{ScopeBalanceRead}, p.Scopes)
+	})
+
+	t.Run("Admin scope claim", func(t *testing.T) {
+		claims := newClaims(walletA)
+		claims.Scope = "admin balance:read"
+		token := sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", claims)
+
+		p, err := v.Verify(token)
+		require.NoError(t, err)
+		assert.Equal(t, []Scope{ScopeBalanceRead}, p.Scopes)
+		assert.False(t, p.Has(ScopeWalletsWrite))
+
+		allowing, err := NewJWTVerifier(config.JWT{HMACSecret: testSecret, AllowAdmin: true})
+		require.NoError(t, err)
+		p, err = allowing.Verify(token)
+		require.NoError(t, err)
+		assert.Equal(t, []Scope{ScopeAdmin, ScopeBalanceRead}, p.Scopes)
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		expired := newClaims(walletA)
+		expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+		noExpiry := newClaims(walletA)
+		noExpiry.ExpiresAt = nil
+		wrongIssuer := newClaims(walletA)
+		wrongIssuer.Issuer = "other"
+		wrongAudience := newClaims(walletA)
+		wrongAudience.Audience = jwt.ClaimStrings{"other"}
+
+		for name, token := range map[string]string{
+			"expired":        sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", expired),
+			"no expiry":      sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", noExpiry),
+			"wrong issuer":   sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", wrongIssuer),
+			"wrong audience": sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", wrongAudience),
+			"wrong secret":   sign(t, jwt.SigningMethodHS256, []byte(testSecret+"x"), "", newClaims(walletA)),
+			"alg none":       sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", newClaims(walletA)),
+			"garbage":        "not.a.token",
+		} {
+			_, err := v.Verify(token)
+			assert.ErrorIs(t, err, ErrInvalidToken, name)
+		}
+	})
+}
+
+func TestJWTVerifierPublicKey(t *testing.T) {
+	t.Run("RS256", func(t *testing.T) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		v, err := NewJWTVerifier(config.JWT{PublicKeyFile: writePublicKey(t, &key.PublicKey)})
+		require.NoError(t, err)
+
+		p, err := v.Verify(sign(t, jwt.SigningMethodRS256, key, "", newClaims(walletA)))
+		require.NoError(t, err)
+		assert.Equal(t, []string{walletA}, p.Wallets)
+	})
+
+	t.Run("EdDSA", func(t *testing.T) {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		v, err := NewJWTVerifier(config.JWT{PublicKeyFile: writePublicKey(t, pub)})
+		require.NoError(t, err)
+
+		_, err = v.Verify(sign(t, jwt.SigningMethodEdDSA, priv, "", newClaims(walletA)))
+		require.NoError(t, err)
+
+		_, other, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		_, err = v.Verify(sign(t, jwt.SigningMethodEdDSA, other, "", newClaims(walletA)))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("HMAC with public key as secret", func(t *testing.T) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		path := writePublicKey(t, &key.PublicKey)
+		v, err := NewJWTVerifier(config.JWT{PublicKeyFile: path})
+		require.NoError(t, err)
+
+		pemBytes, err := os.ReadFile(path)
+		require.NoError(t, err)
+		_, err = v.Verify(sign(t, jwt.SigningMethodHS256, pemBytes, "", newClaims(walletA)))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+}
+
+func TestJWTVerifierJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks := fmt.Sprintf(`{"keys": [
+		{"kty": "RSA", "kid": "rsa-1", "alg": "RS256", "use": "sig", "n": %q, "e": %q},
+		{"kty": "OKP", "kid": "ed-1", "crv": "Ed25519", "x": %q},
+		{"kty": "oct", "kid": "hs-1", "k": %q},
+		{"kty": "RSA", "kid": "enc-1", "use": "enc", "n": "", "e": ""}
+	]}`, b64(rsaKey.N.Bytes()), b64(big.NewInt(int64(rsaKey.E)).Bytes()), b64(edPub), b64([]byte(testSecret)))
+
+	v, err := NewJWTVerifier(config.JWT{JWKSFile: writeFile(t, "jwks.json", jwks)})
+	require.NoError(t, err)
+
+	for kid, token := range map[string]string{
+		"rsa-1": sign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", newClaims(walletA)),
+		"ed-1":  sign(t, jwt.SigningMethodEdDSA, edPriv, "ed-1", newClaims(walletA)),
+		"hs-1":  sign(t, jwt.SigningMethodHS256, []byte(testSecret), "hs-1", newClaims(walletA)),
+	} {
+		_, err := v.Verify(token)
+		assert.NoError(t, err, kid)
+	}
+
+	for name, token := range map[string]string{
+		"unknown kid":  sign(t, jwt.SigningMethodEdDSA, edPriv, "ed-2", newClaims(walletA)),
+		"missing kid":  sign(t, jwt.SigningMethodEdDSA, edPriv, "", newClaims(walletA)),
+		"kid of other": sign(t, jwt.SigningMethodEdDSA, edPriv, "rsa-1", newClaims(walletA)),
+	} {
+		_, err := v.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidToken, name)
+	}
+}
+
+func TestNewJWTVerifierErrors(t *testing.T) {
+	for name, cfg := range map[string]config.JWT{
+		"no key":       {},
+		"short secret": {HMACSecret: "short"},
+		"both keys":    {HMACSecret: testSecret, PublicKeyFile: "key.pem"},
+		"missing file": {PublicKeyFile: filepath.Join(t.TempDir(), "missing.pem")},
+		"not PEM":      {PublicKeyFile: writeFile(t, "key.pem", "not a key")},
+		"bad JWKS":     {JWKSFile: writeFile(t, "jwks.json", `{"keys": [{"kty": "EC", "kid": "1"}]}`)},
+	} {
+		_, err := NewJWTVerifier(cfg)
+		assert.Error(t, err, name)
+	}
+}
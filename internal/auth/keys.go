@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidKey  = errors.New("invalid or revoked API key")
+	ErrKeyNotFound = errors.New("API key not found")
+)
+
+// An API key is "tpk_", a public key id and a secret joined by "_". Only
+// the id and a SHA-256 hash of the whole key are stored.
+const (
+	keyPrefix    = "tpk_"
+	keyIDBytes   = 8
+	keySecretLen = 32
+)
+
+// Key describes an issued API key.
+type Key struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Scopes    []Scope    `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// KeyStore persists API keys. GetKey and RevokeKey return ErrKeyNotFound
+// for unknown ids.
+type KeyStore interface {
+	CreateKey(ctx context.Context, key Key, hash []byte) error
+	GetKey(ctx context.Context, id string) (Key, []byte, error)
+	ListKeys(ctx context.Context) ([]Key, error)
+	RevokeKey(ctx context.Context, id string, at time.Time) error
+}
+
+// Service issues and verifies API keys.
+type Service struct {
+	store KeyStore
+	now   func() time.Time
+}
+
+func NewService(store KeyStore) *Service {
+	return &Service{store: store, now: time.Now}
+}
+
+// Issue creates a key with the given scopes and returns it together with
+// the secret token, which is not stored and cannot be recovered.
+func (s *Service) Issue(ctx context.Context, name string, scopes []Scope) (string, Key, error) {
+	const op = "auth.Issue"
+
+	if name == "" {
+		return "", Key{}, fmt.Errorf("%s: key name is required", op)
+	}
+	if len(scopes) == 0 {
+		return "", Key{}, fmt.Errorf("%s: at least one scope is required", op)
+	}
+
+	id := make([]byte, keyIDBytes)
+	secret := make([]byte, keySecretLen)
+	if _, err := rand.Read(id); err != nil {
+		return "", Key{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", Key{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	key := Key{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: s.now().UTC().Truncate(time.Second),
+	}
+	token := keyPrefix + key.ID + "_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	if err := s.store.CreateKey(ctx, key, hashToken(token)); err != nil {
+		return "", Key{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return token, key, nil
+}
+
+// Authenticate returns the principal of a valid, unrevoked token.
+func (s *Service) Authenticate(ctx context.Context, token string) (Principal, error) {
+	const op = "auth.Authenticate"
+
+	id, ok := parseToken(token)
+	if !ok {
+		return Principal{}, fmt.Errorf("%s: %w", op, ErrInvalidKey)
+	}
+
+	key, hash, err := s.store.GetKey(ctx, id)
+	if errors.Is(err, ErrKeyNotFound) {
+		return Principal{}, fmt.Errorf("%s: %w", op, ErrInvalidKey)
+	}
+	if err != nil {
+		return Principal{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if subtle.ConstantTimeCompare(hash, hashToken(token)) != 1 || key.RevokedAt != nil {
+		return Principal{}, fmt.Errorf("%s: %w", op, ErrInvalidKey)
+	}
+
+	return Principal{KeyID: key.ID, Name: key.Name, Scopes: key.Scopes}, nil
+}
+
+func (s *Service) List(ctx context.Context) ([]Key, error) {
+	const op = "auth.List"
+
+	keys, err := s.store.ListKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return keys, nil
+}
+
+// Revoke disables a key. Revoking a revoked key keeps the first revocation time.
+func (s *Service) Revoke(ctx context.Context, id string) error {
+	const op = "auth.Revoke"
+
+	if err := s.store.RevokeKey(ctx, id, s.now().UTC().Truncate(time.Second)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// IsAPIKey reports whether token has the form of an API key rather than
+// a bearer token.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, keyPrefix)
+}
+
+func parseToken(token string) (string, bool) {
+	rest, ok := strings.CutPrefix(token, keyPrefix)
+	if !ok || len(rest) <= 2*keyIDBytes || rest[2*keyIDBytes] != '_' {
+		return "", false
+	}
+	return rest[:2*keyIDBytes], true
+}
+
+func hashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
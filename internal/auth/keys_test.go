@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryKeyStore struct {
+	mu     sync.Mutex
+	keys   map[string]Key
+	hashes map[string][]byte
+}
+
+func newMemoryKeyStore() *memoryKeyStore {
+	return &memoryKeyStore{keys: make(map[string]Key), hashes: make(map[string][]byte)}
+}
+
+func (m *memoryKeyStore) CreateKey(ctx context.Context, key Key, hash []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[key.ID], m.hashes[key.ID] = key, hash
+	return nil
+}
+
+func (m *memoryKeyStore) GetKey(ctx context.Context, id string) (Key, []byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[id]
+	if !ok {
+		return Key{}, nil, ErrKeyNotFound
+	}
+	return key, m.hashes[id], nil
+}
+
+func (m *memoryKeyStore) ListKeys(ctx context.Context) ([]Key, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := []Key{}
+	for _, key := range m.keys {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (m *memoryKeyStore) RevokeKey(ctx context.Context, id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[id]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt = &at
+	}
+	m.keys[id] = key
+	return nil
+}
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Issue and authenticate", func(t *testing.T) {
+		svc := NewService(newMemoryKeyStore())
+
+		token, key, err := svc.Issue(ctx, "reporting", []Scope{ScopeBalanceRead})
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(token, keyPrefix+key.ID+"_"))
+
+		p, err := svc.Authenticate(ctx, token)
+		require.NoError(t, err)
+		assert.Equal(t, Principal{KeyID: key.ID, Name: "reporting", Scopes: []Scope{ScopeBalanceRead}}, p)
+		assert.True(t, p.Has(ScopeBalanceRead))
+		assert.False(t, p.Has(ScopeTransfersWrite))
+	})
+
+	t.Run("Only the hash is stored", func(t *testing.T) {
+		store := newMemoryKeyStore()
+		svc := NewService(store)
+
+		token, key, err := svc.Issue(ctx, "ops", []Scope{ScopeAdmin})
+		require.NoError(t, err)
+		assert.NotContains(t, string(store.hashes[key.ID]), token[len(keyPrefix)+2*keyIDBytes+1:])
+	})
+
+	t.Run("Invalid tokens", func(t *testing.T) {
+		svc := NewService(newMemoryKeyStore())
+		token, _, err := svc.Issue(ctx, "ops", []Scope{ScopeAdmin})
+		require.NoError(t, err)
+
+		for _, bad := range []string{"", "tpk_", "secret", token[:len(token)-1] + "x", "tpk_0123456789abcdef_secret"} {
+			_, err := svc.Authenticate(ctx, bad)
+			assert.ErrorIs(t, err, ErrInvalidKey, bad)
+		}
+	})
+
+	t.Run("Revoked key", func(t *testing.T) {
+		svc := NewService(newMemoryKeyStore())
+		token, key, err := svc.Issue(ctx, "ops", []Scope{ScopeAdmin})
+		require.NoError(t, err)
+
+		require.NoError(t, svc.Revoke(ctx, key.ID))
+		_, err = svc.Authenticate(ctx, token)
+		assert.ErrorIs(t, err, ErrInvalidKey)
+
+		assert.ErrorIs(t, svc.Revoke(ctx, "unknown"), ErrKeyNotFound)
+	})
+}
+
+func TestPrincipal_Has(t *testing.T) {
+	admin := Principal{Scopes: []Scope{ScopeAdmin}}
+	for _, scope := range Scopes {
+		assert.True(t, admin.Has(scope), scope)
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes([]string{"balance:read", "transfers:write", "balance:read"})
+	require.NoError(t, err)
+	assert.Equal(t, []Scope{ScopeBalanceRead, ScopeTransfersWrite}, scopes)
+
+	_, err = ParseScopes([]string{"balance:write"})
+	assert.Error(t, err)
+
+	_, err = ParseScopes(nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,321 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
+	"github.com/Petro-vich/transaction_processing_go/internal/service/importer"
+	"github.com/Petro-vich/transaction_processing_go/internal/signing"
+)
+
+// APIError is an error response returned by the transaction service.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("api error (%d): %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("api error (%d %s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+// ErrTransferHeld is matched by a HeldError.
+var ErrTransferHeld = errors.New("transfer held for review")
+
+// HeldError is returned for a transfer the service accepted but held for
+// manual review by a risk rule instead of executing it.
+type HeldError struct {
+	ReviewID int64  `json:"review_id"`
+	Rule     string `json:"rule"`
+	Reason   string `json:"reason"`
+}
+
+func (e *HeldError) Error() string {
+	return fmt.Sprintf("%s %d by rule %s: %s", ErrTransferHeld, e.ReviewID, e.Rule, e.Reason)
+}
+
+func (e *HeldError) Is(target error) bool {
+	return target == ErrTransferHeld
+}
+
+// Client talks to the transaction service HTTP API.
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func New(baseURL string, timeout time.Duration) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// SetAPIKey makes the client authenticate every request with key.
+func (c *Client) SetAPIKey(key string) {
+	c.apiKey = key
+}
+
+// SetTLSConfig makes the client use cfg for HTTPS connections, for example
+// to trust a private CA or to present a client certificate.
+func (c *Client) SetTLSConfig(cfg *tls.Config) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	c.httpClient.Transport = transport
+}
+
+// Wallet is a freshly created wallet. ChecksumAddress is the same address
+// in the checksummed encoding meant for people. PrivateKey is only set when
+// the service requires signed transfers.
+type Wallet struct {
+	Address         string  `json:"address"`
+	ChecksumAddress string  `json:"checksum_address,omitempty"`
+	Balance         float64 `json:"balance"`
+	PrivateKey      string  `json:"private_key,omitempty"`
+}
+
+// CreateWallet creates a wallet with the opening balance amount. Only an
+// admin caller may set a non-zero one.
+func (c *Client) CreateWallet(ctx context.Context, amount float64) (Wallet, error) {
+	const op = "client.CreateWallet"
+
+	var resp map[string]string
+	err := c.do(ctx, http.MethodPost, "/api/wallet", map[string]float64{"amount": amount}, &resp)
+	if err != nil {
+		return Wallet{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	balance, err := strconv.ParseFloat(resp["balance"], 64)
+	if err != nil {
+		return Wallet{}, fmt.Errorf("%s: invalid balance in response: %w", op, err)
+	}
+
+	return Wallet{
+		Address:         resp["address"],
+		ChecksumAddress: resp["checksum_address"],
+		Balance:         balance,
+		PrivateKey:      resp["private_key"],
+	}, nil
+}
+
+func (c *Client) GetBalance(ctx context.Context, address string) (float64, error) {
+	const op = "client.GetBalance"
+
+	var resp map[string]string
+	err := c.do(ctx, http.MethodGet, "/api/wallet/"+url.PathEscape(address)+"/balance", nil, &resp)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	balance, err := strconv.ParseFloat(resp["balance"], 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid balance in response: %w", op, err)
+	}
+
+	return balance, nil
+}
+
+func (c *Client) SendMoney(ctx context.Context, from, to string, amount float64) error {
+	const op = "client.SendMoney"
+
+	req := transaction.Request{From: from, To: to, Amount: amount}
+	if err := c.send(ctx, req); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SendSigned sends a transfer signed with the private key of the sending
+// wallet. The nonce must be greater than every nonce the wallet used before.
+func (c *Client) SendSigned(ctx context.Context, from, to string, amount float64, nonce int64, key ed25519.PrivateKey) error {
+	const op = "client.SendSigned"
+
+	transfer := signing.Transfer{From: from, To: to, Amount: amount, Nonce: nonce}
+	req := map[string]any{
+		"from":      from,
+		"to":        to,
+		"amount":    amount,
+		"nonce":     nonce,
+		"signature": signing.Sign(key, transfer),
+	}
+	if err := c.send(ctx, req); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// send posts a transfer and returns a HeldError if it was held for review.
+func (c *Client) send(ctx context.Context, req any) error {
+	var resp struct {
+		Status string `json:"status"`
+		HeldError
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/send", req, &resp); err != nil {
+		return err
+	}
+	if resp.Status == "held" {
+		return &resp.HeldError
+	}
+	return nil
+}
+
+// GetNonce returns the latest nonce used by a wallet in a signed transfer.
+func (c *Client) GetNonce(ctx context.Context, address string) (int64, error) {
+	const op = "client.GetNonce"
+
+	var resp map[string]string
+	if err := c.do(ctx, http.MethodGet, "/api/wallet/"+url.PathEscape(address)+"/nonce", nil, &resp); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	nonce, err := strconv.ParseInt(resp["nonce"], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid nonce in response: %w", op, err)
+	}
+
+	return nonce, nil
+}
+
+func (c *Client) GetLast(ctx context.Context, count int) ([]transaction.Request, error) {
+	const op = "client.GetLast"
+
+	var transactions []transaction.Request
+	err := c.do(ctx, http.MethodGet, "/api/transactions?count="+strconv.Itoa(count), nil, &transactions)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return transactions, nil
+}
+
+// GetHistory returns the latest transactions of one wallet, newest first,
+// including archived ones.
+func (c *Client) GetHistory(ctx context.Context, address string, count int) ([]transaction.Request, error) {
+	const op = "client.GetHistory"
+
+	var transactions []transaction.Request
+	path := "/api/wallet/" + url.PathEscape(address) + "/transactions?count=" + strconv.Itoa(count)
+	if err := c.do(ctx, http.MethodGet, path, nil, &transactions); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return transactions, nil
+}
+
+// Import uploads a CSV file of transfers. A report that failed validation
+// is returned together with an *APIError.
+func (c *Client) Import(ctx context.Context, file io.Reader, dryRun bool) (importer.Report, error) {
+	const op = "client.Import"
+
+	path := "/api/import?dry_run=" + strconv.FormatBool(dryRun)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, file)
+	if err != nil {
+		return importer.Report{}, fmt.Errorf("%s: %w", op, err)
+	}
+	req.Header.Set("Content-Type", "text/csv")
+	c.authorize(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return importer.Report{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnprocessableEntity {
+		return importer.Report{}, fmt.Errorf("%s: %w", op, decodeAPIError(resp))
+	}
+
+	var report importer.Report
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return importer.Report{}, fmt.Errorf("%s: invalid report: %w", op, err)
+	}
+
+	if !report.Valid {
+		return report, fmt.Errorf("%s: %w", op, &APIError{
+			StatusCode: resp.StatusCode,
+			Code:       "validation_failed",
+			Message:    "import file failed validation",
+		})
+	}
+
+	return report, nil
+}
+
+// do sends a JSON request and decodes a successful response into out.
+// Non-2xx responses are returned as *APIError.
+func (c *Client) do(ctx context.Context, method, path string, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c.authorize(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return decodeAPIError(resp)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) authorize(req *http.Request) {
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+}
+
+func decodeAPIError(resp *http.Response) error {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+
+	var payload struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+		return apiErr
+	}
+
+	apiErr.Code = payload.Code
+	apiErr.Message = payload.Message
+	return apiErr
+}
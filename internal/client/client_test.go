@@ -0,0 +1,190 @@
+package client
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
+	"github.com/Petro-vich/transaction_processing_go/internal/signing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return New(srv.URL+"/", time.Second)
+}
+
+func TestClient_GetBalance(t *testing.T) {
+	t.Run("Successful request", func(t *testing.T) {
+		c := setupTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api/wallet/abc/balance", r.URL.Path)
+			json.NewEncoder(w).Encode(map[string]string{"status": "OK", "balance": "12.5"})
+		})
+
+		balance, err := c.GetBalance(context.Background(), "abc")
+		require.NoError(t, err)
+		assert.Equal(t, 12.5, balance)
+	})
+
+	t.Run("API error", func(t *testing.T) {
+		c := setupTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{
+				"status":  "Error",
+				"code":    "not_found",
+				"message": "Address does not exist",
+			})
+		})
+
+		_, err := c.GetBalance(context.Background(), "abc")
+
+		var apiErr *APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+		assert.Equal(t, "not_found", apiErr.Code)
+		assert.Equal(t, "Address does not exist", apiErr.Message)
+	})
+
+	t.Run("Non-JSON error body", func(t *testing.T) {
+		c := setupTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "boom", http.StatusBadGateway)
+		})
+
+		_, err := c.GetBalance(context.Background(), "abc")
+
+		var apiErr *APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+		assert.Empty(t, apiErr.Code)
+	})
+}
+
+func TestClient_SendMoney(t *testing.T) {
+	c := setupTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/api/send", r.URL.Path)
+
+		var req transaction.Request
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "a", req.From)
+		assert.Equal(t, "b", req.To)
+		assert.Equal(t, 3.0, req.Amount)
+
+		json.NewEncoder(w).Encode(map[string]string{"status": "OK"})
+	})
+
+	assert.NoError(t, c.SendMoney(context.Background(), "a", "b", 3))
+}
+
+func TestClient_SendMoneyHeld(t *testing.T) {
+	c := setupTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]any{"status": "held", "review_id": 7, "rule": "round_trip", "reason": "recipient sent 5"})
+	})
+
+	err := c.SendMoney(context.Background(), "a", "b", 3)
+
+	var held *HeldError
+	require.ErrorAs(t, err, &held)
+	assert.ErrorIs(t, err, ErrTransferHeld)
+	assert.Equal(t, HeldError{ReviewID: 7, Rule: "round_trip", Reason: "recipient sent 5"}, *held)
+}
+
+func TestClient_CreateWallet(t *testing.T) {
+	c := setupTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/wallet", r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"status": "OK", "address": "abc", "checksum_address": "tpw1abc", "balance": "50"})
+	})
+
+	wallet, err := c.CreateWallet(context.Background(), 50)
+	require.NoError(t, err)
+	assert.Equal(t, Wallet{Address: "abc", ChecksumAddress: "tpw1abc", Balance: 50}, wallet)
+}
+
+func TestClient_GetLast(t *testing.T) {
+	c := setupTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "5", r.URL.Query().Get("count"))
+		json.NewEncoder(w).Encode([]transaction.Request{{Id: 1, From: "a", To: "b", Amount: 1}})
+	})
+
+	transactions, err := c.GetLast(context.Background(), 5)
+	require.NoError(t, err)
+	assert.Len(t, transactions, 1)
+	assert.Equal(t, 1, transactions[0].Id)
+}
+
+func TestClient_GetHistory(t *testing.T) {
+	c := setupTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/wallet/abc/transactions", r.URL.Path)
+		assert.Equal(t, "5", r.URL.Query().Get("count"))
+		json.NewEncoder(w).Encode([]transaction.Request{{Id: 1, From: "abc", To: "b", Amount: 1}})
+	})
+
+	transactions, err := c.GetHistory(context.Background(), "abc", 5)
+	require.NoError(t, err)
+	assert.Len(t, transactions, 1)
+	assert.Equal(t, "abc", transactions[0].From)
+}
+
+func TestClient_SetAPIKey(t *testing.T) {
+	c := setupTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer tpk_key", r.Header.Get("Authorization"))
+		json.NewEncoder(w).Encode([]transaction.Request{})
+	})
+	c.SetAPIKey("tpk_key")
+
+	_, err := c.GetLast(context.Background(), 5)
+	require.NoError(t, err)
+}
+
+func TestClient_SetTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"status": "OK", "balance": "1"})
+	}))
+	t.Cleanup(srv.Close)
+
+	c := New(srv.URL, time.Second)
+	_, err := c.GetBalance(context.Background(), "abc")
+	require.Error(t, err, "the test CA is not trusted by default")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	c.SetTLSConfig(&tls.Config{RootCAs: roots})
+
+	balance, err := c.GetBalance(context.Background(), "abc")
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, balance)
+}
+
+func TestClient_SendSigned(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	from := hex.EncodeToString(pub)
+
+	c := setupTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			From      string  `json:"from"`
+			To        string  `json:"to"`
+			Amount    float64 `json:"amount"`
+			Nonce     int64   `json:"nonce"`
+			Signature string  `json:"signature"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, int64(3), req.Nonce)
+		assert.NoError(t, signing.Verify(signing.Transfer{From: req.From, To: req.To, Amount: req.Amount, Nonce: req.Nonce}, req.Signature))
+		json.NewEncoder(w).Encode(map[string]string{"status": "OK"})
+	})
+
+	require.NoError(t, c.SendSigned(context.Background(), from, "b", 12.5, 3, key))
+}
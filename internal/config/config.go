@@ -3,18 +3,212 @@ package config
 import (
 	"log"
 	"os"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
+// Supported storage backends.
+const (
+	StorageSQLite  = "sqlite"
+	StorageMemory  = "memory"
+	StorageJournal = "journal"
+)
+
 type Config struct {
 	Env         string `yaml:"env"`
+	Storage     string `yaml:"storage" env-default:"sqlite"`
 	StoragePath string `yaml:"storage_path" validate:"required"`
-	HTTPServer  `yaml:"http_server"`
+	AutoMigrate bool   `yaml:"auto_migrate" env-default:"true"`
+	// SnapshotEvery is the number of events between journal snapshots.
+	SnapshotEvery int `yaml:"snapshot_every" env-default:"1000"`
+	HTTPServer    `yaml:"http_server"`
+	Backup        Backup    `yaml:"backup"`
+	Archive       Archive   `yaml:"archive"`
+	Cache         Cache     `yaml:"cache"`
+	Auth          Auth      `yaml:"auth"`
+	Transfers     Transfers `yaml:"transfers"`
+	RateLimit     RateLimit `yaml:"rate_limit"`
+	Chain         Chain     `yaml:"chain"`
+	Risk          Risk      `yaml:"risk"`
+	Screening     Screening `yaml:"screening"`
+	Health        Health    `yaml:"health"`
+	Metrics       Metrics   `yaml:"metrics"`
+	Tracing       Tracing   `yaml:"tracing"`
 }
 
 type HTTPServer struct {
-	Address string `yaml:"address" env-default:"localhost:8080"`
+	Address        string        `yaml:"address" env-default:"localhost:8080"`
+	RequestTimeout time.Duration `yaml:"request_timeout" env-default:"5s"`
+	// ImportTimeout bounds the execution of an import instead of
+	// RequestTimeout, so that a file is not left executed halfway.
+	ImportTimeout time.Duration `yaml:"import_timeout" env-default:"5m"`
+	// ShutdownTimeout bounds each step of the shutdown on SIGINT or SIGTERM:
+	// draining in-flight requests, stopping background workers and flushing
+	// traces.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env-default:"30s"`
+	TLS             TLS           `yaml:"tls"`
+}
+
+// Client certificate verification modes.
+const (
+	ClientAuthRequire  = "require"
+	ClientAuthOptional = "optional"
+)
+
+// TLS configures HTTPS. With ClientCAFile client certificates are verified
+// against that bundle; Clients maps the common name of a verified
+// certificate to the scopes granted to it. The files are read again on SIGHUP.
+type TLS struct {
+	Enabled      bool                `yaml:"enabled" env-default:"false"`
+	CertFile     string              `yaml:"cert_file"`
+	KeyFile      string              `yaml:"key_file"`
+	MinVersion   string              `yaml:"min_version" env-default:"1.2"`
+	ClientCAFile string              `yaml:"client_ca_file"`
+	ClientAuth   string              `yaml:"client_auth" env-default:"require"`
+	Clients      map[string][]string `yaml:"clients"`
+}
+
+// Backup configures online backups of the SQLite storage.
+type Backup struct {
+	Dir      string `yaml:"dir" env-default:"storage/backup"`
+	Keep     int    `yaml:"keep" env-default:"7"`
+	Compress bool   `yaml:"compress" env-default:"true"`
+}
+
+// Archive configures moving old transactions of the SQLite storage into
+// monthly archive files. A non-positive RetentionDays disables archiving.
+type Archive struct {
+	Dir           string        `yaml:"dir" env-default:"storage/archive"`
+	RetentionDays int           `yaml:"retention_days" env-default:"0"`
+	Interval      time.Duration `yaml:"interval" env-default:"24h"`
+}
+
+// Cache configures the wallet balance cache. A non-positive Size disables it.
+type Cache struct {
+	Size int           `yaml:"size" env-default:"10000"`
+	TTL  time.Duration `yaml:"ttl" env-default:"30s"`
+}
+
+// Auth configures authentication. Enabled turns on API keys, which are
+// stored in the SQLite storage and so require the sqlite backend.
+type Auth struct {
+	Enabled bool `yaml:"enabled" env-default:"false"`
+	JWT     JWT  `yaml:"jwt"`
+}
+
+// JWT configures verification of bearer tokens issued by the identity
+// service. Tokens are verified with the HMAC secret, the PEM public key
+// (RSA or Ed25519) or the keys of a local JWKS file selected by "kid".
+// The admin scope is honoured in the "scope" claim only with AllowAdmin, so
+// the identity service cannot hand out admin by default.
+type JWT struct {
+	Enabled       bool          `yaml:"enabled" env-default:"false"`
+	HMACSecret    string        `yaml:"hmac_secret" env:"JWT_HMAC_SECRET"`
+	PublicKeyFile string        `yaml:"public_key_file"`
+	JWKSFile      string        `yaml:"jwks_file"`
+	Issuer        string        `yaml:"issuer"`
+	Audience      string        `yaml:"audience"`
+	Leeway        time.Duration `yaml:"leeway" env-default:"30s"`
+	AllowAdmin    bool          `yaml:"allow_admin" env-default:"false"`
+}
+
+// Transfers configures transfer verification. With RequireSignatures
+// every transfer must be signed by the key of the sending wallet.
+type Transfers struct {
+	RequireSignatures bool `yaml:"require_signatures" env-default:"false"`
+}
+
+// RateLimit configures token bucket rate limits. Client limits every
+// request per API key, JWT subject or client IP; Wallet limits transfers
+// per source wallet. A non-positive rate disables a limit.
+type RateLimit struct {
+	Client          Limit         `yaml:"client"`
+	Wallet          Limit         `yaml:"wallet"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval" env-default:"1m"`
+}
+
+// Limit is a bucket of Burst requests refilled at Rate requests per second.
+type Limit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// Chain configures signed checkpoints of the transaction hash chain of the
+// SQLite storage. CheckpointKeyFile holds a hex encoded Ed25519 private
+// key; without it no checkpoints are written.
+type Chain struct {
+	CheckpointKeyFile  string        `yaml:"checkpoint_key_file"`
+	CheckpointInterval time.Duration `yaml:"checkpoint_interval" env-default:"1h"`
+}
+
+// Risk configures the rules evaluated before every transfer. The first
+// matching rule decides whether the transfer is allowed, denied or held for
+// review; a transfer matched by no rule is allowed. Rules look at the last
+// HistoryLimit transactions of the sending wallet.
+type Risk struct {
+	HistoryLimit int        `yaml:"history_limit" env-default:"100"`
+	Rules        []RiskRule `yaml:"rules"`
+}
+
+// RiskRule is a rule of the type new_wallet_large_amount, fan_out or
+// round_trip. It applies to transfers of at least Amount; the remaining
+// fields are parameters of the rule types that use them.
+type RiskRule struct {
+	Name          string        `yaml:"name"`
+	Type          string        `yaml:"type"`
+	Action        string        `yaml:"action"`
+	Amount        float64       `yaml:"amount"`
+	Window        time.Duration `yaml:"window"`
+	MinAge        time.Duration `yaml:"min_age"`
+	MaxRecipients int           `yaml:"max_recipients"`
+}
+
+// Screening configures address block and allow lists. Lists are read from
+// BlockFiles and AllowFiles, one address per line, and extended through the
+// admin API. Files are read again on SIGHUP and every ReloadInterval when
+// it is positive.
+type Screening struct {
+	Enabled        bool          `yaml:"enabled" env-default:"false"`
+	BlockFiles     []string      `yaml:"block_files"`
+	AllowFiles     []string      `yaml:"allow_files"`
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+// Health configures the readiness checks. Every check is bounded by
+// CheckTimeout; while MaintenanceFile exists the service reports itself
+// not ready.
+type Health struct {
+	CheckTimeout    time.Duration `yaml:"check_timeout" env-default:"2s"`
+	MaintenanceFile string        `yaml:"maintenance_file"`
+}
+
+// Metrics configures the Prometheus endpoint /metrics. With authentication
+// it requires the metrics:read scope.
+type Metrics struct {
+	Enabled bool `yaml:"enabled" env-default:"true"`
+}
+
+// Tracing exporters.
+const (
+	TracingNone   = "none"
+	TracingStdout = "stdout"
+	TracingFile   = "file"
+	TracingOTLP   = "otlp"
+)
+
+// Tracing configures OpenTelemetry tracing. Spans are written to stdout,
+// appended to File as JSON or sent to an OTLP/HTTP collector at Endpoint,
+// depending on Exporter. SampleRatio is the share of new traces recorded;
+// traces started by a caller follow its sampling decision.
+type Tracing struct {
+	Exporter    string            `yaml:"exporter" env-default:"none"`
+	ServiceName string            `yaml:"service_name" env-default:"transaction-service"`
+	SampleRatio float64           `yaml:"sample_ratio" env-default:"1"`
+	File        string            `yaml:"file" env-default:"storage/traces.json"`
+	Endpoint    string            `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	Insecure    bool              `yaml:"insecure" env-default:"false"`
+	Headers     map[string]string `yaml:"headers"`
 }
 
 func Load() *Config {
@@ -0,0 +1,228 @@
+// Package hashchain links transactions into a tamper-evident chain: the hash
+// of every transaction covers its contents and the hash of the previous one.
+package hashchain
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
+)
+
+var ErrInvalidCheckpointKey = errors.New("checkpoint key must be a hex encoded Ed25519 private key")
+
+// Genesis is the previous hash of the first transaction of the chain.
+var Genesis = strings.Repeat("0", 2*sha256.Size)
+
+const (
+	transactionDomain = "transaction-service/transaction/v1"
+	checkpointDomain  = "transaction-service/checkpoint/v1"
+)
+
+// Hash returns the hex encoded SHA-256 of tr chained to prev. Addresses are
+// lowercased and the creation time is taken in UTC, so the hash does not
+// depend on how the storage returns them.
+func Hash(prev string, tr transaction.Request) string {
+	msg := strings.Join([]string{
+		transactionDomain,
+		strconv.Itoa(tr.Id),
+		strings.ToLower(tr.From),
+		strings.ToLower(tr.To),
+		strconv.FormatFloat(tr.Amount, 'f', -1, 64),
+		tr.Created_at.UTC().Format(time.RFC3339Nano),
+		prev,
+	}, "\n")
+
+	sum := sha256.Sum256([]byte(msg))
+	return hex.EncodeToString(sum[:])
+}
+
+// Head is the newest transaction of the chain.
+type Head struct {
+	LastID int    `json:"last_id"`
+	Hash   string `json:"hash"`
+}
+
+// Checkpoint is a chain head signed at a point in time.
+type Checkpoint struct {
+	ID        int       `json:"id"`
+	Head      Head      `json:"head"`
+	CreatedAt time.Time `json:"created_at"`
+	// PublicKey and Signature are hex encoded.
+	PublicKey string `json:"public_key"`
+	Signature string `json:"signature"`
+}
+
+func checkpointMessage(cp Checkpoint) []byte {
+	return []byte(strings.Join([]string{
+		checkpointDomain,
+		strconv.Itoa(cp.Head.LastID),
+		cp.Head.Hash,
+		cp.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}, "\n"))
+}
+
+// Sign returns a checkpoint of head signed with key.
+func Sign(key ed25519.PrivateKey, head Head, at time.Time) Checkpoint {
+	cp := Checkpoint{
+		Head:      head,
+		CreatedAt: at.UTC(),
+		PublicKey: hex.EncodeToString(key.Public().(ed25519.PublicKey)),
+	}
+	cp.Signature = hex.EncodeToString(ed25519.Sign(key, checkpointMessage(cp)))
+	return cp
+}
+
+// VerifyCheckpoint reports whether cp was signed by pub.
+func VerifyCheckpoint(pub ed25519.PublicKey, cp Checkpoint) bool {
+	sig, err := hex.DecodeString(cp.Signature)
+	if err != nil {
+		return false
+	}
+	return cp.PublicKey == hex.EncodeToString(pub) && ed25519.Verify(pub, checkpointMessage(cp), sig)
+}
+
+// ParseKey decodes a hex encoded Ed25519 private key, as stored in the
+// checkpoint key file.
+func ParseKey(s string) (ed25519.PrivateKey, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != ed25519.PrivateKeySize {
+		return nil, ErrInvalidCheckpointKey
+	}
+	return ed25519.PrivateKey(key), nil
+}
+
+// LoadKey reads the checkpoint key file.
+func LoadKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKey(string(data))
+}
+
+// Report is the outcome of a chain verification.
+type Report struct {
+	Valid bool `json:"valid"`
+	// Checked is the number of chained transactions verified.
+	Checked int `json:"checked"`
+	// Unchained is the number of transactions up to the chain boundary
+	// archived before the chain was introduced, which carry no hash.
+	Unchained   int    `json:"unchained"`
+	Checkpoints int    `json:"checkpoints"`
+	Head        Head   `json:"head"`
+	Broken      *Break `json:"broken,omitempty"`
+}
+
+// Break is the first broken link found. ID is the transaction id, or the
+// checkpoint id for checkpoint failures.
+type Break struct {
+	ID     int    `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// Break reasons.
+const (
+	ReasonHashMismatch      = "hash does not match the transaction contents"
+	ReasonPrevMismatch      = "prev_hash does not link to the previous transaction"
+	ReasonMissingHash       = "transaction inside the chain has no hash"
+	ReasonHeadMismatch      = "chain head does not match the newest transaction"
+	ReasonCheckpointHash    = "checkpoint does not match the chain"
+	ReasonCheckpointSigning = "checkpoint signature is invalid"
+)
+
+// Verifier checks transactions fed to Add in id order and then the stored
+// chain head and checkpoints.
+type Verifier struct {
+	report      Report
+	started     bool
+	boundary    int
+	checkpoints []Checkpoint
+	key         ed25519.PublicKey
+	// hashes holds the hashes at the checkpointed ids.
+	hashes map[int]string
+}
+
+// NewVerifier returns a verifier of a chain with the given checkpoints.
+// Their signatures are checked against key unless it is nil. Transactions
+// up to boundary, the newest id when the chain was introduced, may lack a
+// hash; every later one must have one.
+func NewVerifier(checkpoints []Checkpoint, key ed25519.PublicKey, boundary int) *Verifier {
+	v := &Verifier{
+		report:      Report{Head: Head{Hash: Genesis}},
+		boundary:    boundary,
+		checkpoints: checkpoints,
+		key:         key,
+		hashes:      make(map[int]string, len(checkpoints)),
+	}
+	for _, cp := range checkpoints {
+		v.hashes[cp.Head.LastID] = ""
+	}
+	return v
+}
+
+// Add checks the next transaction and its stored prev_hash and hash, empty
+// when not set. It returns false once the chain is broken.
+func (v *Verifier) Add(tr transaction.Request, prevHash, hash string) bool {
+	if v.report.Broken != nil {
+		return false
+	}
+
+	switch {
+	case hash == "" && !v.started && tr.Id <= v.boundary:
+		v.report.Unchained++
+		return true
+	case hash == "":
+		return v.fail(tr.Id, ReasonMissingHash)
+	case prevHash != v.report.Head.Hash:
+		return v.fail(tr.Id, ReasonPrevMismatch)
+	case Hash(prevHash, tr) != hash:
+		return v.fail(tr.Id, ReasonHashMismatch)
+	}
+
+	v.started = true
+	v.report.Checked++
+	v.report.Head = Head{LastID: tr.Id, Hash: hash}
+	if _, ok := v.hashes[tr.Id]; ok {
+		v.hashes[tr.Id] = hash
+	}
+	return true
+}
+
+// Finish compares the chain with the stored head and checkpoints and
+// returns the report.
+func (v *Verifier) Finish(stored Head) Report {
+	if v.report.Broken != nil {
+		return v.report
+	}
+	if stored != v.report.Head {
+		v.fail(stored.LastID, ReasonHeadMismatch)
+		return v.report
+	}
+
+	for _, cp := range v.checkpoints {
+		if v.key != nil && !VerifyCheckpoint(v.key, cp) {
+			v.fail(cp.ID, ReasonCheckpointSigning)
+			return v.report
+		}
+		if v.hashes[cp.Head.LastID] != cp.Head.Hash {
+			v.fail(cp.ID, ReasonCheckpointHash)
+			return v.report
+		}
+		v.report.Checkpoints++
+	}
+
+	v.report.Valid = true
+	return v.report
+}
+
+func (v *Verifier) fail(id int, reason string) bool {
+	v.report.Broken = &Break{ID: id, Reason: reason}
+	return false
+}
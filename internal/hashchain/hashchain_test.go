@@ -0,0 +1,111 @@
+package hashchain
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHash(t *testing.T) {
+	at := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	tr := transaction.Request{Id: 1, From: "AB", To: "cd", Amount: 1.5, Created_at: at}
+
+	h := Hash(Genesis, tr)
+	assert.Len(t, h, 64)
+
+	same := tr
+	same.From = "ab"
+	same.Created_at = at.In(time.FixedZone("MSK", 3*60*60))
+	assert.Equal(t, h, Hash(Genesis, same), "case of addresses and time zone do not matter")
+
+	changed := tr
+	changed.Amount = 1.25
+	assert.NotEqual(t, h, Hash(Genesis, changed))
+	assert.NotEqual(t, h, Hash(h, tr))
+}
+
+func TestCheckpoint(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	cp := Sign(key, Head{LastID: 7, Hash: Genesis}, time.Now())
+	assert.True(t, VerifyCheckpoint(pub, cp))
+
+	forged := cp
+	forged.Head.LastID = 8
+	assert.False(t, VerifyCheckpoint(pub, forged))
+
+	other, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	assert.False(t, VerifyCheckpoint(other, cp))
+
+	parsed, err := ParseKey(hex.EncodeToString(key) + "\n")
+	require.NoError(t, err)
+	assert.Equal(t, key, parsed)
+	_, err = ParseKey("abcd")
+	assert.ErrorIs(t, err, ErrInvalidCheckpointKey)
+}
+
+func TestVerifier(t *testing.T) {
+	at := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	chain := func(n int) ([]transaction.Request, []string) {
+		var (
+			trs    []transaction.Request
+			hashes []string
+		)
+		prev := Genesis
+		for i := 1; i <= n; i++ {
+			tr := transaction.Request{Id: i, From: "a", To: "b", Amount: float64(i), Created_at: at}
+			prev = Hash(prev, tr)
+			trs = append(trs, tr)
+			hashes = append(hashes, prev)
+		}
+		return trs, hashes
+	}
+
+	t.Run("Unchained transactions before the chain", func(t *testing.T) {
+		trs, hashes := chain(3)
+		v := NewVerifier(nil, nil, 0)
+		assert.True(t, v.Add(transaction.Request{Id: 0}, "", ""))
+		prev := Genesis
+		for i, tr := range trs {
+			assert.True(t, v.Add(tr, prev, hashes[i]))
+			prev = hashes[i]
+		}
+		report := v.Finish(Head{LastID: 3, Hash: prev})
+		assert.True(t, report.Valid)
+		assert.Equal(t, 1, report.Unchained)
+		assert.Equal(t, 3, report.Checked)
+	})
+
+	t.Run("Missing hash inside the chain", func(t *testing.T) {
+		trs, hashes := chain(2)
+		v := NewVerifier(nil, nil, 0)
+		assert.True(t, v.Add(trs[0], Genesis, hashes[0]))
+		assert.False(t, v.Add(trs[1], "", ""))
+		report := v.Finish(Head{LastID: 2, Hash: hashes[1]})
+		assert.False(t, report.Valid)
+		assert.Equal(t, &Break{ID: 2, Reason: ReasonMissingHash}, report.Broken)
+	})
+
+	t.Run("Missing hash after the boundary", func(t *testing.T) {
+		trs, hashes := chain(1)
+		v := NewVerifier(nil, nil, 0)
+		assert.False(t, v.Add(transaction.Request{Id: 1}, "", ""))
+		report := v.Finish(Head{LastID: 1, Hash: hashes[0]})
+		assert.Equal(t, &Break{ID: trs[0].Id, Reason: ReasonMissingHash}, report.Broken)
+	})
+
+	t.Run("Checkpoint beyond the chain", func(t *testing.T) {
+		trs, hashes := chain(1)
+		v := NewVerifier([]Checkpoint{{ID: 1, Head: Head{LastID: 5, Hash: hashes[0]}}}, nil, 0)
+		v.Add(trs[0], Genesis, hashes[0])
+		report := v.Finish(Head{LastID: 1, Hash: hashes[0]})
+		assert.Equal(t, &Break{ID: 1, Reason: ReasonCheckpointHash}, report.Broken)
+	})
+}
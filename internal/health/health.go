@@ -0,0 +1,169 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Report statuses.
+const (
+	StatusReady    = "ready"
+	StatusNotReady = "not_ready"
+)
+
+// Check statuses.
+const (
+	CheckOK   = "ok"
+	CheckFail = "fail"
+)
+
+// defaultTimeout bounds every check when no timeout is configured.
+const defaultTimeout = 2 * time.Second
+
+var (
+	// ErrStarting is reported by the startup check until MarkStarted is called.
+	ErrStarting = errors.New("service is starting")
+	// ErrMaintenance is reported while the maintenance file exists.
+	ErrMaintenance = errors.New("service is in maintenance")
+)
+
+// Check returns an error when the dependency it checks is not usable.
+type Check func(ctx context.Context) error
+
+// Result is the outcome of a single check.
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// Report is the outcome of all checks. Status is StatusReady only when
+// every check passed.
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Ready reports whether every check passed.
+func (r Report) Ready() bool {
+	return r.Status == StatusReady
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs the readiness checks. It reports not ready until
+// MarkStarted is called, so traffic is withheld while the service is
+// still being set up.
+type Checker struct {
+	timeout time.Duration
+	checks  []namedCheck
+	started atomic.Bool
+}
+
+// New returns a checker bounding every check by timeout.
+func New(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	c := &Checker{timeout: timeout}
+	c.Add("startup", c.checkStarted)
+	return c
+}
+
+// Add registers check under name. Checks are not safe to add once the
+// checker is in use.
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// MarkStarted reports the service as started.
+func (c *Checker) MarkStarted() {
+	c.started.Store(true)
+}
+
+func (c *Checker) checkStarted(context.Context) error {
+	if !c.started.Load() {
+		return ErrStarting
+	}
+	return nil
+}
+
+// Check runs all checks concurrently and reports their results in the
+// order they were added.
+func (c *Checker) Check(ctx context.Context) Report {
+	results := make([]Result, len(c.checks))
+
+	var wg sync.WaitGroup
+	for i, nc := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, nc)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusReady, Checks: results}
+	for _, res := range results {
+		if res.Status != CheckOK {
+			report.Status = StatusNotReady
+			break
+		}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, nc namedCheck) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := nc.check(ctx)
+	res := Result{
+		Name:      nc.name,
+		Status:    CheckOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		res.Status = CheckFail
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// Writable checks that a file can be created and removed in dir.
+func Writable(dir string) Check {
+	return func(context.Context) error {
+		f, err := os.CreateTemp(dir, ".health-*")
+		if err != nil {
+			return fmt.Errorf("directory %s is not writable: %w", dir, err)
+		}
+		name := f.Name()
+		f.Close()
+		return os.Remove(name)
+	}
+}
+
+// Maintenance fails while the file at path exists.
+func Maintenance(path string) Check {
+	return func(context.Context) error {
+		_, err := os.Stat(path)
+		switch {
+		case err == nil:
+			return ErrMaintenance
+		case errors.Is(err, os.ErrNotExist):
+			return nil
+		default:
+			return fmt.Errorf("checking maintenance file: %w", err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker_Startup(t *testing.T) {
+	c := New(time.Second)
+
+	report := c.Check(context.Background())
+	assert.False(t, report.Ready())
+	require.Len(t, report.Checks, 1)
+	assert.Equal(t, "startup", report.Checks[0].Name)
+	assert.Equal(t, CheckFail, report.Checks[0].Status)
+	assert.Equal(t, ErrStarting.Error(), report.Checks[0].Error)
+
+	c.MarkStarted()
+	report = c.Check(context.Background())
+	assert.True(t, report.Ready())
+	assert.Equal(t, CheckOK, report.Checks[0].Status)
+}
+
+func TestChecker_Check(t *testing.T) {
+	c := New(time.Second)
+	c.MarkStarted()
+	c.Add("database", func(context.Context) error { return nil })
+	c.Add("disk", func(context.Context) error { return errors.New("read-only file system") })
+
+	report := c.Check(context.Background())
+	assert.Equal(t, StatusNotReady, report.Status)
+	require.Len(t, report.Checks, 3)
+	assert.Equal(t, "database", report.Checks[1].Name)
+	assert.Equal(t, CheckOK, report.Checks[1].Status)
+	assert.Empty(t, report.Checks[1].Error)
+	assert.Equal(t, "disk", report.Checks[2].Name)
+	assert.Equal(t, CheckFail, report.Checks[2].Status)
+	assert.Equal(t, "read-only file system", report.Checks[2].Error)
+}
+
+func TestChecker_Timeout(t *testing.T) {
+	c := New(50 * time.Millisecond)
+	c.MarkStarted()
+	c.Add("database", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	report := c.Check(context.Background())
+	assert.False(t, report.Ready())
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks[1].Error)
+	assert.GreaterOrEqual(t, report.Checks[1].LatencyMS, float64(50))
+}
+
+func TestWritable(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, Writable(dir)(context.Background()))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "the probe file is removed")
+
+	assert.Error(t, Writable(filepath.Join(dir, "missing"))(context.Background()))
+}
+
+func TestMaintenance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "maintenance")
+	check := Maintenance(path)
+	assert.NoError(t, check(context.Background()))
+
+	require.NoError(t, os.WriteFile(path, nil, 0o644))
+	assert.ErrorIs(t, check(context.Background()), ErrMaintenance)
+
+	require.NoError(t, os.Remove(path))
+	assert.NoError(t, check(context.Background()))
+}
@@ -0,0 +1,261 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/auth"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/logger/sl"
+	"github.com/Petro-vich/transaction_processing_go/internal/risk"
+	"github.com/gorilla/mux"
+)
+
+const (
+	BackupNotSupported = "backups are not supported by the configured storage"
+	CacheDisabled      = "balance cache is disabled"
+	KeyNotFound        = "API key not found"
+	ChainNotSupported  = "hash chain is not supported by the configured storage"
+	RiskDisabled       = "risk rules are not configured"
+	InvalidReviewID    = "review id must be a positive integer"
+)
+
+type createKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type createKeyResponse struct {
+	Status string   `json:"status"`
+	Token  string   `json:"token"`
+	Key    auth.Key `json:"key"`
+}
+
+func (sr *Server) CreateBackupHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "httpserver.CreateBackupHandler"
+
+	if sr.backup == nil {
+		sendError(w, BackupNotSupported, http.StatusNotImplemented)
+		return
+	}
+
+	info, err := sr.backup.Create(r.Context())
+	if err != nil {
+		sr.sendStorageError(w, r, op, err)
+		return
+	}
+
+	sr.log.Info("Backup created", slog.String("op", op), slog.String("path", info.Path), slog.Int64("size", info.Size))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(info)
+}
+
+func (sr *Server) ListBackupsHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "httpserver.ListBackupsHandler"
+
+	if sr.backup == nil {
+		sendError(w, BackupNotSupported, http.StatusNotImplemented)
+		return
+	}
+
+	backups, err := sr.backup.List()
+	if err != nil {
+		sr.log.Error("Failed to list backups", slog.String("op", op), sl.Err(err))
+		sendError(w, InternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(backups)
+}
+
+func (sr *Server) CacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if sr.cache == nil {
+		sendError(w, CacheDisabled, http.StatusNotImplemented)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sr.cache.Stats())
+}
+
+func (sr *Server) CreateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "httpserver.CreateKeyHandler"
+
+	if sr.keys == nil {
+		sendError(w, AuthNotAvailable, http.StatusNotImplemented)
+		return
+	}
+
+	var req createKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		sendError(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	scopes, err := auth.ParseScopes(req.Scopes)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, key, err := sr.keys.Issue(r.Context(), req.Name, scopes)
+	if err != nil {
+		sr.sendStorageError(w, r, op, err)
+		return
+	}
+
+	sr.log.Info("API key issued", slog.String("op", op), slog.String("key_id", key.ID), slog.String("name", key.Name))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createKeyResponse{Status: StatusOk, Token: token, Key: key})
+}
+
+func (sr *Server) ListKeysHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "httpserver.ListKeysHandler"
+
+	if sr.keys == nil {
+		sendError(w, AuthNotAvailable, http.StatusNotImplemented)
+		return
+	}
+
+	keys, err := sr.keys.List(r.Context())
+	if err != nil {
+		sr.sendStorageError(w, r, op, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+func (sr *Server) RevokeKeyHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "httpserver.RevokeKeyHandler"
+
+	if sr.keys == nil {
+		sendError(w, AuthNotAvailable, http.StatusNotImplemented)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	err := sr.keys.Revoke(r.Context(), id)
+	if errors.Is(err, auth.ErrKeyNotFound) {
+		sendError(w, KeyNotFound, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sr.sendStorageError(w, r, op, err)
+		return
+	}
+
+	sr.log.Info("API key revoked", slog.String("op", op), slog.String("key_id", id))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": StatusOk})
+}
+
+// VerifyChainHandler recomputes the transaction hash chain. A broken chain
+// is reported with valid set to false and the first broken link.
+func (sr *Server) VerifyChainHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "httpserver.VerifyChainHandler"
+
+	if sr.chain == nil {
+		sendError(w, ChainNotSupported, http.StatusNotImplemented)
+		return
+	}
+
+	report, err := sr.chain.VerifyChain(r.Context(), sr.chainKey)
+	if err != nil {
+		sr.sendStorageError(w, r, op, err)
+		return
+	}
+
+	if !report.Valid {
+		sr.log.Warn("transaction chain is broken", slog.String("op", op),
+			slog.Int("id", report.Broken.ID), slog.String("reason", report.Broken.Reason))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// ListReviewsHandler lists the transfers held by risk rules, newest first,
+// optionally filtered by status.
+func (sr *Server) ListReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "httpserver.ListReviewsHandler"
+
+	if sr.risk == nil {
+		sendError(w, RiskDisabled, http.StatusNotImplemented)
+		return
+	}
+
+	query := r.URL.Query()
+	count := 100
+	if query.Has("count") {
+		var err error
+		if count, err = strconv.Atoi(query.Get("count")); err != nil || count <= 0 {
+			sendError(w, InvalidCount, http.StatusBadRequest)
+			return
+		}
+	}
+
+	status := query.Get("status")
+	switch status {
+	case "", risk.StatusPending, risk.StatusExecuting, risk.StatusApproved, risk.StatusRejected, risk.StatusFailed:
+	default:
+		sendError(w, "status must be pending, executing, approved, rejected or failed", http.StatusBadRequest)
+		return
+	}
+
+	reviews, err := sr.risk.List(r.Context(), status, count)
+	if err != nil {
+		sr.sendStorageError(w, r, op, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reviews)
+}
+
+// ApproveReviewHandler executes a held transfer. A transfer that then
+// fails is reported with the error of the transfer and its review is
+// marked failed.
+func (sr *Server) ApproveReviewHandler(w http.ResponseWriter, r *http.Request) {
+	sr.decideReview(w, r, "httpserver.ApproveReviewHandler", sr.risk.Approve)
+}
+
+// RejectReviewHandler drops a held transfer.
+func (sr *Server) RejectReviewHandler(w http.ResponseWriter, r *http.Request) {
+	sr.decideReview(w, r, "httpserver.RejectReviewHandler", sr.risk.Reject)
+}
+
+func (sr *Server) decideReview(w http.ResponseWriter, r *http.Request, op string,
+	decide func(ctx context.Context, id int64, by string) (risk.Review, error)) {
+	if sr.risk == nil {
+		sendError(w, RiskDisabled, http.StatusNotImplemented)
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id <= 0 {
+		sendError(w, InvalidReviewID, http.StatusBadRequest)
+		return
+	}
+
+	principal, _ := auth.FromContext(r.Context())
+	review, err := decide(r.Context(), id, principal.Name)
+	if err != nil {
+		sr.sendStorageError(w, r, op, err)
+		return
+	}
+
+	sr.log.Info("Review decided", slog.String("op", op), slog.Int64("review_id", id),
+		slog.String("status", review.Status), slog.String("by", principal.Name))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
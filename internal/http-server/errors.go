@@ -0,0 +1,155 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/address"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/logger/sl"
+	"github.com/Petro-vich/transaction_processing_go/internal/risk"
+	"github.com/Petro-vich/transaction_processing_go/internal/screening"
+	"github.com/Petro-vich/transaction_processing_go/internal/signing"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+)
+
+// Machine-readable error codes returned in the "code" field of error responses.
+const (
+	CodeBadRequest        = "bad_request"
+	CodeUnauthorized      = "unauthorized"
+	CodeForbidden         = "forbidden"
+	CodeNotFound          = "not_found"
+	CodeConflict          = "conflict"
+	CodeInsufficientFunds = "insufficient_funds"
+	CodeInvalidSignature  = "invalid_signature"
+	CodeNonceReused       = "nonce_reused"
+	CodeTransferDenied    = "transfer_denied"
+	CodeAddressBlocked    = "address_blocked"
+	CodeRateLimited       = "rate_limited"
+	CodeValidation        = "validation_failed"
+	CodeTimeout           = "timeout"
+	CodeUnavailable       = "unavailable"
+	CodeNotSupported      = "not_supported"
+	CodeInternal          = "internal_error"
+)
+
+const (
+	AddressNotExist   = "Address does not exist"
+	WalletExists      = "Wallet already exists"
+	InsufficientFunds = "Insufficient funds in the account"
+	InternalError     = "Internal server error"
+	RequestTimeout    = "Request timed out"
+	RequestCancelled  = "Request cancelled"
+	StorageBusy       = "Storage is busy, try again later"
+	InvalidSignature  = "Invalid transfer signature"
+	NonceReused       = "Nonce has already been used"
+	ReviewNotFound    = "Review not found"
+	ReviewDecided     = "Review is already decided"
+	AddressBlocked    = "Transfers from or to this address are blocked"
+	EntryNotFound     = "Screening entry not found"
+	FileEntry         = "Entry comes from a list file, remove it there and reload"
+)
+
+// apiError is an HTTP representation of a failed operation.
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+// mapError converts an error returned by the storage layer into an apiError.
+// Unknown errors are reported as internal errors.
+func mapError(err error) apiError {
+	var (
+		notFound     *storage.NotFoundError
+		conflict     *storage.ConflictError
+		insufficient *storage.InsufficientFundsError
+		validation   *storage.ValidationError
+		denied       *risk.DeniedError
+	)
+
+	switch {
+	case errors.As(err, &notFound), errors.Is(err, storage.ErrAddressNotExist):
+		return apiError{http.StatusNotFound, CodeNotFound, AddressNotExist}
+	case errors.As(err, &conflict), errors.Is(err, storage.ErrConflict):
+		return apiError{http.StatusConflict, CodeConflict, WalletExists}
+	case errors.As(err, &insufficient), errors.Is(err, storage.ErrInsufficient):
+		return apiError{http.StatusBadRequest, CodeInsufficientFunds, InsufficientFunds}
+	case errors.As(err, &validation):
+		return apiError{http.StatusBadRequest, CodeValidation, validation.Message}
+	case errors.Is(err, signing.ErrInvalidSignature):
+		return apiError{http.StatusForbidden, CodeInvalidSignature, InvalidSignature}
+	case errors.Is(err, signing.ErrNonceReused):
+		return apiError{http.StatusConflict, CodeNonceReused, NonceReused}
+	case errors.Is(err, screening.ErrBlocked):
+		return apiError{http.StatusForbidden, CodeAddressBlocked, AddressBlocked}
+	case errors.Is(err, screening.ErrUnknownList):
+		return apiError{http.StatusBadRequest, CodeBadRequest, screening.ErrUnknownList.Error()}
+	case errors.Is(err, address.ErrInvalid):
+		return apiError{http.StatusBadRequest, CodeBadRequest, InvalidAddr}
+	case errors.Is(err, screening.ErrEntryNotFound):
+		return apiError{http.StatusNotFound, CodeNotFound, EntryNotFound}
+	case errors.Is(err, screening.ErrFileEntry):
+		return apiError{http.StatusConflict, CodeConflict, FileEntry}
+	case errors.As(err, &denied):
+		return apiError{http.StatusForbidden, CodeTransferDenied, denied.Error()}
+	case errors.Is(err, risk.ErrReviewNotFound):
+		return apiError{http.StatusNotFound, CodeNotFound, ReviewNotFound}
+	case errors.Is(err, risk.ErrReviewDecided):
+		return apiError{http.StatusConflict, CodeConflict, ReviewDecided}
+	case errors.Is(err, storage.ErrBusy):
+		return apiError{http.StatusServiceUnavailable, CodeUnavailable, StorageBusy}
+	case errors.Is(err, context.DeadlineExceeded):
+		return apiError{http.StatusGatewayTimeout, CodeTimeout, RequestTimeout}
+	case errors.Is(err, context.Canceled):
+		return apiError{http.StatusServiceUnavailable, CodeUnavailable, RequestCancelled}
+	default:
+		return apiError{http.StatusInternalServerError, CodeInternal, InternalError}
+	}
+}
+
+// codeForStatus returns the default error code for handler-level failures.
+func codeForStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusNotImplemented:
+		return CodeNotSupported
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case http.StatusGatewayTimeout:
+		return CodeTimeout
+	case http.StatusInternalServerError:
+		return CodeInternal
+	default:
+		return CodeBadRequest
+	}
+}
+
+// sendStorageError logs err and writes the mapped error response. When the
+// request context is done the driver error is replaced by the context error,
+// since drivers report interrupted queries inconsistently.
+func (sr *Server) sendStorageError(w http.ResponseWriter, r *http.Request, op string, err error) {
+	if ctxErr := r.Context().Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+		err = fmt.Errorf("%w: %v", ctxErr, err)
+	}
+
+	apiErr := mapError(err)
+	if apiErr.status >= http.StatusInternalServerError {
+		sr.log.Error("storage operation failed", slog.String("op", op), sl.Err(err))
+	} else {
+		sr.log.Info("storage operation rejected", slog.String("op", op), slog.String("code", apiErr.code), sl.Err(err))
+	}
+
+	writeError(w, apiErr.status, apiErr.code, apiErr.message)
+}
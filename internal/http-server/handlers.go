@@ -2,14 +2,21 @@ package httpserver
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
 
+	"github.com/Petro-vich/transaction_processing_go/internal/address"
 	"github.com/Petro-vich/transaction_processing_go/internal/lib/logger/sl"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/tracing"
 	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
-	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+	"github.com/Petro-vich/transaction_processing_go/internal/risk"
+	"github.com/Petro-vich/transaction_processing_go/internal/service/importer"
+	"github.com/Petro-vich/transaction_processing_go/internal/signing"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -17,42 +24,124 @@ const (
 	EmptyRequest  = "empty request"
 	InvalidAmount = "amount must be positive"
 	InvalidCount  = "count must be a positive integer"
+	InvalidCSV    = "invalid csv file"
+
+	NegativeBalance = "opening balance must not be negative"
+	FundingAdmin    = "a non-zero opening balance requires the admin scope"
+
+	SignatureRequired  = "signature and a positive nonce are required"
+	SignedOnly         = "transfers must be signed, import is disabled"
+	SigningNotRequired = "transfers are not signed, nonces are not tracked"
 )
 
+// maxImportSize limits the size of an uploaded CSV file.
+const maxImportSize = 10 << 20
+
 const (
 	StatusOk    = "OK"
 	StatusError = "Error"
+	StatusHeld  = "held"
 )
 
 func sendError(w http.ResponseWriter, err string, statusCode int) {
+	writeError(w, statusCode, codeForStatus(statusCode), err)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, code string, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(map[string]string{
 		"status":  StatusError,
-		"message": err,
+		"code":    code,
+		"message": message,
 	})
 }
 
-func (sr *Server) GetBalanceHandler(w http.ResponseWriter, r *http.Request) {
-	const op = "handlers.getbalancehandler"
+// walletAddress normalizes an address given as hex or in the checksummed
+// encoding to the stored hex form. It writes 400 and returns false when the
+// address is invalid.
+func (sr *Server) walletAddress(w http.ResponseWriter, op string, raw string) (string, bool) {
+	adr, err := address.Normalize(raw)
+	if err != nil {
+		sr.log.Info("Invalid wallet address", slog.String("op", op), slog.String("address", raw), sl.Err(err))
+		sendError(w, InvalidAddr, http.StatusBadRequest)
+		return "", false
+	}
+	return adr, true
+}
 
-	arg := mux.Vars(r)
-	adr := arg["address"]
+type createWalletRequest struct {
+	Amount float64 `json:"amount"`
+}
 
-	if len(adr) != 64 {
-		sendError(w, InvalidAddr, http.StatusBadRequest)
-		sr.log.Info("Invalid wallet address length", slog.String("op", op), slog.String("address", adr))
+// CreateWalletHandler creates a wallet with a zero balance. Funds enter the
+// system only through seeding or an opening balance set by an admin caller,
+// so transfers conserve the total. The body may be empty.
+func (sr *Server) CreateWalletHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "httpserver.CreateWalletHandler"
+
+	var req createWalletRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		sendError(w, "Invalid request body", http.StatusBadRequest)
+		sr.log.Info("Failed to decode request body", slog.String("op", op), sl.Err(err))
 		return
 	}
 
-	balance, err := sr.storage.GetBalance(adr)
-	if err == storage.ErrAddressNotExist {
-		sr.log.Info("address not found", slog.String("op", op), slog.String("address", adr))
-		sendError(w, "the address is not exists", http.StatusBadRequest)
+	if req.Amount < 0 {
+		sendError(w, NegativeBalance, http.StatusBadRequest)
+		sr.log.Info(NegativeBalance, slog.String("op", op), slog.Float64("amount", req.Amount))
 		return
-	} else if err != nil {
-		sendError(w, "Internal server error", http.StatusInternalServerError)
-		sr.log.Error("Error get balance", slog.String("op", op), sl.Err(err))
+	}
+
+	if req.Amount > 0 && !isAdmin(r) {
+		sendError(w, FundingAdmin, http.StatusForbidden)
+		sr.log.Info(FundingAdmin, slog.String("op", op), slog.Float64("amount", req.Amount))
+		return
+	}
+
+	resp := map[string]string{
+		"status":  StatusOk,
+		"balance": strconv.FormatFloat(req.Amount, 'g', -1, 64),
+	}
+
+	if sr.nonces != nil {
+		keypair, err := sr.wallet.CreateKeypairWallet(r.Context(), req.Amount)
+		if err != nil {
+			sr.sendStorageError(w, r, op, err)
+			return
+		}
+		resp["address"], resp["private_key"] = keypair.Address.Hex(), keypair.PrivateKey
+		resp["checksum_address"] = keypair.Address.String()
+	} else {
+		adr, err := sr.wallet.CreateWallet(r.Context(), req.Amount)
+		if err != nil {
+			sr.sendStorageError(w, r, op, err)
+			return
+		}
+		resp["address"], resp["checksum_address"] = adr.Hex(), adr.String()
+	}
+
+	sr.log.Info("Wallet created", slog.String("op", op), slog.String("address", resp["address"]))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (sr *Server) GetBalanceHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.getbalancehandler"
+
+	adr, ok := sr.walletAddress(w, op, mux.Vars(r)["address"])
+	if !ok {
+		return
+	}
+	if !sr.authorizeWallet(w, r, adr) {
+		return
+	}
+
+	balance, err := sr.storage.GetBalance(r.Context(), adr)
+	if err != nil {
+		sr.sendStorageError(w, r, op, err)
 		return
 	}
 
@@ -64,44 +153,81 @@ func (sr *Server) GetBalanceHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// sendMoneyRequest is a transfer with the signature fields required when
+// transfers must be signed.
+type sendMoneyRequest struct {
+	transaction.Request
+	Nonce     int64  `json:"nonce"`
+	Signature string `json:"signature"`
+}
+
+// heldResponse is returned with 202 for a transfer queued for review.
+type heldResponse struct {
+	Status   string `json:"status"`
+	ReviewID int64  `json:"review_id"`
+	Rule     string `json:"rule"`
+	Reason   string `json:"reason"`
+}
+
 func (sr *Server) SendMoneyHandler(w http.ResponseWriter, r *http.Request) {
 	const op = "httpserver.SendMoneyHandler"
 
-	var req transaction.Request
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sr.log.Info("error decode", slog.String("op", op), sl.Err(err))
-		sendError(w, "Invalid request body", http.StatusBadRequest)
-		sr.log.Error("Failed to decode request body", slog.String("op", op), sl.Err(err))
+	_, span := tracer.Start(r.Context(), "SendMoneyHandler.decode")
+	req, ok := sr.decodeSendMoney(w, r, op)
+	span.End()
+	if !ok {
 		return
 	}
 
-	if len(req.From) != 64 || len(req.To) != 64 {
-		sendError(w, InvalidAddr, http.StatusBadRequest)
-		sr.log.Error("Invalid wallet address length", slog.String("op", op))
+	if !sr.authorizeWallet(w, r, req.From) {
 		return
 	}
 
-	if req.Amount <= 0 {
-		sendError(w, InvalidAmount, http.StatusBadRequest)
-		sr.log.Info(InvalidAmount, slog.String("op", op), slog.Float64("amount", (req.Amount)))
+	sr.log.Info("Request body decoded", slog.String("op", op))
+
+	// The wallet limit is charged only for a caller allowed to send from
+	// the wallet, so others cannot lock its owner out.
+	if sr.nonces != nil {
+		if !sr.verifySignature(w, r, op, req) {
+			return
+		}
+	} else if !sr.allow(w, sr.walletLimit, req.From) {
 		return
 	}
 
-	sr.log.Info("Request body decoded", slog.String("op", op))
+	if sr.screening != nil {
+		ctx, span := tracer.Start(r.Context(), "SendMoneyHandler.screening")
+		err := sr.screening.CheckTransfer(ctx, req.From, req.To, req.Amount)
+		tracing.End(span, err)
+		if err != nil {
+			sr.sendStorageError(w, r, op, err)
+			return
+		}
+	}
+	if sr.risk != nil {
+		ctx, span := tracer.Start(r.Context(), "SendMoneyHandler.risk")
+		err := sr.risk.CheckTransfer(ctx, req.From, req.To, req.Amount)
+		var held *risk.HeldError
+		if errors.As(err, &held) {
+			span.SetAttributes(attribute.String("risk.rule", held.Review.Rule))
+			span.End()
+			sr.log.Info("Transfer held for review", slog.String("op", op),
+				slog.Int64("review_id", held.Review.ID), slog.String("rule", held.Review.Rule))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(heldResponse{Status: StatusHeld, ReviewID: held.Review.ID, Rule: held.Review.Rule, Reason: held.Review.Reason})
+			return
+		}
+		tracing.End(span, err)
+		if err != nil {
+			sr.sendStorageError(w, r, op, err)
+			return
+		}
+	}
 
-	err := sr.storage.SendMoney(req.From, req.To, req.Amount)
-	if err == storage.ErrAddressNotExist {
-		sendError(w, "Address does not exist", http.StatusNotFound)
-		sr.log.Info("Address not found")
-		return
-	} else if err == storage.ErrInsufficient {
-		sendError(w, "Insufficient funds in the account", http.StatusBadRequest)
-		sr.log.Info("Insufficient funds", slog.String("op", op))
-		return
-	} else if err != nil {
-		sr.log.Error("Failed to send money", slog.String("op", op), sl.Err(err))
-		sendError(w, "Internal server error", http.StatusInternalServerError)
+	err := sr.storage.SendMoney(r.Context(), req.From, req.To, req.Amount)
+	if err != nil {
+		sr.sendStorageError(w, r, op, err)
 		return
 	}
 
@@ -113,6 +239,68 @@ func (sr *Server) SendMoneyHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// verifySignature checks the signature of a transfer, charges the wallet
+// limit and uses up the nonce. The nonce is used up before the transfer, so
+// a signature can never move money twice even if the transfer then fails.
+// The limit is charged before the nonce, so a wallet out of transfers keeps
+// its nonce for a retry, and refunded when the nonce is rejected, so a
+// replay costs the owner nothing.
+func (sr *Server) verifySignature(w http.ResponseWriter, r *http.Request, op string, req sendMoneyRequest) bool {
+	if req.Signature == "" || req.Nonce <= 0 {
+		sendError(w, SignatureRequired, http.StatusBadRequest)
+		return false
+	}
+
+	ctx, span := tracer.Start(r.Context(), "SendMoneyHandler.verify_signature")
+	transfer := signing.Transfer{From: req.From, To: req.To, Amount: req.Amount, Nonce: req.Nonce}
+	err := signing.Verify(transfer, req.Signature)
+	if err == nil && !sr.allow(w, sr.walletLimit, req.From) {
+		span.End()
+		return false
+	}
+	if err == nil {
+		err = sr.nonces.UseNonce(ctx, req.From, req.Nonce)
+		if err != nil && sr.walletLimit != nil {
+			sr.walletLimit.Refund(req.From)
+		}
+	}
+	tracing.End(span, err)
+	if err != nil {
+		sr.sendStorageError(w, r, op, err)
+		return false
+	}
+	return true
+}
+
+// decodeSendMoney decodes the transfer and normalizes its addresses. It
+// writes 400 and returns false when the request is invalid.
+func (sr *Server) decodeSendMoney(w http.ResponseWriter, r *http.Request, op string) (sendMoneyRequest, bool) {
+	var req sendMoneyRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sr.log.Info("error decode", slog.String("op", op), sl.Err(err))
+		sendError(w, "Invalid request body", http.StatusBadRequest)
+		sr.log.Error("Failed to decode request body", slog.String("op", op), sl.Err(err))
+		return req, false
+	}
+
+	var ok bool
+	if req.From, ok = sr.walletAddress(w, op, req.From); !ok {
+		return req, false
+	}
+	if req.To, ok = sr.walletAddress(w, op, req.To); !ok {
+		return req, false
+	}
+
+	if req.Amount <= 0 {
+		sendError(w, InvalidAmount, http.StatusBadRequest)
+		sr.log.Info(InvalidAmount, slog.String("op", op), slog.Float64("amount", (req.Amount)))
+		return req, false
+	}
+
+	return req, true
+}
+
 func (sr *Server) GetLastHandler(w http.ResponseWriter, r *http.Request) {
 	const op = "httpserver.GetLastHandler"
 
@@ -126,10 +314,14 @@ func (sr *Server) GetLastHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	transactions, err := sr.storage.GetLast(count)
+	if restricted(r) {
+		sendError(w, OwnWalletsOnly, http.StatusForbidden)
+		return
+	}
+
+	transactions, err := sr.storage.GetLast(r.Context(), count)
 	if err != nil {
-		sr.log.Error("Couldn't get the latest transactions", slog.String("op", op), sl.Err(err))
-		sendError(w, "Internal server error", http.StatusInternalServerError)
+		sr.sendStorageError(w, r, op, err)
 		return
 	}
 
@@ -138,3 +330,135 @@ func (sr *Server) GetLastHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(transactions)
 }
+
+// GetNonceHandler returns the latest nonce used by a wallet; the next
+// signed transfer must use a greater one.
+func (sr *Server) GetNonceHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "httpserver.GetNonceHandler"
+
+	if sr.nonces == nil {
+		sendError(w, SigningNotRequired, http.StatusNotImplemented)
+		return
+	}
+
+	adr, ok := sr.walletAddress(w, op, mux.Vars(r)["address"])
+	if !ok {
+		return
+	}
+	if !sr.authorizeWallet(w, r, adr) {
+		return
+	}
+
+	nonce, err := sr.nonces.LastNonce(r.Context(), adr)
+	if err != nil {
+		sr.sendStorageError(w, r, op, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": StatusOk,
+		"nonce":  strconv.FormatInt(nonce, 10),
+	})
+}
+
+func (sr *Server) GetHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "httpserver.GetHistoryHandler"
+
+	adr, ok := sr.walletAddress(w, op, mux.Vars(r)["address"])
+	if !ok {
+		return
+	}
+
+	strCount := r.URL.Query().Get("count")
+	count, err := strconv.Atoi(strCount)
+	if err != nil || count <= 0 {
+		sendError(w, InvalidCount, http.StatusBadRequest)
+		sr.log.Info(InvalidCount, slog.String("op", op), slog.String("count", strCount))
+		return
+	}
+	if !sr.authorizeWallet(w, r, adr) {
+		return
+	}
+
+	transactions, err := sr.storage.GetHistory(r.Context(), adr, count)
+	if err != nil {
+		sr.sendStorageError(w, r, op, err)
+		return
+	}
+
+	sr.log.Info("Retrieved wallet history", slog.String("op", op), slog.String("address", adr), slog.Int("count", len(transactions)))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transactions)
+}
+
+func (sr *Server) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "httpserver.ImportHandler"
+
+	if sr.nonces != nil {
+		sendError(w, SignedOnly, http.StatusNotImplemented)
+		return
+	}
+	// A CSV may send from any wallet, so it is not open to callers bound
+	// to their own wallets.
+	if restricted(r) {
+		sendError(w, WalletNotOwned, http.StatusForbidden)
+		return
+	}
+
+	dryRun, err := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	if err != nil && r.URL.Query().Has("dry_run") {
+		sendError(w, "dry_run must be a boolean", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := importer.Parse(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		sr.log.Info("Failed to parse csv", slog.String("op", op), sl.Err(err))
+		sendError(w, InvalidCSV+": "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !dryRun && !sr.allowImport(w, rows) {
+		return
+	}
+
+	report := sr.importer.Import(r.Context(), rows, dryRun)
+
+	statusCode := http.StatusOK
+	if !report.Valid {
+		statusCode = http.StatusUnprocessableEntity
+	}
+
+	sr.log.Info("Import processed",
+		slog.String("op", op),
+		slog.Bool("dry_run", dryRun),
+		slog.Bool("valid", report.Valid),
+		slog.Int("total", report.Total),
+		slog.Int("succeeded", report.Succeeded),
+		slog.Int("failed", report.Failed),
+	)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(report)
+}
+
+// allowImport charges the wallet limit of every sending wallet one transfer
+// per row, all or nothing, as if the rows were sent one by one. Dry runs
+// move no money and are not charged.
+func (sr *Server) allowImport(w http.ResponseWriter, rows []importer.Row) bool {
+	if sr.walletLimit == nil {
+		return true
+	}
+
+	counts := make(map[string]int)
+	for _, row := range rows {
+		if address.IsCanonical(row.From) {
+			counts[row.From]++
+		}
+	}
+	if key, res := sr.walletLimit.AllowAll(counts); !res.Allowed {
+		return sr.checkLimit(w, res, key)
+	}
+	return true
+}
@@ -2,44 +2,86 @@ package httpserver
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest" // Добавьте этот импорт
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/Petro-vich/transaction_processing_go/internal/address"
+	"github.com/Petro-vich/transaction_processing_go/internal/auth"
 	"github.com/Petro-vich/transaction_processing_go/internal/config"
+	"github.com/Petro-vich/transaction_processing_go/internal/hashchain"
+	"github.com/Petro-vich/transaction_processing_go/internal/health"
 	"github.com/Petro-vich/transaction_processing_go/internal/lib/logger/sl"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/ratelimit"
+	"github.com/Petro-vich/transaction_processing_go/internal/metrics"
 	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
+	"github.com/Petro-vich/transaction_processing_go/internal/risk"
+	"github.com/Petro-vich/transaction_processing_go/internal/screening"
+	"github.com/Petro-vich/transaction_processing_go/internal/service/importer"
+	"github.com/Petro-vich/transaction_processing_go/internal/service/wallet"
+	"github.com/Petro-vich/transaction_processing_go/internal/signing"
 	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage/cache"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage/memory"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage/sqlite"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
-// Повторно используем mockStorage из service_test.go
-type mockStorage struct {
-	mock.Mock
+// failingStorage fails every repository operation with err, for error
+// responses real storage cannot produce on demand. Everything else is
+// served by the embedded memory storage.
+type failingStorage struct {
+	*memory.Storage
+	err error
 }
 
-func (m *mockStorage) CreateWallet(address string, amount float64) error {
-	args := m.Called(address, amount)
-	return args.Error(0)
+func newFailingStorage(err error) *failingStorage {
+	return &failingStorage{Storage: memory.New(), err: err}
 }
 
-func (m *mockStorage) GetBalance(address string) (float64, error) {
-	args := m.Called(address)
-	return args.Get(0).(float64), args.Error(1)
+func (st *failingStorage) CreateWallet(context.Context, string, float64) error {
+	return st.err
 }
 
-func (m *mockStorage) SendMoney(from, to string, amount float64) error {
-	args := m.Called(from, to, amount)
-	return args.Error(0)
+func (st *failingStorage) GetBalance(context.Context, string) (float64, error) {
+	return 0, st.err
 }
 
-func (m *mockStorage) GetLast(count int) ([]transaction.Request, error) {
-	args := m.Called(count)
-	return args.Get(0).([]transaction.Request), args.Error(1)
+func (st *failingStorage) SendMoney(context.Context, string, string, float64) error {
+	return st.err
+}
+
+func (st *failingStorage) GetLast(context.Context, int) ([]transaction.Request, error) {
+	return nil, st.err
+}
+
+func (st *failingStorage) GetHistory(context.Context, string, int) ([]transaction.Request, error) {
+	return nil, st.err
 }
 
 // Вспомогательная функция для создания тестового сервера
@@ -59,24 +101,175 @@ func generateTestAddress(prefix string) string {
 	return prefix + strings.Repeat("0", 64-len(prefix))
 }
 
+// barrierNonces accepts every nonce once, in any order. UseNonce waits
+// until n calls have arrived or a short timeout passes, so requests that
+// reach it do so together.
+type barrierNonces struct {
+	n   int
+	all chan struct{}
+
+	mu    sync.Mutex
+	calls int
+	used  map[int64]bool
+}
+
+func newBarrierNonces(n int) *barrierNonces {
+	return &barrierNonces{n: n, all: make(chan struct{}), used: make(map[int64]bool)}
+}
+
+func (b *barrierNonces) UseNonce(_ context.Context, _ string, nonce int64) error {
+	b.mu.Lock()
+	if b.calls++; b.calls == b.n {
+		close(b.all)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-b.all:
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.used[nonce] {
+		return signing.ErrNonceReused
+	}
+	b.used[nonce] = true
+	return nil
+}
+
+func (b *barrierNonces) LastNonce(context.Context, string) (int64, error) {
+	return 0, nil
+}
+
+// Тесты для CreateWalletHandler
+func TestCreateWalletHandler(t *testing.T) {
+	decode := func(t *testing.T, rr *httptest.ResponseRecorder) map[string]string {
+		var response map[string]string
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		return response
+	}
+
+	t.Run("Successful creation", func(t *testing.T) {
+		st := memory.New()
+		server := setupTestServer(t, st)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/wallet", strings.NewReader(`{}`))
+		rr := httptest.NewRecorder()
+
+		server.CreateWalletHandler(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+		response := decode(t, rr)
+		assert.Equal(t, StatusOk, response["status"])
+		assert.Len(t, response["address"], 64)
+		assert.Equal(t, "0", response["balance"])
+
+		balance, err := st.GetBalance(context.Background(), response["address"])
+		require.NoError(t, err)
+		assert.Equal(t, 0.0, balance)
+	})
+
+	t.Run("Empty body", func(t *testing.T) {
+		server := setupTestServer(t, memory.New())
+
+		rr := httptest.NewRecorder()
+		server.CreateWalletHandler(rr, httptest.NewRequest(http.MethodPost, "/api/wallet", nil))
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("Opening balance without admin", func(t *testing.T) {
+		st := memory.New()
+		server := setupTestServer(t, st)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/wallet", strings.NewReader(`{"amount": 25}`))
+		req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Scopes: []auth.Scope{auth.ScopeWalletsWrite}}))
+		rr := httptest.NewRecorder()
+
+		server.CreateWalletHandler(rr, req)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Equal(t, FundingAdmin, decode(t, rr)["message"])
+		assert.True(t, st.IsEmpty())
+	})
+
+	t.Run("Opening balance without authentication", func(t *testing.T) {
+		server := setupTestServer(t, memory.New())
+
+		rr := httptest.NewRecorder()
+		server.CreateWalletHandler(rr, httptest.NewRequest(http.MethodPost, "/api/wallet", strings.NewReader(`{"amount": 25}`)))
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Opening balance set by admin", func(t *testing.T) {
+		st := memory.New()
+		server := setupTestServer(t, st)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/wallet", strings.NewReader(`{"amount": 25}`))
+		req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Scopes: []auth.Scope{auth.ScopeAdmin}}))
+		rr := httptest.NewRecorder()
+
+		server.CreateWalletHandler(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		response := decode(t, rr)
+		assert.Equal(t, "25", response["balance"])
+
+		balance, err := st.GetBalance(context.Background(), response["address"])
+		require.NoError(t, err)
+		assert.Equal(t, 25.0, balance)
+	})
+
+	t.Run("Negative amount", func(t *testing.T) {
+		server := setupTestServer(t, memory.New())
+
+		req := httptest.NewRequest(http.MethodPost, "/api/wallet", strings.NewReader(`{"amount": -5}`))
+		rr := httptest.NewRecorder()
+
+		server.CreateWalletHandler(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, NegativeBalance, decode(t, rr)["message"])
+	})
+
+	t.Run("Address conflict", func(t *testing.T) {
+		server := setupTestServer(t, newFailingStorage(&storage.ConflictError{Address: generateTestAddress("a")}))
+
+		req := httptest.NewRequest(http.MethodPost, "/api/wallet", strings.NewReader(`{}`))
+		rr := httptest.NewRecorder()
+
+		server.CreateWalletHandler(rr, req)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		response := decode(t, rr)
+		assert.Equal(t, CodeConflict, response["code"])
+		assert.Equal(t, WalletExists, response["message"])
+	})
+}
+
 // Тесты для GetBalanceHandler
 func TestGetBalanceHandler(t *testing.T) {
-	t.Run("Successful balance retrieval", func(t *testing.T) {
-		// Создаем мок хранилища
-		store := &mockStorage{}
-		server := setupTestServer(t, store)
-
-		// Настраиваем мок
-		address := generateTestAddress("a")
-		store.On("GetBalance", address).Return(100.0, nil)
+	address := generateTestAddress("a")
 
-		// Создаем тестовый запрос
-		req := httptest.NewRequest(http.MethodGet, "/api/wallet/"+address+"/balance", nil)
+	getBalance := func(server *Server, ctx context.Context, address string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/wallet/"+address+"/balance", nil).WithContext(ctx)
 		req = mux.SetURLVars(req, map[string]string{"address": address})
 		rr := httptest.NewRecorder()
-
-		// Выполняем хендлер
 		server.GetBalanceHandler(rr, req)
+		return rr
+	}
+
+	t.Run("Successful balance retrieval", func(t *testing.T) {
+		st := memory.New()
+		require.NoError(t, st.CreateWallet(context.Background(), address, 100))
+		server := setupTestServer(t, st)
+
+		rr := getBalance(server, context.Background(), address)
 
 		// Проверяем ответ
 		assert.Equal(t, http.StatusOK, rr.Code)
@@ -90,15 +283,9 @@ func TestGetBalanceHandler(t *testing.T) {
 	})
 
 	t.Run("Invalid address length", func(t *testing.T) {
-		store := &mockStorage{}
-		server := setupTestServer(t, store)
-
-		// Создаем запрос с некорректным адресом
-		req := httptest.NewRequest(http.MethodGet, "/api/wallet/short_address/balance", nil)
-		req = mux.SetURLVars(req, map[string]string{"address": "short_address"})
-		rr := httptest.NewRecorder()
+		server := setupTestServer(t, memory.New())
 
-		server.GetBalanceHandler(rr, req)
+		rr := getBalance(server, context.Background(), "short_address")
 
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
 		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
@@ -111,40 +298,57 @@ func TestGetBalanceHandler(t *testing.T) {
 	})
 
 	t.Run("Non-existent address", func(t *testing.T) {
-		store := &mockStorage{}
-		server := setupTestServer(t, store)
+		server := setupTestServer(t, memory.New())
 
-		address := generateTestAddress("a")
-		store.On("GetBalance", address).Return(0.0, storage.ErrAddressNotExist)
-
-		req := httptest.NewRequest(http.MethodGet, "/api/wallet/"+address+"/balance", nil)
-		req = mux.SetURLVars(req, map[string]string{"address": address})
-		rr := httptest.NewRecorder()
+		rr := getBalance(server, context.Background(), address)
 
-		server.GetBalanceHandler(rr, req)
-
-		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
 		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
 
 		var response map[string]string
 		err := json.NewDecoder(rr.Body).Decode(&response)
 		assert.NoError(t, err)
 		assert.Equal(t, StatusError, response["status"])
-		assert.Equal(t, "the address is not exists", response["message"])
+		assert.Equal(t, CodeNotFound, response["code"])
+		assert.Equal(t, AddressNotExist, response["message"])
 	})
 
-	t.Run("Storage error", func(t *testing.T) {
-		store := &mockStorage{}
-		server := setupTestServer(t, store)
+	t.Run("Deadline exceeded", func(t *testing.T) {
+		server := setupTestServer(t, memory.New())
 
-		address := generateTestAddress("a")
-		store.On("GetBalance", address).Return(0.0, assert.AnError)
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
 
-		req := httptest.NewRequest(http.MethodGet, "/api/wallet/"+address+"/balance", nil)
-		req = mux.SetURLVars(req, map[string]string{"address": address})
-		rr := httptest.NewRecorder()
+		rr := getBalance(server, ctx, address)
 
-		server.GetBalanceHandler(rr, req)
+		assert.Equal(t, http.StatusGatewayTimeout, rr.Code)
+
+		var response map[string]string
+		err := json.NewDecoder(rr.Body).Decode(&response)
+		assert.NoError(t, err)
+		assert.Equal(t, CodeTimeout, response["code"])
+	})
+
+	t.Run("Cancelled request", func(t *testing.T) {
+		server := setupTestServer(t, memory.New())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		rr := getBalance(server, ctx, address)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+		var response map[string]string
+		err := json.NewDecoder(rr.Body).Decode(&response)
+		assert.NoError(t, err)
+		assert.Equal(t, CodeUnavailable, response["code"])
+	})
+
+	t.Run("Storage error", func(t *testing.T) {
+		server := setupTestServer(t, newFailingStorage(assert.AnError))
+
+		rr := getBalance(server, context.Background(), address)
 
 		assert.Equal(t, http.StatusInternalServerError, rr.Code)
 		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
@@ -159,26 +363,32 @@ func TestGetBalanceHandler(t *testing.T) {
 
 // Тесты для SendMoneyHandler
 func TestSendMoneyHandler(t *testing.T) {
-	t.Run("Successful transaction", func(t *testing.T) {
-		store := &mockStorage{}
-		server := setupTestServer(t, store)
-
-		fromAddr := generateTestAddress("a")
-		toAddr := generateTestAddress("b")
-		amount := 50.0
-
-		store.On("SendMoney", fromAddr, toAddr, amount).Return(nil)
+	fromAddr := generateTestAddress("a")
+	toAddr := generateTestAddress("b")
 
-		reqBody := transaction.Request{
-			From:   fromAddr,
-			To:     toAddr,
-			Amount: amount,
-		}
-		body, _ := json.Marshal(reqBody)
+	send := func(server *Server, body []byte) *httptest.ResponseRecorder {
 		req := httptest.NewRequest(http.MethodPost, "/api/send", bytes.NewReader(body))
 		rr := httptest.NewRecorder()
-
 		server.SendMoneyHandler(rr, req)
+		return rr
+	}
+	transfer := func(from, to string, amount float64) []byte {
+		body, _ := json.Marshal(transaction.Request{From: from, To: to, Amount: amount})
+		return body
+	}
+	// wallets returns a storage with the sender holding balance.
+	wallets := func(t *testing.T, balance float64) *memory.Storage {
+		st := memory.New()
+		require.NoError(t, st.CreateWallet(context.Background(), fromAddr, balance))
+		require.NoError(t, st.CreateWallet(context.Background(), toAddr, 0))
+		return st
+	}
+
+	t.Run("Successful transaction", func(t *testing.T) {
+		st := wallets(t, 100)
+		server := setupTestServer(t, st)
+
+		rr := send(server, transfer(fromAddr, toAddr, 50))
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
@@ -187,16 +397,16 @@ func TestSendMoneyHandler(t *testing.T) {
 		err := json.NewDecoder(rr.Body).Decode(&response)
 		assert.NoError(t, err)
 		assert.Equal(t, StatusOk, response["status"])
+
+		balance, err := st.GetBalance(context.Background(), toAddr)
+		require.NoError(t, err)
+		assert.Equal(t, 50.0, balance)
 	})
 
 	t.Run("Invalid JSON body", func(t *testing.T) {
-		store := &mockStorage{}
-		server := setupTestServer(t, store)
-
-		req := httptest.NewRequest(http.MethodPost, "/api/send", bytes.NewReader([]byte("invalid json")))
-		rr := httptest.NewRecorder()
+		server := setupTestServer(t, memory.New())
 
-		server.SendMoneyHandler(rr, req)
+		rr := send(server, []byte("invalid json"))
 
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
 		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
@@ -209,19 +419,9 @@ func TestSendMoneyHandler(t *testing.T) {
 	})
 
 	t.Run("Invalid address length", func(t *testing.T) {
-		store := &mockStorage{}
-		server := setupTestServer(t, store)
-
-		reqBody := transaction.Request{
-			From:   "short_from",
-			To:     generateTestAddress("b"),
-			Amount: 50.0,
-		}
-		body, _ := json.Marshal(reqBody)
-		req := httptest.NewRequest(http.MethodPost, "/api/send", bytes.NewReader(body))
-		rr := httptest.NewRecorder()
+		server := setupTestServer(t, memory.New())
 
-		server.SendMoneyHandler(rr, req)
+		rr := send(server, transfer("short_from", toAddr, 50))
 
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
 		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
@@ -234,19 +434,9 @@ func TestSendMoneyHandler(t *testing.T) {
 	})
 
 	t.Run("Non-positive amount", func(t *testing.T) {
-		store := &mockStorage{}
-		server := setupTestServer(t, store)
-
-		reqBody := transaction.Request{
-			From:   generateTestAddress("a"),
-			To:     generateTestAddress("b"),
-			Amount: 0,
-		}
-		body, _ := json.Marshal(reqBody)
-		req := httptest.NewRequest(http.MethodPost, "/api/send", bytes.NewReader(body))
-		rr := httptest.NewRecorder()
+		server := setupTestServer(t, memory.New())
 
-		server.SendMoneyHandler(rr, req)
+		rr := send(server, transfer(fromAddr, toAddr, 0))
 
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
 		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
@@ -259,25 +449,9 @@ func TestSendMoneyHandler(t *testing.T) {
 	})
 
 	t.Run("Non-existent address", func(t *testing.T) {
-		store := &mockStorage{}
-		server := setupTestServer(t, store)
+		server := setupTestServer(t, memory.New())
 
-		fromAddr := generateTestAddress("a")
-		toAddr := generateTestAddress("b")
-		amount := 50.0
-
-		store.On("SendMoney", fromAddr, toAddr, amount).Return(storage.ErrAddressNotExist)
-
-		reqBody := transaction.Request{
-			From:   fromAddr,
-			To:     toAddr,
-			Amount: amount,
-		}
-		body, _ := json.Marshal(reqBody)
-		req := httptest.NewRequest(http.MethodPost, "/api/send", bytes.NewReader(body))
-		rr := httptest.NewRecorder()
-
-		server.SendMoneyHandler(rr, req)
+		rr := send(server, transfer(fromAddr, toAddr, 50))
 
 		assert.Equal(t, http.StatusNotFound, rr.Code)
 		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
@@ -290,25 +464,9 @@ func TestSendMoneyHandler(t *testing.T) {
 	})
 
 	t.Run("Insufficient funds", func(t *testing.T) {
-		store := &mockStorage{}
-		server := setupTestServer(t, store)
+		server := setupTestServer(t, wallets(t, 10))
 
-		fromAddr := generateTestAddress("a")
-		toAddr := generateTestAddress("b")
-		amount := 50.0
-
-		store.On("SendMoney", fromAddr, toAddr, amount).Return(storage.ErrInsufficient)
-
-		reqBody := transaction.Request{
-			From:   fromAddr,
-			To:     toAddr,
-			Amount: amount,
-		}
-		body, _ := json.Marshal(reqBody)
-		req := httptest.NewRequest(http.MethodPost, "/api/send", bytes.NewReader(body))
-		rr := httptest.NewRecorder()
-
-		server.SendMoneyHandler(rr, req)
+		rr := send(server, transfer(fromAddr, toAddr, 50))
 
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
 		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
@@ -320,26 +478,68 @@ func TestSendMoneyHandler(t *testing.T) {
 		assert.Equal(t, "Insufficient funds in the account", response["message"])
 	})
 
-	t.Run("Storage error", func(t *testing.T) {
-		store := &mockStorage{}
-		server := setupTestServer(t, store)
-
-		fromAddr := generateTestAddress("a")
-		toAddr := generateTestAddress("b")
+	t.Run("Wrapped typed storage errors", func(t *testing.T) {
 		amount := 50.0
 
-		store.On("SendMoney", fromAddr, toAddr, amount).Return(assert.AnError)
+		cases := []struct {
+			name    string
+			err     error
+			status  int
+			code    string
+			message string
+		}{
+			{
+				name:    "not found",
+				err:     fmt.Errorf("storage.sqlite.SendMoney: %w", &storage.NotFoundError{Address: toAddr}),
+				status:  http.StatusNotFound,
+				code:    CodeNotFound,
+				message: AddressNotExist,
+			},
+			{
+				name:    "insufficient funds",
+				err:     fmt.Errorf("storage.sqlite.SendMoney: %w", &storage.InsufficientFundsError{Address: fromAddr, Available: 10, Requested: amount}),
+				status:  http.StatusBadRequest,
+				code:    CodeInsufficientFunds,
+				message: InsufficientFunds,
+			},
+			{
+				name:    "validation",
+				err:     fmt.Errorf("storage.sqlite.SendMoney: %w", &storage.ValidationError{Field: "to", Message: "sender and recipient must differ"}),
+				status:  http.StatusBadRequest,
+				code:    CodeValidation,
+				message: "sender and recipient must differ",
+			},
+			{
+				name:    "busy",
+				err:     fmt.Errorf("storage.sqlite.SendMoney: %w", fmt.Errorf("%w: database is locked", storage.ErrBusy)),
+				status:  http.StatusServiceUnavailable,
+				code:    CodeUnavailable,
+				message: StorageBusy,
+			},
+		}
+
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				server := setupTestServer(t, newFailingStorage(tc.err))
 
-		reqBody := transaction.Request{
-			From:   fromAddr,
-			To:     toAddr,
-			Amount: amount,
+				rr := send(server, transfer(fromAddr, toAddr, amount))
+
+				assert.Equal(t, tc.status, rr.Code)
+
+				var response map[string]string
+				err := json.NewDecoder(rr.Body).Decode(&response)
+				assert.NoError(t, err)
+				assert.Equal(t, StatusError, response["status"])
+				assert.Equal(t, tc.code, response["code"])
+				assert.Equal(t, tc.message, response["message"])
+			})
 		}
-		body, _ := json.Marshal(reqBody)
-		req := httptest.NewRequest(http.MethodPost, "/api/send", bytes.NewReader(body))
-		rr := httptest.NewRecorder()
+	})
 
-		server.SendMoneyHandler(rr, req)
+	t.Run("Storage error", func(t *testing.T) {
+		server := setupTestServer(t, newFailingStorage(assert.AnError))
+
+		rr := send(server, transfer(fromAddr, toAddr, 50))
 
 		assert.Equal(t, http.StatusInternalServerError, rr.Code)
 		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
@@ -354,25 +554,23 @@ func TestSendMoneyHandler(t *testing.T) {
 
 // Тесты для GetLastHandler
 func TestGetLastHandler(t *testing.T) {
-	t.Run("Successful retrieval", func(t *testing.T) {
-		store := &mockStorage{}
-		server := setupTestServer(t, store)
-
-		count := 1
-		transactions := []transaction.Request{
-			{
-				Id:     1,
-				From:   generateTestAddress("a"),
-				To:     generateTestAddress("b"),
-				Amount: 50.0,
-			},
-		}
-		store.On("GetLast", count).Return(transactions, nil)
-
-		req := httptest.NewRequest(http.MethodGet, "/api/transactions?count=1", nil)
+	getLast := func(server *Server, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/transactions?"+query, nil)
 		rr := httptest.NewRecorder()
-
 		server.GetLastHandler(rr, req)
+		return rr
+	}
+
+	t.Run("Successful retrieval", func(t *testing.T) {
+		ctx := context.Background()
+		st := memory.New()
+		require.NoError(t, st.CreateWallet(ctx, generateTestAddress("a"), 100))
+		require.NoError(t, st.CreateWallet(ctx, generateTestAddress("b"), 100))
+		require.NoError(t, st.SendMoney(ctx, generateTestAddress("a"), generateTestAddress("b"), 50))
+		require.NoError(t, st.SendMoney(ctx, generateTestAddress("b"), generateTestAddress("a"), 10))
+		server := setupTestServer(t, st)
+
+		rr := getLast(server, "count=1")
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
@@ -380,18 +578,16 @@ func TestGetLastHandler(t *testing.T) {
 		var response []transaction.Request
 		err := json.NewDecoder(rr.Body).Decode(&response)
 		assert.NoError(t, err)
-		assert.Len(t, response, 1)
-		assert.Equal(t, transactions[0], response[0])
+		require.Len(t, response, 1)
+		assert.Equal(t, 2, response[0].Id)
+		assert.Equal(t, generateTestAddress("b"), response[0].From)
+		assert.Equal(t, 10.0, response[0].Amount)
 	})
 
 	t.Run("Invalid count", func(t *testing.T) {
-		store := &mockStorage{}
-		server := setupTestServer(t, store)
-
-		req := httptest.NewRequest(http.MethodGet, "/api/transactions?count=invalid", nil)
-		rr := httptest.NewRecorder()
+		server := setupTestServer(t, memory.New())
 
-		server.GetLastHandler(rr, req)
+		rr := getLast(server, "count=invalid")
 
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
 		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
@@ -404,13 +600,9 @@ func TestGetLastHandler(t *testing.T) {
 	})
 
 	t.Run("Non-positive count", func(t *testing.T) {
-		store := &mockStorage{}
-		server := setupTestServer(t, store)
-
-		req := httptest.NewRequest(http.MethodGet, "/api/transactions?count=0", nil)
-		rr := httptest.NewRecorder()
+		server := setupTestServer(t, memory.New())
 
-		server.GetLastHandler(rr, req)
+		rr := getLast(server, "count=0")
 
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
 		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
@@ -423,16 +615,9 @@ func TestGetLastHandler(t *testing.T) {
 	})
 
 	t.Run("Storage error", func(t *testing.T) {
-		store := &mockStorage{}
-		server := setupTestServer(t, store)
-
-		count := 1
-		store.On("GetLast", count).Return([]transaction.Request{}, assert.AnError)
-
-		req := httptest.NewRequest(http.MethodGet, "/api/transactions?count=1", nil)
-		rr := httptest.NewRecorder()
+		server := setupTestServer(t, newFailingStorage(assert.AnError))
 
-		server.GetLastHandler(rr, req)
+		rr := getLast(server, "count=1")
 
 		assert.Equal(t, http.StatusInternalServerError, rr.Code)
 		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
@@ -444,3 +629,1467 @@ func TestGetLastHandler(t *testing.T) {
 		assert.Equal(t, "Internal server error", response["message"])
 	})
 }
+
+// Тесты для GetHistoryHandler
+func TestGetHistoryHandler(t *testing.T) {
+	address := generateTestAddress("a")
+
+	getHistory := func(server *Server, address, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/wallet/"+address+"/transactions?"+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"address": address})
+		rr := httptest.NewRecorder()
+		server.GetHistoryHandler(rr, req)
+		return rr
+	}
+
+	t.Run("Successful retrieval", func(t *testing.T) {
+		ctx := context.Background()
+		other := generateTestAddress("b")
+		st := memory.New()
+		require.NoError(t, st.CreateWallet(ctx, address, 100))
+		require.NoError(t, st.CreateWallet(ctx, other, 100))
+		require.NoError(t, st.CreateWallet(ctx, generateTestAddress("c"), 100))
+		require.NoError(t, st.SendMoney(ctx, address, other, 50))
+		require.NoError(t, st.SendMoney(ctx, other, generateTestAddress("c"), 5))
+		require.NoError(t, st.SendMoney(ctx, other, address, 10))
+		server := setupTestServer(t, st)
+
+		rr := getHistory(server, address, "count=5")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var response []transaction.Request
+		err := json.NewDecoder(rr.Body).Decode(&response)
+		assert.NoError(t, err)
+		require.Len(t, response, 2)
+		assert.Equal(t, 3, response[0].Id)
+		assert.Equal(t, 1, response[1].Id)
+	})
+
+	t.Run("Invalid address length", func(t *testing.T) {
+		server := setupTestServer(t, memory.New())
+
+		rr := getHistory(server, "short", "count=5")
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Invalid count", func(t *testing.T) {
+		server := setupTestServer(t, memory.New())
+
+		rr := getHistory(server, address, "count=0")
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		var response map[string]string
+		err := json.NewDecoder(rr.Body).Decode(&response)
+		assert.NoError(t, err)
+		assert.Equal(t, InvalidCount, response["message"])
+	})
+
+	t.Run("Wallet not found", func(t *testing.T) {
+		server := setupTestServer(t, memory.New())
+
+		rr := getHistory(server, address, "count=5")
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+// Тесты для timeoutMiddleware
+func TestTimeoutMiddleware(t *testing.T) {
+	server := setupTestServer(t, memory.New())
+	server.config.RequestTimeout = 50 * time.Millisecond
+
+	var deadline time.Time
+	var ok bool
+	handler := server.timeoutMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok = r.Context().Deadline()
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/transactions", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(50*time.Millisecond), deadline, 50*time.Millisecond)
+}
+
+// Тесты для ImportHandler
+func TestImportHandler(t *testing.T) {
+	fromAddr := generateTestAddress("a")
+	toAddr := generateTestAddress("b")
+	file := "from,to,amount,reference\n" + fromAddr + "," + toAddr + ",10,r1\n"
+
+	// wallets returns a storage with the sender holding balance.
+	wallets := func(t *testing.T, balance float64) *memory.Storage {
+		st := memory.New()
+		require.NoError(t, st.CreateWallet(context.Background(), fromAddr, balance))
+		require.NoError(t, st.CreateWallet(context.Background(), toAddr, 0))
+		return st
+	}
+	balance := func(t *testing.T, st *memory.Storage, address string) float64 {
+		balance, err := st.GetBalance(context.Background(), address)
+		require.NoError(t, err)
+		return balance
+	}
+
+	t.Run("Successful import", func(t *testing.T) {
+		st := wallets(t, 100)
+		server := setupTestServer(t, st)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/import", strings.NewReader(file))
+		rr := httptest.NewRecorder()
+
+		server.ImportHandler(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var report importer.Report
+		err := json.NewDecoder(rr.Body).Decode(&report)
+		assert.NoError(t, err)
+		assert.True(t, report.Valid)
+		assert.Equal(t, 1, report.Succeeded)
+		assert.Equal(t, 10.0, balance(t, st, toAddr))
+	})
+
+	t.Run("Dry run", func(t *testing.T) {
+		st := wallets(t, 100)
+		server := setupTestServer(t, st)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/import?dry_run=true", strings.NewReader(file))
+		rr := httptest.NewRecorder()
+
+		server.ImportHandler(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, 100.0, balance(t, st, fromAddr))
+	})
+
+	t.Run("Validation failure", func(t *testing.T) {
+		server := setupTestServer(t, wallets(t, 5))
+
+		req := httptest.NewRequest(http.MethodPost, "/api/import", strings.NewReader(file))
+		rr := httptest.NewRecorder()
+
+		server.ImportHandler(rr, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+		var report importer.Report
+		err := json.NewDecoder(rr.Body).Decode(&report)
+		assert.NoError(t, err)
+		assert.False(t, report.Valid)
+		assert.Equal(t, importer.StatusInvalid, report.Rows[0].Status)
+	})
+
+	t.Run("Invalid header", func(t *testing.T) {
+		server := setupTestServer(t, memory.New())
+
+		req := httptest.NewRequest(http.MethodPost, "/api/import", strings.NewReader("a,b\n"))
+		rr := httptest.NewRecorder()
+
+		server.ImportHandler(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+// Тесты для резервного копирования
+func TestBackupHandlers(t *testing.T) {
+	t.Run("Not supported by storage", func(t *testing.T) {
+		server := setupTestServer(t, memory.New())
+
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/backup", nil)
+		rr := httptest.NewRecorder()
+
+		server.CreateBackupHandler(rr, req)
+
+		assert.Equal(t, http.StatusNotImplemented, rr.Code)
+
+		var response map[string]string
+		err := json.NewDecoder(rr.Body).Decode(&response)
+		assert.NoError(t, err)
+		assert.Equal(t, CodeNotSupported, response["code"])
+	})
+
+	t.Run("Create and list", func(t *testing.T) {
+		st, err := sqlite.New(filepath.Join(t.TempDir(), "storage.db"))
+		assert.NoError(t, err)
+		defer st.Close()
+
+		cfg := &config.Config{Backup: config.Backup{Dir: filepath.Join(t.TempDir(), "backup"), Keep: 7}}
+		server := New(st, cfg, sl.SetupSlog("test"), withOperator())
+
+		rr := doRequest(server, http.MethodPost, "/api/admin/backup", operator, nil)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var created map[string]any
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+		assert.Contains(t, created["name"], "backup-")
+
+		rr = doRequest(server, http.MethodGet, "/api/admin/backups", operator, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var backups []map[string]any
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&backups))
+		if assert.Len(t, backups, 1) {
+			assert.Equal(t, created["name"], backups[0]["name"])
+		}
+	})
+
+	t.Run("Storage behind the balance cache", func(t *testing.T) {
+		st, err := sqlite.New(filepath.Join(t.TempDir(), "storage.db"))
+		assert.NoError(t, err)
+		defer st.Close()
+
+		cfg := &config.Config{Backup: config.Backup{Dir: filepath.Join(t.TempDir(), "backup"), Keep: 7}}
+		server := New(cache.New(st, 10, time.Minute), cfg, sl.SetupSlog("test"), withOperator())
+
+		rr := doRequest(server, http.MethodPost, "/api/admin/backup", operator, nil)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+	})
+}
+
+// Тесты для статистики кэша балансов
+func TestCacheStatsHandler(t *testing.T) {
+	t.Run("Cache disabled", func(t *testing.T) {
+		server := New(memory.New(), &config.Config{}, sl.SetupSlog("test"), withOperator())
+
+		rr := doRequest(server, http.MethodGet, "/api/admin/cache", operator, nil)
+
+		assert.Equal(t, http.StatusNotImplemented, rr.Code)
+	})
+
+	t.Run("Counters", func(t *testing.T) {
+		st := memory.New()
+		address := generateTestAddress("a")
+		require.NoError(t, st.CreateWallet(context.Background(), address, 100))
+		server := New(cache.New(st, 10, time.Minute), &config.Config{}, sl.SetupSlog("test"), withOperator())
+
+		for i := 0; i < 3; i++ {
+			rr := doRequest(server, http.MethodGet, "/api/wallet/"+address+"/balance", operator, nil)
+			assert.Equal(t, http.StatusOK, rr.Code)
+		}
+
+		rr := doRequest(server, http.MethodGet, "/api/admin/cache", operator, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var stats cache.Stats
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&stats))
+		assert.Equal(t, cache.Stats{Hits: 2, Misses: 1, Size: 1}, stats)
+	})
+}
+
+// Тесты для аутентификации по API-ключам
+func setupAuthServer(t *testing.T) (*Server, *auth.Service) {
+	t.Helper()
+
+	st, err := sqlite.New(filepath.Join(t.TempDir(), "storage.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { st.Close() })
+	require.NoError(t, st.CreateWallet(context.Background(), generateTestAddress("a"), 100))
+
+	cfg := &config.Config{Auth: config.Auth{Enabled: true}}
+	return New(st, cfg, sl.SetupSlog("test")), auth.NewService(st)
+}
+
+// operator is the common name of a client certificate holding the admin
+// scope. Passed to doRequest as the key, it authenticates with that
+// certificate on servers set up withOperator.
+const operator = "operator"
+
+// withOperator accepts the client certificate of operator, since admin
+// endpoints are closed while no authentication method is configured.
+func withOperator() Option {
+	return WithClientCertificates(map[string][]auth.Scope{operator: {auth.ScopeAdmin}})
+}
+
+func doRequest(server *Server, method, path, key string, body io.Reader) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, body)
+	switch key {
+	case "":
+	case operator:
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: operator}}
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+	default:
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	rr := httptest.NewRecorder()
+	server.router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	ctx := context.Background()
+	balancePath := "/api/wallet/" + generateTestAddress("a") + "/balance"
+
+	t.Run("Missing key", func(t *testing.T) {
+		server, _ := setupAuthServer(t)
+
+		rr := doRequest(server, http.MethodGet, balancePath, "", nil)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.NotEmpty(t, rr.Header().Get("WWW-Authenticate"))
+
+		var response map[string]string
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		assert.Equal(t, CodeUnauthorized, response["code"])
+	})
+
+	t.Run("Invalid key", func(t *testing.T) {
+		server, _ := setupAuthServer(t)
+
+		rr := doRequest(server, http.MethodGet, balancePath, "tpk_0123456789abcdef_secret", nil)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Scopes are enforced", func(t *testing.T) {
+		server, keys := setupAuthServer(t)
+		token, _, err := keys.Issue(ctx, "reader", []auth.Scope{auth.ScopeBalanceRead})
+		require.NoError(t, err)
+
+		rr := doRequest(server, http.MethodGet, balancePath, token, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		req := httptest.NewRequest(http.MethodGet, balancePath, nil)
+		req.Header.Set("X-API-Key", token)
+		rr = httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = doRequest(server, http.MethodPost, "/api/send", token, strings.NewReader(`{}`))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		var response map[string]string
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		assert.Equal(t, CodeForbidden, response["code"])
+
+		rr = doRequest(server, http.MethodGet, "/api/admin/keys", token, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Revoked key", func(t *testing.T) {
+		server, keys := setupAuthServer(t)
+		token, key, err := keys.Issue(ctx, "reader", []auth.Scope{auth.ScopeBalanceRead})
+		require.NoError(t, err)
+		require.NoError(t, keys.Revoke(ctx, key.ID))
+
+		rr := doRequest(server, http.MethodGet, balancePath, token, nil)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Principal is stored in the context", func(t *testing.T) {
+		server, keys := setupAuthServer(t)
+		token, key, err := keys.Issue(ctx, "reader", []auth.Scope{auth.ScopeBalanceRead})
+		require.NoError(t, err)
+
+		var principal auth.Principal
+		handler := server.requireScope(auth.ScopeBalanceRead, func(w http.ResponseWriter, r *http.Request) {
+			principal, _ = auth.FromContext(r.Context())
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		assert.Equal(t, key.ID, principal.KeyID)
+	})
+
+	t.Run("Admin endpoints without authentication", func(t *testing.T) {
+		st := memory.New()
+		require.NoError(t, st.CreateWallet(ctx, generateTestAddress("a"), 100))
+		server := setupTestServer(t, st)
+
+		rr := doRequest(server, http.MethodGet, balancePath, "", nil)
+		assert.Equal(t, http.StatusOK, rr.Code, "public endpoints stay open")
+
+		for _, route := range [][2]string{
+			{http.MethodPost, "/api/admin/keys"},
+			{http.MethodPost, "/api/admin/backup"},
+			{http.MethodPost, "/api/admin/reviews/1/approve"},
+			{http.MethodPost, "/api/admin/screening/entries"},
+		} {
+			rr := doRequest(server, route[0], route[1], "", strings.NewReader(`{}`))
+			assert.Equal(t, http.StatusForbidden, rr.Code, route[1])
+
+			var response map[string]string
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+			assert.Equal(t, AdminNotAvailable, response["message"])
+		}
+	})
+}
+
+func TestKeyHandlers(t *testing.T) {
+	server, keys := setupAuthServer(t)
+	admin, _, err := keys.Issue(context.Background(), "ops", []auth.Scope{auth.ScopeAdmin})
+	require.NoError(t, err)
+
+	rr := doRequest(server, http.MethodPost, "/api/admin/keys", admin,
+		strings.NewReader(`{"name": "payouts", "scopes": ["transfers:write", "balance:read"]}`))
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	var created createKeyResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+	assert.Equal(t, "payouts", created.Key.Name)
+
+	rr = doRequest(server, http.MethodGet, "/api/wallet/"+generateTestAddress("a")+"/balance", created.Token, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = doRequest(server, http.MethodPost, "/api/admin/keys", admin, strings.NewReader(`{"name": "bad", "scopes": ["root"]}`))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = doRequest(server, http.MethodGet, "/api/admin/keys", admin, nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var list []auth.Key
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&list))
+	assert.Len(t, list, 2)
+
+	rr = doRequest(server, http.MethodDelete, "/api/admin/keys/"+created.Key.ID, admin, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = doRequest(server, http.MethodDelete, "/api/admin/keys/missing", admin, nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = doRequest(server, http.MethodGet, "/api/wallet/"+generateTestAddress("a")+"/balance", created.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+// Тесты для подписанных переводов
+func TestSignedTransfers(t *testing.T) {
+	st := memory.New()
+	server := New(st, &config.Config{}, sl.SetupSlog("test"), WithSignedTransfers(st))
+
+	// The sender is funded directly; wallets created through the API start
+	// empty.
+	fundedWallet := func(t *testing.T) (string, ed25519.PrivateKey) {
+		keypair, err := wallet.NewService(st).CreateKeypairWallet(context.Background(), 100)
+		require.NoError(t, err)
+		key, err := hex.DecodeString(keypair.PrivateKey)
+		require.NoError(t, err)
+		return keypair.Address.Hex(), ed25519.PrivateKey(key)
+	}
+	createWallet := func(t *testing.T) string {
+		rr := doRequest(server, http.MethodPost, "/api/wallet", "", strings.NewReader(`{}`))
+		require.Equal(t, http.StatusCreated, rr.Code)
+
+		var response map[string]string
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		assert.NotEmpty(t, response["private_key"])
+		return response["address"]
+	}
+	send := func(transfer signing.Transfer, signature string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]any{
+			"from": transfer.From, "to": transfer.To, "amount": transfer.Amount,
+			"nonce": transfer.Nonce, "signature": signature,
+		})
+		return doRequest(server, http.MethodPost, "/api/send", "", bytes.NewReader(body))
+	}
+	decodeCode := func(rr *httptest.ResponseRecorder) string {
+		var response map[string]string
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		return response["code"]
+	}
+
+	from, key := fundedWallet(t)
+	to := createWallet(t)
+
+	t.Run("Valid signature", func(t *testing.T) {
+		transfer := signing.Transfer{From: from, To: to, Amount: 10, Nonce: 1}
+		rr := send(transfer, signing.Sign(key, transfer))
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		balance, err := st.GetBalance(context.Background(), from)
+		require.NoError(t, err)
+		assert.Equal(t, 90.0, balance)
+
+		rr = doRequest(server, http.MethodGet, "/api/wallet/"+from+"/nonce", "", nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var response map[string]string
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		assert.Equal(t, "1", response["nonce"])
+	})
+
+	t.Run("Replayed signature", func(t *testing.T) {
+		transfer := signing.Transfer{From: from, To: to, Amount: 10, Nonce: 1}
+		rr := send(transfer, signing.Sign(key, transfer))
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Equal(t, CodeNonceReused, decodeCode(rr))
+	})
+
+	t.Run("Invalid signature", func(t *testing.T) {
+		signed := signing.Transfer{From: from, To: to, Amount: 10, Nonce: 2}
+		tampered := signed
+		tampered.Amount = 90
+
+		rr := send(tampered, signing.Sign(key, signed))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Equal(t, CodeInvalidSignature, decodeCode(rr))
+
+		rr = send(signed, signing.Sign(key, signed))
+		assert.Equal(t, http.StatusOK, rr.Code, "a rejected signature does not use up the nonce")
+	})
+
+	t.Run("Missing signature", func(t *testing.T) {
+		rr := send(signing.Transfer{From: from, To: to, Amount: 10, Nonce: 5}, "")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Import is disabled", func(t *testing.T) {
+		rr := doRequest(server, http.MethodPost, "/api/import", "", strings.NewReader("from,to,amount,reference\n"))
+		assert.Equal(t, http.StatusNotImplemented, rr.Code)
+	})
+
+	t.Run("Nonce endpoint without signed transfers", func(t *testing.T) {
+		unsigned := setupTestServer(t, memory.New())
+		rr := doRequest(unsigned, http.MethodGet, "/api/wallet/"+from+"/nonce", "", nil)
+		assert.Equal(t, http.StatusNotImplemented, rr.Code)
+	})
+}
+
+// Тесты для аутентификации по JWT и владения кошельками
+func TestJWTAuthorization(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+	ctx := context.Background()
+	owned, other := generateTestAddress("a"), generateTestAddress("b")
+
+	st := memory.New()
+	require.NoError(t, st.CreateWallet(ctx, owned, 100))
+	require.NoError(t, st.CreateWallet(ctx, other, 100))
+
+	verifier, err := auth.NewJWTVerifier(config.JWT{Enabled: true, HMACSecret: secret})
+	require.NoError(t, err)
+	server := New(st, &config.Config{}, sl.SetupSlog("test"), WithJWT(verifier))
+
+	token := func(t *testing.T, wallets ...string) string {
+		claims := auth.Claims{Wallets: wallets}
+		claims.Subject = "user-1"
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		require.NoError(t, err)
+		return signed
+	}
+	decodeCode := func(t *testing.T, rr *httptest.ResponseRecorder) string {
+		var response map[string]string
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		return response["code"]
+	}
+	send := func(key, from, to string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"from": %q, "to": %q, "amount": 10}`, from, to)
+		return doRequest(server, http.MethodPost, "/api/send", key, strings.NewReader(body))
+	}
+
+	t.Run("Missing or invalid token", func(t *testing.T) {
+		rr := doRequest(server, http.MethodGet, "/api/wallet/"+owned+"/balance", "", nil)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		rr = doRequest(server, http.MethodGet, "/api/wallet/"+owned+"/balance", "not.a.token", nil)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Equal(t, CodeUnauthorized, decodeCode(t, rr))
+
+		rr = doRequest(server, http.MethodGet, "/api/wallet/"+owned+"/balance", "tpk_0123456789abcdef_secret", nil)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code, "API keys are off without auth.enabled")
+	})
+
+	t.Run("Owned wallet", func(t *testing.T) {
+		key := token(t, owned)
+
+		rr := doRequest(server, http.MethodGet, "/api/wallet/"+owned+"/balance", key, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = send(key, owned, other)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = doRequest(server, http.MethodGet, "/api/wallet/"+owned+"/transactions?count=5", key, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("Wallet of another owner", func(t *testing.T) {
+		key := token(t, owned)
+
+		for _, rr := range []*httptest.ResponseRecorder{
+			doRequest(server, http.MethodGet, "/api/wallet/"+other+"/balance", key, nil),
+			doRequest(server, http.MethodGet, "/api/wallet/"+other+"/transactions?count=5", key, nil),
+			send(key, other, owned),
+		} {
+			assert.Equal(t, http.StatusForbidden, rr.Code)
+			assert.Equal(t, CodeForbidden, decodeCode(t, rr))
+		}
+
+		balance, err := st.GetBalance(ctx, other)
+		require.NoError(t, err)
+		assert.Equal(t, 110.0, balance, "the rejected transfer was not executed")
+	})
+
+	t.Run("Global endpoints", func(t *testing.T) {
+		key := token(t, owned)
+
+		rr := doRequest(server, http.MethodGet, "/api/transactions?count=5", key, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = doRequest(server, http.MethodPost, "/api/import", key, strings.NewReader("from,to,amount,reference\n"))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = doRequest(server, http.MethodPost, "/api/wallet", key, strings.NewReader(`{"amount": 1}`))
+		assert.Equal(t, http.StatusForbidden, rr.Code, "bearer tokens lack wallets:write by default")
+	})
+}
+
+// Тесты для ограничения частоты запросов
+func TestRateLimits(t *testing.T) {
+	ctx := context.Background()
+	from, to := generateTestAddress("a"), generateTestAddress("b")
+
+	newServer := func(t *testing.T, st storage.Repository, cfg *config.Config, client, wallet *ratelimit.Limiter) *Server {
+		return New(st, cfg, sl.SetupSlog("test"), WithRateLimits(client, wallet))
+	}
+	decodeCode := func(t *testing.T, rr *httptest.ResponseRecorder) string {
+		var response map[string]string
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		return response["code"]
+	}
+
+	t.Run("Per client IP", func(t *testing.T) {
+		server := newServer(t, memory.New(), &config.Config{}, ratelimit.New(1, 2), nil)
+		request := func(remoteAddr string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/api/transactions?count=1", nil)
+			req.RemoteAddr = remoteAddr
+			rr := httptest.NewRecorder()
+			server.router.ServeHTTP(rr, req)
+			return rr
+		}
+
+		rr := request("192.0.2.1:1000")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "2", rr.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "1", rr.Header().Get("RateLimit-Remaining"))
+		request("192.0.2.1:1001")
+
+		rr = request("192.0.2.1:1002")
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+		assert.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "2", rr.Header().Get("RateLimit-Reset"))
+		assert.Equal(t, CodeRateLimited, decodeCode(t, rr))
+
+		rr = request("192.0.2.2:1000")
+		assert.Equal(t, http.StatusOK, rr.Code, "another IP has its own bucket")
+	})
+
+	t.Run("Per API key", func(t *testing.T) {
+		st, err := sqlite.New(filepath.Join(t.TempDir(), "storage.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { st.Close() })
+		require.NoError(t, st.CreateWallet(ctx, from, 100))
+
+		server := newServer(t, st, &config.Config{Auth: config.Auth{Enabled: true}}, ratelimit.New(1, 1), nil)
+		keys := auth.NewService(st)
+		first, _, err := keys.Issue(ctx, "first", []auth.Scope{auth.ScopeBalanceRead})
+		require.NoError(t, err)
+		second, _, err := keys.Issue(ctx, "second", []auth.Scope{auth.ScopeBalanceRead})
+		require.NoError(t, err)
+
+		balancePath := "/api/wallet/" + from + "/balance"
+		assert.Equal(t, http.StatusOK, doRequest(server, http.MethodGet, balancePath, first, nil).Code)
+		assert.Equal(t, http.StatusTooManyRequests, doRequest(server, http.MethodGet, balancePath, first, nil).Code)
+		assert.Equal(t, http.StatusOK, doRequest(server, http.MethodGet, balancePath, second, nil).Code,
+			"clients behind one IP are limited per key")
+	})
+
+	t.Run("Failed authentication is charged to the IP", func(t *testing.T) {
+		st, err := sqlite.New(filepath.Join(t.TempDir(), "storage.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { st.Close() })
+
+		server := newServer(t, st, &config.Config{Auth: config.Auth{Enabled: true}}, ratelimit.New(1, 2), nil)
+		token, _, err := auth.NewService(st).Issue(ctx, "valid", []auth.Scope{auth.ScopeAdmin})
+		require.NoError(t, err)
+
+		for range 2 {
+			rr := doRequest(server, http.MethodGet, "/api/admin/keys", "tpk_0123456789abcdef_secret", nil)
+			assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		}
+		rr := doRequest(server, http.MethodGet, "/api/admin/keys", "tpk_0123456789abcdef_secret", nil)
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+
+		rr = doRequest(server, http.MethodGet, "/api/admin/keys", token, nil)
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code, "the IP is blocked until its bucket refills")
+	})
+
+	t.Run("Per source wallet", func(t *testing.T) {
+		st := memory.New()
+		require.NoError(t, st.CreateWallet(ctx, from, 100))
+		require.NoError(t, st.CreateWallet(ctx, to, 100))
+
+		server := newServer(t, st, &config.Config{}, ratelimit.New(100, 100), ratelimit.New(1, 1))
+		send := func(from, to string) *httptest.ResponseRecorder {
+			body := fmt.Sprintf(`{"from": %q, "to": %q, "amount": 1}`, from, to)
+			return doRequest(server, http.MethodPost, "/api/send", "", strings.NewReader(body))
+		}
+
+		rr := send(from, to)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "1", rr.Header().Get("RateLimit-Limit"), "the stricter limit is reported")
+		assert.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+
+		rr = send(strings.ToUpper(from), to)
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+
+		assert.Equal(t, http.StatusOK, send(to, from).Code)
+
+		balance, err := st.GetBalance(ctx, from)
+		require.NoError(t, err)
+		assert.Equal(t, 100.0, balance)
+	})
+
+	t.Run("Unverified transfers are not charged", func(t *testing.T) {
+		st := memory.New()
+		keypair, err := wallet.NewService(st).CreateKeypairWallet(ctx, 100)
+		require.NoError(t, err)
+		require.NoError(t, st.CreateWallet(ctx, to, 0))
+		key, err := hex.DecodeString(keypair.PrivateKey)
+		require.NoError(t, err)
+		sender := keypair.Address.Hex()
+
+		server := New(st, &config.Config{}, sl.SetupSlog("test"),
+			WithSignedTransfers(st), WithRateLimits(nil, ratelimit.New(0.001, 2)))
+		send := func(transfer signing.Transfer, signature string) *httptest.ResponseRecorder {
+			body, _ := json.Marshal(map[string]any{
+				"from": transfer.From, "to": transfer.To, "amount": transfer.Amount,
+				"nonce": transfer.Nonce, "signature": signature,
+			})
+			return doRequest(server, http.MethodPost, "/api/send", "", bytes.NewReader(body))
+		}
+
+		transfer := signing.Transfer{From: sender, To: to, Amount: 1, Nonce: 1}
+		for range 3 {
+			assert.Equal(t, http.StatusBadRequest, send(transfer, "").Code)
+			assert.Equal(t, http.StatusForbidden, send(transfer, strings.Repeat("00", 64)).Code)
+		}
+
+		signed := func(nonce int64) (signing.Transfer, string) {
+			transfer := signing.Transfer{From: sender, To: to, Amount: 1, Nonce: nonce}
+			return transfer, signing.Sign(ed25519.PrivateKey(key), transfer)
+		}
+		assert.Equal(t, http.StatusOK, send(signed(1)).Code)
+		for range 3 {
+			assert.Equal(t, http.StatusConflict, send(signed(1)).Code, "replays are not charged")
+		}
+		assert.Equal(t, http.StatusOK, send(signed(2)).Code)
+		assert.Equal(t, http.StatusTooManyRequests, send(signed(3)).Code)
+
+		nonce, err := st.LastNonce(ctx, sender)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), nonce, "a rate-limited transfer does not use up its nonce")
+	})
+
+	t.Run("Concurrent transfers keep the nonces of rejected ones", func(t *testing.T) {
+		st := memory.New()
+		keypair, err := wallet.NewService(st).CreateKeypairWallet(ctx, 100)
+		require.NoError(t, err)
+		require.NoError(t, st.CreateWallet(ctx, to, 0))
+		key, err := hex.DecodeString(keypair.PrivateKey)
+		require.NoError(t, err)
+		sender := keypair.Address.Hex()
+
+		const requests = 5
+		nonces := newBarrierNonces(requests)
+		server := New(st, &config.Config{}, sl.SetupSlog("test"),
+			WithSignedTransfers(nonces), WithRateLimits(nil, ratelimit.New(0.001, 2)))
+
+		codes := make([]int, requests)
+		var wg sync.WaitGroup
+		for i := range requests {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				transfer := signing.Transfer{From: sender, To: to, Amount: 1, Nonce: int64(i + 1)}
+				body, _ := json.Marshal(map[string]any{
+					"from": transfer.From, "to": transfer.To, "amount": transfer.Amount,
+					"nonce": transfer.Nonce, "signature": signing.Sign(ed25519.PrivateKey(key), transfer),
+				})
+				codes[i] = doRequest(server, http.MethodPost, "/api/send", "", bytes.NewReader(body)).Code
+			}()
+		}
+		wg.Wait()
+
+		ok := 0
+		for _, code := range codes {
+			if code == http.StatusOK {
+				ok++
+			} else {
+				assert.Equal(t, http.StatusTooManyRequests, code)
+			}
+		}
+		assert.Equal(t, 2, ok)
+		assert.Len(t, nonces.used, ok, "only executed transfers use up their nonce")
+	})
+
+	t.Run("Import is charged per sending wallet", func(t *testing.T) {
+		st := memory.New()
+		require.NoError(t, st.CreateWallet(ctx, from, 100))
+		require.NoError(t, st.CreateWallet(ctx, to, 100))
+
+		server := newServer(t, st, &config.Config{}, nil, ratelimit.New(1, 2))
+		csv := func(rows int) io.Reader {
+			var b strings.Builder
+			b.WriteString("from,to,amount,reference\n")
+			for i := range rows {
+				fmt.Fprintf(&b, "%s,%s,1,ref-%d\n", from, to, i)
+			}
+			return strings.NewReader(b.String())
+		}
+
+		assert.Equal(t, http.StatusTooManyRequests, doRequest(server, http.MethodPost, "/api/import", "", csv(3)).Code)
+		assert.Equal(t, http.StatusOK, doRequest(server, http.MethodPost, "/api/import?dry_run=true", "", csv(2)).Code,
+			"dry runs are not charged")
+		assert.Equal(t, http.StatusOK, doRequest(server, http.MethodPost, "/api/import", "", csv(2)).Code)
+
+		rr := doRequest(server, http.MethodPost, "/api/send", "",
+			strings.NewReader(fmt.Sprintf(`{"from": %q, "to": %q, "amount": 1}`, from, to)))
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code, "the import used up the wallet limit")
+
+		balance, err := st.GetBalance(ctx, from)
+		require.NoError(t, err)
+		assert.Equal(t, 98.0, balance)
+	})
+}
+
+// Тесты для аутентификации по клиентским сертификатам
+func TestClientCertificateAuth(t *testing.T) {
+	ctx := context.Background()
+	address := generateTestAddress("a")
+
+	st := memory.New()
+	require.NoError(t, st.CreateWallet(ctx, address, 100))
+	server := New(st, &config.Config{}, sl.SetupSlog("test"), WithClientCertificates(map[string][]auth.Scope{
+		"reporting": {auth.ScopeBalanceRead},
+	}))
+
+	request := func(path string, state *tls.ConnectionState) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.TLS = state
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+		return rr
+	}
+	verified := func(cn string) *tls.ConnectionState {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+		return &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		}
+	}
+
+	balancePath := "/api/wallet/" + address + "/balance"
+
+	rr := request(balancePath, verified("reporting"))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = request("/api/transactions?count=1", verified("reporting"))
+	assert.Equal(t, http.StatusForbidden, rr.Code, "scopes of the certificate are enforced")
+
+	rr = request(balancePath, verified("unknown"))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	unverified := verified("reporting")
+	unverified.VerifiedChains = nil
+	rr = request(balancePath, unverified)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code, "unverified certificates are ignored")
+
+	rr = request(balancePath, nil)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+// Тесты для проверки цепочки хэшей транзакций
+func TestVerifyChainHandler(t *testing.T) {
+	t.Run("Not supported by storage", func(t *testing.T) {
+		server := New(memory.New(), &config.Config{}, sl.SetupSlog("test"), withOperator())
+
+		rr := doRequest(server, http.MethodGet, "/api/admin/chain/verify", operator, nil)
+		assert.Equal(t, http.StatusNotImplemented, rr.Code)
+	})
+
+	st, err := sqlite.New(filepath.Join(t.TempDir(), "storage.db"))
+	require.NoError(t, err)
+	defer st.Close()
+
+	ctx := context.Background()
+	a, b := generateTestAddress("a"), generateTestAddress("b")
+	require.NoError(t, st.CreateWallet(ctx, a, 100))
+	require.NoError(t, st.CreateWallet(ctx, b, 100))
+	require.NoError(t, st.SendMoney(ctx, a, b, 10))
+	require.NoError(t, st.SendMoney(ctx, b, a, 5))
+
+	pub, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	head, err := st.ChainHead(ctx)
+	require.NoError(t, err)
+	_, err = st.SaveCheckpoint(ctx, hashchain.Sign(key, head, time.Now()))
+	require.NoError(t, err)
+
+	verify := func(key ed25519.PublicKey) hashchain.Report {
+		server := New(cache.New(st, 10, time.Minute), &config.Config{}, sl.SetupSlog("test"), WithChainKey(key), withOperator())
+		rr := doRequest(server, http.MethodGet, "/api/admin/chain/verify", operator, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var report hashchain.Report
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&report))
+		return report
+	}
+
+	t.Run("Valid chain", func(t *testing.T) {
+		report := verify(pub)
+		assert.True(t, report.Valid)
+		assert.Equal(t, 2, report.Checked)
+		assert.Equal(t, 1, report.Checkpoints)
+		assert.Equal(t, head, report.Head)
+	})
+
+	t.Run("Checkpoint of another key", func(t *testing.T) {
+		other, _, err := ed25519.GenerateKey(nil)
+		require.NoError(t, err)
+
+		report := verify(other)
+		assert.False(t, report.Valid)
+		if assert.NotNil(t, report.Broken) {
+			assert.Equal(t, hashchain.ReasonCheckpointSigning, report.Broken.Reason)
+		}
+	})
+}
+
+// Тесты для форматов адресов кошельков
+func TestWalletAddressFormats(t *testing.T) {
+	st := memory.New()
+	server := setupTestServer(t, st)
+
+	request := func(method, path string, body any) *httptest.ResponseRecorder {
+		var reader io.Reader
+		if body != nil {
+			data, err := json.Marshal(body)
+			require.NoError(t, err)
+			reader = bytes.NewReader(data)
+		}
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, httptest.NewRequest(method, path, reader))
+		return rr
+	}
+
+	createWallet := func() (string, string) {
+		rr := request(http.MethodPost, "/api/wallet", nil)
+		require.Equal(t, http.StatusCreated, rr.Code)
+		var resp map[string]string
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		return resp["address"], resp["checksum_address"]
+	}
+
+	fromHex, fromChecksum := createWallet()
+	toHex, toChecksum := createWallet()
+	// Wallets created through the API start empty, so the sender is funded
+	// from a seeded wallet.
+	require.NoError(t, st.CreateWallet(context.Background(), generateTestAddress("f"), 100))
+	require.NoError(t, st.SendMoney(context.Background(), generateTestAddress("f"), fromHex, 100))
+	assert.Len(t, fromHex, 64)
+	assert.True(t, strings.HasPrefix(fromChecksum, address.Prefix+"1"))
+	parsed, err := address.Parse(fromChecksum)
+	require.NoError(t, err)
+	assert.Equal(t, fromHex, parsed.Hex())
+
+	t.Run("Checksummed and uppercase addresses are accepted", func(t *testing.T) {
+		rr := request(http.MethodPost, "/api/send", map[string]any{"from": fromChecksum, "to": strings.ToUpper(toHex), "amount": 10})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		for _, adr := range []string{fromChecksum, strings.ToUpper(fromChecksum), fromHex} {
+			rr = request(http.MethodGet, "/api/wallet/"+adr+"/balance", nil)
+			require.Equal(t, http.StatusOK, rr.Code, adr)
+			var resp map[string]string
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+			assert.Equal(t, "90", resp["balance"], adr)
+		}
+
+		rr = request(http.MethodGet, "/api/wallet/"+toChecksum+"/transactions?count=5", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var history []transaction.Request
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&history))
+		if assert.Len(t, history, 1) {
+			assert.Equal(t, fromHex, history[0].From, "transactions keep the hex form")
+		}
+	})
+
+	t.Run("Invalid addresses are rejected", func(t *testing.T) {
+		typo := []byte(toChecksum)
+		typo[10] = 'q'
+		if toChecksum[10] == 'q' {
+			typo[10] = 'p'
+		}
+
+		for name, adr := range map[string]string{
+			"not hex":      strings.Repeat("z", 64),
+			"typo":         string(typo),
+			"other prefix": "bc1" + toChecksum[4:],
+		} {
+			rr := request(http.MethodPost, "/api/send", map[string]any{"from": fromHex, "to": adr, "amount": 1})
+			assert.Equal(t, http.StatusBadRequest, rr.Code, name)
+
+			rr = request(http.MethodGet, "/api/wallet/"+adr+"/balance", nil)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, name)
+		}
+	})
+}
+
+// Тесты для правил оценки рисков и очереди проверки
+func TestRiskRules(t *testing.T) {
+	ctx := context.Background()
+	a, b, c := generateTestAddress("a"), generateTestAddress("b"), generateTestAddress("c")
+
+	setup := func(t *testing.T) (*Server, *memory.Storage) {
+		st := memory.New()
+		require.NoError(t, st.CreateWallet(ctx, a, 100))
+		require.NoError(t, st.CreateWallet(ctx, b, 100))
+		require.NoError(t, st.CreateWallet(ctx, c, 100))
+		require.NoError(t, st.SendMoney(ctx, b, a, 5))
+
+		engine, err := risk.NewEngine(config.Risk{HistoryLimit: 10, Rules: []config.RiskRule{
+			{Name: "large", Type: risk.TypeNewWalletLargeAmount, Action: risk.ActionDeny, Amount: 50, MinAge: time.Hour},
+			{Name: "back", Type: risk.TypeRoundTrip, Action: risk.ActionHold, Window: time.Hour},
+		}}, st)
+		require.NoError(t, err)
+		svc, err := risk.NewService(engine, st, st)
+		require.NoError(t, err)
+
+		return New(st, &config.Config{}, sl.SetupSlog("test"), WithRisk(svc), withOperator()), st
+	}
+
+	send := func(server *Server, to string, amount float64) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]any{"from": a, "to": to, "amount": amount})
+		return doRequest(server, http.MethodPost, "/api/send", operator, bytes.NewReader(body))
+	}
+
+	t.Run("Allowed transfer", func(t *testing.T) {
+		server, st := setup(t)
+
+		rr := send(server, c, 10)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		balance, _ := st.GetBalance(ctx, c)
+		assert.Equal(t, 110.0, balance)
+	})
+
+	t.Run("Denied transfer", func(t *testing.T) {
+		server, st := setup(t)
+
+		rr := send(server, c, 60)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		var response map[string]string
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		assert.Equal(t, CodeTransferDenied, response["code"])
+		balance, _ := st.GetBalance(ctx, a)
+		assert.Equal(t, 105.0, balance)
+	})
+
+	t.Run("Held transfer is approved", func(t *testing.T) {
+		server, st := setup(t)
+
+		rr := send(server, b, 10)
+		require.Equal(t, http.StatusAccepted, rr.Code)
+		var held heldResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&held))
+		assert.Equal(t, StatusHeld, held.Status)
+		assert.Equal(t, "back", held.Rule)
+
+		balance, _ := st.GetBalance(ctx, a)
+		assert.Equal(t, 105.0, balance, "held transfer is not executed")
+
+		rr = doRequest(server, http.MethodGet, "/api/admin/reviews?status=pending", operator, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var reviews []risk.Review
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&reviews))
+		if assert.Len(t, reviews, 1) {
+			assert.Equal(t, held.ReviewID, reviews[0].ID)
+		}
+
+		path := fmt.Sprintf("/api/admin/reviews/%d/approve", held.ReviewID)
+		rr = doRequest(server, http.MethodPost, path, operator, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		balance, _ = st.GetBalance(ctx, a)
+		assert.Equal(t, 95.0, balance)
+
+		rr = doRequest(server, http.MethodPost, path, operator, nil)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("Held transfer is rejected", func(t *testing.T) {
+		server, st := setup(t)
+
+		require.Equal(t, http.StatusAccepted, send(server, b, 10).Code)
+
+		rr := doRequest(server, http.MethodPost, "/api/admin/reviews/1/reject", operator, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		balance, _ := st.GetBalance(ctx, a)
+		assert.Equal(t, 105.0, balance)
+
+		rr = doRequest(server, http.MethodPost, "/api/admin/reviews/2/reject", operator, nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		rr = doRequest(server, http.MethodPost, "/api/admin/reviews/x/reject", operator, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Import rejects rows", func(t *testing.T) {
+		server, _ := setup(t)
+
+		csv := "from,to,amount,reference\n" + a + "," + b + ",10,r1\n"
+		rr := doRequest(server, http.MethodPost, "/api/import", operator, strings.NewReader(csv))
+		require.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		var report importer.Report
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&report))
+		assert.Contains(t, report.Rows[0].Error, "held by risk rule back")
+	})
+
+	t.Run("Rules not configured", func(t *testing.T) {
+		server := New(memory.New(), &config.Config{}, sl.SetupSlog("test"), withOperator())
+
+		rr := doRequest(server, http.MethodGet, "/api/admin/reviews", operator, nil)
+		assert.Equal(t, http.StatusNotImplemented, rr.Code)
+		rr = doRequest(server, http.MethodPost, "/api/admin/reviews/1/approve", operator, nil)
+		assert.Equal(t, http.StatusNotImplemented, rr.Code)
+	})
+}
+
+// Тесты для проверки адресов по спискам блокировки
+func TestScreening(t *testing.T) {
+	ctx := context.Background()
+	a, b, c := generateTestAddress("a"), generateTestAddress("b"), generateTestAddress("c")
+
+	setup := func(t *testing.T) (*Server, *memory.Storage, string) {
+		st := memory.New()
+		require.NoError(t, st.CreateWallet(ctx, a, 100))
+		require.NoError(t, st.CreateWallet(ctx, b, 100))
+		require.NoError(t, st.CreateWallet(ctx, c, 100))
+
+		block := filepath.Join(t.TempDir(), "block.txt")
+		require.NoError(t, os.WriteFile(block, []byte(b+" # sanctioned\n"), 0o644))
+
+		screener := screening.New(st, config.Screening{Enabled: true, BlockFiles: []string{block}}, sl.SetupSlog("test"))
+		_, err := screener.Load(ctx)
+		require.NoError(t, err)
+
+		return New(st, &config.Config{}, sl.SetupSlog("test"), WithScreening(screener), withOperator()), st, block
+	}
+
+	send := func(server *Server, from, to string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]any{"from": from, "to": to, "amount": 10})
+		return doRequest(server, http.MethodPost, "/api/send", operator, bytes.NewReader(body))
+	}
+	decodeCode := func(rr *httptest.ResponseRecorder) string {
+		var response map[string]string
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		return response["code"]
+	}
+
+	t.Run("Blocked transfers", func(t *testing.T) {
+		server, st, block := setup(t)
+
+		assert.Equal(t, http.StatusOK, send(server, a, c).Code)
+
+		rr := send(server, a, b)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Equal(t, CodeAddressBlocked, decodeCode(rr))
+		rr = send(server, b, a)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		balance, _ := st.GetBalance(ctx, b)
+		assert.Equal(t, 100.0, balance)
+
+		rr = doRequest(server, http.MethodGet, "/api/admin/screening/hits", operator, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var hits []screening.Hit
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&hits))
+		if assert.Len(t, hits, 2) {
+			assert.Equal(t, b, hits[0].From)
+			assert.Equal(t, block, hits[0].Source)
+		}
+	})
+
+	t.Run("Manage entries", func(t *testing.T) {
+		server, _, _ := setup(t)
+
+		body := `{"list": "block", "address": "` + strings.ToUpper(c) + `", "note": "fraud report"}`
+		rr := doRequest(server, http.MethodPost, "/api/admin/screening/entries", operator, strings.NewReader(body))
+		require.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, http.StatusForbidden, send(server, a, c).Code)
+
+		rr = doRequest(server, http.MethodGet, "/api/admin/screening/entries?list=block", operator, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var entries []screening.Entry
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&entries))
+		assert.Len(t, entries, 2)
+
+		rr = doRequest(server, http.MethodDelete, "/api/admin/screening/entries/block/"+c, operator, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, http.StatusOK, send(server, a, c).Code)
+
+		rr = doRequest(server, http.MethodDelete, "/api/admin/screening/entries/block/"+c, operator, nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		rr = doRequest(server, http.MethodDelete, "/api/admin/screening/entries/block/"+b, operator, nil)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		for _, body := range []string{`{"list": "deny", "address": "` + c + `"}`, `{"list": "allow", "address": "zz"}`} {
+			rr = doRequest(server, http.MethodPost, "/api/admin/screening/entries", operator, strings.NewReader(body))
+			assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+		}
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		server, _, block := setup(t)
+
+		require.NoError(t, os.WriteFile(block, []byte(c+"\n"), 0o644))
+		rr := doRequest(server, http.MethodPost, "/api/admin/screening/reload", operator, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, http.StatusOK, send(server, a, b).Code)
+		assert.Equal(t, http.StatusForbidden, send(server, a, c).Code)
+
+		require.NoError(t, os.WriteFile(block, []byte("garbage\n"), 0o644))
+		rr = doRequest(server, http.MethodPost, "/api/admin/screening/reload", operator, nil)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Equal(t, http.StatusForbidden, send(server, a, c).Code, "previous lists are kept")
+	})
+
+	t.Run("Not enabled", func(t *testing.T) {
+		server := New(memory.New(), &config.Config{}, sl.SetupSlog("test"), withOperator())
+
+		rr := doRequest(server, http.MethodGet, "/api/admin/screening/entries", operator, nil)
+		assert.Equal(t, http.StatusNotImplemented, rr.Code)
+	})
+}
+
+// Тесты для корректной остановки сервера
+func TestServerShutdown(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	server := New(memory.New(), &config.Config{HTTPServer: config.HTTPServer{Address: addr}}, sl.SetupSlog("test"))
+	started, release := make(chan struct{}), make(chan struct{})
+	server.router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+
+	served := make(chan error, 1)
+	go func() { served <- server.Start() }()
+
+	response := make(chan string, 1)
+	go func() {
+		var resp *http.Response
+		var err error
+		for i := 0; i < 50; i++ {
+			if resp, err = http.Get("http://" + addr + "/slow"); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if err != nil {
+			response <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		response <- string(body)
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- server.Shutdown(context.Background()) }()
+
+	select {
+	case <-shutdown:
+		t.Fatal("shutdown returned before the request finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	_, err = http.Get("http://" + addr + "/slow")
+	assert.Error(t, err, "new connections are refused")
+
+	close(release)
+	assert.Equal(t, "done", <-response)
+	assert.NoError(t, <-shutdown)
+	assert.ErrorIs(t, <-served, http.ErrServerClosed)
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	server := New(memory.New(), &config.Config{HTTPServer: config.HTTPServer{Address: addr}}, sl.SetupSlog("test"))
+	started := make(chan struct{})
+	var returned atomic.Bool
+	server.router.HandleFunc("/stuck", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+		// The handler keeps working for a while after it is cut off.
+		time.Sleep(50 * time.Millisecond)
+		returned.Store(true)
+	})
+	go server.Start()
+
+	go func() {
+		for i := 0; i < 50; i++ {
+			if resp, err := http.Get("http://" + addr + "/stuck"); err == nil {
+				resp.Body.Close()
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, server.Shutdown(ctx), context.DeadlineExceeded)
+
+	wait, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, server.Wait(wait))
+	assert.True(t, returned.Load())
+}
+
+// Тесты для проб живости и готовности
+func TestHealthProbes(t *testing.T) {
+	t.Run("Liveness without credentials", func(t *testing.T) {
+		st, err := sqlite.New(filepath.Join(t.TempDir(), "storage.db"))
+		require.NoError(t, err)
+		defer st.Close()
+		server := New(st, &config.Config{Auth: config.Auth{Enabled: true}}, sl.SetupSlog("test"))
+
+		rr := doRequest(server, http.MethodGet, "/healthz", "", nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), StatusOk)
+
+		rr = doRequest(server, http.MethodGet, "/readyz", "", nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("Not ready until started", func(t *testing.T) {
+		checker := health.New(time.Second)
+		checker.Add("database", func(context.Context) error { return nil })
+		server := New(memory.New(), &config.Config{}, sl.SetupSlog("test"), WithHealth(checker))
+
+		rr := doRequest(server, http.MethodGet, "/readyz", "", nil)
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+		var report health.Report
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&report))
+		assert.Equal(t, health.StatusNotReady, report.Status)
+		require.Len(t, report.Checks, 2)
+		assert.Equal(t, "startup", report.Checks[0].Name)
+		assert.Equal(t, health.CheckFail, report.Checks[0].Status)
+		assert.Equal(t, health.CheckOK, report.Checks[1].Status)
+
+		checker.MarkStarted()
+		rr = doRequest(server, http.MethodGet, "/readyz", "", nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&report))
+		assert.True(t, report.Ready())
+	})
+
+	t.Run("Failing check", func(t *testing.T) {
+		maintenance := filepath.Join(t.TempDir(), "maintenance")
+		require.NoError(t, os.WriteFile(maintenance, nil, 0o644))
+
+		checker := health.New(time.Second)
+		checker.MarkStarted()
+		checker.Add("maintenance", health.Maintenance(maintenance))
+		server := New(memory.New(), &config.Config{}, sl.SetupSlog("test"), WithHealth(checker))
+
+		rr := doRequest(server, http.MethodGet, "/readyz", "", nil)
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		assert.Contains(t, rr.Body.String(), health.ErrMaintenance.Error())
+
+		rr = doRequest(server, http.MethodGet, "/healthz", "", nil)
+		assert.Equal(t, http.StatusOK, rr.Code, "liveness ignores readiness")
+	})
+}
+
+// Тесты для метрик Prometheus
+func TestMetricsEndpoint(t *testing.T) {
+	t.Run("Requests by route template", func(t *testing.T) {
+		st := memory.New()
+		require.NoError(t, st.CreateWallet(context.Background(), generateTestAddress("a"), 100))
+		server := New(st, &config.Config{}, sl.SetupSlog("test"), WithMetrics(metrics.New()))
+
+		rr := doRequest(server, http.MethodGet, "/api/wallet/"+generateTestAddress("a")+"/balance", "", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		rr = doRequest(server, http.MethodGet, "/api/wallet/"+generateTestAddress("b")+"/balance", "", nil)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+
+		rr = doRequest(server, http.MethodGet, "/metrics", "", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		body := rr.Body.String()
+		assert.Contains(t, body, `transaction_service_http_requests_total{method="GET",route="/api/wallet/{address}/balance",status="200"} 1`)
+		assert.Contains(t, body, `transaction_service_http_requests_total{method="GET",route="/api/wallet/{address}/balance",status="404"} 1`)
+		assert.NotContains(t, body, generateTestAddress("a"))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		server := setupTestServer(t, memory.New())
+		rr := doRequest(server, http.MethodGet, "/metrics", "", nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Requires the metrics scope", func(t *testing.T) {
+		st, err := sqlite.New(filepath.Join(t.TempDir(), "storage.db"))
+		require.NoError(t, err)
+		defer st.Close()
+		server := New(st, &config.Config{Auth: config.Auth{Enabled: true}}, sl.SetupSlog("test"), WithMetrics(metrics.New()))
+		keys := auth.NewService(st)
+
+		rr := doRequest(server, http.MethodGet, "/metrics", "", nil)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		token, _, err := keys.Issue(context.Background(), "reader", []auth.Scope{auth.ScopeBalanceRead})
+		require.NoError(t, err)
+		rr = doRequest(server, http.MethodGet, "/metrics", token, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		token, _, err = keys.Issue(context.Background(), "prometheus", []auth.Scope{auth.ScopeMetricsRead})
+		require.NoError(t, err)
+		rr = doRequest(server, http.MethodGet, "/metrics", token, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
+
+// Тесты для трассировки запросов
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	st := memory.New()
+	require.NoError(t, st.CreateWallet(context.Background(), generateTestAddress("a"), 100))
+	require.NoError(t, st.CreateWallet(context.Background(), generateTestAddress("b"), 100))
+	server := setupTestServer(t, st)
+
+	body := fmt.Sprintf(`{"from": %q, "to": %q, "amount": 10}`, generateTestAddress("a"), generateTestAddress("b"))
+	req := httptest.NewRequest(http.MethodPost, "/api/send", strings.NewReader(body))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	server.router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	decode, root := spans[0], spans[1]
+	assert.Equal(t, "SendMoneyHandler.decode", decode.Name())
+	assert.Equal(t, root.SpanContext().SpanID(), decode.Parent().SpanID())
+
+	assert.Equal(t, "POST /api/send", root.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", root.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", root.Parent().SpanID().String(), "the caller's span is the parent")
+	assert.Contains(t, root.Attributes(), attribute.Int("http.response.status_code", http.StatusOK))
+
+	rr = doRequest(server, http.MethodGet, "/healthz", "", nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Len(t, recorder.Ended(), 2, "probes are not traced")
+}
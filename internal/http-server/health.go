@@ -0,0 +1,44 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/health"
+)
+
+type livenessResponse struct {
+	Status string `json:"status"`
+}
+
+// HealthzHandler reports that the process is alive. It never touches the
+// storage, so a busy database does not get the process restarted.
+func (sr *Server) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(livenessResponse{Status: StatusOk})
+}
+
+// ReadyzHandler runs the readiness checks and answers 503 with the
+// details of every check unless all of them passed.
+func (sr *Server) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "httpserver.ReadyzHandler"
+
+	report := sr.health.Check(r.Context())
+
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+		for _, res := range report.Checks {
+			if res.Status != health.CheckOK && res.Error != health.ErrStarting.Error() {
+				sr.log.Warn("Readiness check failed", slog.String("op", op), slog.String("check", res.Name),
+					slog.String("error", res.Error))
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
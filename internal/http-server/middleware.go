@@ -0,0 +1,358 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/auth"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/logger/sl"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/ratelimit"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/Petro-vich/transaction_processing_go/internal/http-server")
+
+// untracedRoutes are polled by the orchestrator and Prometheus; tracing
+// them would bury the traces of real requests.
+var untracedRoutes = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+const (
+	CredentialsRequired = "API key or bearer token required"
+	InvalidAPIKey       = "Invalid or revoked API key"
+	InvalidToken        = "Invalid or expired bearer token"
+	MissingScope        = "Caller lacks the required scope"
+	WalletNotOwned      = "Wallet is not owned by the caller"
+	OwnWalletsOnly      = "Only transactions of owned wallets are available"
+	AuthNotAvailable    = "API keys are not supported by the configured storage"
+	AdminNotAvailable   = "Admin endpoints require an authentication method to be configured"
+	RateLimited         = "Too many requests, retry later"
+)
+
+const (
+	apiKeyHeader      = "X-API-Key"
+	bearerPrefix      = "Bearer "
+	authenticateValue = `Bearer realm="transaction-service"`
+)
+
+// timeoutMiddleware bounds the request context by the configured request
+// timeout so storage calls are cancelled when the deadline passes.
+func (sr *Server) timeoutMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout := sr.config.RequestTimeout
+		if timeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// statusRecorder remembers the status code written to the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// metricsMiddleware records the status and latency of every request under
+// its route template.
+func (sr *Server) metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		sr.metrics.ObserveRequest(routeTemplate(r), r.Method, rec.status, time.Since(start))
+	})
+}
+
+// tracingMiddleware runs every request in a server span named after its
+// route. The span continues the trace of the W3C traceparent header when
+// the caller sent one.
+func (sr *Server) tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+		if untracedRoutes[route] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPRequestMethodKey.String(r.Method), semconv.HTTPRoute(route)),
+		)
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
+
+// routeTemplate returns the path template of the matched route, so wallet
+// addresses do not end up in metric labels or span names.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return r.URL.Path
+}
+
+// requireScope authenticates the request and rejects it unless the caller
+// was granted scope. A verified client certificate whose common name is
+// mapped to scopes identifies the caller without further credentials.
+// Otherwise bearer tokens starting with the API key prefix and the
+// X-API-Key header are checked as API keys, other bearer tokens as JWTs.
+// The principal is stored in the request context. Without any
+// authentication method configured every request is let through, except
+// for the admin scope, which nobody holds then.
+func (sr *Server) requireScope(scope auth.Scope, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const op = "httpserver.requireScope"
+
+		ipKey := "ip:" + clientIP(r)
+
+		if !sr.authConfigured() {
+			if scope == auth.ScopeAdmin {
+				sendError(w, AdminNotAvailable, http.StatusForbidden)
+				return
+			}
+			if sr.allow(w, sr.clientLimit, ipKey) {
+				next.ServeHTTP(w, r)
+			}
+			return
+		}
+
+		principal, ok := sr.certificatePrincipal(r)
+		if !ok {
+			principal, ok = sr.authenticate(w, r, ipKey)
+			if !ok {
+				return
+			}
+		}
+
+		if !sr.allow(w, sr.clientLimit, principalKey(principal)) {
+			return
+		}
+
+		if !principal.Has(scope) {
+			sr.log.Info("caller lacks scope", slog.String("op", op), slog.String("key_id", principal.KeyID),
+				slog.String("subject", principal.Name), slog.String("scope", string(scope)))
+			sendError(w, MissingScope+": "+string(scope), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// authConfigured reports whether any authentication method is configured.
+func (sr *Server) authConfigured() bool {
+	return sr.config.Auth.Enabled || sr.jwt != nil || sr.certClients != nil
+}
+
+// authenticate checks the API key or bearer token of the request. On
+// failure it writes the error response and returns false.
+func (sr *Server) authenticate(w http.ResponseWriter, r *http.Request, ipKey string) (auth.Principal, bool) {
+	const op = "httpserver.authenticate"
+
+	if sr.config.Auth.Enabled && sr.keys == nil {
+		sendError(w, AuthNotAvailable, http.StatusInternalServerError)
+		return auth.Principal{}, false
+	}
+	// Failed authentications are charged to the client IP, so an IP
+	// guessing credentials is stopped before reaching the key store.
+	if sr.clientLimit != nil && !sr.checkLimit(w, sr.clientLimit.Peek(ipKey), ipKey) {
+		return auth.Principal{}, false
+	}
+
+	token, isKey := credentials(r)
+	if token == "" {
+		w.Header().Set("WWW-Authenticate", authenticateValue)
+		sendError(w, CredentialsRequired, http.StatusUnauthorized)
+		return auth.Principal{}, false
+	}
+
+	var (
+		principal auth.Principal
+		err       error
+	)
+	switch {
+	case isKey && sr.config.Auth.Enabled:
+		principal, err = sr.keys.Authenticate(r.Context(), token)
+	case isKey:
+		err = auth.ErrInvalidKey
+	case sr.jwt != nil:
+		principal, err = sr.jwt.Verify(token)
+	default:
+		err = auth.ErrInvalidToken
+	}
+	if errors.Is(err, auth.ErrInvalidKey) || errors.Is(err, auth.ErrInvalidToken) {
+		if sr.clientLimit != nil {
+			sr.clientLimit.Allow(ipKey)
+		}
+		sr.log.Info("credentials rejected", slog.String("op", op), slog.String("path", r.URL.Path), sl.Err(err))
+		w.Header().Set("WWW-Authenticate", authenticateValue)
+		message := InvalidAPIKey
+		if !isKey {
+			message = InvalidToken
+		}
+		sendError(w, message, http.StatusUnauthorized)
+		return auth.Principal{}, false
+	}
+	if err != nil {
+		sr.sendStorageError(w, r, op, err)
+		return auth.Principal{}, false
+	}
+	return principal, true
+}
+
+// certificatePrincipal returns the principal mapped to the common name of
+// the verified client certificate of the request, if any.
+func (sr *Server) certificatePrincipal(r *http.Request) (auth.Principal, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return auth.Principal{}, false
+	}
+
+	cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	scopes, ok := sr.certClients[cn]
+	if !ok {
+		return auth.Principal{}, false
+	}
+	return auth.Principal{Name: cn, Scopes: scopes}, true
+}
+
+// allow takes a token for key from limiter, which may be nil. It writes 429
+// and returns false when the bucket is empty.
+func (sr *Server) allow(w http.ResponseWriter, limiter *ratelimit.Limiter, key string) bool {
+	if limiter == nil {
+		return true
+	}
+	return sr.checkLimit(w, limiter.Allow(key), key)
+}
+
+// checkLimit sets the RateLimit headers of res, keeping those of a stricter
+// limit checked before, and rejects the request unless res allows it.
+func (sr *Server) checkLimit(w http.ResponseWriter, res ratelimit.Result, key string) bool {
+	header := w.Header()
+	remaining, err := strconv.Atoi(header.Get("RateLimit-Remaining"))
+	if err != nil || res.Remaining <= remaining || !res.Allowed {
+		header.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+	}
+	if res.Allowed {
+		return true
+	}
+
+	sr.log.Info("rate limit exceeded", slog.String("op", "httpserver.checkLimit"), slog.String("key", key))
+	header.Set("Retry-After", strconv.Itoa(max(ceilSeconds(res.RetryAfter), 1)))
+	sendError(w, RateLimited, http.StatusTooManyRequests)
+	return false
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// principalKey identifies the client bucket of an authenticated caller.
+func principalKey(p auth.Principal) string {
+	if p.KeyID != "" {
+		return "key:" + p.KeyID
+	}
+	return "sub:" + p.Name
+}
+
+// clientIP returns the host of the remote address of the request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// authorizeWallet writes 403 and returns false unless the caller may act
+// on the wallet at address. Callers authenticated by a JWT may only act on
+// the wallets listed in its claims.
+func (sr *Server) authorizeWallet(w http.ResponseWriter, r *http.Request, address string) bool {
+	principal, ok := auth.FromContext(r.Context())
+	if !ok || principal.Owns(address) {
+		return true
+	}
+
+	sr.log.Info("wallet not owned by caller", slog.String("op", "httpserver.authorizeWallet"),
+		slog.String("subject", principal.Name), slog.String("address", address))
+	sendError(w, WalletNotOwned, http.StatusForbidden)
+	return false
+}
+
+// restricted reports whether the caller may only act on its own wallets.
+func restricted(r *http.Request) bool {
+	principal, ok := auth.FromContext(r.Context())
+	return ok && principal.Restricted()
+}
+
+// isAdmin reports whether the caller was authenticated with the admin
+// scope. Without authentication configured there is no admin caller.
+func isAdmin(r *http.Request) bool {
+	principal, ok := auth.FromContext(r.Context())
+	return ok && principal.Has(auth.ScopeAdmin)
+}
+
+// credentials returns the token from the Authorization bearer token or the
+// X-API-Key header and whether it is an API key.
+func credentials(r *http.Request) (string, bool) {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, bearerPrefix) {
+		token := strings.TrimSpace(strings.TrimPrefix(header, bearerPrefix))
+		return token, auth.IsAPIKey(token)
+	}
+	return strings.TrimSpace(r.Header.Get(apiKeyHeader)), true
+}
@@ -0,0 +1,141 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/auth"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/logger/sl"
+	"github.com/gorilla/mux"
+)
+
+const ScreeningDisabled = "address screening is not enabled"
+
+type screeningEntryRequest struct {
+	List    string `json:"list"`
+	Address string `json:"address"`
+	Note    string `json:"note"`
+}
+
+// ListScreeningEntriesHandler lists the entries of the block and allow
+// lists, or of the list given by the list query parameter.
+func (sr *Server) ListScreeningEntriesHandler(w http.ResponseWriter, r *http.Request) {
+	if sr.screening == nil {
+		sendError(w, ScreeningDisabled, http.StatusNotImplemented)
+		return
+	}
+
+	entries, err := sr.screening.Entries(r.URL.Query().Get("list"))
+	if err != nil {
+		sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+func (sr *Server) AddScreeningEntryHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "httpserver.AddScreeningEntryHandler"
+
+	if sr.screening == nil {
+		sendError(w, ScreeningDisabled, http.StatusNotImplemented)
+		return
+	}
+
+	var req screeningEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	principal, _ := auth.FromContext(r.Context())
+	entry, err := sr.screening.AddEntry(r.Context(), req.List, req.Address, req.Note, principal.Name)
+	if err != nil {
+		sr.sendStorageError(w, r, op, err)
+		return
+	}
+
+	sr.log.Info("Screening entry added", slog.String("op", op), slog.String("list", entry.List),
+		slog.String("address", entry.Address), slog.String("by", principal.Name))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(entry)
+}
+
+// RemoveScreeningEntryHandler removes an entry added through the API.
+// Entries of list files are removed by editing the file.
+func (sr *Server) RemoveScreeningEntryHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "httpserver.RemoveScreeningEntryHandler"
+
+	if sr.screening == nil {
+		sendError(w, ScreeningDisabled, http.StatusNotImplemented)
+		return
+	}
+
+	vars := mux.Vars(r)
+	err := sr.screening.RemoveEntry(r.Context(), vars["list"], vars["address"])
+	if err != nil {
+		sr.sendStorageError(w, r, op, err)
+		return
+	}
+
+	principal, _ := auth.FromContext(r.Context())
+	sr.log.Info("Screening entry removed", slog.String("op", op), slog.String("list", vars["list"]),
+		slog.String("address", vars["address"]), slog.String("by", principal.Name))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": StatusOk})
+}
+
+// ReloadScreeningHandler reads the list files again. A broken file keeps
+// the previous lists and is reported with 422.
+func (sr *Server) ReloadScreeningHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "httpserver.ReloadScreeningHandler"
+
+	if sr.screening == nil {
+		sendError(w, ScreeningDisabled, http.StatusNotImplemented)
+		return
+	}
+
+	stats, err := sr.screening.Load(r.Context())
+	if err != nil {
+		sr.log.Error("failed to reload screening lists", slog.String("op", op), sl.Err(err))
+		sendError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	sr.log.Info("Screening lists reloaded", slog.String("op", op), slog.Int("block", stats.Block), slog.Int("allow", stats.Allow))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// ListScreeningHitsHandler returns the latest transfers rejected because of
+// a blocked address, newest first.
+func (sr *Server) ListScreeningHitsHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "httpserver.ListScreeningHitsHandler"
+
+	if sr.screening == nil {
+		sendError(w, ScreeningDisabled, http.StatusNotImplemented)
+		return
+	}
+
+	count := 100
+	if query := r.URL.Query(); query.Has("count") {
+		var err error
+		if count, err = strconv.Atoi(query.Get("count")); err != nil || count <= 0 {
+			sendError(w, InvalidCount, http.StatusBadRequest)
+			return
+		}
+	}
+
+	hits, err := sr.screening.Hits(r.Context(), count)
+	if err != nil {
+		sr.sendStorageError(w, r, op, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hits)
+}
@@ -1,38 +1,284 @@
 package httpserver
 
 import (
+	"context"
+	"crypto/ed25519"
 	"log/slog"
 	"net/http"
+	"sync"
 
+	"github.com/Petro-vich/transaction_processing_go/internal/auth"
 	"github.com/Petro-vich/transaction_processing_go/internal/config"
+	"github.com/Petro-vich/transaction_processing_go/internal/hashchain"
+	"github.com/Petro-vich/transaction_processing_go/internal/health"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/ratelimit"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/tlsreload"
+	"github.com/Petro-vich/transaction_processing_go/internal/metrics"
+	"github.com/Petro-vich/transaction_processing_go/internal/risk"
+	"github.com/Petro-vich/transaction_processing_go/internal/screening"
+	"github.com/Petro-vich/transaction_processing_go/internal/service/backup"
+	"github.com/Petro-vich/transaction_processing_go/internal/service/importer"
+	"github.com/Petro-vich/transaction_processing_go/internal/service/wallet"
+	"github.com/Petro-vich/transaction_processing_go/internal/signing"
 	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage/cache"
 	"github.com/gorilla/mux"
 )
 
+// chainVerifier is a storage keeping a hash chain of its transactions.
+type chainVerifier interface {
+	VerifyChain(ctx context.Context, key ed25519.PublicKey) (hashchain.Report, error)
+}
+
 type Server struct {
-	storage storage.Repository
-	config  *config.Config
-	router  *mux.Router
-	log     *slog.Logger
+	storage  storage.Repository
+	wallet   *wallet.WalletService
+	importer *importer.Importer
+	backup   *backup.Service
+	cache    *cache.Storage
+	keys     *auth.Service
+	chain    chainVerifier
+	config   *config.Config
+	router   *mux.Router
+	server   *http.Server
+	log      *slog.Logger
+	// handlers counts the requests being served, including those cut off
+	// by Shutdown whose handlers have not returned yet.
+	handlers sync.WaitGroup
+
+	// nonces is set when transfers must be signed by the sending wallet.
+	nonces signing.NonceStore
+	// jwt is set when JWT bearer tokens are accepted.
+	jwt *auth.JWTVerifier
+	// clientLimit and walletLimit are nil when the limit is disabled.
+	clientLimit *ratelimit.Limiter
+	walletLimit *ratelimit.Limiter
+	// tls is set when the server listens for HTTPS.
+	tls *tlsreload.Reloader
+	// certClients maps the common names of verified client certificates to
+	// their scopes.
+	certClients map[string][]auth.Scope
+	// chainKey verifies the signatures of chain checkpoints when set.
+	chainKey ed25519.PublicKey
+	// risk evaluates transfers before they are executed when set.
+	risk *risk.Service
+	// screening rejects transfers from or to blocked addresses when set.
+	screening *screening.Screener
+	// health runs the readiness checks.
+	health *health.Checker
+	// metrics records requests and serves /metrics when set.
+	metrics *metrics.Metrics
+}
+
+// Option configures optional behaviour of the server.
+type Option func(*Server)
+
+// WithSignedTransfers requires every transfer to be signed by the key of the
+// sending wallet with a nonce greater than the previous one, tracked in nonces.
+// Wallets are then created with Ed25519 keypairs and CSV import is disabled.
+func WithSignedTransfers(nonces signing.NonceStore) Option {
+	return func(sr *Server) {
+		sr.nonces = nonces
+	}
+}
+
+// WithJWT accepts bearer tokens verified by verifier. Their callers may only
+// read and send from the wallets listed in the token claims.
+func WithJWT(verifier *auth.JWTVerifier) Option {
+	return func(sr *Server) {
+		sr.jwt = verifier
+	}
+}
+
+// WithRateLimits limits requests per client with client and transfers per
+// source wallet with wallet. Either may be nil.
+func WithRateLimits(client, wallet *ratelimit.Limiter) Option {
+	return func(sr *Server) {
+		sr.clientLimit = client
+		sr.walletLimit = wallet
+	}
+}
+
+// WithTLS serves HTTPS with the configuration kept by reloader.
+func WithTLS(reloader *tlsreload.Reloader) Option {
+	return func(sr *Server) {
+		sr.tls = reloader
+	}
+}
+
+// WithClientCertificates authenticates callers presenting a verified client
+// certificate whose common name is a key of clients with its scopes.
+func WithClientCertificates(clients map[string][]auth.Scope) Option {
+	return func(sr *Server) {
+		sr.certClients = clients
+	}
 }
 
-func New(storage storage.Repository, config *config.Config, log *slog.Logger) *Server {
+// WithChainKey checks the signatures of chain checkpoints against key when
+// the chain is verified.
+func WithChainKey(key ed25519.PublicKey) Option {
+	return func(sr *Server) {
+		sr.chainKey = key
+	}
+}
+
+// WithRisk evaluates every transfer with the rules of svc before it is
+// executed and exposes its review queue.
+func WithRisk(svc *risk.Service) Option {
+	return func(sr *Server) {
+		sr.risk = svc
+	}
+}
+
+// WithScreening rejects transfers from or to addresses blocked by screener
+// and exposes the management of its lists.
+func WithScreening(screener *screening.Screener) Option {
+	return func(sr *Server) {
+		sr.screening = screener
+	}
+}
+
+// WithHealth reports readiness with the checks of checker. Without it the
+// server is ready as soon as it is created.
+func WithHealth(checker *health.Checker) Option {
+	return func(sr *Server) {
+		sr.health = checker
+	}
+}
+
+// WithMetrics records every request in m and serves it on /metrics.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(sr *Server) {
+		sr.metrics = m
+	}
+}
+
+func New(repo storage.Repository, config *config.Config, log *slog.Logger, opts ...Option) *Server {
 	serv := Server{
-		storage: storage,
+		storage: repo,
+		wallet:  wallet.NewService(repo),
 		config:  config,
 		router:  mux.NewRouter(),
 		log:     log,
 	}
+	if src, ok := storage.Unwrap(repo).(backup.Source); ok {
+		serv.backup = backup.New(src, config.Backup)
+	}
+	if c, ok := repo.(*cache.Storage); ok {
+		serv.cache = c
+	}
+	if store, ok := storage.Unwrap(repo).(auth.KeyStore); ok {
+		serv.keys = auth.NewService(store)
+	}
+	if v, ok := storage.Unwrap(repo).(chainVerifier); ok {
+		serv.chain = v
+	}
+	for _, opt := range opts {
+		opt(&serv)
+	}
+	if serv.health == nil {
+		serv.health = health.New(0)
+		serv.health.MarkStarted()
+	}
+	importOpts := []importer.Option{importer.WithExecutionTimeout(config.ImportTimeout)}
+	if serv.screening != nil {
+		importOpts = append(importOpts, importer.WithScreening(serv.screening))
+	}
+	if serv.risk != nil {
+		importOpts = append(importOpts, importer.WithRiskRules(serv.risk))
+	}
+	serv.importer = importer.New(repo, importOpts...)
 	serv.routes()
+
+	serv.server = &http.Server{Addr: config.Address, Handler: serv.track(serv.router)}
+	if serv.tls != nil {
+		serv.server.TLSConfig = serv.tls.TLSConfig()
+	}
 	return &serv
 }
 
+// Start listens and serves until the server fails or is shut down, in
+// which case it returns http.ErrServerClosed.
 func (sr *Server) Start() error {
-	return http.ListenAndServe(sr.config.Address, sr.router)
+	if sr.tls == nil {
+		return sr.server.ListenAndServe()
+	}
+	return sr.server.ListenAndServeTLS("", "")
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests
+// to finish until ctx is done. Requests still running then are cut off:
+// their contexts are cancelled, but their handlers may still be returning,
+// which Wait waits for.
+func (sr *Server) Shutdown(ctx context.Context) error {
+	if err := sr.server.Shutdown(ctx); err != nil {
+		sr.server.Close()
+		return err
+	}
+	return nil
+}
+
+// Wait waits until every handler started by the server has returned or
+// ctx is done.
+func (sr *Server) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		sr.handlers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// track counts the requests served by next for Wait.
+func (sr *Server) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sr.handlers.Add(1)
+		defer sr.handlers.Done()
+		next.ServeHTTP(w, r)
+	})
 }
 
 func (sr *Server) routes() {
-	sr.router.HandleFunc("/api/wallet/{address}/balance", sr.GetBalanceHandler).Methods("GET")
-	sr.router.HandleFunc("/api/send", sr.SendMoneyHandler).Methods("POST")
-	sr.router.HandleFunc("/api/transactions", sr.GetLastHandler).Methods("GET")
+	sr.router.Use(sr.tracingMiddleware)
+	if sr.metrics != nil {
+		sr.router.Use(sr.metricsMiddleware)
+	}
+	sr.router.Use(sr.timeoutMiddleware)
+
+	// Probes are neither authenticated nor rate limited.
+	sr.router.HandleFunc("/healthz", sr.HealthzHandler).Methods("GET")
+	sr.router.HandleFunc("/readyz", sr.ReadyzHandler).Methods("GET")
+	if sr.metrics != nil {
+		sr.router.Handle("/metrics", sr.requireScope(auth.ScopeMetricsRead, sr.metrics.Handler().ServeHTTP)).Methods("GET")
+	}
+
+	sr.router.Handle("/api/wallet", sr.requireScope(auth.ScopeWalletsWrite, sr.CreateWalletHandler)).Methods("POST")
+	sr.router.Handle("/api/wallet/{address}/balance", sr.requireScope(auth.ScopeBalanceRead, sr.GetBalanceHandler)).Methods("GET")
+	sr.router.Handle("/api/send", sr.requireScope(auth.ScopeTransfersWrite, sr.SendMoneyHandler)).Methods("POST")
+	sr.router.Handle("/api/transactions", sr.requireScope(auth.ScopeTransactionsRead, sr.GetLastHandler)).Methods("GET")
+	sr.router.Handle("/api/wallet/{address}/nonce", sr.requireScope(auth.ScopeBalanceRead, sr.GetNonceHandler)).Methods("GET")
+	sr.router.Handle("/api/wallet/{address}/transactions", sr.requireScope(auth.ScopeTransactionsRead, sr.GetHistoryHandler)).Methods("GET")
+	sr.router.Handle("/api/import", sr.requireScope(auth.ScopeTransfersWrite, sr.ImportHandler)).Methods("POST")
+
+	sr.router.Handle("/api/admin/backup", sr.requireScope(auth.ScopeAdmin, sr.CreateBackupHandler)).Methods("POST")
+	sr.router.Handle("/api/admin/backups", sr.requireScope(auth.ScopeAdmin, sr.ListBackupsHandler)).Methods("GET")
+	sr.router.Handle("/api/admin/cache", sr.requireScope(auth.ScopeAdmin, sr.CacheStatsHandler)).Methods("GET")
+	sr.router.Handle("/api/admin/keys", sr.requireScope(auth.ScopeAdmin, sr.CreateKeyHandler)).Methods("POST")
+	sr.router.Handle("/api/admin/keys", sr.requireScope(auth.ScopeAdmin, sr.ListKeysHandler)).Methods("GET")
+	sr.router.Handle("/api/admin/keys/{id}", sr.requireScope(auth.ScopeAdmin, sr.RevokeKeyHandler)).Methods("DELETE")
+	sr.router.Handle("/api/admin/chain/verify", sr.requireScope(auth.ScopeAdmin, sr.VerifyChainHandler)).Methods("GET")
+	sr.router.Handle("/api/admin/reviews", sr.requireScope(auth.ScopeAdmin, sr.ListReviewsHandler)).Methods("GET")
+	sr.router.Handle("/api/admin/reviews/{id}/approve", sr.requireScope(auth.ScopeAdmin, sr.ApproveReviewHandler)).Methods("POST")
+	sr.router.Handle("/api/admin/reviews/{id}/reject", sr.requireScope(auth.ScopeAdmin, sr.RejectReviewHandler)).Methods("POST")
+	sr.router.Handle("/api/admin/screening/entries", sr.requireScope(auth.ScopeAdmin, sr.ListScreeningEntriesHandler)).Methods("GET")
+	sr.router.Handle("/api/admin/screening/entries", sr.requireScope(auth.ScopeAdmin, sr.AddScreeningEntryHandler)).Methods("POST")
+	sr.router.Handle("/api/admin/screening/entries/{list}/{address}", sr.requireScope(auth.ScopeAdmin, sr.RemoveScreeningEntryHandler)).Methods("DELETE")
+	sr.router.Handle("/api/admin/screening/reload", sr.requireScope(auth.ScopeAdmin, sr.ReloadScreeningHandler)).Methods("POST")
+	sr.router.Handle("/api/admin/screening/hits", sr.requireScope(auth.ScopeAdmin, sr.ListScreeningHitsHandler)).Methods("GET")
 }
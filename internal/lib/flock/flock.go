@@ -0,0 +1,50 @@
+// Package flock provides advisory, process-wide file locks.
+package flock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+var ErrLocked = errors.New("file is locked by another process")
+
+// Lock is a lock held on a file until Unlock is called.
+type Lock struct {
+	file *os.File
+}
+
+// TryLock creates path if needed and takes an exclusive lock on it without
+// waiting. ErrLocked is returned when another process holds any lock on it.
+func TryLock(path string) (*Lock, error) {
+	return lock("flock.TryLock", path, false)
+}
+
+// TryRLock takes a shared lock on path without waiting. Any number of shared
+// locks can be held at once, but none while an exclusive lock is held.
+func TryRLock(path string) (*Lock, error) {
+	return lock("flock.TryRLock", path, true)
+}
+
+func lock(op string, path string, shared bool) (*Lock, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tryLock(file, shared); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %s: %w", op, path, err)
+	}
+
+	return &Lock{file: file}, nil
+}
+
+// Unlock releases the lock.
+func (l *Lock) Unlock() error {
+	if err := unlock(l.file); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
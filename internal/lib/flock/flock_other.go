@@ -0,0 +1,15 @@
+//go:build !unix
+
+package flock
+
+import "os"
+
+// Advisory locks are not implemented on this platform; locking always succeeds.
+
+func tryLock(file *os.File, shared bool) error {
+	return nil
+}
+
+func unlock(file *os.File) error {
+	return nil
+}
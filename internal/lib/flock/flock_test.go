@@ -0,0 +1,49 @@
+//go:build unix
+
+package flock
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTryLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "LOCK")
+
+	lock, err := TryLock(path)
+	require.NoError(t, err)
+
+	_, err = TryLock(path)
+	assert.ErrorIs(t, err, ErrLocked)
+
+	require.NoError(t, lock.Unlock())
+
+	lock, err = TryLock(path)
+	require.NoError(t, err)
+	require.NoError(t, lock.Unlock())
+}
+
+func TestTryRLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "LOCK")
+
+	first, err := TryRLock(path)
+	require.NoError(t, err)
+	second, err := TryRLock(path)
+	require.NoError(t, err)
+
+	_, err = TryLock(path)
+	assert.ErrorIs(t, err, ErrLocked)
+
+	require.NoError(t, first.Unlock())
+	require.NoError(t, second.Unlock())
+
+	exclusive, err := TryLock(path)
+	require.NoError(t, err)
+
+	_, err = TryRLock(path)
+	assert.ErrorIs(t, err, ErrLocked)
+	require.NoError(t, exclusive.Unlock())
+}
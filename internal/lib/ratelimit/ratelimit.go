@@ -0,0 +1,164 @@
+// Package ratelimit provides in-memory token bucket rate limiters.
+package ratelimit
+
+import (
+	"context"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Limiter keeps one token bucket per key. A bucket holds up to burst tokens
+// and refills at rate tokens per second; every allowed request takes one.
+type Limiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+
+	now func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Result describes the state of a bucket after a request.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is the time until the next token; zero when allowed.
+	RetryAfter time.Duration
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+}
+
+// New returns a limiter refilling rate tokens per second up to burst.
+// A burst below one is raised to one.
+func New(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		burst:   math.Max(float64(burst), 1),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket of key if one is available.
+func (l *Limiter) Allow(key string) Result {
+	return l.take(key, true)
+}
+
+// Peek reports whether Allow would succeed without taking a token.
+func (l *Limiter) Peek(key string) Result {
+	return l.take(key, false)
+}
+
+// Refund gives back a token taken by Allow for a request that was then
+// rejected for another reason. The bucket never grows past the burst.
+func (l *Limiter) Refund(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.buckets[key]; ok {
+		l.refill(b, l.now())
+		b.tokens = math.Min(l.burst, b.tokens+1)
+	}
+}
+
+// AllowAll takes counts[key] tokens from the bucket of every key, or none
+// when any bucket holds too few. It returns the first key denied in sorted
+// order with its result; on success the result only has Allowed set. A
+// count above the burst is never allowed.
+func (l *Limiter) AllowAll(counts map[string]int) (string, Result) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	keys := slices.Sorted(maps.Keys(counts))
+	for _, key := range keys {
+		if res := l.check(key, float64(counts[key]), false); !res.Allowed {
+			return key, res
+		}
+	}
+	for _, key := range keys {
+		l.check(key, float64(counts[key]), true)
+	}
+	return "", Result{Allowed: true}
+}
+
+func (l *Limiter) take(key string, consume bool) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.check(key, 1, consume)
+}
+
+// check reports whether the bucket of key holds n tokens and takes them if
+// consume is set. l.mu must be held.
+func (l *Limiter) check(key string, n float64, consume bool) Result {
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+
+	res := Result{Allowed: b.tokens >= n, Limit: int(l.burst)}
+	if res.Allowed && consume {
+		b.tokens -= n
+	}
+	if !res.Allowed {
+		res.RetryAfter = l.duration(n - b.tokens)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = l.duration(l.burst - b.tokens)
+	return res
+}
+
+func (l *Limiter) refill(b *bucket, now time.Time) {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed.Seconds()*l.rate)
+		b.updated = now
+	}
+}
+
+func (l *Limiter) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// Cleanup drops the buckets that have refilled completely, since a full
+// bucket behaves like a missing one. It returns the number of buckets left.
+func (l *Limiter) Cleanup() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	return len(l.buckets)
+}
+
+// Run calls Cleanup once per interval until ctx is done.
+func (l *Limiter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.Cleanup()
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLimiter(rate float64, burst int) (*Limiter, *time.Time) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(rate, burst)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestAllow(t *testing.T) {
+	l, now := newTestLimiter(2, 3)
+
+	for i := 2; i >= 0; i-- {
+		res := l.Allow("a")
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 3, res.Limit)
+		assert.Equal(t, i, res.Remaining)
+	}
+
+	res := l.Allow("a")
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, res.Reset)
+
+	assert.True(t, l.Allow("b").Allowed, "buckets are independent")
+
+	*now = now.Add(500 * time.Millisecond)
+	assert.True(t, l.Allow("a").Allowed)
+	assert.False(t, l.Allow("a").Allowed)
+
+	*now = now.Add(time.Hour)
+	res = l.Allow("a")
+	assert.Equal(t, 2, res.Remaining, "refill is capped at burst")
+}
+
+func TestPeek(t *testing.T) {
+	l, _ := newTestLimiter(1, 1)
+
+	assert.True(t, l.Peek("a").Allowed)
+	assert.True(t, l.Peek("a").Allowed, "peek does not take a token")
+
+	l.Allow("a")
+	res := l.Peek("a")
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+}
+
+func TestRefund(t *testing.T) {
+	l, now := newTestLimiter(1, 2)
+
+	l.Allow("a")
+	l.Allow("a")
+	l.Refund("a")
+	assert.Equal(t, 1, l.Peek("a").Remaining)
+
+	*now = now.Add(time.Hour)
+	l.Refund("a")
+	assert.Equal(t, 2, l.Peek("a").Remaining, "refund is capped at burst")
+
+	l.Refund("b")
+	assert.Equal(t, 2, l.Peek("b").Remaining)
+}
+
+func TestAllowAll(t *testing.T) {
+	l, _ := newTestLimiter(1, 3)
+
+	key, res := l.AllowAll(map[string]int{"a": 2, "b": 1})
+	assert.True(t, res.Allowed)
+	assert.Empty(t, key)
+	assert.Equal(t, 1, l.Peek("a").Remaining)
+
+	key, res = l.AllowAll(map[string]int{"a": 2, "b": 1})
+	assert.False(t, res.Allowed)
+	assert.Equal(t, "a", key)
+	assert.Equal(t, time.Second, res.RetryAfter)
+	assert.Equal(t, 2, l.Peek("b").Remaining, "no bucket is charged when one is denied")
+
+	key, res = l.AllowAll(map[string]int{"c": 4})
+	assert.False(t, res.Allowed, "a count above the burst is never allowed")
+	assert.Equal(t, "c", key)
+}
+
+func TestCleanup(t *testing.T) {
+	l, now := newTestLimiter(1, 2)
+
+	l.Allow("a")
+	l.Allow("b")
+	l.Allow("b")
+	assert.Equal(t, 2, l.Cleanup())
+
+	*now = now.Add(time.Second)
+	assert.Equal(t, 1, l.Cleanup(), "a is full again")
+
+	*now = now.Add(time.Second)
+	assert.Equal(t, 0, l.Cleanup())
+
+	res := l.Allow("b")
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining, "a dropped bucket starts full")
+}
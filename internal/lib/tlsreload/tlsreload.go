@@ -0,0 +1,99 @@
+// Package tlsreload builds server TLS configurations from files that can be
+// replaced at runtime.
+package tlsreload
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/config"
+)
+
+var versions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Reloader serves the certificate, key and client CA bundle loaded by the
+// latest successful Reload to every new connection.
+type Reloader struct {
+	cfg     config.TLS
+	current atomic.Pointer[tls.Config]
+}
+
+// New validates cfg and loads its files.
+func New(cfg config.TLS) (*Reloader, error) {
+	const op = "tlsreload.New"
+
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, fmt.Errorf("%s: cert_file and key_file are required", op)
+	}
+	if _, ok := versions[cfg.MinVersion]; !ok {
+		return nil, fmt.Errorf("%s: unsupported min_version %q, use 1.2 or 1.3", op, cfg.MinVersion)
+	}
+	if cfg.ClientCAFile != "" && cfg.ClientAuth != config.ClientAuthRequire && cfg.ClientAuth != config.ClientAuthOptional {
+		return nil, fmt.Errorf("%s: unknown client_auth %q", op, cfg.ClientAuth)
+	}
+
+	r := &Reloader{cfg: cfg}
+	if err := r.Reload(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return r, nil
+}
+
+// Reload reads the files again. On failure the previous configuration
+// stays in use.
+func (r *Reloader) Reload() error {
+	const op = "tlsreload.Reload"
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	next := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   versions[r.cfg.MinVersion],
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%s: no certificates found in %s", op, r.cfg.ClientCAFile)
+		}
+
+		next.ClientCAs = pool
+		next.ClientAuth = tls.RequireAndVerifyClientCert
+		if r.cfg.ClientAuth == config.ClientAuthOptional {
+			next.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+
+	r.current.Store(next)
+	return nil
+}
+
+// TLSConfig returns a server configuration that picks up every reload.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: versions[r.cfg.MinVersion],
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load(), nil
+		},
+		// Unused during handshakes, but marks the configuration as having
+		// a certificate for servers that only check this callback.
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &r.current.Load().Certificates[0], nil
+		},
+	}
+}
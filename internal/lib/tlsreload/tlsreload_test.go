@@ -0,0 +1,201 @@
+package tlsreload
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+var serial int64
+
+// issue creates a certificate for cn signed by parent, or self-signed
+// when parent is nil.
+func issue(t *testing.T, cn string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write stores the certificate and key as PEM files in dir.
+func (c *testCert) write(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+// serve starts an HTTPS server with the configuration of r that reports
+// the common name of the verified client certificate.
+func serve(t *testing.T, r *Reloader) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if len(req.TLS.VerifiedChains) > 0 {
+			w.Write([]byte(req.TLS.VerifiedChains[0][0].Subject.CommonName))
+		}
+	}))
+	srv.TLS = r.TLSConfig()
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newClient(ca *testCert, cert *testCert) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	cfg := &tls.Config{RootCAs: roots}
+	if cert != nil {
+		cfg.Certificates = []tls.Certificate{cert.tlsCertificate()}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := issue(t, "ca", nil)
+	first := issue(t, "server", ca)
+	certFile, keyFile := first.write(t, dir)
+
+	r, err := New(config.TLS{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.2"})
+	require.NoError(t, err)
+	srv := serve(t, r)
+
+	peerSerial := func() *big.Int {
+		resp, err := newClient(ca, nil).Get(srv.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].SerialNumber
+	}
+	assert.Equal(t, first.cert.SerialNumber, peerSerial())
+
+	second := issue(t, "server", ca)
+	second.write(t, dir)
+	require.NoError(t, r.Reload())
+	assert.Equal(t, second.cert.SerialNumber, peerSerial(), "new connections use the reloaded certificate")
+
+	require.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0o600))
+	assert.Error(t, r.Reload())
+	assert.Equal(t, second.cert.SerialNumber, peerSerial(), "a failed reload keeps the previous certificate")
+}
+
+func TestClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := issue(t, "ca", nil)
+	certFile, keyFile := issue(t, "server", ca).write(t, dir)
+
+	clientCA := issue(t, "client-ca", nil)
+	caFile := filepath.Join(dir, "clients.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientCA.der}), 0o600))
+
+	get := func(srv *httptest.Server, cert *testCert) (string, error) {
+		resp, err := newClient(ca, cert).Get(srv.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		var body [64]byte
+		n, _ := resp.Body.Read(body[:])
+		return string(body[:n]), nil
+	}
+
+	t.Run("Required", func(t *testing.T) {
+		r, err := New(config.TLS{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.3",
+			ClientCAFile: caFile, ClientAuth: config.ClientAuthRequire})
+		require.NoError(t, err)
+		srv := serve(t, r)
+
+		cn, err := get(srv, issue(t, "payouts", clientCA))
+		require.NoError(t, err)
+		assert.Equal(t, "payouts", cn)
+
+		_, err = get(srv, nil)
+		assert.Error(t, err, "a client without certificate is rejected")
+		_, err = get(srv, issue(t, "payouts", issue(t, "other-ca", nil)))
+		assert.Error(t, err, "a certificate of another CA is rejected")
+	})
+
+	t.Run("Optional", func(t *testing.T) {
+		r, err := New(config.TLS{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.2",
+			ClientCAFile: caFile, ClientAuth: config.ClientAuthOptional})
+		require.NoError(t, err)
+		srv := serve(t, r)
+
+		cn, err := get(srv, nil)
+		require.NoError(t, err)
+		assert.Empty(t, cn)
+
+		cn, err = get(srv, issue(t, "payouts", clientCA))
+		require.NoError(t, err)
+		assert.Equal(t, "payouts", cn)
+	})
+}
+
+func TestNewErrors(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := issue(t, "server", nil).write(t, dir)
+
+	for name, cfg := range map[string]config.TLS{
+		"no files":       {MinVersion: "1.2"},
+		"min version":    {CertFile: certFile, KeyFile: keyFile, MinVersion: "1.0"},
+		"client auth":    {CertFile: certFile, KeyFile: keyFile, MinVersion: "1.2", ClientCAFile: certFile, ClientAuth: "maybe"},
+		"missing CA":     {CertFile: certFile, KeyFile: keyFile, MinVersion: "1.2", ClientCAFile: filepath.Join(dir, "missing.pem"), ClientAuth: "require"},
+		"CA without PEM": {CertFile: certFile, KeyFile: keyFile, MinVersion: "1.2", ClientCAFile: keyFile, ClientAuth: "require"},
+	} {
+		_, err := New(cfg)
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/config"
+)
+
+func TestSetup_None(t *testing.T) {
+	shutdown, err := Setup(context.Background(), config.Tracing{Exporter: config.TracingNone})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	carrier := propagation.MapCarrier{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+	out := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, out)
+	assert.Equal(t, carrier["traceparent"], out["traceparent"], "W3C trace context is propagated")
+}
+
+func TestSetup_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces", "traces.json")
+	shutdown, err := Setup(context.Background(), config.Tracing{
+		Exporter:    config.TracingFile,
+		ServiceName: "transaction-service",
+		SampleRatio: 1,
+		File:        path,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { otel.SetTracerProvider(sdktrace.NewTracerProvider()) })
+
+	_, span := otel.Tracer("test").Start(context.Background(), "transfer")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var exported struct{ Name string }
+	require.NoError(t, json.Unmarshal(data, &exported))
+	assert.Equal(t, "transfer", exported.Name)
+	assert.Contains(t, string(data), `"Key":"service.name","Value":{"Type":"STRING","Value":"transaction-service"}`)
+}
+
+func TestSetup_Errors(t *testing.T) {
+	_, err := Setup(context.Background(), config.Tracing{Exporter: "zipkin"})
+	assert.ErrorContains(t, err, `unknown tracing exporter "zipkin"`)
+
+	_, err = Setup(context.Background(), config.Tracing{Exporter: config.TracingFile})
+	assert.ErrorContains(t, err, "tracing.file is required")
+}
+
+func TestEnd(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	_, span := tracer.Start(context.Background(), "ok")
+	End(span, nil)
+	_, span = tracer.Start(context.Background(), "failed")
+	End(span, errors.New("database is locked"))
+
+	ended := recorder.Ended()
+	require.Len(t, ended, 2)
+	assert.Equal(t, codes.Unset, ended[0].Status().Code)
+	assert.Equal(t, codes.Error, ended[1].Status().Code)
+	assert.Equal(t, "database is locked", ended[1].Status().Description)
+	require.Len(t, ended[1].Events(), 1)
+	assert.Equal(t, "exception", ended[1].Events()[0].Name)
+}
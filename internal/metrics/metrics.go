@@ -0,0 +1,221 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+)
+
+const namespace = "transaction_service"
+
+// Transfer outcomes.
+const (
+	OutcomeSuccess          = "success"
+	OutcomeInsufficient     = "insufficient_funds"
+	OutcomeAddressNotExist  = "address_not_exist"
+	OutcomeValidationFailed = "validation_failed"
+	OutcomeReferenceUsed    = "reference_used"
+	OutcomeError            = "error"
+)
+
+// fundsTimeout bounds the query of the total funds on every scrape.
+const fundsTimeout = 5 * time.Second
+
+// FundsSource is a storage able to sum the balances of all wallets.
+type FundsSource interface {
+	TotalFunds(ctx context.Context) (float64, error)
+}
+
+// PoolSource is a storage with a database connection pool.
+type PoolSource interface {
+	Stats() sql.DBStats
+}
+
+// Metrics holds the collectors of the service in its own registry.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	transfers       *prometheus.CounterVec
+	volume          prometheus.Counter
+	queryDuration   *prometheus.HistogramVec
+}
+
+// New returns metrics registered together with the Go runtime and
+// process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		transfers: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transfers_total",
+			Help:      "Transfers by outcome.",
+		}, []string{"outcome"}),
+		volume: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transferred_amount_total",
+			Help:      "Sum of the amounts of successful transfers.",
+		}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_query_duration_seconds",
+			Help:      "Storage query latency by repository operation.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"operation"}),
+	}
+	for _, outcome := range []string{OutcomeSuccess, OutcomeInsufficient, OutcomeAddressNotExist, OutcomeValidationFailed, OutcomeError} {
+		m.transfers.WithLabelValues(outcome)
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.requestDuration, m.transfers, m.volume, m.queryDuration,
+	)
+	return m
+}
+
+// Handler serves the registered metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a request to route that was answered with status.
+func (m *Metrics) ObserveRequest(route, method string, status int, elapsed time.Duration) {
+	code := strconv.Itoa(status)
+	m.requests.WithLabelValues(route, method, code).Inc()
+	m.requestDuration.WithLabelValues(route, method, code).Observe(elapsed.Seconds())
+}
+
+// ObserveTransfer records a transfer of amount that returned err.
+func (m *Metrics) ObserveTransfer(amount float64, err error) {
+	outcome := Outcome(err)
+	m.transfers.WithLabelValues(outcome).Inc()
+	if outcome == OutcomeSuccess {
+		m.volume.Add(amount)
+	}
+}
+
+// ObserveQuery records a storage operation that took elapsed.
+func (m *Metrics) ObserveQuery(operation string, elapsed time.Duration) {
+	m.queryDuration.WithLabelValues(operation).Observe(elapsed.Seconds())
+}
+
+// RegisterFunds exposes the total funds of src, queried on every scrape.
+func (m *Metrics) RegisterFunds(src FundsSource) {
+	m.registry.MustRegister(&fundsCollector{
+		src: src,
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "funds_total"),
+			"Sum of the balances of all wallets.", nil, nil),
+	})
+}
+
+// RegisterPool exposes the connection pool statistics of src.
+func (m *Metrics) RegisterPool(src PoolSource) {
+	m.registry.MustRegister(newPoolCollector(src))
+}
+
+// Outcome classifies the error returned by a transfer.
+func Outcome(err error) string {
+	switch {
+	case err == nil:
+		return OutcomeSuccess
+	case errors.Is(err, storage.ErrInsufficient):
+		return OutcomeInsufficient
+	case errors.Is(err, storage.ErrAddressNotExist):
+		return OutcomeAddressNotExist
+	case errors.Is(err, storage.ErrValidation):
+		return OutcomeValidationFailed
+	case errors.Is(err, storage.ErrReferenceUsed):
+		return OutcomeReferenceUsed
+	default:
+		return OutcomeError
+	}
+}
+
+type fundsCollector struct {
+	src  FundsSource
+	desc *prometheus.Desc
+}
+
+func (c *fundsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *fundsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), fundsTimeout)
+	defer cancel()
+
+	total, err := c.src.TotalFunds(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, total)
+}
+
+type poolCollector struct {
+	src PoolSource
+
+	maxOpen      *prometheus.Desc
+	open         *prometheus.Desc
+	inUse        *prometheus.Desc
+	idle         *prometheus.Desc
+	waitCount    *prometheus.Desc
+	waitDuration *prometheus.Desc
+}
+
+func newPoolCollector(src PoolSource) *poolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "storage_pool", name), help, nil, nil)
+	}
+	return &poolCollector{
+		src:          src,
+		maxOpen:      desc("max_open_connections", "Maximum number of open connections, 0 is unlimited."),
+		open:         desc("open_connections", "Open connections, in use and idle."),
+		inUse:        desc("in_use_connections", "Connections currently in use."),
+		idle:         desc("idle_connections", "Idle connections."),
+		waitCount:    desc("wait_count_total", "Times a connection had to be waited for."),
+		waitDuration: desc("wait_duration_seconds_total", "Time spent waiting for connections."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpen
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.src.Stats()
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage/memory"
+)
+
+func address(prefix string) string {
+	return prefix + strings.Repeat("0", 64-len(prefix))
+}
+
+func TestOutcome(t *testing.T) {
+	assert.Equal(t, OutcomeSuccess, Outcome(nil))
+	assert.Equal(t, OutcomeInsufficient, Outcome(fmt.Errorf("op: %w", &storage.InsufficientFundsError{})))
+	assert.Equal(t, OutcomeAddressNotExist, Outcome(fmt.Errorf("op: %w", &storage.NotFoundError{})))
+	assert.Equal(t, OutcomeValidationFailed, Outcome(&storage.ValidationError{}))
+	assert.Equal(t, OutcomeReferenceUsed, Outcome(fmt.Errorf("op: %w", &storage.ReferenceUsedError{})))
+	assert.Equal(t, OutcomeError, Outcome(context.DeadlineExceeded))
+}
+
+func TestStorage_Transfers(t *testing.T) {
+	m := New()
+	st := memory.New()
+	repo := m.Wrap(st)
+	ctx := context.Background()
+
+	require.NoError(t, repo.CreateWallet(ctx, address("a"), 100))
+	require.NoError(t, repo.CreateWallet(ctx, address("b"), 100))
+	require.NoError(t, repo.SendMoney(ctx, address("a"), address("b"), 30))
+	require.NoError(t, repo.SendMoney(ctx, address("a"), address("b"), 20))
+	assert.ErrorIs(t, repo.SendMoney(ctx, address("a"), address("b"), 500), storage.ErrInsufficient)
+	assert.ErrorIs(t, repo.SendMoney(ctx, address("a"), address("c"), 1), storage.ErrAddressNotExist)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.transfers.WithLabelValues(OutcomeSuccess)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.transfers.WithLabelValues(OutcomeInsufficient)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.transfers.WithLabelValues(OutcomeAddressNotExist)))
+	assert.Zero(t, testutil.ToFloat64(m.transfers.WithLabelValues(OutcomeError)))
+	assert.Equal(t, 50.0, testutil.ToFloat64(m.volume))
+
+	assert.Equal(t, 2, testutil.CollectAndCount(m.queryDuration), "CreateWallet and SendMoney")
+	assert.Equal(t, st, storage.Unwrap(repo))
+}
+
+func TestMetrics_Handler(t *testing.T) {
+	m := New()
+	st := memory.New()
+	m.RegisterFunds(st)
+	m.RegisterPool(poolStats{InUse: 2, Idle: 1, OpenConnections: 3, WaitCount: 4, WaitDuration: time.Second})
+	require.NoError(t, st.CreateWallet(context.Background(), address("a"), 125))
+
+	m.ObserveRequest("/api/wallet/{address}/balance", http.MethodGet, http.StatusOK, 10*time.Millisecond)
+
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	body := rr.Body.String()
+	assert.Contains(t, body, `transaction_service_http_requests_total{method="GET",route="/api/wallet/{address}/balance",status="200"} 1`)
+	assert.Contains(t, body, `transaction_service_http_request_duration_seconds_bucket{method="GET",route="/api/wallet/{address}/balance",status="200",le="0.01"} 1`)
+	assert.Contains(t, body, `transaction_service_transfers_total{outcome="insufficient_funds"} 0`)
+	assert.Contains(t, body, "transaction_service_funds_total 125")
+	assert.Contains(t, body, "transaction_service_storage_pool_in_use_connections 2")
+	assert.Contains(t, body, "transaction_service_storage_pool_wait_duration_seconds_total 1")
+	assert.Contains(t, body, "go_goroutines")
+}
+
+func TestMetrics_FundsError(t *testing.T) {
+	m := New()
+	m.RegisterFunds(failingFunds{})
+
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Contains(t, rr.Body.String(), "database is locked")
+}
+
+type poolStats sql.DBStats
+
+func (s poolStats) Stats() sql.DBStats {
+	return sql.DBStats(s)
+}
+
+type failingFunds struct{}
+
+func (failingFunds) TotalFunds(context.Context) (float64, error) {
+	return 0, errors.New("database is locked")
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+)
+
+// Storage is a storage.Repository decorator recording the latency of every
+// operation and the outcome of every transfer, whichever way it was made.
+type Storage struct {
+	storage.Repository
+
+	metrics *Metrics
+}
+
+// Wrap returns repo with its operations recorded in m.
+func (m *Metrics) Wrap(repo storage.Repository) *Storage {
+	return &Storage{Repository: repo, metrics: m}
+}
+
+// Unwrap returns the decorated repository.
+func (st *Storage) Unwrap() storage.Repository {
+	return st.Repository
+}
+
+func (st *Storage) CreateWallet(ctx context.Context, address string, amount float64) error {
+	defer st.observe("CreateWallet", time.Now())
+	return st.Repository.CreateWallet(ctx, address, amount)
+}
+
+func (st *Storage) GetBalance(ctx context.Context, address string) (float64, error) {
+	defer st.observe("GetBalance", time.Now())
+	return st.Repository.GetBalance(ctx, address)
+}
+
+func (st *Storage) SendMoney(ctx context.Context, from string, to string, amount float64) error {
+	defer st.observe("SendMoney", time.Now())
+	err := st.Repository.SendMoney(ctx, from, to, amount)
+	st.metrics.ObserveTransfer(amount, err)
+	return err
+}
+
+func (st *Storage) SendMoneyWithReference(ctx context.Context, reference, from, to string, amount float64) error {
+	defer st.observe("SendMoneyWithReference", time.Now())
+	err := st.Repository.SendMoneyWithReference(ctx, reference, from, to, amount)
+	st.metrics.ObserveTransfer(amount, err)
+	return err
+}
+
+func (st *Storage) HasReference(ctx context.Context, reference string) (bool, error) {
+	defer st.observe("HasReference", time.Now())
+	return st.Repository.HasReference(ctx, reference)
+}
+
+func (st *Storage) GetLast(ctx context.Context, count int) ([]transaction.Request, error) {
+	defer st.observe("GetLast", time.Now())
+	return st.Repository.GetLast(ctx, count)
+}
+
+func (st *Storage) GetHistory(ctx context.Context, address string, count int) ([]transaction.Request, error) {
+	defer st.observe("GetHistory", time.Now())
+	return st.Repository.GetHistory(ctx, address, count)
+}
+
+func (st *Storage) observe(operation string, start time.Time) {
+	st.metrics.ObserveQuery(operation, time.Since(start))
+}
@@ -0,0 +1,264 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+)
+
+var (
+	ErrDenied         = errors.New("transfer denied by risk rule")
+	ErrHeld           = errors.New("transfer held for review")
+	ErrReviewNotFound = errors.New("review not found")
+	ErrReviewDecided  = errors.New("review is already decided")
+)
+
+// Review statuses. A held transfer is pending until a reviewer approves
+// or rejects it. An approved transfer is executing until it is executed,
+// then approved, or fails, then failed.
+const (
+	StatusPending   = "pending"
+	StatusExecuting = "executing"
+	StatusApproved  = "approved"
+	StatusRejected  = "rejected"
+	StatusFailed    = "failed"
+)
+
+// DeniedError is returned for a transfer denied by a rule.
+type DeniedError struct {
+	Rule   string
+	Reason string
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("%s %s: %s", ErrDenied, e.Rule, e.Reason)
+}
+
+func (e *DeniedError) Is(target error) bool {
+	return target == ErrDenied
+}
+
+// HeldError is returned for a transfer queued for review instead of being
+// executed.
+type HeldError struct {
+	Review Review
+}
+
+func (e *HeldError) Error() string {
+	return fmt.Sprintf("%s %d by rule %s: %s", ErrHeld, e.Review.ID, e.Review.Rule, e.Review.Reason)
+}
+
+func (e *HeldError) Is(target error) bool {
+	return target == ErrHeld
+}
+
+// Review is a transfer held by a rule.
+type Review struct {
+	ID        int64      `json:"id"`
+	From      string     `json:"from"`
+	To        string     `json:"to"`
+	Amount    float64    `json:"amount"`
+	Rule      string     `json:"rule"`
+	Reason    string     `json:"reason"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+	DecidedBy string     `json:"decided_by,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// ReviewStore persists held transfers. DecideReview moves a pending
+// review to status and returns ErrReviewDecided for any other review;
+// GetReview and DecideReview return ErrReviewNotFound for unknown ids.
+// CompleteReview moves an executing review to approved.
+type ReviewStore interface {
+	CreateReview(ctx context.Context, r Review) (Review, error)
+	GetReview(ctx context.Context, id int64) (Review, error)
+	ListReviews(ctx context.Context, status string, count int) ([]Review, error)
+	DecideReview(ctx context.Context, id int64, status, by string, at time.Time) (Review, error)
+	CompleteReview(ctx context.Context, id int64) error
+	FailReview(ctx context.Context, id int64, message string) error
+}
+
+// Sender executes a transfer identified by a reference at most once, see
+// storage.Repository.
+type Sender interface {
+	SendMoneyWithReference(ctx context.Context, reference, from, to string, amount float64) error
+	HasReference(ctx context.Context, reference string) (bool, error)
+}
+
+// Reference returns the reference the transfer of review id is executed
+// with.
+func Reference(id int64) string {
+	return "review:" + strconv.FormatInt(id, 10)
+}
+
+// Service applies the decisions of the engine to transfers and executes
+// the held ones a reviewer approves.
+type Service struct {
+	engine  *Engine
+	reviews ReviewStore
+	sender  Sender
+	now     func() time.Time
+}
+
+// NewService returns a service queuing held transfers in reviews and
+// executing approved ones with sender. reviews may be nil when no rule
+// holds transfers.
+func NewService(engine *Engine, reviews ReviewStore, sender Sender) (*Service, error) {
+	if engine.Holds() && reviews == nil {
+		return nil, errors.New("risk.NewService: rules with the hold action require a review queue")
+	}
+	return &Service{engine: engine, reviews: reviews, sender: sender, now: time.Now}, nil
+}
+
+// Evaluate returns the decision on tr without acting on it.
+func (s *Service) Evaluate(ctx context.Context, tr Transfer) (Result, error) {
+	return s.engine.Evaluate(ctx, tr)
+}
+
+// CheckTransfer returns nil for an allowed transfer, a DeniedError for a
+// denied one and a HeldError once a held one is queued for review.
+func (s *Service) CheckTransfer(ctx context.Context, from, to string, amount float64) error {
+	const op = "risk.CheckTransfer"
+
+	res, err := s.engine.Evaluate(ctx, Transfer{From: from, To: to, Amount: amount})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	switch res.Action {
+	case ActionDeny:
+		return fmt.Errorf("%s: %w", op, &DeniedError{Rule: res.Rule, Reason: res.Reason})
+	case ActionHold:
+		review, err := s.reviews.CreateReview(ctx, Review{
+			From:      from,
+			To:        to,
+			Amount:    amount,
+			Rule:      res.Rule,
+			Reason:    res.Reason,
+			Status:    StatusPending,
+			CreatedAt: s.now().UTC().Truncate(time.Second),
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return fmt.Errorf("%s: %w", op, &HeldError{Review: review})
+	}
+	return nil
+}
+
+// List returns up to count reviews with status, newest first; every
+// status when it is empty.
+func (s *Service) List(ctx context.Context, status string, count int) ([]Review, error) {
+	const op = "risk.List"
+
+	switch status {
+	case "", StatusPending, StatusExecuting, StatusApproved, StatusRejected, StatusFailed:
+	default:
+		return nil, fmt.Errorf("%s: unknown status %q", op, status)
+	}
+
+	reviews, err := s.reviews.ListReviews(ctx, status, count)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return reviews, nil
+}
+
+// Approve executes a pending transfer without evaluating the rules again.
+// The review is claimed as executing before the transfer, which runs with
+// the reference of the review, so it is executed at most once even if the
+// process stops before the review is marked approved; Recover finishes such
+// reviews. If the transfer fails the review is marked failed and the error
+// returned.
+func (s *Service) Approve(ctx context.Context, id int64, by string) (Review, error) {
+	const op = "risk.Approve"
+
+	review, err := s.reviews.DecideReview(ctx, id, StatusExecuting, by, s.now().UTC().Truncate(time.Second))
+	if err != nil {
+		return Review{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	review, err = s.execute(ctx, review)
+	if err != nil {
+		return review, fmt.Errorf("%s: %w", op, err)
+	}
+	return review, nil
+}
+
+// Recover finishes the reviews left executing by a stop between claiming
+// and completing them and returns how many it finished. A review whose
+// transfer was executed is marked approved; the transfer of any other is
+// executed now.
+func (s *Service) Recover(ctx context.Context) (int, error) {
+	const op = "risk.Recover"
+
+	if s.reviews == nil {
+		return 0, nil
+	}
+
+	reviews, err := s.reviews.ListReviews(ctx, StatusExecuting, -1)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, review := range reviews {
+		executed, err := s.sender.HasReference(ctx, Reference(review.ID))
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		if executed {
+			if err := s.reviews.CompleteReview(ctx, review.ID); err != nil {
+				return 0, fmt.Errorf("%s: %w", op, err)
+			}
+			continue
+		}
+
+		// A transfer that fails is recorded on its review.
+		if review, err = s.execute(ctx, review); err != nil && review.Status != StatusFailed {
+			return 0, fmt.Errorf("%s: review %d: %w", op, review.ID, err)
+		}
+	}
+	return len(reviews), nil
+}
+
+// execute runs the transfer of an executing review and marks the review
+// approved or failed. The outcome is recorded even if ctx is cancelled
+// meanwhile; a transfer that returns an error but has committed, e.g.
+// because ctx expired after the commit, is approved.
+func (s *Service) execute(ctx context.Context, review Review) (Review, error) {
+	ref := Reference(review.ID)
+	err := s.sender.SendMoneyWithReference(ctx, ref, review.From, review.To, review.Amount)
+	if err != nil && !errors.Is(err, storage.ErrReferenceUsed) {
+		executed, checkErr := s.sender.HasReference(context.WithoutCancel(ctx), ref)
+		if checkErr != nil || !executed {
+			if failErr := s.reviews.FailReview(context.WithoutCancel(ctx), review.ID, err.Error()); failErr != nil {
+				return review, fmt.Errorf("%w (marking the review failed: %v)", err, failErr)
+			}
+			review.Status, review.Error = StatusFailed, err.Error()
+			return review, err
+		}
+	}
+
+	if err := s.reviews.CompleteReview(context.WithoutCancel(ctx), review.ID); err != nil {
+		return review, fmt.Errorf("marking the review approved: %w", err)
+	}
+	review.Status = StatusApproved
+	return review, nil
+}
+
+// Reject drops a pending transfer.
+func (s *Service) Reject(ctx context.Context, id int64, by string) (Review, error) {
+	const op = "risk.Reject"
+
+	review, err := s.reviews.DecideReview(ctx, id, StatusRejected, by, s.now().UTC().Truncate(time.Second))
+	if err != nil {
+		return Review{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return review, nil
+}
@@ -0,0 +1,249 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/config"
+	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+)
+
+type memoryReviewStore struct {
+	mu      sync.Mutex
+	reviews []Review
+}
+
+func (m *memoryReviewStore) CreateReview(ctx context.Context, r Review) (Review, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r.ID = int64(len(m.reviews) + 1)
+	m.reviews = append(m.reviews, r)
+	return r, nil
+}
+
+func (m *memoryReviewStore) GetReview(ctx context.Context, id int64) (Review, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || id > int64(len(m.reviews)) {
+		return Review{}, ErrReviewNotFound
+	}
+	return m.reviews[id-1], nil
+}
+
+func (m *memoryReviewStore) ListReviews(ctx context.Context, status string, count int) ([]Review, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []Review{}
+	for i := len(m.reviews) - 1; i >= 0 && len(out) != count; i-- {
+		if status == "" || m.reviews[i].Status == status {
+			out = append(out, m.reviews[i])
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryReviewStore) DecideReview(ctx context.Context, id int64, status, by string, at time.Time) (Review, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || id > int64(len(m.reviews)) {
+		return Review{}, ErrReviewNotFound
+	}
+	r := &m.reviews[id-1]
+	if r.Status != StatusPending {
+		return Review{}, ErrReviewDecided
+	}
+	r.Status, r.DecidedBy, r.DecidedAt = status, by, &at
+	return *r, nil
+}
+
+func (m *memoryReviewStore) CompleteReview(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.reviews[id-1].Status == StatusExecuting {
+		m.reviews[id-1].Status = StatusApproved
+	}
+	return nil
+}
+
+func (m *memoryReviewStore) FailReview(ctx context.Context, id int64, message string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reviews[id-1].Status, m.reviews[id-1].Error = StatusFailed, message
+	return nil
+}
+
+// fakeSender executes every reference once. With err set it fails every
+// transfer, and with committed set too it executes the transfer first.
+type fakeSender struct {
+	sent       []Transfer
+	references []string
+	err        error
+	committed  bool
+}
+
+func (f *fakeSender) SendMoneyWithReference(ctx context.Context, reference, from, to string, amount float64) error {
+	if used, _ := f.HasReference(ctx, reference); used {
+		return &storage.ReferenceUsedError{Reference: reference}
+	}
+	if f.err != nil && !f.committed {
+		return f.err
+	}
+	f.sent = append(f.sent, Transfer{From: from, To: to, Amount: amount})
+	f.references = append(f.references, reference)
+	return f.err
+}
+
+func (f *fakeSender) HasReference(ctx context.Context, reference string) (bool, error) {
+	return slices.Contains(f.references, reference), nil
+}
+
+func newTestService(t *testing.T, sender Sender) (*Service, *memoryReviewStore) {
+	t.Helper()
+	h := &fakeHistory{txs: []transaction.Request{tx("b", "a", 5, time.Minute)}}
+	e := newTestEngine(t, h,
+		config.RiskRule{Name: "large", Type: TypeNewWalletLargeAmount, Action: ActionDeny, Amount: 1000, MinAge: time.Hour},
+		config.RiskRule{Name: "back", Type: TypeRoundTrip, Action: ActionHold, Window: time.Hour},
+	)
+	store := &memoryReviewStore{}
+	s, err := NewService(e, store, sender)
+	require.NoError(t, err)
+	s.now = func() time.Time { return now }
+	return s, store
+}
+
+func TestNewService_HoldRequiresQueue(t *testing.T) {
+	e := newTestEngine(t, &fakeHistory{}, config.RiskRule{Type: TypeRoundTrip, Action: ActionHold, Window: time.Hour})
+	_, err := NewService(e, nil, &fakeSender{})
+	assert.Error(t, err)
+
+	e = newTestEngine(t, &fakeHistory{}, config.RiskRule{Type: TypeRoundTrip, Action: ActionDeny, Window: time.Hour})
+	_, err = NewService(e, nil, &fakeSender{})
+	assert.NoError(t, err)
+}
+
+func TestService_CheckTransfer(t *testing.T) {
+	s, store := newTestService(t, &fakeSender{})
+	ctx := context.Background()
+
+	assert.NoError(t, s.CheckTransfer(ctx, "a", "c", 5))
+
+	err := s.CheckTransfer(ctx, "a", "c", 1000)
+	var denied *DeniedError
+	require.ErrorAs(t, err, &denied)
+	assert.ErrorIs(t, err, ErrDenied)
+	assert.Equal(t, "large", denied.Rule)
+
+	err = s.CheckTransfer(ctx, "a", "b", 5)
+	var held *HeldError
+	require.ErrorAs(t, err, &held)
+	assert.ErrorIs(t, err, ErrHeld)
+	assert.Equal(t, Review{ID: 1, From: "a", To: "b", Amount: 5, Rule: "back", Reason: held.Review.Reason, Status: StatusPending, CreatedAt: now}, held.Review)
+	assert.Len(t, store.reviews, 1)
+}
+
+func TestService_Decide(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("approve", func(t *testing.T) {
+		sender := &fakeSender{}
+		s, _ := newTestService(t, sender)
+		require.ErrorIs(t, s.CheckTransfer(ctx, "a", "b", 5), ErrHeld)
+
+		review, err := s.Approve(ctx, 1, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, StatusApproved, review.Status)
+		assert.Equal(t, "alice", review.DecidedBy)
+		assert.Equal(t, []Transfer{{From: "a", To: "b", Amount: 5}}, sender.sent)
+		assert.Equal(t, []string{Reference(1)}, sender.references)
+
+		_, err = s.Approve(ctx, 1, "alice")
+		assert.ErrorIs(t, err, ErrReviewDecided)
+		_, err = s.Reject(ctx, 1, "alice")
+		assert.ErrorIs(t, err, ErrReviewDecided)
+		assert.Len(t, sender.sent, 1)
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		sender := &fakeSender{}
+		s, _ := newTestService(t, sender)
+		require.ErrorIs(t, s.CheckTransfer(ctx, "a", "b", 5), ErrHeld)
+
+		review, err := s.Reject(ctx, 1, "bob")
+		require.NoError(t, err)
+		assert.Equal(t, StatusRejected, review.Status)
+		assert.Empty(t, sender.sent)
+
+		_, err = s.Reject(ctx, 2, "bob")
+		assert.ErrorIs(t, err, ErrReviewNotFound)
+	})
+
+	t.Run("failed transfer", func(t *testing.T) {
+		sender := &fakeSender{err: errors.New("insufficient funds")}
+		s, store := newTestService(t, sender)
+		require.ErrorIs(t, s.CheckTransfer(ctx, "a", "b", 5), ErrHeld)
+
+		_, err := s.Approve(ctx, 1, "alice")
+		assert.ErrorIs(t, err, sender.err)
+		assert.Equal(t, StatusFailed, store.reviews[0].Status)
+		assert.Equal(t, "insufficient funds", store.reviews[0].Error)
+
+		failed, err := s.List(ctx, StatusFailed, 10)
+		require.NoError(t, err)
+		assert.Len(t, failed, 1)
+	})
+
+	t.Run("transfer committed before failing", func(t *testing.T) {
+		sender := &fakeSender{err: context.DeadlineExceeded, committed: true}
+		s, store := newTestService(t, sender)
+		require.ErrorIs(t, s.CheckTransfer(ctx, "a", "b", 5), ErrHeld)
+
+		review, err := s.Approve(ctx, 1, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, StatusApproved, review.Status)
+		assert.Equal(t, StatusApproved, store.reviews[0].Status)
+	})
+
+	t.Run("list unknown status", func(t *testing.T) {
+		s, _ := newTestService(t, &fakeSender{})
+		_, err := s.List(ctx, "done", 10)
+		assert.Error(t, err)
+	})
+}
+
+func TestService_Recover(t *testing.T) {
+	ctx := context.Background()
+	sender := &fakeSender{}
+	s, store := newTestService(t, sender)
+	for i := 0; i < 3; i++ {
+		require.ErrorIs(t, s.CheckTransfer(ctx, "a", "b", float64(i+1)), ErrHeld)
+	}
+
+	// The process stopped after claiming the first two reviews, and after
+	// executing the transfer of the first.
+	for _, id := range []int64{1, 2} {
+		_, err := store.DecideReview(ctx, id, StatusExecuting, "alice", now)
+		require.NoError(t, err)
+	}
+	require.NoError(t, sender.SendMoneyWithReference(ctx, Reference(1), "a", "b", 1))
+
+	recovered, err := s.Recover(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, recovered)
+	assert.Equal(t, StatusApproved, store.reviews[0].Status)
+	assert.Equal(t, StatusApproved, store.reviews[1].Status)
+	assert.Equal(t, StatusPending, store.reviews[2].Status)
+	assert.Equal(t, []Transfer{{From: "a", To: "b", Amount: 1}, {From: "a", To: "b", Amount: 2}}, sender.sent)
+
+	recovered, err = s.Recover(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, recovered)
+	assert.Len(t, sender.sent, 2)
+}
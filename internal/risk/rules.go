@@ -0,0 +1,221 @@
+// Package risk evaluates transfers against configured rules before they are
+// executed and keeps the queue of transfers held for manual review.
+package risk
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/config"
+	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
+)
+
+// Actions a rule may take on a matching transfer.
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+	ActionHold  = "hold"
+)
+
+// Rule types.
+const (
+	// TypeNewWalletLargeAmount matches transfers of at least Amount from a
+	// wallet without transactions or whose oldest transaction is younger
+	// than MinAge.
+	TypeNewWalletLargeAmount = "new_wallet_large_amount"
+	// TypeFanOut matches a transfer that makes the sender pay more than
+	// MaxRecipients distinct wallets within Window.
+	TypeFanOut = "fan_out"
+	// TypeRoundTrip matches a transfer back to a wallet that paid the
+	// sender within Window.
+	TypeRoundTrip = "round_trip"
+)
+
+// Transfer is a transfer about to be executed, with addresses in the
+// stored hex form.
+type Transfer struct {
+	From   string
+	To     string
+	Amount float64
+}
+
+// Result is the decision on a transfer. Rule and Reason are empty when no
+// rule matched.
+type Result struct {
+	Action string `json:"action"`
+	Rule   string `json:"rule,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// History gives the latest transactions of a wallet, newest first.
+type History interface {
+	GetHistory(ctx context.Context, address string, count int) ([]transaction.Request, error)
+}
+
+// matcher reports whether a rule matches tr given the history of the
+// sender and, if so, why.
+type matcher func(tr Transfer, history []transaction.Request, now time.Time) (string, bool)
+
+type rule struct {
+	config.RiskRule
+	match matcher
+}
+
+// Engine evaluates transfers against the rules in configuration order.
+type Engine struct {
+	rules   []rule
+	history History
+	limit   int
+	now     func() time.Time
+}
+
+// NewEngine validates the rules of cfg.
+func NewEngine(cfg config.Risk, history History) (*Engine, error) {
+	const op = "risk.NewEngine"
+
+	if cfg.HistoryLimit <= 0 {
+		return nil, fmt.Errorf("%s: history_limit must be positive", op)
+	}
+
+	e := &Engine{history: history, limit: cfg.HistoryLimit, now: time.Now}
+	names := make(map[string]bool, len(cfg.Rules))
+	for i, rc := range cfg.Rules {
+		if rc.Name == "" {
+			rc.Name = rc.Type
+		}
+		r, err := e.newRule(rc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: rule %d (%s): %w", op, i+1, rc.Name, err)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("%s: duplicate rule name %q", op, r.Name)
+		}
+		names[r.Name] = true
+		e.rules = append(e.rules, r)
+	}
+	return e, nil
+}
+
+func (e *Engine) newRule(rc config.RiskRule) (rule, error) {
+	switch rc.Action {
+	case ActionAllow, ActionDeny, ActionHold:
+	default:
+		return rule{}, fmt.Errorf("unknown action %q, use allow, deny or hold", rc.Action)
+	}
+	if rc.Amount < 0 {
+		return rule{}, fmt.Errorf("amount must not be negative")
+	}
+
+	r := rule{RiskRule: rc}
+	switch rc.Type {
+	case TypeNewWalletLargeAmount:
+		if rc.Amount <= 0 || rc.MinAge <= 0 {
+			return rule{}, fmt.Errorf("%s requires a positive amount and min_age", rc.Type)
+		}
+		r.match = e.newWallet(rc)
+	case TypeFanOut:
+		if rc.Window <= 0 || rc.MaxRecipients <= 0 {
+			return rule{}, fmt.Errorf("%s requires a positive window and max_recipients", rc.Type)
+		}
+		r.match = fanOut(rc)
+	case TypeRoundTrip:
+		if rc.Window <= 0 {
+			return rule{}, fmt.Errorf("%s requires a positive window", rc.Type)
+		}
+		r.match = roundTrip(rc)
+	default:
+		return rule{}, fmt.Errorf("unknown type %q", rc.Type)
+	}
+	return r, nil
+}
+
+// Holds reports whether any rule holds transfers for review.
+func (e *Engine) Holds() bool {
+	for _, r := range e.rules {
+		if r.Action == ActionHold {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate returns the decision of the first rule matching tr, or allow.
+// The history of the sender is only read when a rule applies to the amount.
+func (e *Engine) Evaluate(ctx context.Context, tr Transfer) (Result, error) {
+	const op = "risk.Evaluate"
+
+	var (
+		history []transaction.Request
+		loaded  bool
+	)
+	now := e.now()
+	for _, r := range e.rules {
+		if tr.Amount < r.Amount {
+			continue
+		}
+		if !loaded {
+			var err error
+			if history, err = e.history.GetHistory(ctx, tr.From, e.limit); err != nil {
+				return Result{}, fmt.Errorf("%s: %w", op, err)
+			}
+			loaded = true
+		}
+
+		if reason, ok := r.match(tr, history, now); ok {
+			return Result{Action: r.Action, Rule: r.Name, Reason: reason}, nil
+		}
+	}
+	return Result{Action: ActionAllow}, nil
+}
+
+func (e *Engine) newWallet(rc config.RiskRule) matcher {
+	return func(tr Transfer, history []transaction.Request, now time.Time) (string, bool) {
+		if len(history) == 0 {
+			return fmt.Sprintf("wallet without transactions sends %g", tr.Amount), true
+		}
+		// A full page of history means an established wallet, whatever
+		// the age of the oldest transaction on it.
+		if len(history) >= e.limit {
+			return "", false
+		}
+		age := now.Sub(history[len(history)-1].Created_at)
+		if age >= rc.MinAge {
+			return "", false
+		}
+		return fmt.Sprintf("wallet first used %s ago sends %g", age.Truncate(time.Second), tr.Amount), true
+	}
+}
+
+func fanOut(rc config.RiskRule) matcher {
+	return func(tr Transfer, history []transaction.Request, now time.Time) (string, bool) {
+		recipients := map[string]bool{strings.ToLower(tr.To): true}
+		for _, h := range history {
+			if now.Sub(h.Created_at) > rc.Window {
+				break
+			}
+			if strings.EqualFold(h.From, tr.From) {
+				recipients[strings.ToLower(h.To)] = true
+			}
+		}
+		if len(recipients) <= rc.MaxRecipients {
+			return "", false
+		}
+		return fmt.Sprintf("%d recipients within %s", len(recipients), rc.Window), true
+	}
+}
+
+func roundTrip(rc config.RiskRule) matcher {
+	return func(tr Transfer, history []transaction.Request, now time.Time) (string, bool) {
+		for _, h := range history {
+			if now.Sub(h.Created_at) > rc.Window {
+				break
+			}
+			if strings.EqualFold(h.From, tr.To) && strings.EqualFold(h.To, tr.From) {
+				return fmt.Sprintf("recipient sent %g to the sender within %s", h.Amount, rc.Window), true
+			}
+		}
+		return "", false
+	}
+}
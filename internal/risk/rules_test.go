@@ -0,0 +1,179 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/config"
+	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
+)
+
+type fakeHistory struct {
+	txs   []transaction.Request
+	err   error
+	calls int
+}
+
+func (f *fakeHistory) GetHistory(ctx context.Context, address string, count int) ([]transaction.Request, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	var out []transaction.Request
+	for _, tx := range f.txs {
+		if tx.From == address || tx.To == address {
+			out = append(out, tx)
+		}
+		if len(out) == count {
+			break
+		}
+	}
+	return out, nil
+}
+
+var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestEngine(t *testing.T, history History, rules ...config.RiskRule) *Engine {
+	t.Helper()
+	e, err := NewEngine(config.Risk{HistoryLimit: 10, Rules: rules}, history)
+	require.NoError(t, err)
+	e.now = func() time.Time { return now }
+	return e
+}
+
+func tx(from, to string, amount float64, ago time.Duration) transaction.Request {
+	return transaction.Request{From: from, To: to, Amount: amount, Created_at: now.Add(-ago)}
+}
+
+func TestNewEngine(t *testing.T) {
+	valid := config.RiskRule{Type: TypeRoundTrip, Action: ActionDeny, Window: time.Hour}
+
+	tests := []struct {
+		name  string
+		rules []config.RiskRule
+		err   string
+	}{
+		{"no rules", nil, ""},
+		{"valid", []config.RiskRule{valid}, ""},
+		{"unknown type", []config.RiskRule{{Type: "velocity", Action: ActionDeny}}, `unknown type "velocity"`},
+		{"unknown action", []config.RiskRule{{Type: TypeRoundTrip, Action: "block", Window: time.Hour}}, `unknown action "block"`},
+		{"missing window", []config.RiskRule{{Type: TypeFanOut, Action: ActionDeny, MaxRecipients: 3}}, "requires a positive window"},
+		{"missing min age", []config.RiskRule{{Type: TypeNewWalletLargeAmount, Action: ActionHold, Amount: 100}}, "requires a positive amount and min_age"},
+		{"duplicate name", []config.RiskRule{valid, valid}, `duplicate rule name "round_trip"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewEngine(config.Risk{HistoryLimit: 10, Rules: tt.rules}, &fakeHistory{})
+			if tt.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+
+	_, err := NewEngine(config.Risk{}, &fakeHistory{})
+	assert.ErrorContains(t, err, "history_limit")
+}
+
+func TestEngine_NewWalletLargeAmount(t *testing.T) {
+	rule := config.RiskRule{Name: "new-wallet", Type: TypeNewWalletLargeAmount, Action: ActionHold, Amount: 50, MinAge: 24 * time.Hour}
+
+	tests := []struct {
+		name    string
+		txs     []transaction.Request
+		amount  float64
+		action  string
+		history bool
+	}{
+		{"small amount", nil, 10, ActionAllow, false},
+		{"no history", nil, 50, ActionHold, true},
+		{"young wallet", []transaction.Request{tx("x", "a", 100, time.Hour)}, 60, ActionHold, true},
+		{"old wallet", []transaction.Request{tx("x", "a", 100, 48*time.Hour)}, 60, ActionAllow, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &fakeHistory{txs: tt.txs}
+			res, err := newTestEngine(t, h, rule).Evaluate(context.Background(), Transfer{From: "a", To: "b", Amount: tt.amount})
+			require.NoError(t, err)
+			assert.Equal(t, tt.action, res.Action)
+			if tt.action != ActionAllow {
+				assert.Equal(t, "new-wallet", res.Rule)
+				assert.NotEmpty(t, res.Reason)
+			}
+			assert.Equal(t, tt.history, h.calls > 0)
+		})
+	}
+
+	t.Run("full page of history", func(t *testing.T) {
+		var txs []transaction.Request
+		for i := 0; i < 10; i++ {
+			txs = append(txs, tx("x", "a", 1, time.Minute))
+		}
+		res, err := newTestEngine(t, &fakeHistory{txs: txs}, rule).Evaluate(context.Background(), Transfer{From: "a", To: "b", Amount: 60})
+		require.NoError(t, err)
+		assert.Equal(t, ActionAllow, res.Action)
+	})
+}
+
+func TestEngine_FanOut(t *testing.T) {
+	rule := config.RiskRule{Type: TypeFanOut, Action: ActionDeny, Window: time.Hour, MaxRecipients: 2}
+	h := &fakeHistory{txs: []transaction.Request{
+		tx("a", "c", 1, 10*time.Minute),
+		tx("d", "a", 1, 15*time.Minute),
+		tx("a", "b", 1, 20*time.Minute),
+		tx("a", "e", 1, 2*time.Hour),
+	}}
+	e := newTestEngine(t, h, rule)
+
+	res, err := e.Evaluate(context.Background(), Transfer{From: "a", To: "b", Amount: 1})
+	require.NoError(t, err)
+	assert.Equal(t, ActionAllow, res.Action, "repeated recipient")
+
+	res, err = e.Evaluate(context.Background(), Transfer{From: "a", To: "f", Amount: 1})
+	require.NoError(t, err)
+	assert.Equal(t, Result{Action: ActionDeny, Rule: TypeFanOut, Reason: "3 recipients within 1h0m0s"}, res)
+}
+
+func TestEngine_RoundTrip(t *testing.T) {
+	rule := config.RiskRule{Type: TypeRoundTrip, Action: ActionDeny, Window: time.Hour}
+	h := &fakeHistory{txs: []transaction.Request{
+		tx("b", "a", 5, 10*time.Minute),
+		tx("c", "a", 5, 2*time.Hour),
+	}}
+	e := newTestEngine(t, h, rule)
+
+	res, err := e.Evaluate(context.Background(), Transfer{From: "a", To: "b", Amount: 5})
+	require.NoError(t, err)
+	assert.Equal(t, ActionDeny, res.Action)
+
+	res, err = e.Evaluate(context.Background(), Transfer{From: "a", To: "c", Amount: 5})
+	require.NoError(t, err)
+	assert.Equal(t, ActionAllow, res.Action, "outside the window")
+}
+
+func TestEngine_FirstMatchWins(t *testing.T) {
+	h := &fakeHistory{txs: []transaction.Request{tx("b", "a", 5, time.Minute)}}
+	e := newTestEngine(t, h,
+		config.RiskRule{Name: "trusted", Type: TypeRoundTrip, Action: ActionAllow, Window: time.Hour},
+		config.RiskRule{Name: "strict", Type: TypeRoundTrip, Action: ActionDeny, Window: time.Hour},
+	)
+
+	res, err := e.Evaluate(context.Background(), Transfer{From: "a", To: "b", Amount: 5})
+	require.NoError(t, err)
+	assert.Equal(t, ActionAllow, res.Action)
+	assert.Equal(t, "trusted", res.Rule)
+	assert.Equal(t, 1, h.calls)
+
+	h.err = errors.New("disk failure")
+	_, err = e.Evaluate(context.Background(), Transfer{From: "a", To: "b", Amount: 5})
+	assert.ErrorIs(t, err, h.err)
+}
@@ -0,0 +1,460 @@
+// Package screening rejects transfers to and from addresses on block lists
+// and keeps an audit trail of the rejected transfers.
+package screening
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/address"
+	"github.com/Petro-vich/transaction_processing_go/internal/config"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/logger/sl"
+)
+
+var (
+	ErrBlocked       = errors.New("address is blocked")
+	ErrUnknownList   = errors.New("unknown screening list, use block or allow")
+	ErrEntryNotFound = errors.New("screening entry not found")
+	ErrFileEntry     = errors.New("screening entry comes from a list file")
+)
+
+// Lists. An address on the allow list is never blocked, so the allow list
+// clears false positives of broad block lists.
+const (
+	ListBlock = "block"
+	ListAllow = "allow"
+)
+
+// SourceAPI is the source of entries added through the admin API. Entries
+// read from a list file have the path of the file as their source.
+const SourceAPI = "api"
+
+// Entry is an address on a list.
+type Entry struct {
+	List      string    `json:"list"`
+	Address   string    `json:"address"`
+	Note      string    `json:"note,omitempty"`
+	Source    string    `json:"source"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Hit is a transfer rejected because of a blocked address.
+type Hit struct {
+	ID        int64     `json:"id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Amount    float64   `json:"amount"`
+	Address   string    `json:"address"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BlockedError is returned for a transfer from or to a blocked address.
+type BlockedError struct {
+	Address string
+	// Role is sender or recipient.
+	Role   string
+	Source string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("%s: %s %s", ErrBlocked, e.Role, e.Address)
+}
+
+func (e *BlockedError) Is(target error) bool {
+	return target == ErrBlocked
+}
+
+// Store persists the entries added through the admin API and the hits.
+// AddScreeningEntry replaces an entry of the same list and address;
+// RemoveScreeningEntry returns ErrEntryNotFound for an unknown entry.
+type Store interface {
+	AddScreeningEntry(ctx context.Context, e Entry) error
+	RemoveScreeningEntry(ctx context.Context, list, address string) error
+	ListScreeningEntries(ctx context.Context) ([]Entry, error)
+	RecordScreeningHit(ctx context.Context, h Hit) (Hit, error)
+	ListScreeningHits(ctx context.Context, count int) ([]Hit, error)
+}
+
+// Sender executes a transfer identified by a reference, see
+// storage.Repository.
+type Sender interface {
+	SendMoneyWithReference(ctx context.Context, reference, from, to string, amount float64) error
+	HasReference(ctx context.Context, reference string) (bool, error)
+}
+
+// lists maps a list name to the entries on it by address.
+type lists map[string]map[string]Entry
+
+func newLists() lists {
+	return lists{ListBlock: {}, ListAllow: {}}
+}
+
+// Stats counts the distinct addresses on each list.
+type Stats struct {
+	Block int `json:"block"`
+	Allow int `json:"allow"`
+}
+
+// Screener checks transfers against the lists read from files and the
+// entries of the store.
+type Screener struct {
+	store    Store
+	files    map[string][]string
+	interval time.Duration
+	log      *slog.Logger
+
+	now func() time.Time
+
+	// apiMu serializes Load and the API changes, so a change made while
+	// Load reads the store is neither lost nor undone by its swap.
+	apiMu sync.Mutex
+
+	mu       sync.RWMutex
+	fromFile lists
+	fromAPI  lists
+}
+
+// New returns a screener with empty lists; call Load to read them.
+func New(store Store, cfg config.Screening, log *slog.Logger) *Screener {
+	return &Screener{
+		store:    store,
+		files:    map[string][]string{ListBlock: cfg.BlockFiles, ListAllow: cfg.AllowFiles},
+		interval: cfg.ReloadInterval,
+		log:      log,
+		now:      time.Now,
+		fromFile: newLists(),
+		fromAPI:  newLists(),
+	}
+}
+
+// Load reads the list files and the entries of the store. If any of them
+// fails the lists in use are kept.
+func (s *Screener) Load(ctx context.Context) (Stats, error) {
+	const op = "screening.Load"
+
+	fromFile := newLists()
+	for list, paths := range s.files {
+		for _, path := range paths {
+			if err := readFile(path, list, fromFile[list]); err != nil {
+				return Stats{}, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+
+	s.apiMu.Lock()
+	defer s.apiMu.Unlock()
+
+	entries, err := s.store.ListScreeningEntries(ctx)
+	if err != nil {
+		return Stats{}, fmt.Errorf("%s: %w", op, err)
+	}
+	fromAPI := newLists()
+	for _, e := range entries {
+		if l, ok := fromAPI[e.List]; ok {
+			e.Source = SourceAPI
+			l[e.Address] = e
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fromFile, s.fromAPI = fromFile, fromAPI
+	return s.statsLocked(), nil
+}
+
+// readFile adds the addresses in the file at path to the entries of list.
+// Every line holds an address in any accepted format; text after # is kept
+// as the note and blank lines are skipped.
+func readFile(path, list string, entries map[string]Entry) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		raw, note, _ := strings.Cut(scanner.Text(), "#")
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+
+		adr, err := address.Normalize(raw)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if _, ok := entries[adr]; ok {
+			continue
+		}
+		entries[adr] = Entry{
+			List:      list,
+			Address:   adr,
+			Note:      strings.TrimSpace(note),
+			Source:    path,
+			CreatedAt: info.ModTime().UTC().Truncate(time.Second),
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// Run reloads the lists once per reload interval until ctx is done. It
+// returns immediately when the interval is not positive.
+func (s *Screener) Run(ctx context.Context) {
+	if s.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.Reload(ctx)
+	}
+}
+
+// Reload is Load logging its outcome.
+func (s *Screener) Reload(ctx context.Context) {
+	const op = "screening.Reload"
+
+	stats, err := s.Load(ctx)
+	if err != nil {
+		s.log.Error("failed to reload screening lists, keeping the previous ones", slog.String("op", op), sl.Err(err))
+		return
+	}
+	s.log.Info("screening lists loaded", slog.String("op", op), slog.Int("block", stats.Block), slog.Int("allow", stats.Allow))
+}
+
+// CheckTransfer returns a BlockedError if the sender or the recipient is
+// blocked and records the hit.
+func (s *Screener) CheckTransfer(ctx context.Context, from, to string, amount float64) error {
+	const op = "screening.CheckTransfer"
+
+	for _, party := range []struct{ role, address string }{{"sender", from}, {"recipient", to}} {
+		entry, ok := s.blocked(party.address)
+		if !ok {
+			continue
+		}
+
+		hit := Hit{
+			From:      from,
+			To:        to,
+			Amount:    amount,
+			Address:   party.address,
+			Source:    entry.Source,
+			CreatedAt: s.now().UTC().Truncate(time.Second),
+		}
+		// The transfer is rejected either way, so the audit record is
+		// written even if the request was cancelled meanwhile.
+		if _, err := s.store.RecordScreeningHit(context.WithoutCancel(ctx), hit); err != nil {
+			s.log.Error("failed to record screening hit", slog.String("op", op),
+				slog.String("address", party.address), sl.Err(err))
+		}
+		return fmt.Errorf("%s: %w", op, &BlockedError{Address: party.address, Role: party.role, Source: entry.Source})
+	}
+	return nil
+}
+
+func (s *Screener) blocked(adr string) (Entry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok := s.lookupLocked(ListBlock, adr)
+	if !ok {
+		return Entry{}, false
+	}
+	if _, allowed := s.lookupLocked(ListAllow, adr); allowed {
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+func (s *Screener) lookupLocked(list, adr string) (Entry, bool) {
+	if e, ok := s.fromAPI[list][adr]; ok {
+		return e, true
+	}
+	e, ok := s.fromFile[list][adr]
+	return e, ok
+}
+
+// Entries returns the entries of list, or of both lists when it is empty,
+// sorted by list and address. An address on a list both in a file and
+// through the API is returned once, with the API entry.
+func (s *Screener) Entries(list string) ([]Entry, error) {
+	if list != "" && list != ListBlock && list != ListAllow {
+		return nil, ErrUnknownList
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := []Entry{}
+	for _, name := range []string{ListAllow, ListBlock} {
+		if list != "" && list != name {
+			continue
+		}
+		for adr, e := range s.fromFile[name] {
+			if _, ok := s.fromAPI[name][adr]; !ok {
+				entries = append(entries, e)
+			}
+		}
+		for _, e := range s.fromAPI[name] {
+			entries = append(entries, e)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].List != entries[j].List {
+			return entries[i].List < entries[j].List
+		}
+		return entries[i].Address < entries[j].Address
+	})
+	return entries, nil
+}
+
+// Stats counts the addresses on each list.
+func (s *Screener) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.statsLocked()
+}
+
+func (s *Screener) statsLocked() Stats {
+	count := func(list string) int {
+		n := len(s.fromFile[list])
+		for adr := range s.fromAPI[list] {
+			if _, ok := s.fromFile[list][adr]; !ok {
+				n++
+			}
+		}
+		return n
+	}
+	return Stats{Block: count(ListBlock), Allow: count(ListAllow)}
+}
+
+// AddEntry puts adr on list and persists it. It takes effect immediately.
+func (s *Screener) AddEntry(ctx context.Context, list, adr, note, by string) (Entry, error) {
+	const op = "screening.AddEntry"
+
+	if list != ListBlock && list != ListAllow {
+		return Entry{}, fmt.Errorf("%s: %w", op, ErrUnknownList)
+	}
+	normalized, err := address.Normalize(adr)
+	if err != nil {
+		return Entry{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	entry := Entry{
+		List:      list,
+		Address:   normalized,
+		Note:      note,
+		Source:    SourceAPI,
+		CreatedBy: by,
+		CreatedAt: s.now().UTC().Truncate(time.Second),
+	}
+
+	s.apiMu.Lock()
+	defer s.apiMu.Unlock()
+
+	if err := s.store.AddScreeningEntry(ctx, entry); err != nil {
+		return Entry{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	s.fromAPI[list][normalized] = entry
+	s.mu.Unlock()
+
+	return entry, nil
+}
+
+// RemoveEntry takes adr off list. Only entries added through the API can
+// be removed; an address from a list file returns ErrFileEntry.
+func (s *Screener) RemoveEntry(ctx context.Context, list, adr string) error {
+	const op = "screening.RemoveEntry"
+
+	if list != ListBlock && list != ListAllow {
+		return fmt.Errorf("%s: %w", op, ErrUnknownList)
+	}
+	normalized, err := address.Normalize(adr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.apiMu.Lock()
+	defer s.apiMu.Unlock()
+
+	err = s.store.RemoveScreeningEntry(ctx, list, normalized)
+	if errors.Is(err, ErrEntryNotFound) {
+		s.mu.RLock()
+		_, inFile := s.fromFile[list][normalized]
+		s.mu.RUnlock()
+		if inFile {
+			return fmt.Errorf("%s: %w", op, ErrFileEntry)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	delete(s.fromAPI[list], normalized)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Hits returns up to count hits, newest first.
+func (s *Screener) Hits(ctx context.Context, count int) ([]Hit, error) {
+	const op = "screening.Hits"
+
+	hits, err := s.store.ListScreeningHits(ctx, count)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return hits, nil
+}
+
+// Guard returns a Sender screening every transfer before it is executed by
+// next, for transfers that bypass the HTTP handlers.
+func (s *Screener) Guard(next Sender) Sender {
+	return guarded{screener: s, next: next}
+}
+
+type guarded struct {
+	screener *Screener
+	next     Sender
+}
+
+func (g guarded) SendMoneyWithReference(ctx context.Context, reference, from, to string, amount float64) error {
+	if err := g.screener.CheckTransfer(ctx, from, to, amount); err != nil {
+		return err
+	}
+	return g.next.SendMoneyWithReference(ctx, reference, from, to, amount)
+}
+
+func (g guarded) HasReference(ctx context.Context, reference string) (bool, error) {
+	return g.next.HasReference(ctx, reference)
+}
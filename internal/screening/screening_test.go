@@ -0,0 +1,310 @@
+package screening
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/address"
+	"github.com/Petro-vich/transaction_processing_go/internal/config"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/logger/sl"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[[2]string]Entry
+	hits    []Hit
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{entries: make(map[[2]string]Entry)}
+}
+
+func (m *memoryStore) AddScreeningEntry(ctx context.Context, e Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[[2]string{e.List, e.Address}] = e
+	return nil
+}
+
+func (m *memoryStore) RemoveScreeningEntry(ctx context.Context, list, address string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.entries[[2]string{list, address}]; !ok {
+		return ErrEntryNotFound
+	}
+	delete(m.entries, [2]string{list, address})
+	return nil
+}
+
+func (m *memoryStore) ListScreeningEntries(ctx context.Context) ([]Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := []Entry{}
+	for _, e := range m.entries {
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (m *memoryStore) RecordScreeningHit(ctx context.Context, h Hit) (Hit, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h.ID = int64(len(m.hits) + 1)
+	m.hits = append(m.hits, h)
+	return h, nil
+}
+
+func (m *memoryStore) ListScreeningHits(ctx context.Context, count int) ([]Hit, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hits := []Hit{}
+	for i := len(m.hits) - 1; i >= 0 && len(hits) != count; i-- {
+		hits = append(hits, m.hits[i])
+	}
+	return hits, nil
+}
+
+type fakeSender struct {
+	sent int
+}
+
+func (f *fakeSender) SendMoneyWithReference(ctx context.Context, reference, from, to string, amount float64) error {
+	f.sent++
+	return nil
+}
+
+func (f *fakeSender) HasReference(ctx context.Context, reference string) (bool, error) {
+	return false, nil
+}
+
+func testAddress(prefix string) string {
+	return prefix + strings.Repeat("0", 64-len(prefix))
+}
+
+func writeList(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "list.txt")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644))
+	return path
+}
+
+func newTestScreener(t *testing.T, cfg config.Screening) (*Screener, *memoryStore) {
+	t.Helper()
+	store := newMemoryStore()
+	s := New(store, cfg, sl.SetupSlog("test"))
+	s.now = func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) }
+	_, err := s.Load(context.Background())
+	require.NoError(t, err)
+	return s, store
+}
+
+func TestScreener_Load(t *testing.T) {
+	a, b, c := testAddress("a"), testAddress("b"), testAddress("c")
+	var raw [32]byte
+	raw[0] = 0xcc
+	checksummed := address.Address(raw).String()
+
+	block := writeList(t,
+		"# sanctioned addresses",
+		"",
+		a+"  # first",
+		strings.ToUpper(b),
+		checksummed,
+		a,
+	)
+	allow := writeList(t, b+" # false positive")
+
+	s, _ := newTestScreener(t, config.Screening{BlockFiles: []string{block}, AllowFiles: []string{allow}})
+	assert.Equal(t, Stats{Block: 3, Allow: 1}, s.Stats())
+
+	entries, err := s.Entries(ListBlock)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, a, entries[0].Address)
+	assert.Equal(t, "first", entries[0].Note)
+	assert.Equal(t, block, entries[0].Source)
+	assert.Equal(t, ListBlock, entries[0].List)
+	assert.Equal(t, address.Address(raw).Hex(), entries[2].Address)
+
+	_, err = s.Entries("deny")
+	assert.ErrorIs(t, err, ErrUnknownList)
+
+	t.Run("Broken file keeps the lists", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(block, []byte(c+"\nnot-an-address\n"), 0o644))
+
+		_, err := s.Load(context.Background())
+		require.ErrorIs(t, err, address.ErrInvalid)
+		assert.Contains(t, err.Error(), block+":2")
+		assert.Equal(t, Stats{Block: 3, Allow: 1}, s.Stats())
+	})
+
+	t.Run("Reload picks up changes", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(block, []byte(c+"\n"), 0o644))
+
+		stats, err := s.Load(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, Stats{Block: 1, Allow: 1}, stats)
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		s := New(newMemoryStore(), config.Screening{BlockFiles: []string{filepath.Join(t.TempDir(), "none.txt")}}, sl.SetupSlog("test"))
+		_, err := s.Load(context.Background())
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestScreener_CheckTransfer(t *testing.T) {
+	a, b, c, d := testAddress("a"), testAddress("b"), testAddress("c"), testAddress("d")
+	block := writeList(t, b, c)
+	allow := writeList(t, c)
+	s, store := newTestScreener(t, config.Screening{BlockFiles: []string{block}, AllowFiles: []string{allow}})
+	ctx := context.Background()
+
+	assert.NoError(t, s.CheckTransfer(ctx, a, d, 5))
+	assert.NoError(t, s.CheckTransfer(ctx, a, c, 5), "allow list wins")
+
+	err := s.CheckTransfer(ctx, a, b, 5)
+	var blocked *BlockedError
+	require.ErrorAs(t, err, &blocked)
+	assert.ErrorIs(t, err, ErrBlocked)
+	assert.Equal(t, BlockedError{Address: b, Role: "recipient", Source: block}, *blocked)
+
+	err = s.CheckTransfer(ctx, b, a, 7)
+	require.ErrorAs(t, err, &blocked)
+	assert.Equal(t, "sender", blocked.Role)
+
+	hits, err := s.Hits(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, hits, 2)
+	assert.Equal(t, Hit{ID: 2, From: b, To: a, Amount: 7, Address: b, Source: block, CreatedAt: s.now()}, hits[0])
+	assert.Len(t, store.hits, 2)
+
+	t.Run("Guard", func(t *testing.T) {
+		sender := &fakeSender{}
+		guarded := s.Guard(sender)
+
+		assert.ErrorIs(t, guarded.SendMoneyWithReference(ctx, "r1", a, b, 1), ErrBlocked)
+		assert.NoError(t, guarded.SendMoneyWithReference(ctx, "r2", a, d, 1))
+		assert.Equal(t, 1, sender.sent)
+	})
+}
+
+func TestScreener_Entries(t *testing.T) {
+	a, b := testAddress("a"), testAddress("b")
+	block := writeList(t, a)
+	s, store := newTestScreener(t, config.Screening{BlockFiles: []string{block}})
+	ctx := context.Background()
+
+	entry, err := s.AddEntry(ctx, ListBlock, b, "reported", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, Entry{List: ListBlock, Address: b, Note: "reported", Source: SourceAPI, CreatedBy: "alice", CreatedAt: s.now()}, entry)
+	assert.ErrorIs(t, s.CheckTransfer(ctx, a, b, 1), ErrBlocked, "takes effect immediately")
+
+	_, err = s.AddEntry(ctx, ListAllow, a, "", "alice")
+	require.NoError(t, err)
+	assert.NoError(t, s.CheckTransfer(ctx, a, testAddress("c"), 1))
+
+	_, err = s.AddEntry(ctx, "deny", b, "", "alice")
+	assert.ErrorIs(t, err, ErrUnknownList)
+	_, err = s.AddEntry(ctx, ListBlock, "zz", "", "alice")
+	assert.ErrorIs(t, err, address.ErrInvalid)
+
+	t.Run("API entries survive a reload", func(t *testing.T) {
+		stats, err := s.Load(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, Stats{Block: 2, Allow: 1}, stats)
+		assert.Len(t, store.entries, 2)
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		require.NoError(t, s.RemoveEntry(ctx, ListBlock, b))
+		assert.NoError(t, s.CheckTransfer(ctx, testAddress("c"), b, 1))
+
+		assert.ErrorIs(t, s.RemoveEntry(ctx, ListBlock, b), ErrEntryNotFound)
+		assert.ErrorIs(t, s.RemoveEntry(ctx, ListBlock, a), ErrFileEntry)
+	})
+
+	t.Run("Store errors", func(t *testing.T) {
+		s := New(failingStore{newMemoryStore()}, config.Screening{}, sl.SetupSlog("test"))
+		_, err := s.AddEntry(ctx, ListBlock, b, "", "alice")
+		assert.Error(t, err)
+		assert.Equal(t, Stats{}, s.Stats())
+	})
+}
+
+// slowStore holds ListScreeningEntries until release is closed and reports
+// every entry added meanwhile on added.
+type slowStore struct {
+	*memoryStore
+	listing chan struct{}
+	release chan struct{}
+	added   chan struct{}
+}
+
+func (s *slowStore) ListScreeningEntries(ctx context.Context) ([]Entry, error) {
+	entries, err := s.memoryStore.ListScreeningEntries(ctx)
+	close(s.listing)
+	<-s.release
+	return entries, err
+}
+
+func (s *slowStore) AddScreeningEntry(ctx context.Context, e Entry) error {
+	err := s.memoryStore.AddScreeningEntry(ctx, e)
+	s.added <- struct{}{}
+	return err
+}
+
+func TestScreener_LoadDuringChange(t *testing.T) {
+	b := testAddress("b")
+	store := &slowStore{
+		memoryStore: newMemoryStore(),
+		listing:     make(chan struct{}),
+		release:     make(chan struct{}),
+		added:       make(chan struct{}, 1),
+	}
+	s := New(store, config.Screening{}, sl.SetupSlog("test"))
+	ctx := context.Background()
+
+	loaded := make(chan error)
+	go func() {
+		_, err := s.Load(ctx)
+		loaded <- err
+	}()
+	<-store.listing
+
+	added := make(chan error)
+	go func() {
+		_, err := s.AddEntry(ctx, ListBlock, b, "", "alice")
+		added <- err
+	}()
+
+	// The entry must not reach the store while Load holds its stale copy.
+	select {
+	case <-store.added:
+		t.Error("entry added while the lists were loading")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(store.release)
+
+	require.NoError(t, <-loaded)
+	require.NoError(t, <-added)
+	assert.ErrorIs(t, s.CheckTransfer(ctx, testAddress("a"), b, 1), ErrBlocked)
+	assert.Equal(t, Stats{Block: 1}, s.Stats())
+}
+
+type failingStore struct {
+	*memoryStore
+}
+
+func (failingStore) AddScreeningEntry(ctx context.Context, e Entry) error {
+	return errors.New("disk failure")
+}
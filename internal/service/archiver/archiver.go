@@ -0,0 +1,74 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/config"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/logger/sl"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage/sqlite"
+)
+
+// Archiver is a database able to move transactions created before
+// a point in time into archive files.
+type Archiver interface {
+	Archive(ctx context.Context, before time.Time) (sqlite.ArchiveReport, error)
+}
+
+// Service applies the retention policy: transactions older than the
+// retention period are moved out of the live database.
+type Service struct {
+	archiver  Archiver
+	retention time.Duration
+	interval  time.Duration
+	log       *slog.Logger
+
+	now func() time.Time
+}
+
+func New(archiver Archiver, cfg config.Archive, log *slog.Logger) *Service {
+	return &Service{
+		archiver:  archiver,
+		retention: time.Duration(cfg.RetentionDays) * 24 * time.Hour,
+		interval:  cfg.Interval,
+		log:       log,
+		now:       time.Now,
+	}
+}
+
+// RunOnce archives the transactions older than the retention period.
+func (s *Service) RunOnce(ctx context.Context) (sqlite.ArchiveReport, error) {
+	const op = "archiver.RunOnce"
+
+	report, err := s.archiver.Archive(ctx, s.now().Add(-s.retention))
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+	return report, nil
+}
+
+// Run archives immediately and then once per interval until ctx is done.
+func (s *Service) Run(ctx context.Context) {
+	const op = "archiver.Run"
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := s.RunOnce(ctx)
+		if err != nil {
+			s.log.Error("failed to archive transactions", slog.String("op", op), sl.Err(err))
+		} else if report.Moved > 0 {
+			s.log.Info("transactions archived", slog.String("op", op),
+				slog.Int("moved", report.Moved), slog.Any("files", report.Files))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
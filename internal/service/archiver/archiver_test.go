@@ -0,0 +1,77 @@
+package archiver
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/config"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/logger/sl"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeArchiver struct {
+	mu     sync.Mutex
+	before []time.Time
+	err    error
+}
+
+func (f *fakeArchiver) Archive(ctx context.Context, before time.Time) (sqlite.ArchiveReport, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.before = append(f.before, before)
+	return sqlite.ArchiveReport{Moved: 1}, f.err
+}
+
+func (f *fakeArchiver) calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.before)
+}
+
+func TestService_RunOnce(t *testing.T) {
+	t.Run("Cutoff is now minus the retention period", func(t *testing.T) {
+		fake := &fakeArchiver{}
+		svc := New(fake, config.Archive{RetentionDays: 30, Interval: time.Hour}, sl.SetupSlog("test"))
+		now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+		svc.now = func() time.Time { return now }
+
+		report, err := svc.RunOnce(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Moved)
+		require.Len(t, fake.before, 1)
+		assert.Equal(t, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), fake.before[0])
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		fake := &fakeArchiver{err: sqlite.ErrArchiveDisabled}
+		svc := New(fake, config.Archive{RetentionDays: 30, Interval: time.Hour}, sl.SetupSlog("test"))
+
+		_, err := svc.RunOnce(context.Background())
+		assert.ErrorIs(t, err, sqlite.ErrArchiveDisabled)
+	})
+}
+
+func TestService_Run(t *testing.T) {
+	fake := &fakeArchiver{}
+	svc := New(fake, config.Archive{RetentionDays: 1, Interval: 10 * time.Millisecond}, sl.SetupSlog("test"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		svc.Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return fake.calls() >= 2 }, time.Second, 5*time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+}
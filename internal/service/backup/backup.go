@@ -0,0 +1,341 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/config"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/flock"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage/sqlite"
+)
+
+var ErrDatabaseInUse = errors.New("database is in use, stop the service before restoring")
+
+// Backup file names are the prefix, a UTC timestamp and an extension,
+// so sorting by name orders backups by age.
+const (
+	filePrefix    = "backup-"
+	fileExt       = ".db"
+	gzipExt       = ".gz"
+	timeLayout    = "20060102T150405.000Z"
+	tmpExt        = ".tmp"
+	restoreTmpExt = ".restore"
+)
+
+// Source is a database able to write a consistent copy of itself.
+type Source interface {
+	BackupTo(ctx context.Context, path string) error
+}
+
+// Info describes a backup file.
+type Info struct {
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	Compressed bool      `json:"compressed"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type Service struct {
+	source   Source
+	dir      string
+	keep     int
+	compress bool
+
+	// mu serializes backups so rotation never races a backup in progress.
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+func New(source Source, cfg config.Backup) *Service {
+	return &Service{
+		source:   source,
+		dir:      cfg.Dir,
+		keep:     cfg.Keep,
+		compress: cfg.Compress,
+		now:      time.Now,
+	}
+}
+
+// Create takes an online backup, verifies it, compresses it when enabled
+// and removes the oldest backups beyond the configured number to keep.
+// The backup holds the live database only: the monthly archive files are
+// rewritten in place by later archive runs and are not part of it.
+func (s *Service) Create(ctx context.Context) (Info, error) {
+	const op = "backup.Create"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return Info{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	createdAt := s.now().UTC().Truncate(time.Millisecond)
+	name := filePrefix + createdAt.Format(timeLayout) + fileExt
+	if s.compress {
+		name += gzipExt
+	}
+	path := filepath.Join(s.dir, name)
+
+	raw := filepath.Join(s.dir, filePrefix+createdAt.Format(timeLayout)+fileExt+tmpExt)
+	defer os.Remove(raw)
+
+	if err := s.source.BackupTo(ctx, raw); err != nil {
+		return Info{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := sqlite.CheckIntegrity(ctx, raw); err != nil {
+		return Info{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var err error
+	if s.compress {
+		err = compressFile(raw, path)
+	} else {
+		err = syncRename(raw, path)
+	}
+	if err != nil {
+		return Info{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.rotate(); err != nil {
+		return Info{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return Info{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return Info{
+		Name:       name,
+		Path:       path,
+		Size:       info.Size(),
+		Compressed: s.compress,
+		CreatedAt:  createdAt,
+	}, nil
+}
+
+// List returns the backups in the backup directory, newest first.
+func (s *Service) List() ([]Info, error) {
+	const op = "backup.List"
+
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Info{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	backups := []Info{}
+	for _, entry := range entries {
+		createdAt, compressed, ok := parseName(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		fi, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		backups = append(backups, Info{
+			Name:       entry.Name(),
+			Path:       filepath.Join(s.dir, entry.Name()),
+			Size:       fi.Size(),
+			Compressed: compressed,
+			CreatedAt:  createdAt,
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+
+	return backups, nil
+}
+
+// rotate removes the oldest backups so that at most keep remain.
+// A non-positive keep disables rotation.
+func (s *Service) rotate() error {
+	if s.keep <= 0 {
+		return nil
+	}
+
+	backups, err := s.List()
+	if err != nil {
+		return err
+	}
+
+	for _, b := range backups[min(s.keep, len(backups)):] {
+		if err := os.Remove(b.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Restore replaces the database at dbPath with the backup at backupPath,
+// which may be gzip compressed. It refuses to run while any process has
+// the database open and keeps the database locked until it is done.
+// Archive files are left as they are; see Create.
+func Restore(ctx context.Context, backupPath, dbPath string) error {
+	const op = "backup.Restore"
+
+	if lockPath, ok := sqlite.LockPath(dbPath); ok {
+		lock, err := flock.TryLock(lockPath)
+		if errors.Is(err, flock.ErrLocked) {
+			return fmt.Errorf("%s: %w", op, ErrDatabaseInUse)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		defer lock.Unlock()
+	}
+
+	tmp := dbPath + restoreTmpExt
+	defer os.Remove(tmp)
+
+	var err error
+	if strings.HasSuffix(backupPath, gzipExt) {
+		err = decompressFile(backupPath, tmp)
+	} else {
+		err = copyFile(backupPath, tmp)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := sqlite.CheckIntegrity(ctx, tmp); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// The old write-ahead log belongs to the replaced database and must not
+	// be applied to the restored one.
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := syncRename(tmp, dbPath); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func parseName(name string) (createdAt time.Time, compressed bool, ok bool) {
+	if !strings.HasPrefix(name, filePrefix) {
+		return time.Time{}, false, false
+	}
+
+	stamp := strings.TrimPrefix(name, filePrefix)
+	switch {
+	case strings.HasSuffix(stamp, fileExt+gzipExt):
+		stamp, compressed = strings.TrimSuffix(stamp, fileExt+gzipExt), true
+	case strings.HasSuffix(stamp, fileExt):
+		stamp = strings.TrimSuffix(stamp, fileExt)
+	default:
+		return time.Time{}, false, false
+	}
+
+	createdAt, err := time.Parse(timeLayout, stamp)
+	if err != nil {
+		return time.Time{}, false, false
+	}
+	return createdAt, compressed, true
+}
+
+func compressFile(src, dst string) error {
+	return transformFile(src, dst, func(w io.Writer, r io.Reader) error {
+		zw := gzip.NewWriter(w)
+		if _, err := io.Copy(zw, r); err != nil {
+			return err
+		}
+		return zw.Close()
+	})
+}
+
+func decompressFile(src, dst string) error {
+	return transformFile(src, dst, func(w io.Writer, r io.Reader) error {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		_, err = io.Copy(w, zr)
+		return err
+	})
+}
+
+func copyFile(src, dst string) error {
+	return transformFile(src, dst, func(w io.Writer, r io.Reader) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+}
+
+// transformFile writes the transformed content of src to a temporary file
+// and renames it to dst once it is synced.
+func transformFile(src, dst string, transform func(w io.Writer, r io.Reader) error) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + tmpExt
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	if err := transform(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	return syncRename(tmp, dst)
+}
+
+// syncRename syncs src, renames it to dst and syncs the directory.
+func syncRename(src, dst string) error {
+	f, err := os.OpenFile(src, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(src, dst); err != nil {
+		return err
+	}
+
+	dir, err := os.Open(filepath.Dir(dst))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
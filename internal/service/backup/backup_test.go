@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/config"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func address(prefix string) string {
+	return prefix + strings.Repeat("0", 64-len(prefix))
+}
+
+func setup(t *testing.T, cfg config.Backup) (*sqlite.Storage, string, *Service) {
+	t.Helper()
+
+	dbPath := filepath.Join(t.TempDir(), "storage.db")
+	st, err := sqlite.New(dbPath)
+	require.NoError(t, err)
+	t.Cleanup(func() { st.Close() })
+
+	require.NoError(t, st.CreateWallet(context.Background(), address("a"), 100))
+	require.NoError(t, st.CreateWallet(context.Background(), address("b"), 100))
+
+	if cfg.Dir == "" {
+		cfg.Dir = filepath.Join(t.TempDir(), "backup")
+	}
+	return st, dbPath, New(st, cfg)
+}
+
+func TestService_Create(t *testing.T) {
+	t.Run("Uncompressed", func(t *testing.T) {
+		_, _, svc := setup(t, config.Backup{Keep: 7})
+
+		info, err := svc.Create(context.Background())
+		require.NoError(t, err)
+		assert.False(t, info.Compressed)
+		assert.True(t, strings.HasSuffix(info.Name, ".db"))
+		assert.Positive(t, info.Size)
+		assert.NoError(t, sqlite.CheckIntegrity(context.Background(), info.Path))
+
+		entries, err := os.ReadDir(svc.dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1, "temporary files must be removed")
+	})
+
+	t.Run("Compressed", func(t *testing.T) {
+		_, _, svc := setup(t, config.Backup{Keep: 7, Compress: true})
+
+		info, err := svc.Create(context.Background())
+		require.NoError(t, err)
+		assert.True(t, info.Compressed)
+		assert.True(t, strings.HasSuffix(info.Name, ".db.gz"))
+
+		backups, err := svc.List()
+		require.NoError(t, err)
+		require.Len(t, backups, 1)
+		assert.Equal(t, info.Name, backups[0].Name)
+		assert.True(t, backups[0].CreatedAt.Equal(info.CreatedAt))
+	})
+
+	t.Run("Rotation", func(t *testing.T) {
+		_, _, svc := setup(t, config.Backup{Keep: 2})
+
+		now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		svc.now = func() time.Time {
+			now = now.Add(time.Minute)
+			return now
+		}
+
+		var names []string
+		for i := 0; i < 3; i++ {
+			info, err := svc.Create(context.Background())
+			require.NoError(t, err)
+			names = append(names, info.Name)
+		}
+
+		backups, err := svc.List()
+		require.NoError(t, err)
+		require.Len(t, backups, 2)
+		assert.Equal(t, names[2], backups[0].Name)
+		assert.Equal(t, names[1], backups[1].Name)
+	})
+}
+
+func TestRestore(t *testing.T) {
+	t.Run("Round trip", func(t *testing.T) {
+		st, dbPath, svc := setup(t, config.Backup{Keep: 7, Compress: true})
+
+		info, err := svc.Create(context.Background())
+		require.NoError(t, err)
+
+		require.NoError(t, st.SendMoney(context.Background(), address("a"), address("b"), 40))
+		require.NoError(t, st.Close())
+
+		require.NoError(t, Restore(context.Background(), info.Path, dbPath))
+
+		restored, err := sqlite.New(dbPath)
+		require.NoError(t, err)
+		defer restored.Close()
+
+		balance, err := restored.GetBalance(context.Background(), address("a"))
+		require.NoError(t, err)
+		assert.Equal(t, 100.0, balance)
+
+		transactions, err := restored.GetLast(context.Background(), 10)
+		require.NoError(t, err)
+		assert.Empty(t, transactions)
+	})
+
+	t.Run("Database in use", func(t *testing.T) {
+		_, dbPath, svc := setup(t, config.Backup{Keep: 7})
+
+		info, err := svc.Create(context.Background())
+		require.NoError(t, err)
+
+		err = Restore(context.Background(), info.Path, dbPath)
+		assert.ErrorIs(t, err, ErrDatabaseInUse)
+	})
+
+	t.Run("Damaged backup", func(t *testing.T) {
+		st, dbPath, _ := setup(t, config.Backup{})
+		require.NoError(t, st.Close())
+
+		damaged := filepath.Join(t.TempDir(), "backup-damaged.db")
+		require.NoError(t, os.WriteFile(damaged, []byte("not a database"), 0o644))
+
+		err := Restore(context.Background(), damaged, dbPath)
+		assert.ErrorIs(t, err, sqlite.ErrIntegrity)
+
+		st, err = sqlite.New(dbPath)
+		require.NoError(t, err)
+		defer st.Close()
+
+		balance, err := st.GetBalance(context.Background(), address("a"))
+		require.NoError(t, err)
+		assert.Equal(t, 100.0, balance)
+	})
+}
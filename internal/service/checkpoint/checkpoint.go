@@ -0,0 +1,95 @@
+package checkpoint
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/config"
+	"github.com/Petro-vich/transaction_processing_go/internal/hashchain"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/logger/sl"
+)
+
+// Store is a database keeping a hash chain of its transactions and the
+// checkpoints signed over it.
+type Store interface {
+	ChainHead(ctx context.Context) (hashchain.Head, error)
+	LastCheckpoint(ctx context.Context) (hashchain.Checkpoint, bool, error)
+	SaveCheckpoint(ctx context.Context, cp hashchain.Checkpoint) (hashchain.Checkpoint, error)
+}
+
+// Service periodically signs the chain head, so a rewritten chain no
+// longer matches the checkpoints taken before.
+type Service struct {
+	store    Store
+	key      ed25519.PrivateKey
+	interval time.Duration
+	log      *slog.Logger
+
+	now func() time.Time
+}
+
+func New(store Store, key ed25519.PrivateKey, cfg config.Chain, log *slog.Logger) *Service {
+	return &Service{
+		store:    store,
+		key:      key,
+		interval: cfg.CheckpointInterval,
+		log:      log,
+		now:      time.Now,
+	}
+}
+
+// RunOnce signs and stores the current chain head. It returns false when
+// the chain is empty or has not grown since the last checkpoint.
+func (s *Service) RunOnce(ctx context.Context) (hashchain.Checkpoint, bool, error) {
+	const op = "checkpoint.RunOnce"
+
+	head, err := s.store.ChainHead(ctx)
+	if err != nil {
+		return hashchain.Checkpoint{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+	if head.LastID == 0 {
+		return hashchain.Checkpoint{}, false, nil
+	}
+
+	last, ok, err := s.store.LastCheckpoint(ctx)
+	if err != nil {
+		return hashchain.Checkpoint{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+	if ok && last.Head == head {
+		return last, false, nil
+	}
+
+	cp, err := s.store.SaveCheckpoint(ctx, hashchain.Sign(s.key, head, s.now().Truncate(time.Second)))
+	if err != nil {
+		return cp, false, fmt.Errorf("%s: %w", op, err)
+	}
+	return cp, true, nil
+}
+
+// Run signs a checkpoint immediately and then once per interval until ctx
+// is done.
+func (s *Service) Run(ctx context.Context) {
+	const op = "checkpoint.Run"
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		cp, created, err := s.RunOnce(ctx)
+		if err != nil {
+			s.log.Error("failed to sign chain checkpoint", slog.String("op", op), sl.Err(err))
+		} else if created {
+			s.log.Info("chain checkpoint signed", slog.String("op", op),
+				slog.Int("id", cp.ID), slog.Int("last_id", cp.Head.LastID), slog.String("hash", cp.Head.Hash))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package checkpoint
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/config"
+	"github.com/Petro-vich/transaction_processing_go/internal/hashchain"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/logger/sl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	mu          sync.Mutex
+	head        hashchain.Head
+	checkpoints []hashchain.Checkpoint
+	err         error
+}
+
+func (f *fakeStore) ChainHead(ctx context.Context) (hashchain.Head, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.head, f.err
+}
+
+func (f *fakeStore) LastCheckpoint(ctx context.Context) (hashchain.Checkpoint, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.checkpoints) == 0 {
+		return hashchain.Checkpoint{}, false, nil
+	}
+	return f.checkpoints[len(f.checkpoints)-1], true, nil
+}
+
+func (f *fakeStore) SaveCheckpoint(ctx context.Context, cp hashchain.Checkpoint) (hashchain.Checkpoint, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cp.ID = len(f.checkpoints) + 1
+	f.checkpoints = append(f.checkpoints, cp)
+	return cp, nil
+}
+
+func (f *fakeStore) setHead(head hashchain.Head) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.head = head
+}
+
+func (f *fakeStore) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.checkpoints)
+}
+
+func newService(t *testing.T, store Store, interval time.Duration) (*Service, ed25519.PublicKey) {
+	t.Helper()
+	pub, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	return New(store, key, config.Chain{CheckpointInterval: interval}, sl.SetupSlog("test")), pub
+}
+
+func TestService_RunOnce(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Signs the head once", func(t *testing.T) {
+		store := &fakeStore{head: hashchain.Head{LastID: 3, Hash: hashchain.Genesis}}
+		svc, pub := newService(t, store, time.Hour)
+		now := time.Date(2026, 5, 1, 12, 0, 0, 500, time.UTC)
+		svc.now = func() time.Time { return now }
+
+		cp, created, err := svc.RunOnce(ctx)
+		require.NoError(t, err)
+		assert.True(t, created)
+		assert.Equal(t, 1, cp.ID)
+		assert.Equal(t, store.head, cp.Head)
+		assert.Equal(t, now.Truncate(time.Second), cp.CreatedAt)
+		assert.True(t, hashchain.VerifyCheckpoint(pub, cp))
+
+		_, created, err = svc.RunOnce(ctx)
+		require.NoError(t, err)
+		assert.False(t, created, "unchanged head")
+
+		store.setHead(hashchain.Head{LastID: 4, Hash: hashchain.Genesis})
+		_, created, err = svc.RunOnce(ctx)
+		require.NoError(t, err)
+		assert.True(t, created)
+		assert.Equal(t, 2, store.count())
+	})
+
+	t.Run("Empty chain", func(t *testing.T) {
+		store := &fakeStore{head: hashchain.Head{Hash: hashchain.Genesis}}
+		svc, _ := newService(t, store, time.Hour)
+
+		_, created, err := svc.RunOnce(ctx)
+		require.NoError(t, err)
+		assert.False(t, created)
+		assert.Zero(t, store.count())
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		failure := errors.New("disk I/O error")
+		svc, _ := newService(t, &fakeStore{err: failure}, time.Hour)
+
+		_, _, err := svc.RunOnce(ctx)
+		assert.ErrorIs(t, err, failure)
+	})
+}
+
+func TestService_Run(t *testing.T) {
+	store := &fakeStore{head: hashchain.Head{LastID: 1, Hash: hashchain.Genesis}}
+	svc, _ := newService(t, store, 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		svc.Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return store.count() == 1 }, time.Second, 5*time.Millisecond)
+	store.setHead(hashchain.Head{LastID: 2, Hash: hashchain.Genesis})
+	assert.Eventually(t, func() bool { return store.count() == 2 }, time.Second, 5*time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+}
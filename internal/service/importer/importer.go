@@ -0,0 +1,393 @@
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/address"
+	"github.com/Petro-vich/transaction_processing_go/internal/risk"
+	"github.com/Petro-vich/transaction_processing_go/internal/screening"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+)
+
+// Row statuses reported for every line of an import.
+const (
+	StatusValid   = "valid"
+	StatusInvalid = "invalid"
+	StatusSkipped = "skipped"
+	StatusOk      = "ok"
+	StatusFailed  = "failed"
+)
+
+var ErrInvalidHeader = errors.New("csv header must contain from, to, amount and reference columns")
+
+var columns = []string{"from", "to", "amount", "reference"}
+
+// Row is a single transfer read from the CSV file.
+type Row struct {
+	Line      int
+	From      string
+	To        string
+	Amount    float64
+	Reference string
+
+	parseErr string
+}
+
+// Result is the outcome of a single row.
+type Result struct {
+	Line      int     `json:"line"`
+	Reference string  `json:"reference"`
+	From      string  `json:"from"`
+	To        string  `json:"to"`
+	Amount    float64 `json:"amount"`
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report summarizes an import run.
+type Report struct {
+	DryRun    bool     `json:"dry_run"`
+	Valid     bool     `json:"valid"`
+	Total     int      `json:"total"`
+	Succeeded int      `json:"succeeded"`
+	Failed    int      `json:"failed"`
+	Rows      []Result `json:"rows"`
+}
+
+// Evaluator decides on a transfer before it is executed.
+type Evaluator interface {
+	Evaluate(ctx context.Context, tr risk.Transfer) (risk.Result, error)
+}
+
+// Screen rejects transfers from or to blocked addresses.
+type Screen interface {
+	CheckTransfer(ctx context.Context, from, to string, amount float64) error
+}
+
+type Importer struct {
+	storage storage.Repository
+	rules   Evaluator
+	screen  Screen
+	// timeout bounds the execution when positive.
+	timeout time.Duration
+}
+
+// Option configures optional behaviour of the importer.
+type Option func(*Importer)
+
+// WithRiskRules rejects rows that rules would deny or hold for review.
+// Held rows are not queued: a row the rules reject fails validation, and
+// validation is all or nothing. Execution is not: every transfer runs in
+// its own transaction, so a row that fails at run time leaves the others
+// committed. Rules see the stored history only, not the earlier rows of the
+// file.
+func WithRiskRules(rules Evaluator) Option {
+	return func(im *Importer) {
+		im.rules = rules
+	}
+}
+
+// WithExecutionTimeout bounds the execution of the rows by timeout instead
+// of the context passed to Import.
+func WithExecutionTimeout(timeout time.Duration) Option {
+	return func(im *Importer) {
+		im.timeout = timeout
+	}
+}
+
+// WithScreening rejects rows from or to blocked addresses.
+func WithScreening(screen Screen) Option {
+	return func(im *Importer) {
+		im.screen = screen
+	}
+}
+
+func New(storage storage.Repository, opts ...Option) *Importer {
+	im := &Importer{storage: storage}
+	for _, opt := range opts {
+		opt(im)
+	}
+	return im
+}
+
+// Reference returns the stored reference of a row with reference, which
+// cannot collide with the references of other kinds of transfers.
+func Reference(reference string) string {
+	return "import:" + reference
+}
+
+// Parse reads transfers from CSV with a from,to,amount,reference header.
+// Malformed rows are kept and reported as invalid during validation.
+func Parse(r io.Reader) ([]Row, error) {
+	const op = "importer.Parse"
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidHeader)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	index := make(map[string]int, len(columns))
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range columns {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidHeader)
+		}
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := Row{Line: line}
+
+		if len(record) != len(header) {
+			row.parseErr = fmt.Sprintf("expected %d fields, got %d", len(header), len(record))
+			rows = append(rows, row)
+			continue
+		}
+
+		row.From = normalizeAddress(record[index["from"]])
+		row.To = normalizeAddress(record[index["to"]])
+		row.Reference = strings.TrimSpace(record[index["reference"]])
+
+		amount := strings.TrimSpace(record[index["amount"]])
+		row.Amount, err = strconv.ParseFloat(amount, 64)
+		if err != nil {
+			row.parseErr = fmt.Sprintf("invalid amount %q", amount)
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// Import validates every row and, unless dryRun is set or validation failed,
+// executes the transfers in file order. Each transfer stores its reference
+// in the same transaction, so a row whose reference was executed by an
+// earlier import fails validation, or fails at run time if that import
+// executed it meanwhile. Cancelling ctx stops validation but not execution,
+// which would leave the file executed halfway; execution is bounded by the
+// timeout of WithExecutionTimeout instead.
+func (im *Importer) Import(ctx context.Context, rows []Row, dryRun bool) Report {
+	report := Report{
+		DryRun: dryRun,
+		Total:  len(rows),
+		Rows:   make([]Result, len(rows)),
+	}
+
+	report.Valid = im.validate(ctx, rows, report.Rows)
+	if !report.Valid || dryRun {
+		for i := range report.Rows {
+			if report.Rows[i].Status == StatusInvalid {
+				report.Failed++
+			}
+		}
+		return report
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	if im.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, im.timeout)
+		defer cancel()
+	}
+
+	for i, row := range rows {
+		res := &report.Rows[i]
+		if err := im.storage.SendMoneyWithReference(ctx, Reference(row.Reference), row.From, row.To, row.Amount); err != nil {
+			res.Status = StatusFailed
+			res.Error = err.Error()
+			report.Failed++
+			continue
+		}
+		res.Status = StatusOk
+		report.Succeeded++
+	}
+
+	return report
+}
+
+// validate fills results with the validation outcome of each row and reports
+// whether all rows are valid. Balances are projected in file order so a
+// sender cannot be overdrawn by a later row.
+func (im *Importer) validate(ctx context.Context, rows []Row, results []Result) bool {
+	valid := true
+	references := make(map[string]int, len(rows))
+	balances := make(map[string]float64)
+
+	for i, row := range rows {
+		results[i] = Result{
+			Line:      row.Line,
+			Reference: row.Reference,
+			From:      row.From,
+			To:        row.To,
+			Amount:    row.Amount,
+			Status:    StatusValid,
+		}
+
+		if msg := im.validateRow(ctx, row, references, balances); msg != "" {
+			results[i].Status = StatusInvalid
+			results[i].Error = msg
+			valid = false
+		}
+
+		if row.Reference != "" {
+			if _, ok := references[row.Reference]; !ok {
+				references[row.Reference] = row.Line
+			}
+		}
+	}
+
+	if !valid {
+		for i := range results {
+			if results[i].Status == StatusValid {
+				results[i].Status = StatusSkipped
+			}
+		}
+	}
+
+	return valid
+}
+
+func (im *Importer) validateRow(ctx context.Context, row Row, references map[string]int, balances map[string]float64) string {
+	if row.parseErr != "" {
+		return row.parseErr
+	}
+
+	if row.Reference == "" {
+		return "reference is required"
+	}
+	if line, ok := references[row.Reference]; ok {
+		return fmt.Sprintf("duplicate reference, first seen on line %d", line)
+	}
+	used, err := im.storage.HasReference(ctx, Reference(row.Reference))
+	if err != nil {
+		return fmt.Sprintf("failed to check reference: %v", err)
+	}
+	if used {
+		return "reference already executed"
+	}
+
+	if !address.IsCanonical(row.From) {
+		return "invalid from address"
+	}
+	if !address.IsCanonical(row.To) {
+		return "invalid to address"
+	}
+	if row.From == row.To {
+		return "sender and recipient must differ"
+	}
+
+	if row.Amount <= 0 || math.IsInf(row.Amount, 0) || math.IsNaN(row.Amount) {
+		return "amount must be positive"
+	}
+
+	for _, adr := range []string{row.From, row.To} {
+		if _, ok := balances[adr]; ok {
+			continue
+		}
+		balance, err := im.storage.GetBalance(ctx, adr)
+		if errors.Is(err, storage.ErrAddressNotExist) {
+			return fmt.Sprintf("address %s does not exist", adr)
+		}
+		if err != nil {
+			return fmt.Sprintf("failed to get balance: %v", err)
+		}
+		balances[adr] = balance
+	}
+
+	if balances[row.From] < row.Amount {
+		return fmt.Sprintf("insufficient funds: projected balance %g", balances[row.From])
+	}
+	if im.screen != nil {
+		err := im.screen.CheckTransfer(ctx, row.From, row.To, row.Amount)
+		var blocked *screening.BlockedError
+		if errors.As(err, &blocked) {
+			return fmt.Sprintf("%s %s is blocked", blocked.Role, blocked.Address)
+		}
+		if err != nil {
+			return fmt.Sprintf("failed to screen addresses: %v", err)
+		}
+	}
+
+	if im.rules != nil {
+		res, err := im.rules.Evaluate(ctx, risk.Transfer{From: row.From, To: row.To, Amount: row.Amount})
+		if err != nil {
+			return fmt.Sprintf("failed to evaluate risk rules: %v", err)
+		}
+		switch res.Action {
+		case risk.ActionDeny:
+			return fmt.Sprintf("denied by risk rule %s: %s", res.Rule, res.Reason)
+		case risk.ActionHold:
+			return fmt.Sprintf("held by risk rule %s: %s", res.Rule, res.Reason)
+		}
+	}
+
+	balances[row.From] -= row.Amount
+	balances[row.To] += row.Amount
+
+	return ""
+}
+
+// normalizeAddress returns the stored hex form of a valid address given as
+// hex or in the checksummed encoding. Invalid addresses are only lowercased
+// and rejected during validation.
+func normalizeAddress(field string) string {
+	field = strings.TrimSpace(field)
+	if adr, err := address.Normalize(field); err == nil {
+		return adr
+	}
+	return strings.ToLower(field)
+}
+
+// WriteCSV writes the per-row results as CSV.
+func (r Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write([]string{"line", "reference", "from", "to", "amount", "status", "error"}); err != nil {
+		return err
+	}
+
+	for _, res := range r.Rows {
+		err := writer.Write([]string{
+			strconv.Itoa(res.Line),
+			res.Reference,
+			res.From,
+			res.To,
+			strconv.FormatFloat(res.Amount, 'f', -1, 64),
+			res.Status,
+			res.Error,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
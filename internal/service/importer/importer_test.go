@@ -0,0 +1,308 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/address"
+	"github.com/Petro-vich/transaction_processing_go/internal/risk"
+	"github.com/Petro-vich/transaction_processing_go/internal/screening"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestImporter(t *testing.T) (*Importer, *sqlite.Storage) {
+	st, err := sqlite.New("file::memory:?cache=shared")
+	require.NoError(t, err)
+	t.Cleanup(func() { st.Close() })
+
+	return New(st), st
+}
+
+type evaluatorFunc func(tr risk.Transfer) risk.Result
+
+func (f evaluatorFunc) Evaluate(ctx context.Context, tr risk.Transfer) (risk.Result, error) {
+	return f(tr), nil
+}
+
+type screenFunc func(from, to string) error
+
+func (f screenFunc) CheckTransfer(ctx context.Context, from, to string, amount float64) error {
+	return f(from, to)
+}
+
+// validatedStorage reports every reference as not executed yet, as seen by
+// an import validated before another one executed it.
+type validatedStorage struct {
+	*sqlite.Storage
+}
+
+func (validatedStorage) HasReference(ctx context.Context, reference string) (bool, error) {
+	return false, nil
+}
+
+// cancellingStorage cancels the context of the import once execution
+// starts, as a client disconnecting or a request timeout would.
+type cancellingStorage struct {
+	*sqlite.Storage
+	cancel context.CancelFunc
+}
+
+func (s cancellingStorage) SendMoneyWithReference(ctx context.Context, reference, from, to string, amount float64) error {
+	s.cancel()
+	return s.Storage.SendMoneyWithReference(ctx, reference, from, to, amount)
+}
+
+func generateTestAddress(prefix string) string {
+	return prefix + strings.Repeat("0", 64-len(prefix))
+}
+
+func csvFile(lines ...string) *strings.Reader {
+	return strings.NewReader("from,to,amount,reference\n" + strings.Join(lines, "\n") + "\n")
+}
+
+func TestParse(t *testing.T) {
+	t.Run("Columns in any order", func(t *testing.T) {
+		rows, err := Parse(strings.NewReader("reference,amount,to,from\nr1,10.5,B,A\n"))
+		require.NoError(t, err)
+		require.Len(t, rows, 1)
+		assert.Equal(t, Row{Line: 2, From: "a", To: "b", Amount: 10.5, Reference: "r1"}, rows[0])
+	})
+
+	t.Run("Checksummed addresses", func(t *testing.T) {
+		from, err := address.Generate()
+		require.NoError(t, err)
+		to := generateTestAddress("b")
+
+		rows, err := Parse(csvFile(from.String() + "," + strings.ToUpper(to) + ",1,r1"))
+		require.NoError(t, err)
+		require.Len(t, rows, 1)
+		assert.Equal(t, from.Hex(), rows[0].From)
+		assert.Equal(t, to, rows[0].To)
+	})
+
+	t.Run("Missing column", func(t *testing.T) {
+		_, err := Parse(strings.NewReader("from,to,amount\na,b,1\n"))
+		assert.ErrorIs(t, err, ErrInvalidHeader)
+	})
+
+	t.Run("Empty file", func(t *testing.T) {
+		_, err := Parse(strings.NewReader(""))
+		assert.ErrorIs(t, err, ErrInvalidHeader)
+	})
+}
+
+func TestImporter_Import(t *testing.T) {
+	a, b, c := generateTestAddress("a"), generateTestAddress("b"), generateTestAddress("c")
+
+	t.Run("Successful import", func(t *testing.T) {
+		im, st := setupTestImporter(t)
+		require.NoError(t, st.CreateWallet(context.Background(), a, 100))
+		require.NoError(t, st.CreateWallet(context.Background(), b, 10))
+
+		rows, err := Parse(csvFile(a+","+b+",60,r1", b+","+a+",70,r2"))
+		require.NoError(t, err)
+
+		report := im.Import(context.Background(), rows, false)
+		assert.True(t, report.Valid)
+		assert.Equal(t, 2, report.Succeeded)
+		assert.Equal(t, 0, report.Failed)
+		assert.Equal(t, StatusOk, report.Rows[0].Status)
+		assert.Equal(t, StatusOk, report.Rows[1].Status)
+
+		balance, err := st.GetBalance(context.Background(), a)
+		require.NoError(t, err)
+		assert.Equal(t, 110.0, balance)
+	})
+
+	t.Run("Importing the same file twice", func(t *testing.T) {
+		im, st := setupTestImporter(t)
+		require.NoError(t, st.CreateWallet(context.Background(), a, 100))
+		require.NoError(t, st.CreateWallet(context.Background(), b, 10))
+
+		file := []string{a + "," + b + ",10,r1", a + "," + b + ",20,r2"}
+		rows, err := Parse(csvFile(file...))
+		require.NoError(t, err)
+		report := im.Import(context.Background(), rows, false)
+		require.True(t, report.Valid)
+		require.Equal(t, 2, report.Succeeded)
+
+		rows, err = Parse(csvFile(file...))
+		require.NoError(t, err)
+		report = im.Import(context.Background(), rows, false)
+		assert.False(t, report.Valid)
+		assert.Equal(t, 0, report.Succeeded)
+		assert.Equal(t, 2, report.Failed)
+		assert.Equal(t, "reference already executed", report.Rows[0].Error)
+		assert.Equal(t, "reference already executed", report.Rows[1].Error)
+
+		balance, err := st.GetBalance(context.Background(), a)
+		require.NoError(t, err)
+		assert.Equal(t, 70.0, balance)
+	})
+
+	t.Run("Reference executed after validation", func(t *testing.T) {
+		im, st := setupTestImporter(t)
+		require.NoError(t, st.CreateWallet(context.Background(), a, 100))
+		require.NoError(t, st.CreateWallet(context.Background(), b, 10))
+
+		rows, err := Parse(csvFile(a + "," + b + ",10,r1"))
+		require.NoError(t, err)
+		require.True(t, im.Import(context.Background(), rows, true).Valid)
+
+		// Another import executes the row between validation and execution.
+		require.NoError(t, st.SendMoneyWithReference(context.Background(), Reference("r1"), a, b, 10))
+		report := New(&validatedStorage{Storage: st}).Import(context.Background(), rows, false)
+		assert.Equal(t, StatusFailed, report.Rows[0].Status)
+		assert.Contains(t, report.Rows[0].Error, "already executed")
+
+		balance, err := st.GetBalance(context.Background(), a)
+		require.NoError(t, err)
+		assert.Equal(t, 90.0, balance)
+	})
+
+	t.Run("Execution outlives the caller", func(t *testing.T) {
+		_, st := setupTestImporter(t)
+		require.NoError(t, st.CreateWallet(context.Background(), a, 100))
+		require.NoError(t, st.CreateWallet(context.Background(), b, 10))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		im := New(cancellingStorage{Storage: st, cancel: cancel}, WithExecutionTimeout(time.Minute))
+
+		rows, err := Parse(csvFile(a+","+b+",10,r1", a+","+b+",20,r2"))
+		require.NoError(t, err)
+
+		report := im.Import(ctx, rows, false)
+		assert.Equal(t, 2, report.Succeeded)
+		assert.Equal(t, 0, report.Failed)
+	})
+
+	t.Run("Execution timeout", func(t *testing.T) {
+		_, st := setupTestImporter(t)
+		require.NoError(t, st.CreateWallet(context.Background(), a, 100))
+		require.NoError(t, st.CreateWallet(context.Background(), b, 10))
+
+		im := New(st, WithExecutionTimeout(time.Nanosecond))
+		rows, err := Parse(csvFile(a + "," + b + ",10,r1"))
+		require.NoError(t, err)
+
+		report := im.Import(context.Background(), rows, false)
+		assert.True(t, report.Valid)
+		assert.Equal(t, StatusFailed, report.Rows[0].Status)
+		assert.Contains(t, report.Rows[0].Error, context.DeadlineExceeded.Error())
+	})
+
+	t.Run("Dry run does not execute", func(t *testing.T) {
+		im, st := setupTestImporter(t)
+		require.NoError(t, st.CreateWallet(context.Background(), a, 100))
+		require.NoError(t, st.CreateWallet(context.Background(), b, 10))
+
+		rows, err := Parse(csvFile(a + "," + b + ",60,r1"))
+		require.NoError(t, err)
+
+		report := im.Import(context.Background(), rows, true)
+		assert.True(t, report.Valid)
+		assert.True(t, report.DryRun)
+		assert.Equal(t, StatusValid, report.Rows[0].Status)
+
+		balance, err := st.GetBalance(context.Background(), a)
+		require.NoError(t, err)
+		assert.Equal(t, 100.0, balance)
+	})
+
+	t.Run("Invalid rows block the whole file", func(t *testing.T) {
+		im, st := setupTestImporter(t)
+		require.NoError(t, st.CreateWallet(context.Background(), a, 100))
+		require.NoError(t, st.CreateWallet(context.Background(), b, 10))
+
+		rows, err := Parse(csvFile(
+			a+","+b+",10,r1",
+			a+","+b+",10,r1",
+			"zz"+a[2:]+","+b+",10,r3",
+			a+","+c+",10,r4",
+			a+","+b+",-1,r5",
+			a+","+b+",abc,r6",
+			a+","+b+",95,r7",
+			a+","+b+",1,",
+		))
+		require.NoError(t, err)
+
+		report := im.Import(context.Background(), rows, false)
+		assert.False(t, report.Valid)
+		assert.Equal(t, 0, report.Succeeded)
+		assert.Equal(t, 7, report.Failed)
+
+		assert.Equal(t, StatusSkipped, report.Rows[0].Status)
+		assert.Contains(t, report.Rows[1].Error, "duplicate reference")
+		assert.Equal(t, "invalid from address", report.Rows[2].Error)
+		assert.Contains(t, report.Rows[3].Error, "does not exist")
+		assert.Equal(t, "amount must be positive", report.Rows[4].Error)
+		assert.Contains(t, report.Rows[5].Error, "invalid amount")
+		assert.Contains(t, report.Rows[6].Error, "insufficient funds")
+		assert.Equal(t, "reference is required", report.Rows[7].Error)
+
+		balance, err := st.GetBalance(context.Background(), a)
+		require.NoError(t, err)
+		assert.Equal(t, 100.0, balance)
+	})
+
+	t.Run("Risk rules reject rows", func(t *testing.T) {
+		_, st := setupTestImporter(t)
+		require.NoError(t, st.CreateWallet(context.Background(), a, 100))
+		require.NoError(t, st.CreateWallet(context.Background(), b, 10))
+		require.NoError(t, st.CreateWallet(context.Background(), c, 10))
+
+		im := New(st, WithRiskRules(evaluatorFunc(func(tr risk.Transfer) risk.Result {
+			switch {
+			case tr.Amount >= 50:
+				return risk.Result{Action: risk.ActionDeny, Rule: "large", Reason: "too much"}
+			case tr.To == c:
+				return risk.Result{Action: risk.ActionHold, Rule: "watch", Reason: "watched recipient"}
+			}
+			return risk.Result{Action: risk.ActionAllow}
+		})))
+
+		rows, err := Parse(csvFile(a+","+b+",10,r1", a+","+b+",60,r2", a+","+c+",5,r3"))
+		require.NoError(t, err)
+
+		report := im.Import(context.Background(), rows, false)
+		assert.False(t, report.Valid)
+		assert.Equal(t, StatusSkipped, report.Rows[0].Status)
+		assert.Equal(t, "denied by risk rule large: too much", report.Rows[1].Error)
+		assert.Equal(t, "held by risk rule watch: watched recipient", report.Rows[2].Error)
+	})
+
+	t.Run("Blocked addresses reject rows", func(t *testing.T) {
+		_, st := setupTestImporter(t)
+		require.NoError(t, st.CreateWallet(context.Background(), a, 100))
+		require.NoError(t, st.CreateWallet(context.Background(), b, 10))
+
+		im := New(st, WithScreening(screenFunc(func(from, to string) error {
+			if to == b {
+				return &screening.BlockedError{Address: b, Role: "recipient"}
+			}
+			return nil
+		})))
+
+		rows, err := Parse(csvFile(b+","+a+",5,r1", a+","+b+",10,r2"))
+		require.NoError(t, err)
+
+		report := im.Import(context.Background(), rows, true)
+		assert.False(t, report.Valid)
+		assert.Equal(t, StatusSkipped, report.Rows[0].Status)
+		assert.Equal(t, "recipient "+b+" is blocked", report.Rows[1].Error)
+	})
+}
+
+func TestReport_WriteCSV(t *testing.T) {
+	report := Report{Rows: []Result{{Line: 2, Reference: "r1", From: "a", To: "b", Amount: 1.5, Status: StatusOk}}}
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteCSV(&buf))
+	assert.Equal(t, "line,reference,from,to,amount,status,error\n2,r1,a,b,1.5,ok,\n", buf.String())
+}
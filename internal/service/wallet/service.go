@@ -1,11 +1,14 @@
 package wallet
 
 import (
+	"context"
+	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
 	"sync"
 
+	"github.com/Petro-vich/transaction_processing_go/internal/address"
 	"github.com/Petro-vich/transaction_processing_go/internal/storage"
 )
 
@@ -18,7 +21,7 @@ func NewService(storage storage.Repository) *WalletService {
 		storage: storage}
 }
 
-func (ws *WalletService) InitWall(count int) error {
+func (ws *WalletService) InitWall(ctx context.Context, count int) error {
 	if count <= 0 {
 		return fmt.Errorf("count can not be zero or negative")
 	}
@@ -37,7 +40,7 @@ func (ws *WalletService) InitWall(count int) error {
 				return
 			}
 			mu.Lock()
-			err = ws.storage.CreateWallet(wallAdr, 100.0)
+			err = ws.storage.CreateWallet(ctx, wallAdr.Hex(), 100.0)
 			mu.Unlock()
 			if err != nil {
 				chErr <- err
@@ -59,11 +62,45 @@ func (ws *WalletService) InitWall(count int) error {
 	return nil
 }
 
-func generateWalletAddress() (string, error) {
-	bytes := make([]byte, 32)
-	_, err := rand.Read(bytes)
+// CreateWallet creates a wallet with a freshly generated address and
+// the given starting balance.
+func (ws *WalletService) CreateWallet(ctx context.Context, amount float64) (address.Address, error) {
+	wallAdr, err := generateWalletAddress()
 	if err != nil {
-		return "", err
+		return address.Address{}, err
 	}
-	return hex.EncodeToString(bytes), nil
+
+	if err := ws.storage.CreateWallet(ctx, wallAdr.Hex(), amount); err != nil {
+		return address.Address{}, err
+	}
+
+	return wallAdr, nil
+}
+
+// Keypair is a wallet whose address is the Ed25519 public key.
+type Keypair struct {
+	Address address.Address
+	// PrivateKey is the hex encoded Ed25519 private key. It is not stored
+	// and must be kept by the owner to sign transfers.
+	PrivateKey string
+}
+
+// CreateKeypairWallet creates a wallet addressed by a freshly generated
+// Ed25519 public key and returns the private key once.
+func (ws *WalletService) CreateKeypairWallet(ctx context.Context, amount float64) (Keypair, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return Keypair{}, err
+	}
+
+	adr := address.FromPublicKey(pub)
+	if err := ws.storage.CreateWallet(ctx, adr.Hex(), amount); err != nil {
+		return Keypair{}, err
+	}
+
+	return Keypair{Address: adr, PrivateKey: hex.EncodeToString(priv)}, nil
+}
+
+func generateWalletAddress() (address.Address, error) {
+	return address.Generate()
 }
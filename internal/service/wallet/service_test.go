@@ -1,61 +1,99 @@
 package wallet
 
 import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
 	"testing"
 
-	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage/memory"
 	"github.com/Petro-vich/transaction_processing_go/internal/storage/sqlite"
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
-type mockStorage struct {
-	mock.Mock
+// failingStorage fails every wallet creation with err.
+type failingStorage struct {
+	storage.Repository
+	err error
 }
 
-func (_m *mockStorage) CreateWallet(address string, amount float64) error {
-	args := _m.Called(address, amount)
-	//fmt.Println(args.Error(0))
-	return args.Error(0)
-}
-
-func (_m *mockStorage) GetBalance(address string) (float64, error) {
-	args := _m.Called(address)
-	return args.Get(0).(float64), args.Error(1)
-}
-
-func (_m *mockStorage) SendMoney(from, to string, amount float64) error {
-	args := _m.Called(from, to, amount)
-	return args.Error(0)
-}
-
-func (_m *mockStorage) GetLast(count int) ([]transaction.Request, error) {
-	args := _m.Called(count)
-	return args.Get(0).([]transaction.Request), args.Error(1)
+func (st failingStorage) CreateWallet(context.Context, string, float64) error {
+	return st.err
 }
 
 func TestWalletService_Initialize(t *testing.T) {
-	store := &mockStorage{}
-	service := NewService(store)
 	t.Run("Successful init", func(t *testing.T) {
+		store := memory.New()
+		service := NewService(store)
 
-		store.On("CreateWallet", mock.AnythingOfType("string"), 100.0).Return(nil).Times(1)
-
-		err := service.InitWall(1)
+		err := service.InitWall(context.Background(), 1)
 		assert.NoError(t, err)
+		assert.False(t, store.IsEmpty())
 	})
 
 	t.Run("Negative count", func(t *testing.T) {
+		service := NewService(memory.New())
 
-		err := service.InitWall(-1)
+		err := service.InitWall(context.Background(), -1)
 		assert.EqualError(t, err, "count can not be zero or negative")
 	})
 
 	t.Run("zero count", func(t *testing.T) {
+		service := NewService(memory.New())
 
-		err := service.InitWall(-1)
+		err := service.InitWall(context.Background(), 0)
 		assert.EqualError(t, err, "count can not be zero or negative")
 	})
+
+	t.Run("Storage error", func(t *testing.T) {
+		service := NewService(failingStorage{err: assert.AnError})
+
+		err := service.InitWall(context.Background(), 3)
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
+
+func TestWalletService_CreateWallet(t *testing.T) {
+	t.Run("Successful creation", func(t *testing.T) {
+		store := memory.New()
+		service := NewService(store)
+
+		adr, err := service.CreateWallet(context.Background(), 25.0)
+		assert.NoError(t, err)
+		assert.NotZero(t, adr)
+
+		balance, err := store.GetBalance(context.Background(), adr.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, 25.0, balance)
+	})
+
+	t.Run("Storage error", func(t *testing.T) {
+		service := NewService(failingStorage{err: assert.AnError})
+
+		adr, err := service.CreateWallet(context.Background(), 25.0)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.Zero(t, adr)
+	})
+}
+
+func TestWalletService_CreateKeypairWallet(t *testing.T) {
+	store := memory.New()
+	service := NewService(store)
+
+	wallet, err := service.CreateKeypairWallet(context.Background(), 25.0)
+	require.NoError(t, err)
+
+	balance, err := store.GetBalance(context.Background(), wallet.Address.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, 25.0, balance)
+
+	pub := wallet.Address.Bytes()
+	priv, err := hex.DecodeString(wallet.PrivateKey)
+	require.NoError(t, err)
+	require.Len(t, priv, ed25519.PrivateKeySize)
+	assert.Equal(t, ed25519.PublicKey(pub), ed25519.PrivateKey(priv).Public())
 }
 
 func BenchmarkInitWallSequential(b *testing.B) {
@@ -68,6 +106,6 @@ func BenchmarkInitWallSequential(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_ = service.InitWall(1000) // Тестируем с 1000 кошельков
+		_ = service.InitWall(context.Background(), 1000) // Тестируем с 1000 кошельков
 	}
 }
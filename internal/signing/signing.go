@@ -0,0 +1,77 @@
+package signing
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid transfer signature")
+	ErrNonceReused      = errors.New("nonce has already been used")
+)
+
+// messagePrefix separates transfer signatures from signatures the same
+// key may produce for other purposes.
+const messagePrefix = "transaction-service/transfer/v1"
+
+// Transfer is the signed part of a transfer request. Nonce must be greater
+// than every nonce previously used by the sending wallet.
+type Transfer struct {
+	From   string
+	To     string
+	Amount float64
+	Nonce  int64
+}
+
+// Message returns the canonical encoding of t that is signed: the prefix,
+// the lowercase addresses, the shortest decimal form of the amount and the
+// nonce, separated by newlines.
+func Message(t Transfer) []byte {
+	return []byte(strings.Join([]string{
+		messagePrefix,
+		strings.ToLower(t.From),
+		strings.ToLower(t.To),
+		strconv.FormatFloat(t.Amount, 'f', -1, 64),
+		strconv.FormatInt(t.Nonce, 10),
+	}, "\n"))
+}
+
+// Sign returns the hex encoded signature of t.
+func Sign(key ed25519.PrivateKey, t Transfer) string {
+	return hex.EncodeToString(ed25519.Sign(key, Message(t)))
+}
+
+// Verify checks that signature is a hex encoded signature of t by the
+// key whose public half is the sending wallet address.
+func Verify(t Transfer, signature string) error {
+	const op = "signing.Verify"
+
+	pub, err := hex.DecodeString(t.From)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return fmt.Errorf("%s: sender address is not a public key: %w", op, ErrInvalidSignature)
+	}
+
+	sig, err := hex.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return fmt.Errorf("%s: malformed signature: %w", op, ErrInvalidSignature)
+	}
+
+	if !ed25519.Verify(ed25519.PublicKey(pub), Message(t), sig) {
+		return fmt.Errorf("%s: %w", op, ErrInvalidSignature)
+	}
+	return nil
+}
+
+// NonceStore records the latest nonce used by each wallet.
+type NonceStore interface {
+	// UseNonce records nonce for address, or returns ErrNonceReused
+	// if it is not greater than the latest one.
+	UseNonce(ctx context.Context, address string, nonce int64) error
+	// LastNonce returns the latest nonce of address, zero if none was used.
+	LastNonce(ctx context.Context, address string) (int64, error)
+}
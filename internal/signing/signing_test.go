@@ -0,0 +1,65 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newKey(t *testing.T) (string, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	return hex.EncodeToString(pub), priv
+}
+
+func TestMessage(t *testing.T) {
+	msg := Message(Transfer{From: "AB", To: "cd", Amount: 10.5, Nonce: 7})
+	assert.Equal(t, "transaction-service/transfer/v1\nab\ncd\n10.5\n7", string(msg))
+
+	msg = Message(Transfer{From: "ab", To: "cd", Amount: 1e21, Nonce: 1})
+	assert.Equal(t, "transaction-service/transfer/v1\nab\ncd\n1000000000000000000000\n1", string(msg))
+}
+
+func TestVerify(t *testing.T) {
+	from, key := newKey(t)
+	to, _ := newKey(t)
+	transfer := Transfer{From: from, To: to, Amount: 25, Nonce: 1}
+	sig := Sign(key, transfer)
+
+	t.Run("Valid", func(t *testing.T) {
+		assert.NoError(t, Verify(transfer, sig))
+
+		upper := transfer
+		upper.From = strings.ToUpper(from)
+		assert.NoError(t, Verify(upper, strings.ToUpper(sig)))
+	})
+
+	t.Run("Tampered fields", func(t *testing.T) {
+		for _, tampered := range []Transfer{
+			{From: from, To: to, Amount: 26, Nonce: 1},
+			{From: from, To: from, Amount: 25, Nonce: 1},
+			{From: from, To: to, Amount: 25, Nonce: 2},
+		} {
+			assert.ErrorIs(t, Verify(tampered, sig), ErrInvalidSignature)
+		}
+	})
+
+	t.Run("Signed by another key", func(t *testing.T) {
+		_, other := newKey(t)
+		assert.ErrorIs(t, Verify(transfer, Sign(other, transfer)), ErrInvalidSignature)
+	})
+
+	t.Run("Malformed input", func(t *testing.T) {
+		assert.ErrorIs(t, Verify(transfer, "zz"), ErrInvalidSignature)
+		assert.ErrorIs(t, Verify(transfer, sig[:10]), ErrInvalidSignature)
+
+		bad := transfer
+		bad.From = "not-hex"
+		assert.ErrorIs(t, Verify(bad, sig), ErrInvalidSignature)
+	})
+}
@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+)
+
+// generationStripes is the number of generation counters addresses are
+// spread over. A transfer only rejects concurrent fills of addresses that
+// share a stripe with one of its wallets.
+const generationStripes = 256
+
+// Stats are the cache counters since the cache was created.
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Size      int    `json:"size"`
+}
+
+type entry struct {
+	address string
+	balance float64
+	expires time.Time
+}
+
+// Storage is a storage.Repository decorator that caches wallet balances.
+// It keeps at most size balances, each for at most ttl, and drops the
+// balances of both wallets once a transfer between them returns.
+//
+// A balance read from the repository is only cached if no transfer touching
+// the wallet finished while it was being read, so a client never reads
+// a balance older than its own completed transfer.
+type Storage struct {
+	storage.Repository
+
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order holds the entries, most recently used first.
+	order *list.List
+	gens  [generationStripes]uint64
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+// New wraps repo with a cache of at most size balances. A non-positive
+// ttl keeps balances until they are evicted or invalidated.
+func New(repo storage.Repository, size int, ttl time.Duration) *Storage {
+	return &Storage{
+		Repository: repo,
+		size:       size,
+		ttl:        ttl,
+		now:        time.Now,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Unwrap returns the decorated repository.
+func (st *Storage) Unwrap() storage.Repository {
+	return st.Repository
+}
+
+func (st *Storage) GetBalance(ctx context.Context, address string) (float64, error) {
+	if balance, ok := st.lookup(address); ok {
+		st.hits.Add(1)
+		return balance, nil
+	}
+	st.misses.Add(1)
+
+	gen := st.generation(address)
+	balance, err := st.Repository.GetBalance(ctx, address)
+	if err != nil {
+		return 0, err
+	}
+
+	st.store(address, balance, gen)
+	return balance, nil
+}
+
+func (st *Storage) SendMoney(ctx context.Context, from, to string, amount float64) error {
+	// A failed transfer may still have committed, e.g. when the context
+	// expired after the commit, so both wallets are invalidated regardless.
+	defer st.invalidate(from, to)
+	return st.Repository.SendMoney(ctx, from, to, amount)
+}
+
+func (st *Storage) SendMoneyWithReference(ctx context.Context, reference, from, to string, amount float64) error {
+	defer st.invalidate(from, to)
+	return st.Repository.SendMoneyWithReference(ctx, reference, from, to, amount)
+}
+
+func (st *Storage) CreateWallet(ctx context.Context, address string, amount float64) error {
+	defer st.invalidate(address)
+	return st.Repository.CreateWallet(ctx, address, amount)
+}
+
+// Stats returns the current cache counters.
+func (st *Storage) Stats() Stats {
+	st.mu.Lock()
+	size := st.order.Len()
+	st.mu.Unlock()
+
+	return Stats{
+		Hits:      st.hits.Load(),
+		Misses:    st.misses.Load(),
+		Evictions: st.evictions.Load(),
+		Size:      size,
+	}
+}
+
+func (st *Storage) lookup(address string) (float64, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	el, ok := st.entries[address]
+	if !ok {
+		return 0, false
+	}
+
+	e := el.Value.(*entry)
+	if st.ttl > 0 && !st.now().Before(e.expires) {
+		st.remove(el)
+		return 0, false
+	}
+
+	st.order.MoveToFront(el)
+	return e.balance, true
+}
+
+// store caches the balance read at generation gen unless a transfer
+// touching the address has been invalidated since.
+func (st *Storage) store(address string, balance float64, gen uint64) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.gens[stripe(address)] != gen {
+		return
+	}
+
+	expires := st.now().Add(st.ttl)
+	if el, ok := st.entries[address]; ok {
+		e := el.Value.(*entry)
+		e.balance, e.expires = balance, expires
+		st.order.MoveToFront(el)
+		return
+	}
+
+	st.entries[address] = st.order.PushFront(&entry{address: address, balance: balance, expires: expires})
+	for st.order.Len() > st.size {
+		st.remove(st.order.Back())
+		st.evictions.Add(1)
+	}
+}
+
+func (st *Storage) generation(address string) uint64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.gens[stripe(address)]
+}
+
+func (st *Storage) invalidate(addresses ...string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for _, address := range addresses {
+		st.gens[stripe(address)]++
+		if el, ok := st.entries[address]; ok {
+			st.remove(el)
+		}
+	}
+}
+
+func (st *Storage) remove(el *list.Element) {
+	st.order.Remove(el)
+	delete(st.entries, el.Value.(*entry).address)
+}
+
+// stripe returns the generation counter of address using FNV-1a.
+func stripe(address string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(address); i++ {
+		h ^= uint32(address[i])
+		h *= 16777619
+	}
+	return int(h % generationStripes)
+}
@@ -0,0 +1,208 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage/memory"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRepository(t *testing.T) storage.Repository {
+	return New(memory.New(), 100, time.Minute)
+}
+
+func TestStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, newTestRepository)
+}
+
+func TestStorage_Concurrent(t *testing.T) {
+	storagetest.RunConcurrent(t, newTestRepository)
+}
+
+func setup(t *testing.T, size int, ttl time.Duration) *Storage {
+	t.Helper()
+	st := New(memory.New(), size, ttl)
+	ctx := context.Background()
+	for _, p := range []string{"a", "b", "c"} {
+		require.NoError(t, st.CreateWallet(ctx, storagetest.Address(p), 100))
+	}
+	return st
+}
+
+func TestStorage_GetBalance(t *testing.T) {
+	ctx := context.Background()
+	a, b, c := storagetest.Address("a"), storagetest.Address("b"), storagetest.Address("c")
+
+	t.Run("Hits and misses", func(t *testing.T) {
+		st := setup(t, 10, time.Minute)
+
+		for i := 0; i < 3; i++ {
+			balance, err := st.GetBalance(ctx, a)
+			require.NoError(t, err)
+			assert.Equal(t, 100.0, balance)
+		}
+
+		_, err := st.GetBalance(ctx, storagetest.Address("x"))
+		assert.ErrorIs(t, err, storage.ErrAddressNotExist)
+
+		assert.Equal(t, Stats{Hits: 2, Misses: 2, Size: 1}, st.Stats())
+	})
+
+	t.Run("Transfer invalidates both wallets", func(t *testing.T) {
+		st := setup(t, 10, time.Minute)
+		for _, address := range []string{a, b, c} {
+			_, err := st.GetBalance(ctx, address)
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, st.SendMoney(ctx, a, b, 30))
+
+		balance, err := st.GetBalance(ctx, a)
+		require.NoError(t, err)
+		assert.Equal(t, 70.0, balance)
+		balance, err = st.GetBalance(ctx, b)
+		require.NoError(t, err)
+		assert.Equal(t, 130.0, balance)
+
+		_, err = st.GetBalance(ctx, c)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), st.Stats().Hits, "the third wallet stays cached")
+	})
+
+	t.Run("Expired entries are read again", func(t *testing.T) {
+		st := setup(t, 10, time.Minute)
+		now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		st.now = func() time.Time { return now }
+
+		_, err := st.GetBalance(ctx, a)
+		require.NoError(t, err)
+
+		now = now.Add(time.Minute)
+		_, err = st.GetBalance(ctx, a)
+		require.NoError(t, err)
+
+		assert.Equal(t, Stats{Misses: 2, Size: 1}, st.Stats())
+	})
+
+	t.Run("Least recently used entry is evicted", func(t *testing.T) {
+		st := setup(t, 2, time.Minute)
+
+		for _, address := range []string{a, b, a, c} {
+			_, err := st.GetBalance(ctx, address)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, Stats{Hits: 1, Misses: 3, Evictions: 1, Size: 2}, st.Stats())
+
+		_, err := st.GetBalance(ctx, a)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), st.Stats().Hits)
+
+		_, err = st.GetBalance(ctx, b)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(4), st.Stats().Misses)
+	})
+}
+
+// slowRepository blocks the first GetBalance after reading the balance
+// until release is closed, so the balance it returns can be outdated by then.
+type slowRepository struct {
+	storage.Repository
+	once    sync.Once
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (r *slowRepository) GetBalance(ctx context.Context, address string) (float64, error) {
+	balance, err := r.Repository.GetBalance(ctx, address)
+	r.once.Do(func() {
+		close(r.read)
+		<-r.release
+	})
+	return balance, err
+}
+
+func TestStorage_ReadYourWrites(t *testing.T) {
+	ctx := context.Background()
+	a, b := storagetest.Address("a"), storagetest.Address("b")
+
+	t.Run("Outdated read is not cached", func(t *testing.T) {
+		repo := memory.New()
+		require.NoError(t, repo.CreateWallet(ctx, a, 100))
+		require.NoError(t, repo.CreateWallet(ctx, b, 100))
+
+		slow := &slowRepository{Repository: repo, read: make(chan struct{}), release: make(chan struct{})}
+		st := New(slow, 10, time.Minute)
+
+		done := make(chan float64)
+		go func() {
+			balance, _ := st.GetBalance(ctx, a)
+			done <- balance
+		}()
+		<-slow.read
+
+		require.NoError(t, st.SendMoney(ctx, a, b, 40))
+		close(slow.release)
+		assert.Equal(t, 100.0, <-done, "the read started before the transfer")
+
+		balance, err := st.GetBalance(ctx, a)
+		require.NoError(t, err)
+		assert.Equal(t, 60.0, balance)
+	})
+
+	t.Run("Concurrent clients", func(t *testing.T) {
+		const (
+			clients   = 8
+			transfers = 200
+		)
+
+		st := New(memory.New(), 4, time.Minute)
+		for i := 0; i < clients; i++ {
+			require.NoError(t, st.CreateWallet(ctx, storagetest.Address(fmt.Sprintf("a%d", i)), transfers))
+			require.NoError(t, st.CreateWallet(ctx, storagetest.Address(fmt.Sprintf("b%d", i)), 1))
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// Readers keep refilling the cache with balances that may be
+		// read while a transfer is in progress.
+		var readers sync.WaitGroup
+		for i := 0; i < clients; i++ {
+			readers.Add(1)
+			go func(address string) {
+				defer readers.Done()
+				for ctx.Err() == nil {
+					st.GetBalance(ctx, address)
+				}
+			}(storagetest.Address(fmt.Sprintf("a%d", i)))
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < clients; i++ {
+			wg.Add(1)
+			go func(from, to string) {
+				defer wg.Done()
+				for n := 1; n <= transfers; n++ {
+					if !assert.NoError(t, st.SendMoney(context.Background(), from, to, 1)) {
+						return
+					}
+					balance, err := st.GetBalance(context.Background(), from)
+					if !assert.NoError(t, err) || !assert.Equal(t, float64(transfers-n), balance) {
+						return
+					}
+				}
+			}(storagetest.Address(fmt.Sprintf("a%d", i)), storagetest.Address(fmt.Sprintf("b%d", i)))
+		}
+
+		wg.Wait()
+		cancel()
+		readers.Wait()
+	})
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrAddressNotExist = errors.New("the address does not exist")
+	ErrInsufficient    = errors.New("insufficient funds")
+	ErrConflict        = errors.New("the resource already exists")
+	ErrValidation      = errors.New("validation failed")
+	ErrBusy            = errors.New("the storage is busy")
+	ErrReferenceUsed   = errors.New("the reference was already executed")
+)
+
+// NotFoundError is returned when a wallet address is not present in the storage.
+type NotFoundError struct {
+	Address string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrAddressNotExist, e.Address)
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrAddressNotExist
+}
+
+// ConflictError is returned when a wallet with the same address already exists.
+type ConflictError struct {
+	Address string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrConflict, e.Address)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// ReferenceUsedError is returned when a transfer with the same reference
+// was already executed.
+type ReferenceUsedError struct {
+	Reference string
+}
+
+func (e *ReferenceUsedError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrReferenceUsed, e.Reference)
+}
+
+func (e *ReferenceUsedError) Is(target error) bool {
+	return target == ErrReferenceUsed
+}
+
+// InsufficientFundsError is returned when the sender balance does not cover a transfer.
+type InsufficientFundsError struct {
+	Address   string
+	Available float64
+	Requested float64
+}
+
+func (e *InsufficientFundsError) Error() string {
+	return fmt.Sprintf("%s: %s has %g, requested %g", ErrInsufficient, e.Address, e.Available, e.Requested)
+}
+
+func (e *InsufficientFundsError) Is(target error) bool {
+	return target == ErrInsufficient
+}
+
+// ValidationError is returned when the input is rejected before reaching the database.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
@@ -0,0 +1,537 @@
+// Package journal implements storage.Repository as an append-only event log.
+//
+// Every change is appended to journal.log as a checksummed record and synced
+// to disk before it becomes visible. Balances and transactions are kept in
+// memory and rebuilt on startup from the latest snapshot plus the events
+// logged after it. A record torn by a crash at the end of the log is
+// truncated during replay.
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/address"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/flock"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/logger/sl"
+	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+)
+
+// Files kept in the journal directory.
+const (
+	logFile      = "journal.log"
+	snapshotFile = "snapshot"
+	lockFile     = "LOCK"
+)
+
+// DefaultSnapshotEvery is the number of logged events after which a
+// snapshot is written and the log is truncated.
+const DefaultSnapshotEvery = 1000
+
+// A failed snapshot is retried after minSnapshotBackoff, doubling with
+// every further failure up to maxSnapshotBackoff.
+const (
+	minSnapshotBackoff = time.Second
+	maxSnapshotBackoff = 5 * time.Minute
+)
+
+type Storage struct {
+	mu    sync.RWMutex
+	dir   string
+	log   *os.File
+	lock  *flock.Lock
+	state *state
+
+	// offset is the end of the last complete record in the log.
+	offset        int64
+	snapshotEvery int
+	sinceSnapshot int
+
+	// snapshotting is set while a snapshot is written in the background,
+	// tracked by bg. After a failure none is started before retryAt.
+	snapshotting bool
+	closing      bool
+	backoff      time.Duration
+	retryAt      time.Time
+	bg           sync.WaitGroup
+
+	logger *slog.Logger
+	now    func() time.Time
+}
+
+// New opens the journal in dir, creating it if needed, and replays it.
+// The directory is locked so that only one process appends to the log.
+func New(dir string, snapshotEvery int) (*Storage, error) {
+	const op = "storage.journal.New"
+
+	if snapshotEvery <= 0 {
+		snapshotEvery = DefaultSnapshotEvery
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	lock, err := flock.TryLock(filepath.Join(dir, lockFile))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st, err := open(dir, snapshotEvery)
+	if err != nil {
+		lock.Unlock()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	st.lock = lock
+
+	return st, nil
+}
+
+func open(dir string, snapshotEvery int) (*Storage, error) {
+	state, err := loadSnapshot(filepath.Join(dir, snapshotFile))
+	if err != nil {
+		return nil, err
+	}
+	snapshotSeq := state.Seq
+
+	log, err := os.OpenFile(filepath.Join(dir, logFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	offset, err := replayLog(log, state.apply)
+	if err != nil {
+		log.Close()
+		return nil, err
+	}
+
+	if err := truncate(log, offset); err != nil {
+		log.Close()
+		return nil, err
+	}
+
+	return &Storage{
+		dir:           dir,
+		log:           log,
+		state:         state,
+		offset:        offset,
+		snapshotEvery: snapshotEvery,
+		sinceSnapshot: int(state.Seq - snapshotSeq),
+		logger:        slog.Default(),
+		now:           time.Now,
+	}, nil
+}
+
+// UseLogger makes the storage report failed background snapshots to log.
+func (st *Storage) UseLogger(log *slog.Logger) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.logger = log
+}
+
+// truncate cuts the log at offset, dropping a torn tail record, and
+// positions the file for the next append.
+func truncate(log *os.File, offset int64) error {
+	info, err := log.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.Size() != offset {
+		if err := log.Truncate(offset); err != nil {
+			return err
+		}
+		if err := log.Sync(); err != nil {
+			return err
+		}
+	}
+
+	_, err = log.Seek(offset, io.SeekStart)
+	return err
+}
+
+func (st *Storage) CreateWallet(ctx context.Context, adr string, amount float64) error {
+	const op = "storage.journal.CreateWallet"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if amount < 0 {
+		return fmt.Errorf("%s: %w", op, &storage.ValidationError{
+			Field:   "amount",
+			Message: "balance must not be negative",
+		})
+	}
+
+	if len(adr) != 64 {
+		return fmt.Errorf("%s: %w", op, &storage.ValidationError{
+			Field:   "address",
+			Message: fmt.Sprintf("invalid address length (expected 64, got %d)", len(adr)),
+		})
+	}
+	if !address.IsCanonical(adr) {
+		return fmt.Errorf("%s: %w", op, &storage.ValidationError{
+			Field:   "address",
+			Message: "address must be lowercase hex",
+		})
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if _, ok := st.state.Wallets[adr]; ok {
+		return fmt.Errorf("%s: %w", op, &storage.ConflictError{Address: adr})
+	}
+
+	err := st.append(event{
+		Type:    eventWalletCreated,
+		Address: adr,
+		Amount:  amount,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (st *Storage) GetBalance(ctx context.Context, address string) (float64, error) {
+	const op = "storage.journal.GetBalance"
+
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	balance, ok := st.state.Wallets[address]
+	if !ok {
+		return 0, fmt.Errorf("%s: %w", op, &storage.NotFoundError{Address: address})
+	}
+
+	return balance, nil
+}
+
+func (st *Storage) SendMoney(ctx context.Context, from string, to string, amount float64) error {
+	return st.send(ctx, "storage.journal.SendMoney", "", from, to, amount)
+}
+
+func (st *Storage) SendMoneyWithReference(ctx context.Context, reference, from, to string, amount float64) error {
+	return st.send(ctx, "storage.journal.SendMoneyWithReference", reference, from, to, amount)
+}
+
+// send appends a transfer event, which carries reference unless it is
+// empty.
+func (st *Storage) send(ctx context.Context, op, reference, from, to string, amount float64) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if amount <= 0 {
+		return fmt.Errorf("%s: %w", op, &storage.ValidationError{
+			Field:   "amount",
+			Message: "amount must be positive",
+		})
+	}
+
+	if from == to {
+		return fmt.Errorf("%s: %w", op, &storage.ValidationError{
+			Field:   "to",
+			Message: "sender and recipient must differ",
+		})
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	balanceFrom, ok := st.state.Wallets[from]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, &storage.NotFoundError{Address: from})
+	}
+
+	if balanceFrom-amount < 0 {
+		return fmt.Errorf("%s: %w", op, &storage.InsufficientFundsError{
+			Address:   from,
+			Available: balanceFrom,
+			Requested: amount,
+		})
+	}
+
+	if _, ok := st.state.Wallets[to]; !ok {
+		return fmt.Errorf("%s: %w", op, &storage.NotFoundError{Address: to})
+	}
+
+	if _, ok := st.state.References[reference]; ok && reference != "" {
+		return fmt.Errorf("%s: %w", op, &storage.ReferenceUsedError{Reference: reference})
+	}
+
+	err := st.append(event{
+		Type:      eventTransfer,
+		From:      from,
+		To:        to,
+		Amount:    amount,
+		ID:        st.state.NextID,
+		Reference: reference,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (st *Storage) HasReference(ctx context.Context, reference string) (bool, error) {
+	const op = "storage.journal.HasReference"
+
+	if err := ctx.Err(); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	_, ok := st.state.References[reference]
+	return ok, nil
+}
+
+// GetLast returns up to count transactions, newest first. As with SQLite
+// LIMIT, a negative count returns all transactions.
+func (st *Storage) GetLast(ctx context.Context, count int) ([]transaction.Request, error) {
+	const op = "storage.journal.GetLast"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	return storage.Newest(st.state.Transactions, count, func(transaction.Request) bool { return true }), nil
+}
+
+// GetHistory returns up to count transactions sent or received by address,
+// newest first.
+func (st *Storage) GetHistory(ctx context.Context, address string, count int) ([]transaction.Request, error) {
+	const op = "storage.journal.GetHistory"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	if _, ok := st.state.Wallets[address]; !ok {
+		return nil, fmt.Errorf("%s: %w", op, &storage.NotFoundError{Address: address})
+	}
+
+	return storage.Newest(st.state.Transactions, count, func(tr transaction.Request) bool {
+		return tr.From == address || tr.To == address
+	}), nil
+}
+
+// append writes ev to the log, syncs it and applies it to the state.
+// The caller must hold the write lock.
+func (st *Storage) append(ev event) error {
+	ev.Seq = st.state.Seq + 1
+
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	record := encodeRecord(payload)
+
+	if _, err := st.log.Write(record); err != nil {
+		st.rewind()
+		return fmt.Errorf("write journal: %w", err)
+	}
+	if err := st.log.Sync(); err != nil {
+		st.rewind()
+		return fmt.Errorf("sync journal: %w", err)
+	}
+
+	if err := st.state.apply(ev); err != nil {
+		return err
+	}
+	st.offset += int64(len(record))
+	st.sinceSnapshot++
+	st.startSnapshot()
+
+	return nil
+}
+
+// startSnapshot writes a snapshot in the background once snapshotEvery
+// events were logged since the last one. Only copying the wallets happens
+// under the write lock; the transactions are append-only and shared. The
+// caller must hold the write lock.
+func (st *Storage) startSnapshot() {
+	if st.sinceSnapshot < st.snapshotEvery || st.snapshotting || st.closing || st.now().Before(st.retryAt) {
+		return
+	}
+
+	st.snapshotting = true
+	snap := st.state.clone()
+	cut := st.offset
+
+	st.bg.Add(1)
+	go func() {
+		defer st.bg.Done()
+		st.finishSnapshot(snap, cut)
+	}()
+}
+
+// finishSnapshot writes snap and drops the log up to cut, the end of the
+// last event in snap. The events are already durable, so a failure only
+// makes the log longer; it is logged and retried after a backoff.
+func (st *Storage) finishSnapshot(snap *state, cut int64) {
+	const op = "storage.journal.snapshot"
+
+	err := writeSnapshot(filepath.Join(st.dir, snapshotFile), snap)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.snapshotting = false
+
+	if err == nil {
+		err = st.dropLog(cut)
+	}
+	if err != nil {
+		st.backoff = min(max(2*st.backoff, minSnapshotBackoff), maxSnapshotBackoff)
+		st.retryAt = st.now().Add(st.backoff)
+		st.logger.Error("failed to write journal snapshot", slog.String("op", op),
+			slog.Duration("retry_in", st.backoff), sl.Err(err))
+		return
+	}
+
+	st.backoff = 0
+	st.retryAt = time.Time{}
+	st.sinceSnapshot = int(st.state.Seq - snap.Seq)
+}
+
+// dropLog replaces the log with the records after cut, those appended
+// while a snapshot was written. The new log is complete before it is
+// renamed over the old one, so a crash leaves either of them. The caller
+// must hold the write lock.
+func (st *Storage) dropLog(cut int64) error {
+	tail := make([]byte, st.offset-cut)
+	if _, err := st.log.ReadAt(tail, cut); err != nil {
+		return err
+	}
+
+	path := filepath.Join(st.dir, logFile)
+	tmp := path + ".tmp"
+	log, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := log.Write(tail); err == nil {
+		err = log.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		log.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	st.log.Close()
+	st.log = log
+	st.offset = int64(len(tail))
+	return syncDir(st.dir)
+}
+
+// rewind drops a partially written record so the next append starts at
+// a record boundary.
+func (st *Storage) rewind() {
+	if err := st.log.Truncate(st.offset); err == nil {
+		st.log.Seek(st.offset, io.SeekStart)
+	}
+}
+
+// snapshot writes the current state and empties the log while holding the
+// write lock, for Close. A crash between the two steps is harmless, replay
+// skips events already in the snapshot.
+func (st *Storage) snapshot() error {
+	if err := writeSnapshot(filepath.Join(st.dir, snapshotFile), st.state); err != nil {
+		return err
+	}
+
+	if err := truncate(st.log, 0); err != nil {
+		return err
+	}
+	st.offset = 0
+	st.sinceSnapshot = 0
+
+	return nil
+}
+
+// TotalFunds returns the sum of all wallet balances.
+func (st *Storage) TotalFunds(ctx context.Context) (float64, error) {
+	const op = "storage.journal.TotalFunds"
+
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	var total float64
+	for _, balance := range st.state.Wallets {
+		total += balance
+	}
+
+	return total, nil
+}
+
+func (st *Storage) IsEmpty() bool {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	return len(st.state.Wallets) == 0
+}
+
+// Close writes a final snapshot, closes the log and releases the directory lock.
+func (st *Storage) Close() error {
+	const op = "storage.journal.Close"
+
+	// A background snapshot needs the lock to finish.
+	st.mu.Lock()
+	st.closing = true
+	st.mu.Unlock()
+	st.bg.Wait()
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	var snapErr error
+	if st.sinceSnapshot > 0 {
+		snapErr = st.snapshot()
+	}
+
+	if err := st.log.Close(); err != nil {
+		st.lock.Unlock()
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := st.lock.Unlock(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if snapErr != nil {
+		return fmt.Errorf("%s: %w", op, snapErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,392 @@
+package journal
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/flock"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRepository(t *testing.T) storage.Repository {
+	st, err := New(t.TempDir(), DefaultSnapshotEvery)
+	require.NoError(t, err)
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+func TestStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, newTestRepository)
+}
+
+func TestStorage_Concurrent(t *testing.T) {
+	storagetest.RunConcurrent(t, newTestRepository)
+}
+
+func TestStorage_TotalFunds(t *testing.T) {
+	storagetest.RunFunds(t, func(t *testing.T) storagetest.FundsStore {
+		return newTestRepository(t).(*Storage)
+	})
+}
+
+// fill creates two wallets and logs three transfers between them.
+func fill(t *testing.T, st *Storage) {
+	t.Helper()
+	ctx := context.Background()
+	require.NoError(t, st.CreateWallet(ctx, storagetest.Address("a"), 100))
+	require.NoError(t, st.CreateWallet(ctx, storagetest.Address("b"), 100))
+	require.NoError(t, st.SendMoney(ctx, storagetest.Address("a"), storagetest.Address("b"), 10))
+	require.NoError(t, st.SendMoney(ctx, storagetest.Address("b"), storagetest.Address("a"), 5))
+	require.NoError(t, st.SendMoney(ctx, storagetest.Address("a"), storagetest.Address("b"), 20))
+}
+
+func assertFilled(t *testing.T, st *Storage) {
+	t.Helper()
+	ctx := context.Background()
+
+	balance, err := st.GetBalance(ctx, storagetest.Address("a"))
+	require.NoError(t, err)
+	assert.Equal(t, 75.0, balance)
+
+	balance, err = st.GetBalance(ctx, storagetest.Address("b"))
+	require.NoError(t, err)
+	assert.Equal(t, 125.0, balance)
+
+	transactions, err := st.GetLast(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, transactions, 3)
+	assert.Equal(t, 3, transactions[0].Id)
+	assert.Equal(t, 20.0, transactions[0].Amount)
+}
+
+// crash closes the log without the final snapshot Close would write, once
+// a background snapshot has finished.
+func crash(t *testing.T, st *Storage) {
+	t.Helper()
+	st.bg.Wait()
+	require.NoError(t, st.log.Close())
+	require.NoError(t, st.lock.Unlock())
+}
+
+func TestStorage_Replay(t *testing.T) {
+	dir := t.TempDir()
+
+	st, err := New(dir, DefaultSnapshotEvery)
+	require.NoError(t, err)
+	fill(t, st)
+	crash(t, st)
+
+	_, err = os.Stat(filepath.Join(dir, snapshotFile))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	st, err = New(dir, DefaultSnapshotEvery)
+	require.NoError(t, err)
+	defer st.Close()
+	assertFilled(t, st)
+
+	require.NoError(t, st.SendMoney(context.Background(), storagetest.Address("a"), storagetest.Address("b"), 1))
+	transactions, err := st.GetLast(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, 4, transactions[0].Id)
+}
+
+func TestStorage_TornTail(t *testing.T) {
+	cases := []struct {
+		name string
+		tail func(record []byte) []byte
+	}{
+		{"partial header", func(record []byte) []byte { return record[:5] }},
+		{"partial payload", func(record []byte) []byte { return record[:len(record)-3] }},
+		{"zero filled", func(record []byte) []byte { return make([]byte, len(record)) }},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			st, err := New(dir, DefaultSnapshotEvery)
+			require.NoError(t, err)
+			fill(t, st)
+			crash(t, st)
+
+			path := filepath.Join(dir, logFile)
+			info, err := os.Stat(path)
+			require.NoError(t, err)
+
+			record := encodeRecord([]byte(`{"seq":6,"type":"transfer","from":"x","to":"y","amount":1,"id":4}`))
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+			require.NoError(t, err)
+			_, err = f.Write(tc.tail(record))
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			st, err = New(dir, DefaultSnapshotEvery)
+			require.NoError(t, err)
+			defer st.Close()
+			assertFilled(t, st)
+
+			truncated, err := os.Stat(path)
+			require.NoError(t, err)
+			assert.Equal(t, info.Size(), truncated.Size())
+
+			require.NoError(t, st.SendMoney(context.Background(), storagetest.Address("a"), storagetest.Address("b"), 1))
+		})
+	}
+}
+
+func TestStorage_CorruptRecordBeforeTail(t *testing.T) {
+	dir := t.TempDir()
+
+	st, err := New(dir, DefaultSnapshotEvery)
+	require.NoError(t, err)
+	fill(t, st)
+	crash(t, st)
+
+	path := filepath.Join(dir, logFile)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[headerSize+2] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	_, err = New(dir, DefaultSnapshotEvery)
+	assert.ErrorIs(t, err, ErrCorrupt)
+}
+
+func TestStorage_CorruptTail(t *testing.T) {
+	dir := t.TempDir()
+
+	st, err := New(dir, DefaultSnapshotEvery)
+	require.NoError(t, err)
+	fill(t, st)
+	crash(t, st)
+
+	// A complete last record failing its checksum was not cut short by a
+	// crash, so it is not dropped.
+	path := filepath.Join(dir, logFile)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-2] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	_, err = New(dir, DefaultSnapshotEvery)
+	assert.ErrorIs(t, err, ErrCorrupt)
+}
+
+func TestStorage_CorruptLengthBeforeTail(t *testing.T) {
+	// recordOffsets returns where every record of the log starts.
+	recordOffsets := func(data []byte) []int {
+		var offsets []int
+		for offset := 0; offset < len(data); {
+			offsets = append(offsets, offset)
+			offset += headerSize + int(binary.BigEndian.Uint32(data[offset:offset+4]))
+		}
+		return offsets
+	}
+
+	cases := []struct {
+		name string
+		byte int
+		mask byte
+	}{
+		{"length within the file", 3, 0x01},
+		{"length past the end of the file", 1, 0x01},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			st, err := New(dir, DefaultSnapshotEvery)
+			require.NoError(t, err)
+			fill(t, st)
+			crash(t, st)
+
+			path := filepath.Join(dir, logFile)
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			offsets := recordOffsets(data)
+			require.Len(t, offsets, 5)
+			data[offsets[2]+tc.byte] ^= tc.mask
+			require.NoError(t, os.WriteFile(path, data, 0o644))
+
+			_, err = New(dir, DefaultSnapshotEvery)
+			assert.ErrorIs(t, err, ErrCorrupt)
+
+			after, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, data, after)
+		})
+	}
+}
+
+func TestStorage_ReplayReferences(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	st, err := New(dir, DefaultSnapshotEvery)
+	require.NoError(t, err)
+	fill(t, st)
+	require.NoError(t, st.SendMoneyWithReference(ctx, "pay-1", storagetest.Address("a"), storagetest.Address("b"), 1))
+	crash(t, st)
+
+	// The reference is replayed from the log, then read from the snapshot
+	// Close writes.
+	for i := 0; i < 2; i++ {
+		st, err = New(dir, DefaultSnapshotEvery)
+		require.NoError(t, err)
+
+		used, err := st.HasReference(ctx, "pay-1")
+		require.NoError(t, err)
+		assert.True(t, used)
+		err = st.SendMoneyWithReference(ctx, "pay-1", storagetest.Address("a"), storagetest.Address("b"), 1)
+		assert.ErrorIs(t, err, storage.ErrReferenceUsed)
+
+		require.NoError(t, st.Close())
+	}
+}
+
+func TestStorage_Snapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	st, err := New(dir, 2)
+	require.NoError(t, err)
+	fill(t, st)
+	st.bg.Wait()
+
+	// Snapshots run in the background, so which events they cover depends
+	// on timing; the log holds exactly the events after the latest one.
+	info, err := os.Stat(filepath.Join(dir, logFile))
+	require.NoError(t, err)
+	assert.Equal(t, st.offset, info.Size())
+	sinceSnapshot := st.sinceSnapshot
+	crash(t, st)
+
+	snap, err := loadSnapshot(filepath.Join(dir, snapshotFile))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, snap.Seq, uint64(2))
+	assert.Equal(t, 5, int(snap.Seq)+sinceSnapshot)
+
+	st, err = New(dir, 2)
+	require.NoError(t, err)
+	assertFilled(t, st)
+	require.NoError(t, st.Close())
+
+	// Close writes a final snapshot and leaves an empty log.
+	info, err = os.Stat(filepath.Join(dir, logFile))
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+
+	st, err = New(dir, 2)
+	require.NoError(t, err)
+	defer st.Close()
+	assertFilled(t, st)
+}
+
+func TestStorage_SnapshotBeforeLogTruncate(t *testing.T) {
+	dir := t.TempDir()
+
+	st, err := New(dir, DefaultSnapshotEvery)
+	require.NoError(t, err)
+	fill(t, st)
+
+	// A crash after the snapshot is written but before the log is emptied
+	// leaves events that are already in the snapshot.
+	require.NoError(t, writeSnapshot(filepath.Join(dir, snapshotFile), st.state))
+	crash(t, st)
+
+	st, err = New(dir, DefaultSnapshotEvery)
+	require.NoError(t, err)
+	defer st.Close()
+	assertFilled(t, st)
+}
+
+func TestStorage_SnapshotKeepsLaterEvents(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	st, err := New(dir, DefaultSnapshotEvery)
+	require.NoError(t, err)
+	require.NoError(t, st.CreateWallet(ctx, storagetest.Address("a"), 100))
+	require.NoError(t, st.CreateWallet(ctx, storagetest.Address("b"), 100))
+
+	// Transfers logged while the snapshot of the wallets is written stay
+	// in the log.
+	snap, cut := st.state.clone(), st.offset
+	require.NoError(t, st.SendMoney(ctx, storagetest.Address("a"), storagetest.Address("b"), 10))
+	require.NoError(t, st.SendMoney(ctx, storagetest.Address("b"), storagetest.Address("a"), 5))
+	require.NoError(t, writeSnapshot(filepath.Join(dir, snapshotFile), snap))
+	require.NoError(t, st.dropLog(cut))
+	require.NoError(t, st.SendMoney(ctx, storagetest.Address("a"), storagetest.Address("b"), 20))
+	crash(t, st)
+
+	st, err = New(dir, DefaultSnapshotEvery)
+	require.NoError(t, err)
+	defer st.Close()
+	assertFilled(t, st)
+	assert.Equal(t, 3, st.sinceSnapshot)
+}
+
+func TestStorage_SnapshotFailure(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// A directory in place of the temporary snapshot file fails every write.
+	blocker := filepath.Join(dir, snapshotFile+".tmp")
+	require.NoError(t, os.MkdirAll(blocker, 0o755))
+
+	st, err := New(dir, 1)
+	require.NoError(t, err)
+	var logged bytes.Buffer
+	st.UseLogger(slog.New(slog.NewTextHandler(&logged, nil)))
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	st.now = func() time.Time { return now }
+
+	fill(t, st)
+	st.bg.Wait()
+	assert.Equal(t, 1, strings.Count(logged.String(), "failed to write journal snapshot"),
+		"a failed snapshot is not retried before the backoff")
+	assert.Equal(t, minSnapshotBackoff, st.backoff)
+	assert.Equal(t, 5, st.sinceSnapshot)
+
+	now = now.Add(minSnapshotBackoff)
+	require.NoError(t, st.SendMoney(ctx, storagetest.Address("a"), storagetest.Address("b"), 1))
+	st.bg.Wait()
+	assert.Equal(t, 2, strings.Count(logged.String(), "failed to write journal snapshot"))
+	assert.Equal(t, 2*minSnapshotBackoff, st.backoff, "the backoff doubles")
+
+	require.NoError(t, os.Remove(blocker))
+	now = now.Add(2 * minSnapshotBackoff)
+	require.NoError(t, st.SendMoney(ctx, storagetest.Address("b"), storagetest.Address("a"), 1))
+	st.bg.Wait()
+	assert.Zero(t, st.backoff)
+	assert.Zero(t, st.sinceSnapshot)
+	require.NoError(t, st.Close())
+
+	st, err = New(dir, 1)
+	require.NoError(t, err)
+	defer st.Close()
+	transactions, err := st.GetLast(ctx, 10)
+	require.NoError(t, err)
+	assert.Len(t, transactions, 5)
+}
+
+func TestStorage_Locked(t *testing.T) {
+	dir := t.TempDir()
+
+	st, err := New(dir, DefaultSnapshotEvery)
+	require.NoError(t, err)
+	defer st.Close()
+
+	_, err = New(dir, DefaultSnapshotEvery)
+	assert.ErrorIs(t, err, flock.ErrLocked)
+}
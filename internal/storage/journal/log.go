@@ -0,0 +1,202 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+)
+
+var ErrCorrupt = errors.New("journal is corrupted")
+
+// Event types written to the log.
+const (
+	eventWalletCreated = "wallet_created"
+	eventTransfer      = "transfer"
+)
+
+// Every record is framed as a 4 byte big-endian payload length, a 4 byte
+// CRC-32C of the payload and the JSON encoded event.
+const (
+	headerSize    = 8
+	maxRecordSize = 1 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// event is a single state change. Seq increases by one with every event and
+// lets replay skip events already contained in the snapshot.
+type event struct {
+	Seq       uint64    `json:"seq"`
+	Type      string    `json:"type"`
+	Address   string    `json:"address,omitempty"`
+	From      string    `json:"from,omitempty"`
+	To        string    `json:"to,omitempty"`
+	Amount    float64   `json:"amount"`
+	ID        int       `json:"id,omitempty"`
+	Reference string    `json:"reference,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+}
+
+func encodeRecord(payload []byte) []byte {
+	record := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(payload, crcTable))
+	copy(record[headerSize:], payload)
+	return record
+}
+
+// errTorn marks a record that is incomplete or fails its checksum.
+var errTorn = errors.New("torn record")
+
+// readRecord reads one framed record of at most maxSize bytes. It returns
+// io.EOF at a clean end of input and errTorn for a partial or damaged record.
+func readRecord(r io.Reader, maxSize uint32) ([]byte, error) {
+	var header [headerSize]byte
+	_, err := io.ReadFull(r, header[:])
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err == io.ErrUnexpectedEOF {
+		return nil, errTorn
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size == 0 || size > maxSize {
+		return nil, errTorn
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errTorn
+		}
+		return nil, err
+	}
+
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, errTorn
+	}
+
+	return payload, nil
+}
+
+// replayLog calls apply for every event in the log and returns the offset
+// of the end of the last valid record. A damaged record is only tolerated
+// at the tail of the file, where it is left by a write interrupted by a
+// crash; damage followed by more data is reported as ErrCorrupt.
+func replayLog(file *os.File, apply func(event) error) (int64, error) {
+	const op = "storage.journal.replayLog"
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	reader := bufio.NewReader(file)
+	var offset int64
+
+	for {
+		payload, err := readRecord(reader, maxRecordSize)
+		if err == io.EOF {
+			return offset, nil
+		}
+		if errors.Is(err, errTorn) {
+			if isTail(file, offset, info.Size()) {
+				return offset, nil
+			}
+			return 0, fmt.Errorf("%s: %w: damaged record at offset %d", op, ErrCorrupt, offset)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		var ev event
+		if err := json.Unmarshal(payload, &ev); err != nil {
+			return 0, fmt.Errorf("%s: %w: record at offset %d: %v", op, ErrCorrupt, offset, err)
+		}
+		if err := apply(ev); err != nil {
+			return 0, fmt.Errorf("%s: %w: record at offset %d: %v", op, ErrCorrupt, offset, err)
+		}
+
+		offset += int64(headerSize + len(payload))
+	}
+}
+
+// isTail reports whether the damaged record starting at offset is the last
+// write to the file, cut short by a crash: the rest of the file is a partial
+// header, zero-filled space the file system allocated before the crash, or
+// a record whose declared length runs past the end of the file with no
+// valid record after it. A complete record failing its checksum, or a
+// length that leaves later records behind it, is corruption.
+func isTail(file *os.File, offset, size int64) bool {
+	rest := size - offset
+	if rest < headerSize {
+		return true
+	}
+	if zeroFilled(file, offset, size) {
+		return true
+	}
+	if rest > headerSize+maxRecordSize {
+		return false
+	}
+
+	buf := make([]byte, rest)
+	if _, err := file.ReadAt(buf, offset); err != nil {
+		return false
+	}
+
+	recordSize := int64(binary.BigEndian.Uint32(buf[0:4]))
+	if recordSize == 0 || recordSize > maxRecordSize || headerSize+recordSize <= rest {
+		return false
+	}
+	return !containsRecord(buf[headerSize:])
+}
+
+// containsRecord reports whether a complete record with a valid checksum
+// starts anywhere in data. Payloads are JSON and never contain a zero byte,
+// while every header starts with one, so only zero bytes are tried.
+func containsRecord(data []byte) bool {
+	for i := range data {
+		if data[i] != 0 || len(data)-i < headerSize {
+			continue
+		}
+		size := int(binary.BigEndian.Uint32(data[i : i+4]))
+		if size == 0 || size > maxRecordSize || len(data)-i-headerSize < size {
+			continue
+		}
+		payload := data[i+headerSize : i+headerSize+size]
+		if crc32.Checksum(payload, crcTable) == binary.BigEndian.Uint32(data[i+4:i+8]) {
+			return true
+		}
+	}
+	return false
+}
+
+func zeroFilled(file *os.File, offset, size int64) bool {
+	buf := make([]byte, 32*1024)
+	for offset < size {
+		n, err := file.ReadAt(buf, offset)
+		for _, b := range buf[:n] {
+			if b != 0 {
+				return false
+			}
+		}
+		offset += int64(n)
+		if err != nil {
+			return err == io.EOF && offset >= size
+		}
+	}
+	return true
+}
@@ -0,0 +1,175 @@
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
+)
+
+// state is the in-memory view rebuilt from the snapshot and the log.
+type state struct {
+	Seq          uint64                `json:"seq"`
+	Wallets      map[string]float64    `json:"wallets"`
+	Transactions []transaction.Request `json:"transactions"`
+	NextID       int                   `json:"next_id"`
+	// References maps the references of executed transfers to their
+	// transaction ids.
+	References map[string]int `json:"references,omitempty"`
+}
+
+func newState() *state {
+	return &state{
+		Wallets:    make(map[string]float64),
+		NextID:     1,
+		References: make(map[string]int),
+	}
+}
+
+// clone returns a copy of s that later events do not change. Transactions
+// are only ever appended, so the copy shares them up to their current
+// length.
+func (s *state) clone() *state {
+	wallets := make(map[string]float64, len(s.Wallets))
+	for adr, balance := range s.Wallets {
+		wallets[adr] = balance
+	}
+	references := make(map[string]int, len(s.References))
+	for ref, id := range s.References {
+		references[ref] = id
+	}
+	return &state{
+		Seq:          s.Seq,
+		Wallets:      wallets,
+		Transactions: s.Transactions[:len(s.Transactions):len(s.Transactions)],
+		NextID:       s.NextID,
+		References:   references,
+	}
+}
+
+// apply changes the state according to ev. Events up to the state sequence
+// number are already part of it and are skipped.
+func (s *state) apply(ev event) error {
+	if ev.Seq <= s.Seq {
+		return nil
+	}
+	if ev.Seq != s.Seq+1 {
+		return fmt.Errorf("expected event %d, got %d", s.Seq+1, ev.Seq)
+	}
+
+	switch ev.Type {
+	case eventWalletCreated:
+		s.Wallets[ev.Address] = ev.Amount
+	case eventTransfer:
+		s.Wallets[ev.From] -= ev.Amount
+		s.Wallets[ev.To] += ev.Amount
+		s.Transactions = append(s.Transactions, transaction.Request{
+			Id:         ev.ID,
+			From:       ev.From,
+			To:         ev.To,
+			Amount:     ev.Amount,
+			Created_at: ev.CreatedAt,
+		})
+		s.NextID = ev.ID + 1
+		if ev.Reference != "" {
+			s.References[ev.Reference] = ev.ID
+		}
+	default:
+		return fmt.Errorf("unknown event type %q", ev.Type)
+	}
+
+	s.Seq = ev.Seq
+	return nil
+}
+
+// loadSnapshot reads the snapshot at path. A missing snapshot yields an
+// empty state. The snapshot is replaced atomically, so a damaged one is
+// never expected and is reported as ErrCorrupt.
+func loadSnapshot(path string) (*state, error) {
+	const op = "storage.journal.loadSnapshot"
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return newState(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer file.Close()
+
+	payload, err := readRecord(file, math.MaxUint32)
+	if errors.Is(err, errTorn) || err == io.EOF {
+		return nil, fmt.Errorf("%s: %w: damaged snapshot", op, ErrCorrupt)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st := newState()
+	if err := json.Unmarshal(payload, st); err != nil {
+		return nil, fmt.Errorf("%s: %w: %v", op, ErrCorrupt, err)
+	}
+	if st.Wallets == nil {
+		st.Wallets = make(map[string]float64)
+	}
+	if st.References == nil {
+		st.References = make(map[string]int)
+	}
+
+	return st, nil
+}
+
+// writeSnapshot stores s at path by writing a temporary file, syncing it
+// and renaming it over the previous snapshot.
+func writeSnapshot(path string, s *state) error {
+	const op = "storage.journal.writeSnapshot"
+
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := writeFile(path, encodeRecord(payload)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir makes a rename or file creation in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,473 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/address"
+	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
+	"github.com/Petro-vich/transaction_processing_go/internal/risk"
+	"github.com/Petro-vich/transaction_processing_go/internal/screening"
+	"github.com/Petro-vich/transaction_processing_go/internal/signing"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+)
+
+// Storage is an in-memory storage.Repository with the same semantics as
+// the SQLite storage. It is safe for concurrent use and loses all data
+// when the process exits.
+type Storage struct {
+	mu               sync.RWMutex
+	wallets          map[string]float64
+	transactions     []transaction.Request
+	nextID           int
+	references       map[string]int
+	nonces           map[string]int64
+	reviews          []risk.Review
+	screeningEntries map[[2]string]screening.Entry
+	screeningHits    []screening.Hit
+}
+
+func New() *Storage {
+	return &Storage{
+		wallets:          make(map[string]float64),
+		nextID:           1,
+		references:       make(map[string]int),
+		nonces:           make(map[string]int64),
+		screeningEntries: make(map[[2]string]screening.Entry),
+	}
+}
+
+func (st *Storage) CreateWallet(ctx context.Context, adr string, amount float64) error {
+	const op = "storage.memory.CreateWallet"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if amount < 0 {
+		return fmt.Errorf("%s: %w", op, &storage.ValidationError{
+			Field:   "amount",
+			Message: "balance must not be negative",
+		})
+	}
+
+	if len(adr) != 64 {
+		return fmt.Errorf("%s: %w", op, &storage.ValidationError{
+			Field:   "address",
+			Message: fmt.Sprintf("invalid address length (expected 64, got %d)", len(adr)),
+		})
+	}
+	if !address.IsCanonical(adr) {
+		return fmt.Errorf("%s: %w", op, &storage.ValidationError{
+			Field:   "address",
+			Message: "address must be lowercase hex",
+		})
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if _, ok := st.wallets[adr]; ok {
+		return fmt.Errorf("%s: %w", op, &storage.ConflictError{Address: adr})
+	}
+	st.wallets[adr] = amount
+
+	return nil
+}
+
+func (st *Storage) GetBalance(ctx context.Context, address string) (float64, error) {
+	const op = "storage.memory.GetBalance"
+
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	balance, ok := st.wallets[address]
+	if !ok {
+		return 0, fmt.Errorf("%s: %w", op, &storage.NotFoundError{Address: address})
+	}
+
+	return balance, nil
+}
+
+func (st *Storage) SendMoney(ctx context.Context, from string, to string, amount float64) error {
+	return st.send(ctx, "storage.memory.SendMoney", "", from, to, amount)
+}
+
+func (st *Storage) SendMoneyWithReference(ctx context.Context, reference, from, to string, amount float64) error {
+	return st.send(ctx, "storage.memory.SendMoneyWithReference", reference, from, to, amount)
+}
+
+// send executes a transfer and stores its reference unless it is empty.
+func (st *Storage) send(ctx context.Context, op, reference, from, to string, amount float64) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if amount <= 0 {
+		return fmt.Errorf("%s: %w", op, &storage.ValidationError{
+			Field:   "amount",
+			Message: "amount must be positive",
+		})
+	}
+
+	if from == to {
+		return fmt.Errorf("%s: %w", op, &storage.ValidationError{
+			Field:   "to",
+			Message: "sender and recipient must differ",
+		})
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	balanceFrom, ok := st.wallets[from]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, &storage.NotFoundError{Address: from})
+	}
+
+	if balanceFrom-amount < 0 {
+		return fmt.Errorf("%s: %w", op, &storage.InsufficientFundsError{
+			Address:   from,
+			Available: balanceFrom,
+			Requested: amount,
+		})
+	}
+
+	if _, ok := st.wallets[to]; !ok {
+		return fmt.Errorf("%s: %w", op, &storage.NotFoundError{Address: to})
+	}
+
+	if _, ok := st.references[reference]; ok && reference != "" {
+		return fmt.Errorf("%s: %w", op, &storage.ReferenceUsedError{Reference: reference})
+	}
+
+	st.wallets[from] -= amount
+	st.wallets[to] += amount
+
+	st.transactions = append(st.transactions, transaction.Request{
+		Id:         st.nextID,
+		From:       from,
+		To:         to,
+		Amount:     amount,
+		Created_at: time.Now().UTC(),
+	})
+	if reference != "" {
+		st.references[reference] = st.nextID
+	}
+	st.nextID++
+
+	return nil
+}
+
+func (st *Storage) HasReference(ctx context.Context, reference string) (bool, error) {
+	const op = "storage.memory.HasReference"
+
+	if err := ctx.Err(); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	_, ok := st.references[reference]
+	return ok, nil
+}
+
+// GetLast returns up to count transactions, newest first. As with SQLite
+// LIMIT, a negative count returns all transactions.
+func (st *Storage) GetLast(ctx context.Context, count int) ([]transaction.Request, error) {
+	const op = "storage.memory.GetLast"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	return storage.Newest(st.transactions, count, func(transaction.Request) bool { return true }), nil
+}
+
+// GetHistory returns up to count transactions sent or received by address,
+// newest first.
+func (st *Storage) GetHistory(ctx context.Context, address string, count int) ([]transaction.Request, error) {
+	const op = "storage.memory.GetHistory"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	if _, ok := st.wallets[address]; !ok {
+		return nil, fmt.Errorf("%s: %w", op, &storage.NotFoundError{Address: address})
+	}
+
+	return storage.Newest(st.transactions, count, func(tr transaction.Request) bool {
+		return tr.From == address || tr.To == address
+	}), nil
+}
+
+func (st *Storage) UseNonce(ctx context.Context, address string, nonce int64) error {
+	const op = "storage.memory.UseNonce"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if nonce <= st.nonces[address] {
+		return fmt.Errorf("%s: %w", op, signing.ErrNonceReused)
+	}
+	st.nonces[address] = nonce
+
+	return nil
+}
+
+func (st *Storage) LastNonce(ctx context.Context, address string) (int64, error) {
+	const op = "storage.memory.LastNonce"
+
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	return st.nonces[address], nil
+}
+
+func (st *Storage) CreateReview(ctx context.Context, r risk.Review) (risk.Review, error) {
+	const op = "storage.memory.CreateReview"
+
+	if err := ctx.Err(); err != nil {
+		return risk.Review{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	r.ID = int64(len(st.reviews) + 1)
+	st.reviews = append(st.reviews, r)
+
+	return r, nil
+}
+
+func (st *Storage) GetReview(ctx context.Context, id int64) (risk.Review, error) {
+	const op = "storage.memory.GetReview"
+
+	if err := ctx.Err(); err != nil {
+		return risk.Review{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	if id < 1 || id > int64(len(st.reviews)) {
+		return risk.Review{}, fmt.Errorf("%s: %w", op, risk.ErrReviewNotFound)
+	}
+	return st.reviews[id-1], nil
+}
+
+func (st *Storage) ListReviews(ctx context.Context, status string, count int) ([]risk.Review, error) {
+	const op = "storage.memory.ListReviews"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	reviews := []risk.Review{}
+	for i := len(st.reviews) - 1; i >= 0 && len(reviews) != count; i-- {
+		if status == "" || st.reviews[i].Status == status {
+			reviews = append(reviews, st.reviews[i])
+		}
+	}
+	return reviews, nil
+}
+
+func (st *Storage) DecideReview(ctx context.Context, id int64, status, by string, at time.Time) (risk.Review, error) {
+	const op = "storage.memory.DecideReview"
+
+	if err := ctx.Err(); err != nil {
+		return risk.Review{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if id < 1 || id > int64(len(st.reviews)) {
+		return risk.Review{}, fmt.Errorf("%s: %w", op, risk.ErrReviewNotFound)
+	}
+	r := &st.reviews[id-1]
+	if r.Status != risk.StatusPending {
+		return risk.Review{}, fmt.Errorf("%s: %w", op, risk.ErrReviewDecided)
+	}
+	r.Status, r.DecidedBy, r.DecidedAt = status, by, &at
+
+	return *r, nil
+}
+
+func (st *Storage) CompleteReview(ctx context.Context, id int64) error {
+	const op = "storage.memory.CompleteReview"
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if id < 1 || id > int64(len(st.reviews)) {
+		return fmt.Errorf("%s: %w", op, risk.ErrReviewNotFound)
+	}
+	if st.reviews[id-1].Status == risk.StatusExecuting {
+		st.reviews[id-1].Status = risk.StatusApproved
+	}
+
+	return nil
+}
+
+func (st *Storage) FailReview(ctx context.Context, id int64, message string) error {
+	const op = "storage.memory.FailReview"
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if id < 1 || id > int64(len(st.reviews)) {
+		return fmt.Errorf("%s: %w", op, risk.ErrReviewNotFound)
+	}
+	st.reviews[id-1].Status, st.reviews[id-1].Error = risk.StatusFailed, message
+
+	return nil
+}
+
+func (st *Storage) AddScreeningEntry(ctx context.Context, e screening.Entry) error {
+	const op = "storage.memory.AddScreeningEntry"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	e.Source = screening.SourceAPI
+	st.screeningEntries[[2]string{e.List, e.Address}] = e
+
+	return nil
+}
+
+func (st *Storage) RemoveScreeningEntry(ctx context.Context, list, address string) error {
+	const op = "storage.memory.RemoveScreeningEntry"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	key := [2]string{list, address}
+	if _, ok := st.screeningEntries[key]; !ok {
+		return fmt.Errorf("%s: %w", op, screening.ErrEntryNotFound)
+	}
+	delete(st.screeningEntries, key)
+
+	return nil
+}
+
+func (st *Storage) ListScreeningEntries(ctx context.Context) ([]screening.Entry, error) {
+	const op = "storage.memory.ListScreeningEntries"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	entries := make([]screening.Entry, 0, len(st.screeningEntries))
+	for _, e := range st.screeningEntries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].List != entries[j].List {
+			return entries[i].List < entries[j].List
+		}
+		return entries[i].Address < entries[j].Address
+	})
+
+	return entries, nil
+}
+
+func (st *Storage) RecordScreeningHit(ctx context.Context, h screening.Hit) (screening.Hit, error) {
+	const op = "storage.memory.RecordScreeningHit"
+
+	if err := ctx.Err(); err != nil {
+		return screening.Hit{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	h.ID = int64(len(st.screeningHits) + 1)
+	st.screeningHits = append(st.screeningHits, h)
+
+	return h, nil
+}
+
+func (st *Storage) ListScreeningHits(ctx context.Context, count int) ([]screening.Hit, error) {
+	const op = "storage.memory.ListScreeningHits"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	hits := []screening.Hit{}
+	for i := len(st.screeningHits) - 1; i >= 0 && len(hits) != count; i-- {
+		hits = append(hits, st.screeningHits[i])
+	}
+	return hits, nil
+}
+
+// TotalFunds returns the sum of all wallet balances.
+func (st *Storage) TotalFunds(ctx context.Context) (float64, error) {
+	const op = "storage.memory.TotalFunds"
+
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	var total float64
+	for _, balance := range st.wallets {
+		total += balance
+	}
+
+	return total, nil
+}
+
+func (st *Storage) IsEmpty() bool {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	return len(st.wallets) == 0
+}
+
+func (st *Storage) Close() error {
+	return nil
+}
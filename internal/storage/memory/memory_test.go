@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/risk"
+	"github.com/Petro-vich/transaction_processing_go/internal/screening"
+	"github.com/Petro-vich/transaction_processing_go/internal/signing"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRepository(t *testing.T) storage.Repository {
+	return New()
+}
+
+func TestStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, newTestRepository)
+}
+
+func TestStorage_Concurrent(t *testing.T) {
+	storagetest.RunConcurrent(t, newTestRepository)
+}
+
+func TestStorage_GetLastNegativeCount(t *testing.T) {
+	st := New()
+	require.NoError(t, st.CreateWallet(context.Background(), storagetest.Address("a"), 100))
+	require.NoError(t, st.CreateWallet(context.Background(), storagetest.Address("b"), 100))
+	require.NoError(t, st.SendMoney(context.Background(), storagetest.Address("a"), storagetest.Address("b"), 1))
+	require.NoError(t, st.SendMoney(context.Background(), storagetest.Address("a"), storagetest.Address("b"), 1))
+
+	transactions, err := st.GetLast(context.Background(), -1)
+	require.NoError(t, err)
+	assert.Len(t, transactions, 2)
+}
+
+func TestStorage_IsEmpty(t *testing.T) {
+	st := New()
+	assert.True(t, st.IsEmpty())
+
+	require.NoError(t, st.CreateWallet(context.Background(), storagetest.Address("a"), 100))
+	assert.False(t, st.IsEmpty())
+}
+
+func TestStorage_Nonces(t *testing.T) {
+	storagetest.RunNonces(t, func(t *testing.T) signing.NonceStore { return New() })
+}
+
+func TestStorage_Reviews(t *testing.T) {
+	storagetest.RunReviews(t, func(t *testing.T) risk.ReviewStore { return New() })
+}
+
+func TestStorage_Screening(t *testing.T) {
+	storagetest.RunScreening(t, func(t *testing.T) screening.Store { return New() })
+}
+
+func TestStorage_TotalFunds(t *testing.T) {
+	storagetest.RunFunds(t, func(t *testing.T) storagetest.FundsStore { return New() })
+}
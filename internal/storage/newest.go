@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"sort"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
+)
+
+// Newest returns up to count transactions of all matching keep, sorted
+// newest first with ties broken by the higher id, the order GetLast and
+// GetHistory return. A negative count returns every match.
+func Newest(all []transaction.Request, count int, keep func(transaction.Request) bool) []transaction.Request {
+	transactions := make([]transaction.Request, 0, len(all))
+	for _, tr := range all {
+		if keep(tr) {
+			transactions = append(transactions, tr)
+		}
+	}
+
+	sort.SliceStable(transactions, func(i, j int) bool {
+		if !transactions[i].Created_at.Equal(transactions[j].Created_at) {
+			return transactions[i].Created_at.After(transactions[j].Created_at)
+		}
+		return transactions[i].Id > transactions[j].Id
+	})
+
+	if count >= 0 && count < len(transactions) {
+		transactions = transactions[:count]
+	}
+
+	return transactions
+}
@@ -0,0 +1,447 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/tracing"
+	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
+)
+
+var ErrArchiveDisabled = errors.New("archive directory is not configured")
+
+// Archive files are named after the month of the transactions they hold,
+// so sorting by name orders them by age.
+const (
+	archivePrefix      = "transactions-"
+	archiveExt         = ".db"
+	archiveMonthLayout = "2006-01"
+)
+
+// archiveBatchSize is the number of transactions moved per transaction
+// of the live database, bounding how long writers are blocked.
+const archiveBatchSize = 1000
+
+const archiveSchema = `
+CREATE TABLE IF NOT EXISTS transactions (
+    id INTEGER PRIMARY KEY,
+    from_address TEXT NOT NULL,
+    to_address TEXT NOT NULL,
+    amount REAL NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    prev_hash TEXT,
+    hash TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_transactions_created_at ON transactions (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_transactions_from_address ON transactions (from_address);
+CREATE INDEX IF NOT EXISTS idx_transactions_to_address ON transactions (to_address);
+
+-- Balance of every wallet after the transaction as_of_id, the newest
+-- one in this file.
+CREATE TABLE IF NOT EXISTS balances (
+    address TEXT PRIMARY KEY,
+    balance REAL NOT NULL,
+    as_of_id INTEGER NOT NULL
+);`
+
+// ArchiveReport describes the outcome of an archive run.
+type ArchiveReport struct {
+	Moved int      `json:"moved"`
+	Files []string `json:"files"`
+}
+
+// archiveSet gives read access to the monthly archive files in dir.
+type archiveSet struct {
+	dir string
+
+	mu  sync.Mutex
+	dbs map[string]*sql.DB
+}
+
+// UseArchive makes the storage move archived transactions to monthly files
+// in dir and include those files in GetLast and GetHistory.
+func (st *Storage) UseArchive(dir string) {
+	st.archive = &archiveSet{dir: dir, dbs: make(map[string]*sql.DB)}
+}
+
+// ArchiveFiles returns the monthly archive files in dir, newest month
+// first. A missing dir has none.
+func ArchiveFiles(dir string) ([]string, error) {
+	return (&archiveSet{dir: dir}).files()
+}
+
+// files returns the archive files, newest month first.
+func (a *archiveSet) files() ([]string, error) {
+	entries, err := os.ReadDir(a.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, archivePrefix) || !strings.HasSuffix(name, archiveExt) {
+			continue
+		}
+		month := strings.TrimSuffix(strings.TrimPrefix(name, archivePrefix), archiveExt)
+		if _, err := time.Parse(archiveMonthLayout, month); err != nil {
+			continue
+		}
+		files = append(files, filepath.Join(a.dir, name))
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+	return files, nil
+}
+
+// reader returns a cached read-only handle for the archive file at path.
+func (a *archiveSet) reader(path string) (*sql.DB, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if db, ok := a.dbs[path]; ok {
+		return db, nil
+	}
+
+	db, err := sql.Open(driverName, "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	a.dbs[path] = db
+	return db, nil
+}
+
+func (a *archiveSet) close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for path, db := range a.dbs {
+		db.Close()
+		delete(a.dbs, path)
+	}
+}
+
+func archivePath(dir string, createdAt time.Time) string {
+	return filepath.Join(dir, archivePrefix+createdAt.UTC().Format(archiveMonthLayout)+archiveExt)
+}
+
+// queryTransactions selects up to count transactions matching where from
+// the live table and then from the archive files, newest first. A negative
+// count selects all of them. Transactions present in both places, left by
+// an interrupted archive run, are returned once.
+func (st *Storage) queryTransactions(ctx context.Context, count int, where string, args ...any) ([]transaction.Request, error) {
+	query := `
+	SELECT id, from_address, to_address, amount, created_at
+	FROM transactions
+	` + where + `
+	ORDER BY created_at DESC, id DESC
+	LIMIT ?`
+
+	transactions, err := scanTransactions(ctx, st.db, query, append(args, count)...)
+	if err != nil {
+		return nil, err
+	}
+	if st.archive == nil || (count >= 0 && len(transactions) >= count) {
+		return transactions, nil
+	}
+
+	files, err := st.archive.files()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool, len(transactions))
+	for _, tr := range transactions {
+		seen[tr.Id] = true
+	}
+
+	for _, path := range files {
+		remaining := -1
+		if count >= 0 {
+			remaining = count - len(transactions)
+			if remaining <= 0 {
+				break
+			}
+		}
+
+		db, err := st.archive.reader(path)
+		if err != nil {
+			return nil, err
+		}
+
+		archived, err := scanTransactions(ctx, db, query, append(args, remaining)...)
+		if err != nil {
+			return nil, fmt.Errorf("archive %s: %w", filepath.Base(path), err)
+		}
+
+		for _, tr := range archived {
+			if seen[tr.Id] {
+				continue
+			}
+			seen[tr.Id] = true
+			transactions = append(transactions, tr)
+		}
+	}
+
+	if count >= 0 && len(transactions) > count {
+		transactions = transactions[:count]
+	}
+	return transactions, nil
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func scanTransactions(ctx context.Context, db queryer, query string, args ...any) ([]transaction.Request, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []transaction.Request{}
+	for rows.Next() {
+		tr := transaction.Request{}
+		if err := rows.Scan(&tr.Id, &tr.From, &tr.To, &tr.Amount, &tr.Created_at); err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, tr)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return transactions, nil
+}
+
+// Archive moves transactions created before the cutoff to monthly archive
+// files. Every file also records the balance of each wallet after its
+// newest transaction, and carried_balances in the live database holds the
+// balance of each wallet before the oldest transaction left in it.
+//
+// Rows are first committed to the archive and then deleted from the live
+// table, so an interrupted run leaves duplicates rather than losing data.
+// Duplicates are ignored by reads and cleaned up by the next run.
+func (st *Storage) Archive(ctx context.Context, before time.Time) (_ ArchiveReport, err error) {
+	const op = "storage.sqlite.Archive"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	report := ArchiveReport{Files: []string{}}
+	if st.archive == nil {
+		return report, fmt.Errorf("%s: %w", op, ErrArchiveDisabled)
+	}
+	if err := os.MkdirAll(st.archive.dir, 0o755); err != nil {
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+
+	files := make(map[string]bool)
+	for {
+		moved, batchFiles, err := st.archiveBatch(ctx, before)
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", op, err)
+		}
+
+		report.Moved += moved
+		for _, f := range batchFiles {
+			if !files[f] {
+				files[f] = true
+				report.Files = append(report.Files, f)
+			}
+		}
+
+		if moved < archiveBatchSize {
+			return report, nil
+		}
+	}
+}
+
+// archiveBatch moves up to archiveBatchSize transactions in one immediate
+// transaction of the live database.
+func (st *Storage) archiveBatch(ctx context.Context, before time.Time) (int, []string, error) {
+	tx, err := st.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Timestamps are stored as text in the local zone SendMoney used, so the
+	// cutoff is formatted the same way for the comparison.
+	batch, err := scanChainedTransactions(ctx, tx, `
+	SELECT `+chainedColumns+`
+	FROM transactions
+	WHERE created_at < ?
+	ORDER BY created_at, id
+	LIMIT ?
+	`, before.In(time.Local), archiveBatchSize)
+	if err != nil {
+		return 0, nil, fmt.Errorf("select transactions: %w", err)
+	}
+	if len(batch) == 0 {
+		return 0, nil, nil
+	}
+
+	var files []string
+	for start := 0; start < len(batch); {
+		path := archivePath(st.archive.dir, batch[start].Created_at)
+		end := start
+		for end < len(batch) && archivePath(st.archive.dir, batch[end].Created_at) == path {
+			end++
+		}
+		month := batch[start:end]
+		lastID := 0
+		for _, tr := range month {
+			lastID = max(lastID, tr.Id)
+		}
+
+		balances, err := balancesAfter(ctx, tx, lastID)
+		if err != nil {
+			return 0, nil, err
+		}
+		if err := writeArchive(ctx, path, month, balances, lastID); err != nil {
+			return 0, nil, fmt.Errorf("write %s: %w", filepath.Base(path), err)
+		}
+
+		files = append(files, path)
+		start = end
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `DELETE FROM transactions WHERE id = ?`)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer stmt.Close()
+
+	lastID := 0
+	for _, tr := range batch {
+		if _, err := stmt.ExecContext(ctx, tr.Id); err != nil {
+			return 0, nil, fmt.Errorf("delete transaction %d: %w", tr.Id, err)
+		}
+		lastID = max(lastID, tr.Id)
+	}
+
+	carried, err := balancesAfter(ctx, tx, 0)
+	if err != nil {
+		return 0, nil, err
+	}
+	for address, balance := range carried {
+		_, err := tx.ExecContext(ctx, `
+		INSERT INTO carried_balances (address, balance, archived_through, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (address) DO UPDATE SET
+			balance = excluded.balance,
+			archived_through = MAX(archived_through, excluded.archived_through),
+			updated_at = excluded.updated_at
+		`, address, balance, lastID, time.Now())
+		if err != nil {
+			return 0, nil, fmt.Errorf("update carried balance: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return len(batch), files, nil
+}
+
+// balancesAfter returns the balance of every wallet right after the live
+// transaction afterID by reverting the transactions recorded after it.
+func balancesAfter(ctx context.Context, tx *sql.Tx, afterID int) (map[string]float64, error) {
+	rows, err := tx.QueryContext(ctx, `
+	SELECT w.address, w.balance
+		- COALESCE((SELECT SUM(t.amount) FROM transactions t WHERE t.to_address = w.address AND t.id > ?), 0)
+		+ COALESCE((SELECT SUM(t.amount) FROM transactions t WHERE t.from_address = w.address AND t.id > ?), 0)
+	FROM wallet w
+	`, afterID, afterID)
+	if err != nil {
+		return nil, fmt.Errorf("compute balances: %w", err)
+	}
+	defer rows.Close()
+
+	balances := make(map[string]float64)
+	for rows.Next() {
+		var address string
+		var balance float64
+		if err := rows.Scan(&address, &balance); err != nil {
+			return nil, fmt.Errorf("compute balances: %w", err)
+		}
+		balances[address] = balance
+	}
+
+	return balances, rows.Err()
+}
+
+// writeArchive stores transactions and the closing balances in the archive
+// file at path, creating it if needed.
+func writeArchive(ctx context.Context, path string, transactions []chainedTransaction, balances map[string]float64, asOfID int) error {
+	db, err := sql.Open(driverName, "file:"+path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("PRAGMA busy_timeout = %d", busyTimeout.Milliseconds())); err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, archiveSchema); err != nil {
+		return err
+	}
+	// Files written before the hash chain lack its columns.
+	if chained, err := hasChainColumns(ctx, db); err != nil {
+		return err
+	} else if !chained {
+		if _, err := db.ExecContext(ctx, `
+		ALTER TABLE transactions ADD COLUMN prev_hash TEXT;
+		ALTER TABLE transactions ADD COLUMN hash TEXT;
+		`); err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, tr := range transactions {
+		_, err := tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO transactions (id, from_address, to_address, amount, created_at, prev_hash, hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, tr.Id, tr.From, tr.To, tr.Amount, tr.Created_at, tr.PrevHash, tr.Hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	for address, balance := range balances {
+		_, err := tx.ExecContext(ctx, `
+		INSERT INTO balances (address, balance, as_of_id)
+		VALUES (?, ?, ?)
+		ON CONFLICT (address) DO UPDATE SET
+			balance = excluded.balance,
+			as_of_id = excluded.as_of_id
+		WHERE excluded.as_of_id >= balances.as_of_id
+		`, address, balance, asOfID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,162 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupArchive creates wallets a (100) and b (100) and seven transfers:
+// three in January, two in February and two recent ones.
+func setupArchive(t *testing.T) (*Storage, string) {
+	t.Helper()
+
+	st, err := New(filepath.Join(t.TempDir(), "storage.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { st.Close() })
+
+	dir := filepath.Join(t.TempDir(), "archive")
+	st.UseArchive(dir)
+
+	ctx := context.Background()
+	a, b := generateTestAddress(t, "a"), generateTestAddress(t, "b")
+	require.NoError(t, st.CreateWallet(ctx, a, 100))
+	require.NoError(t, st.CreateWallet(ctx, b, 100))
+
+	dates := []time.Time{
+		time.Date(2026, 1, 5, 10, 0, 0, 0, time.UTC),
+		time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC),
+		time.Date(2026, 1, 25, 10, 0, 0, 0, time.UTC),
+		time.Date(2026, 2, 10, 10, 0, 0, 0, time.UTC),
+		time.Date(2026, 2, 20, 10, 0, 0, 0, time.UTC),
+	}
+	for i := 0; i < 7; i++ {
+		require.NoError(t, st.SendMoney(ctx, a, b, float64(i+1)))
+		if i < len(dates) {
+			_, err := st.db.Exec(`UPDATE transactions SET created_at = ? WHERE id = ?`, dates[i].In(time.Local), i+1)
+			require.NoError(t, err)
+		}
+	}
+	rehashChain(t, st)
+
+	return st, dir
+}
+
+func TestStorage_Archive(t *testing.T) {
+	ctx := context.Background()
+	cutoff := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Moves old transactions to monthly files", func(t *testing.T) {
+		st, dir := setupArchive(t)
+
+		report, err := st.Archive(ctx, cutoff)
+		require.NoError(t, err)
+		assert.Equal(t, 5, report.Moved)
+		assert.Equal(t, []string{
+			filepath.Join(dir, "transactions-2026-01.db"),
+			filepath.Join(dir, "transactions-2026-02.db"),
+		}, report.Files)
+
+		files, err := ArchiveFiles(dir)
+		require.NoError(t, err)
+		assert.Equal(t, []string{report.Files[1], report.Files[0]}, files)
+
+		var live int
+		require.NoError(t, st.db.QueryRow(`SELECT COUNT(*) FROM transactions`).Scan(&live))
+		assert.Equal(t, 2, live)
+
+		balance, err := st.GetBalance(ctx, generateTestAddress(t, "a"))
+		require.NoError(t, err)
+		assert.Equal(t, 72.0, balance)
+
+		report, err = st.Archive(ctx, cutoff)
+		require.NoError(t, err)
+		assert.Zero(t, report.Moved)
+	})
+
+	t.Run("Reads span live and archived data", func(t *testing.T) {
+		st, _ := setupArchive(t)
+		_, err := st.Archive(ctx, cutoff)
+		require.NoError(t, err)
+
+		transactions, err := st.GetLast(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, transactions, 7)
+		for i, tr := range transactions {
+			assert.Equal(t, 7-i, tr.Id)
+		}
+
+		transactions, err = st.GetLast(ctx, 4)
+		require.NoError(t, err)
+		require.Len(t, transactions, 4)
+		assert.Equal(t, 4, transactions[3].Id)
+
+		history, err := st.GetHistory(ctx, generateTestAddress(t, "b"), -1)
+		require.NoError(t, err)
+		assert.Len(t, history, 7)
+		assert.Equal(t, 1.0, history[6].Amount)
+	})
+
+	t.Run("Carried forward balances", func(t *testing.T) {
+		st, dir := setupArchive(t)
+		_, err := st.Archive(ctx, cutoff)
+		require.NoError(t, err)
+
+		// The five archived transfers moved 15 from a to b.
+		var carried float64
+		err = st.db.QueryRow(`SELECT balance FROM carried_balances WHERE address = ?`, generateTestAddress(t, "a")).Scan(&carried)
+		require.NoError(t, err)
+		assert.Equal(t, 85.0, carried)
+
+		// January closes after transfers of 1, 2 and 3.
+		archive, err := sql.Open(driverName, "file:"+filepath.Join(dir, "transactions-2026-01.db")+"?mode=ro")
+		require.NoError(t, err)
+		defer archive.Close()
+
+		var closing float64
+		var asOf int
+		err = archive.QueryRow(`SELECT balance, as_of_id FROM balances WHERE address = ?`, generateTestAddress(t, "b")).Scan(&closing, &asOf)
+		require.NoError(t, err)
+		assert.Equal(t, 106.0, closing)
+		assert.Equal(t, 3, asOf)
+	})
+
+	t.Run("Interrupted run leaves no visible duplicates", func(t *testing.T) {
+		st, dir := setupArchive(t)
+
+		// Simulate a crash after the archive commit: copy January to the
+		// archive without deleting it from the live table.
+		batch, err := scanChainedTransactions(ctx, st.db, `
+		SELECT `+chainedColumns+` FROM transactions WHERE id <= 3`)
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		require.NoError(t, writeArchive(ctx, filepath.Join(dir, "transactions-2026-01.db"), batch, map[string]float64{}, 3))
+
+		transactions, err := st.GetLast(ctx, -1)
+		require.NoError(t, err)
+		assert.Len(t, transactions, 7)
+
+		report, err := st.Archive(ctx, cutoff)
+		require.NoError(t, err)
+		assert.Equal(t, 5, report.Moved)
+
+		transactions, err = st.GetLast(ctx, -1)
+		require.NoError(t, err)
+		assert.Len(t, transactions, 7)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		st, err := New(filepath.Join(t.TempDir(), "storage.db"))
+		require.NoError(t, err)
+		defer st.Close()
+
+		_, err = st.Archive(ctx, cutoff)
+		assert.ErrorIs(t, err, ErrArchiveDisabled)
+	})
+}
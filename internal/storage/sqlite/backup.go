@@ -0,0 +1,81 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/tracing"
+)
+
+var ErrIntegrity = errors.New("database integrity check failed")
+
+// BackupTo writes a consistent copy of the database to path with
+// VACUUM INTO. The copy is taken in a single read transaction, so writers
+// are not blocked and concurrent transfers never produce a torn file.
+// path must not exist.
+func (st *Storage) BackupTo(ctx context.Context, path string) (err error) {
+	const op = "storage.sqlite.BackupTo"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := st.db.ExecContext(ctx, `VACUUM INTO ?`, path); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// CheckIntegrity opens the database file at path read-only and runs
+// PRAGMA integrity_check on it. The file must contain the wallet and
+// transactions tables.
+func CheckIntegrity(ctx context.Context, path string) error {
+	const op = "storage.sqlite.CheckIntegrity"
+
+	db, err := sql.Open(driverName, "file:"+path+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, `PRAGMA integrity_check`)
+	if err != nil {
+		return fmt.Errorf("%s: %w: %v", op, ErrIntegrity, err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%s: %w: %v", op, ErrIntegrity, err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s: %w: %s", op, ErrIntegrity, strings.Join(problems, "; "))
+	}
+
+	var tables int
+	err = db.QueryRowContext(ctx, `
+	SELECT COUNT(*)
+	FROM sqlite_master
+	WHERE type = 'table' AND name IN ('wallet', 'transactions')
+	`).Scan(&tables)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tables != 2 {
+		return fmt.Errorf("%s: %w: wallet or transactions table is missing", op, ErrIntegrity)
+	}
+
+	return nil
+}
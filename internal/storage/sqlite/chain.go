@@ -0,0 +1,414 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/hashchain"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/tracing"
+	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
+)
+
+// chainedTransaction is a transaction with its chain hashes, which are not
+// set for transactions archived before the chain was introduced.
+type chainedTransaction struct {
+	transaction.Request
+	PrevHash sql.NullString
+	Hash     sql.NullString
+}
+
+const chainedColumns = `id, from_address, to_address, amount, created_at, prev_hash, hash`
+
+func scanChained(rows *sql.Rows) (chainedTransaction, error) {
+	var tr chainedTransaction
+	err := rows.Scan(&tr.Id, &tr.From, &tr.To, &tr.Amount, &tr.Created_at, &tr.PrevHash, &tr.Hash)
+	return tr, err
+}
+
+func scanChainedTransactions(ctx context.Context, db queryer, query string, args ...any) ([]chainedTransaction, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []chainedTransaction
+	for rows.Next() {
+		tr, err := scanChained(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, tr)
+	}
+	return transactions, rows.Err()
+}
+
+type rowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func chainHead(ctx context.Context, q rowQueryer) (hashchain.Head, error) {
+	head := hashchain.Head{Hash: hashchain.Genesis}
+	err := q.QueryRowContext(ctx, `SELECT last_id, hash FROM chain_head WHERE id = 1`).Scan(&head.LastID, &head.Hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return hashchain.Head{Hash: hashchain.Genesis}, nil
+	}
+	return head, err
+}
+
+// chainExecer is a transaction or connection the chain is written through.
+type chainExecer interface {
+	queryer
+	rowQueryer
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// linkTransaction stores the hashes of tr chained onto head and returns the
+// new head. The chain head itself is saved by saveChainHead.
+func linkTransaction(ctx context.Context, db chainExecer, head hashchain.Head, tr transaction.Request) (hashchain.Head, error) {
+	hash := hashchain.Hash(head.Hash, tr)
+	_, err := db.ExecContext(ctx, `UPDATE transactions SET prev_hash = ?, hash = ? WHERE id = ?`, head.Hash, hash, tr.Id)
+	if err != nil {
+		return head, fmt.Errorf("hash transaction %d: %w", tr.Id, err)
+	}
+	return hashchain.Head{LastID: tr.Id, Hash: hash}, nil
+}
+
+func saveChainHead(ctx context.Context, db chainExecer, head hashchain.Head) error {
+	_, err := db.ExecContext(ctx, `
+	INSERT INTO chain_head (id, last_id, hash) VALUES (1, ?, ?)
+	ON CONFLICT (id) DO UPDATE SET last_id = excluded.last_id, hash = excluded.hash
+	`, head.LastID, head.Hash)
+	if err != nil {
+		return fmt.Errorf("update chain head: %w", err)
+	}
+	return nil
+}
+
+// chainBackfill hashes the transactions recorded before the chain existed
+// and records the newest transaction id as the chain boundary. It runs once,
+// inside the migration creating chain_boundary: later transactions are
+// hashed by record, and one without a hash is reported by VerifyChain.
+func chainBackfill(ctx context.Context, conn *sql.Conn) error {
+	head, err := chainHead(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("read chain head: %w", err)
+	}
+
+	pending, err := scanTransactions(ctx, conn, `
+	SELECT id, from_address, to_address, amount, created_at
+	FROM transactions
+	WHERE hash IS NULL
+	ORDER BY id
+	`)
+	if err != nil {
+		return fmt.Errorf("select unhashed transactions: %w", err)
+	}
+
+	for _, tr := range pending {
+		if head, err = linkTransaction(ctx, conn, head, tr); err != nil {
+			return err
+		}
+	}
+	if len(pending) > 0 {
+		if err := saveChainHead(ctx, conn, head); err != nil {
+			return err
+		}
+	}
+
+	var newest int
+	err = conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM transactions`).Scan(&newest)
+	if err != nil {
+		return fmt.Errorf("select newest transaction: %w", err)
+	}
+
+	_, err = conn.ExecContext(ctx, `
+	INSERT INTO chain_boundary (id, last_id, backfilled_at) VALUES (1, ?, ?)
+	ON CONFLICT (id) DO UPDATE SET last_id = excluded.last_id, backfilled_at = excluded.backfilled_at
+	`, max(newest, head.LastID), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("record chain boundary: %w", err)
+	}
+	return nil
+}
+
+// chainBoundary returns the id of the newest transaction hashed by the
+// backfill. Without a recorded boundary every transaction must be hashed.
+func chainBoundary(ctx context.Context, q rowQueryer) (int, error) {
+	var boundary int
+	err := q.QueryRowContext(ctx, `SELECT last_id FROM chain_boundary WHERE id = 1`).Scan(&boundary)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return boundary, err
+}
+
+// ChainHead returns the newest transaction of the chain.
+func (st *Storage) ChainHead(ctx context.Context) (_ hashchain.Head, err error) {
+	const op = "storage.sqlite.ChainHead"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	head, err := chainHead(ctx, st.db)
+	if err != nil {
+		return head, fmt.Errorf("%s: %w", op, err)
+	}
+	return head, nil
+}
+
+// SaveCheckpoint stores a signed chain head and returns it with its id.
+func (st *Storage) SaveCheckpoint(ctx context.Context, cp hashchain.Checkpoint) (_ hashchain.Checkpoint, err error) {
+	const op = "storage.sqlite.SaveCheckpoint"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	err = st.retryBusy(ctx, func() error {
+		res, err := st.db.ExecContext(ctx, `
+		INSERT INTO chain_checkpoints (last_id, hash, created_at, public_key, signature)
+		VALUES (?, ?, ?, ?, ?)
+		`, cp.Head.LastID, cp.Head.Hash, cp.CreatedAt, cp.PublicKey, cp.Signature)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		cp.ID = int(id)
+		return err
+	})
+	if err != nil {
+		return cp, fmt.Errorf("%s: %w", op, err)
+	}
+	return cp, nil
+}
+
+// LastCheckpoint returns the newest checkpoint; false when there is none.
+func (st *Storage) LastCheckpoint(ctx context.Context) (_ hashchain.Checkpoint, _ bool, err error) {
+	const op = "storage.sqlite.LastCheckpoint"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	checkpoints, err := queryCheckpoints(ctx, st.db, "ORDER BY id DESC LIMIT 1")
+	if err != nil {
+		return hashchain.Checkpoint{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(checkpoints) == 0 {
+		return hashchain.Checkpoint{}, false, nil
+	}
+	return checkpoints[0], true, nil
+}
+
+func queryCheckpoints(ctx context.Context, db queryer, suffix string) ([]hashchain.Checkpoint, error) {
+	rows, err := db.QueryContext(ctx, `
+	SELECT id, last_id, hash, created_at, public_key, signature
+	FROM chain_checkpoints
+	`+suffix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checkpoints []hashchain.Checkpoint
+	for rows.Next() {
+		var cp hashchain.Checkpoint
+		if err := rows.Scan(&cp.ID, &cp.Head.LastID, &cp.Head.Hash, &cp.CreatedAt, &cp.PublicKey, &cp.Signature); err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+	return checkpoints, rows.Err()
+}
+
+// VerifyChain recomputes the chain over the archive files and the live
+// table in id order and checks it against the chain head and the
+// checkpoints, whose signatures are checked against key unless it is nil.
+// It only reads: a transaction after the chain boundary without a hash is
+// reported as a broken link. A broken chain is reported in the result, not
+// as an error.
+func (st *Storage) VerifyChain(ctx context.Context, key ed25519.PublicKey) (_ hashchain.Report, err error) {
+	const op = "storage.sqlite.VerifyChain"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	report, err := st.verifyChain(ctx, key)
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+	return report, nil
+}
+
+func (st *Storage) verifyChain(ctx context.Context, key ed25519.PublicKey) (hashchain.Report, error) {
+	// A deferred read transaction on one connection sees a single snapshot
+	// of the live database without blocking writers.
+	conn, err := st.db.Conn(ctx)
+	if err != nil {
+		return hashchain.Report{}, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "BEGIN DEFERRED"); err != nil {
+		return hashchain.Report{}, err
+	}
+	defer conn.ExecContext(context.Background(), "ROLLBACK")
+
+	// The snapshot starts with the first read, so transactions archived
+	// while the archive files are read below are still in the live table.
+	head, err := chainHead(ctx, conn)
+	if err != nil {
+		return hashchain.Report{}, fmt.Errorf("read chain head: %w", err)
+	}
+	checkpoints, err := queryCheckpoints(ctx, conn, "ORDER BY id")
+	if err != nil {
+		return hashchain.Report{}, fmt.Errorf("read checkpoints: %w", err)
+	}
+	boundary, err := chainBoundary(ctx, conn)
+	if err != nil {
+		return hashchain.Report{}, fmt.Errorf("read chain boundary: %w", err)
+	}
+
+	sources, err := st.chainSources(ctx, conn)
+	if err != nil {
+		return hashchain.Report{}, err
+	}
+	defer func() {
+		for _, src := range sources {
+			src.rows.Close()
+		}
+	}()
+
+	v := hashchain.NewVerifier(checkpoints, key, boundary)
+	lastID := 0
+	for {
+		src := nextSource(sources)
+		if src == nil {
+			break
+		}
+
+		tr := src.current
+		if err := src.advance(); err != nil {
+			return hashchain.Report{}, err
+		}
+		// Left in both places by an interrupted archive run.
+		if tr.Id == lastID {
+			continue
+		}
+		lastID = tr.Id
+
+		if !v.Add(tr.Request, tr.PrevHash.String, tr.Hash.String) {
+			break
+		}
+	}
+
+	return v.Finish(head), nil
+}
+
+// chainSource reads the transactions of one database in id order.
+type chainSource struct {
+	name    string
+	rows    *sql.Rows
+	current chainedTransaction
+	done    bool
+}
+
+func (src *chainSource) advance() error {
+	if !src.rows.Next() {
+		src.done = true
+		if err := src.rows.Err(); err != nil {
+			return fmt.Errorf("%s: %w", src.name, err)
+		}
+		return nil
+	}
+
+	tr, err := scanChained(src.rows)
+	if err != nil {
+		return fmt.Errorf("%s: %w", src.name, err)
+	}
+	src.current = tr
+	return nil
+}
+
+// nextSource returns the source holding the lowest transaction id, or nil
+// when all are exhausted.
+func nextSource(sources []*chainSource) *chainSource {
+	var next *chainSource
+	for _, src := range sources {
+		if !src.done && (next == nil || src.current.Id < next.current.Id) {
+			next = src
+		}
+	}
+	return next
+}
+
+// chainSources opens a cursor over every archive file and the live table.
+func (st *Storage) chainSources(ctx context.Context, live queryer) ([]*chainSource, error) {
+	var sources []*chainSource
+	closeAll := func() {
+		for _, src := range sources {
+			src.rows.Close()
+		}
+	}
+
+	var files []string
+	if st.archive != nil {
+		var err error
+		if files, err = st.archive.files(); err != nil {
+			return nil, err
+		}
+		slices.Reverse(files)
+	}
+
+	for _, path := range files {
+		db, err := st.archive.reader(path)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		columns := chainedColumns
+		if chained, err := hasChainColumns(ctx, db); err != nil {
+			closeAll()
+			return nil, fmt.Errorf("archive %s: %w", filepath.Base(path), err)
+		} else if !chained {
+			columns = `id, from_address, to_address, amount, created_at, NULL, NULL`
+		}
+
+		rows, err := db.QueryContext(ctx, `SELECT `+columns+` FROM transactions ORDER BY id`)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("archive %s: %w", filepath.Base(path), err)
+		}
+		sources = append(sources, &chainSource{name: "archive " + filepath.Base(path), rows: rows})
+	}
+
+	rows, err := live.QueryContext(ctx, `SELECT `+chainedColumns+` FROM transactions ORDER BY id`)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	sources = append(sources, &chainSource{name: "transactions", rows: rows})
+
+	for _, src := range sources {
+		if err := src.advance(); err != nil {
+			closeAll()
+			return nil, err
+		}
+	}
+	return sources, nil
+}
+
+// hasChainColumns reports whether the transactions table of db has the
+// hash columns, which archive files written before the chain lack.
+func hasChainColumns(ctx context.Context, db rowQueryer) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, `
+	SELECT COUNT(*) FROM pragma_table_info('transactions') WHERE name IN ('prev_hash', 'hash')
+	`).Scan(&n)
+	return n == 2, err
+}
@@ -0,0 +1,268 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/hashchain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rehashChain drops the chain and builds it again from the current rows,
+// for tests that rewrite transactions while setting up.
+func rehashChain(t *testing.T, st *Storage) {
+	t.Helper()
+	_, err := st.db.Exec(`UPDATE transactions SET prev_hash = NULL, hash = NULL; DELETE FROM chain_head`)
+	require.NoError(t, err)
+
+	conn, err := st.db.Conn(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, chainBackfill(context.Background(), conn))
+}
+
+func setupChain(t *testing.T, transfers int) *Storage {
+	t.Helper()
+
+	st, err := New(filepath.Join(t.TempDir(), "storage.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { st.Close() })
+
+	ctx := context.Background()
+	a, b := generateTestAddress(t, "a"), generateTestAddress(t, "b")
+	require.NoError(t, st.CreateWallet(ctx, a, 100))
+	require.NoError(t, st.CreateWallet(ctx, b, 100))
+	for i := 0; i < transfers; i++ {
+		require.NoError(t, st.SendMoney(ctx, a, b, float64(i+1)))
+	}
+	return st
+}
+
+func verify(t *testing.T, st *Storage, key ed25519.PublicKey) hashchain.Report {
+	t.Helper()
+	report, err := st.VerifyChain(context.Background(), key)
+	require.NoError(t, err)
+	return report
+}
+
+func TestStorage_VerifyChain(t *testing.T) {
+	t.Run("Valid chain", func(t *testing.T) {
+		st := setupChain(t, 5)
+
+		report := verify(t, st, nil)
+		assert.True(t, report.Valid)
+		assert.Equal(t, 5, report.Checked)
+		assert.Nil(t, report.Broken)
+
+		head, err := st.ChainHead(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, head, report.Head)
+		assert.Equal(t, 5, head.LastID)
+
+		var prev string
+		require.NoError(t, st.db.QueryRow(`SELECT prev_hash FROM transactions WHERE id = 1`).Scan(&prev))
+		assert.Equal(t, hashchain.Genesis, prev)
+	})
+
+	t.Run("Empty chain", func(t *testing.T) {
+		report := verify(t, setupChain(t, 0), nil)
+		assert.True(t, report.Valid)
+		assert.Equal(t, hashchain.Head{Hash: hashchain.Genesis}, report.Head)
+	})
+
+	for name, tc := range map[string]struct {
+		tamper string
+		broken hashchain.Break
+	}{
+		"Edited amount":      {`UPDATE transactions SET amount = 100 WHERE id = 3`, hashchain.Break{ID: 3, Reason: hashchain.ReasonHashMismatch}},
+		"Edited recipient":   {`UPDATE transactions SET to_address = from_address WHERE id = 2`, hashchain.Break{ID: 2, Reason: hashchain.ReasonHashMismatch}},
+		"Deleted row":        {`DELETE FROM transactions WHERE id = 2`, hashchain.Break{ID: 3, Reason: hashchain.ReasonPrevMismatch}},
+		"Deleted newest row": {`DELETE FROM transactions WHERE id = 5`, hashchain.Break{ID: 5, Reason: hashchain.ReasonHeadMismatch}},
+		"Edited hash":        {`UPDATE transactions SET hash = prev_hash WHERE id = 4`, hashchain.Break{ID: 4, Reason: hashchain.ReasonHashMismatch}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			st := setupChain(t, 5)
+			_, err := st.db.Exec(tc.tamper)
+			require.NoError(t, err)
+
+			report := verify(t, st, nil)
+			assert.False(t, report.Valid)
+			require.NotNil(t, report.Broken)
+			assert.Equal(t, tc.broken, *report.Broken)
+		})
+	}
+
+	t.Run("Unhashed row after the boundary", func(t *testing.T) {
+		st := setupChain(t, 3)
+		_, err := st.db.Exec(`
+		INSERT INTO transactions (from_address, to_address, amount, created_at)
+		SELECT from_address, to_address, 1, created_at FROM transactions WHERE id = 1`)
+		require.NoError(t, err)
+
+		report := verify(t, st, nil)
+		assert.False(t, report.Valid)
+		assert.Equal(t, hashchain.Break{ID: 4, Reason: hashchain.ReasonMissingHash}, *report.Broken)
+
+		// Verifying leaves the row unhashed, so it stays reported.
+		report = verify(t, st, nil)
+		assert.Equal(t, hashchain.Break{ID: 4, Reason: hashchain.ReasonMissingHash}, *report.Broken)
+	})
+
+	t.Run("Unhashed row in an empty chain", func(t *testing.T) {
+		st := setupChain(t, 0)
+		_, err := st.db.Exec(`
+		INSERT INTO transactions (from_address, to_address, amount, created_at)
+		VALUES (?, ?, 1, CURRENT_TIMESTAMP)`, generateTestAddress(t, "a"), generateTestAddress(t, "b"))
+		require.NoError(t, err)
+
+		report := verify(t, st, nil)
+		assert.Equal(t, hashchain.Break{ID: 1, Reason: hashchain.ReasonMissingHash}, *report.Broken)
+	})
+
+	t.Run("Backfill of existing transactions", func(t *testing.T) {
+		ctx := context.Background()
+		st := setupChain(t, 3)
+		require.NoError(t, st.MigrateTo(ctx, 7))
+		_, err := st.db.Exec(`UPDATE transactions SET prev_hash = NULL, hash = NULL; DELETE FROM chain_head`)
+		require.NoError(t, err)
+
+		require.NoError(t, st.Migrate(ctx))
+		head, err := st.ChainHead(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 3, head.LastID)
+		boundary, err := chainBoundary(ctx, st.db)
+		require.NoError(t, err)
+		assert.Equal(t, 3, boundary)
+
+		require.NoError(t, st.SendMoney(ctx, generateTestAddress(t, "a"), generateTestAddress(t, "b"), 1))
+		report := verify(t, st, nil)
+		assert.True(t, report.Valid, "%+v", report.Broken)
+		assert.Equal(t, 4, report.Checked)
+	})
+}
+
+func TestStorage_VerifyChainArchive(t *testing.T) {
+	ctx := context.Background()
+	cutoff := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Archived transactions stay in the chain", func(t *testing.T) {
+		st, _ := setupArchive(t)
+		_, err := st.Archive(ctx, cutoff)
+		require.NoError(t, err)
+
+		report := verify(t, st, nil)
+		assert.True(t, report.Valid, "%+v", report.Broken)
+		assert.Equal(t, 7, report.Checked)
+	})
+
+	t.Run("Edited archive", func(t *testing.T) {
+		st, dir := setupArchive(t)
+		_, err := st.Archive(ctx, cutoff)
+		require.NoError(t, err)
+
+		archive, err := sql.Open(driverName, "file:"+filepath.Join(dir, "transactions-2026-02.db"))
+		require.NoError(t, err)
+		_, err = archive.Exec(`UPDATE transactions SET amount = 0.5 WHERE id = 4`)
+		require.NoError(t, err)
+		archive.Close()
+
+		report := verify(t, st, nil)
+		assert.False(t, report.Valid)
+		assert.Equal(t, hashchain.Break{ID: 4, Reason: hashchain.ReasonHashMismatch}, *report.Broken)
+	})
+
+	t.Run("Archives from before the chain", func(t *testing.T) {
+		st, dir := setupArchive(t)
+
+		// Archive January the way it was done before the chain existed.
+		batch, err := scanChainedTransactions(ctx, st.db, `
+		SELECT id, from_address, to_address, amount, created_at, NULL, NULL FROM transactions WHERE id <= 3`)
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		legacy, err := sql.Open(driverName, "file:"+filepath.Join(dir, "transactions-2026-01.db"))
+		require.NoError(t, err)
+		_, err = legacy.Exec(`CREATE TABLE transactions (id INTEGER PRIMARY KEY, from_address TEXT, to_address TEXT, amount REAL, created_at TIMESTAMP)`)
+		require.NoError(t, err)
+		for _, tr := range batch {
+			_, err := legacy.Exec(`INSERT INTO transactions VALUES (?, ?, ?, ?, ?)`, tr.Id, tr.From, tr.To, tr.Amount, tr.Created_at)
+			require.NoError(t, err)
+		}
+		legacy.Close()
+		_, err = st.db.Exec(`DELETE FROM transactions WHERE id <= 3`)
+		require.NoError(t, err)
+		rehashChain(t, st)
+
+		report := verify(t, st, nil)
+		assert.True(t, report.Valid, "%+v", report.Broken)
+		assert.Equal(t, 3, report.Unchained)
+		assert.Equal(t, 4, report.Checked)
+
+		// Archiving February adds the chain columns to new rows only.
+		_, err = st.Archive(ctx, cutoff)
+		require.NoError(t, err)
+		report = verify(t, st, nil)
+		assert.True(t, report.Valid, "%+v", report.Broken)
+	})
+}
+
+func TestStorage_Checkpoints(t *testing.T) {
+	ctx := context.Background()
+	pub, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	checkpoint := func(t *testing.T, st *Storage) hashchain.Checkpoint {
+		head, err := st.ChainHead(ctx)
+		require.NoError(t, err)
+		cp, err := st.SaveCheckpoint(ctx, hashchain.Sign(key, head, time.Now().Truncate(time.Second)))
+		require.NoError(t, err)
+		return cp
+	}
+
+	t.Run("Signed checkpoints verify", func(t *testing.T) {
+		st := setupChain(t, 3)
+		first := checkpoint(t, st)
+		require.NoError(t, st.SendMoney(ctx, generateTestAddress(t, "a"), generateTestAddress(t, "b"), 1))
+		checkpoint(t, st)
+
+		last, ok, err := st.LastCheckpoint(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, 4, last.Head.LastID)
+		assert.Equal(t, first.ID+1, last.ID)
+
+		report := verify(t, st, pub)
+		assert.True(t, report.Valid, "%+v", report.Broken)
+		assert.Equal(t, 2, report.Checkpoints)
+	})
+
+	t.Run("Rewritten chain contradicts the checkpoint", func(t *testing.T) {
+		st := setupChain(t, 3)
+		cp := checkpoint(t, st)
+
+		// Without the checkpoint key a consistent forgery is possible, but
+		// it no longer matches the signed head.
+		_, err := st.db.Exec(`UPDATE transactions SET amount = 50 WHERE id = 2`)
+		require.NoError(t, err)
+		rehashChain(t, st)
+
+		report := verify(t, st, pub)
+		assert.False(t, report.Valid)
+		assert.Equal(t, hashchain.Break{ID: cp.ID, Reason: hashchain.ReasonCheckpointHash}, *report.Broken)
+	})
+
+	t.Run("Checkpoint signed by another key", func(t *testing.T) {
+		st := setupChain(t, 3)
+		cp := checkpoint(t, st)
+
+		other, _, err := ed25519.GenerateKey(nil)
+		require.NoError(t, err)
+		report := verify(t, st, other)
+		assert.Equal(t, hashchain.Break{ID: cp.ID, Reason: hashchain.ReasonCheckpointSigning}, *report.Broken)
+	})
+}
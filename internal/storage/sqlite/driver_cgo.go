@@ -0,0 +1,34 @@
+//go:build !purego
+
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// driverName is the database/sql driver used when building with CGO.
+const driverName = "sqlite3"
+
+// dsn returns the data source name for path. go-sqlite3 waits up to
+// busyTimeout for locks held by other connections, uses the WAL journal so
+// readers do not block the writer, and starts transactions with
+// BEGIN IMMEDIATE so the write lock is taken before any balance is read.
+func dsn(path string) string {
+	return withParams(path,
+		fmt.Sprintf("_busy_timeout=%d", busyTimeout.Milliseconds()),
+		"_journal_mode=WAL",
+		"_txlock=immediate",
+	)
+}
+
+// errorCode returns the extended SQLite result code carried by err.
+func errorCode(err error) (int, bool) {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return 0, false
+	}
+	return int(sqliteErr.ExtendedCode), true
+}
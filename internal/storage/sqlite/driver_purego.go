@@ -0,0 +1,33 @@
+//go:build purego
+
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+
+	"modernc.org/sqlite"
+)
+
+// driverName is the CGO-free database/sql driver selected with the purego build tag.
+const driverName = "sqlite"
+
+// dsn returns the data source name for path. Unlike go-sqlite3 the pure-Go
+// driver has no default busy timeout, so it is set explicitly. The journal
+// and transaction mode match the CGO build.
+func dsn(path string) string {
+	return withParams(path,
+		fmt.Sprintf("_pragma=busy_timeout(%d)", busyTimeout.Milliseconds()),
+		"_pragma=journal_mode(WAL)",
+		"_txlock=immediate",
+	)
+}
+
+// errorCode returns the extended SQLite result code carried by err.
+func errorCode(err error) (int, bool) {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return 0, false
+	}
+	return sqliteErr.Code(), true
+}
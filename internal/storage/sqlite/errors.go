@@ -0,0 +1,51 @@
+package sqlite
+
+import (
+	"fmt"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+)
+
+// Extended SQLite result codes shared by both drivers.
+// See https://www.sqlite.org/rescode.html.
+const (
+	codeBusy                 = 5
+	codeLocked               = 6
+	codeConstraintCheck      = 275
+	codeConstraintForeignKey = 787
+	codeConstraintPrimaryKey = 1555
+	codeConstraintUnique     = 2067
+)
+
+// checkViolated is the client-facing message of a CHECK constraint
+// violation. The driver text names the schema and stays in the wrapped
+// error, which only reaches the server log.
+const checkViolated = "invalid wallet address"
+
+// translateError converts driver errors into the storage error types
+// and wraps the result with the operation name.
+func translateError(op string, address string, err error) error {
+	if code, ok := errorCode(err); ok {
+		switch code {
+		case codeConstraintUnique, codeConstraintPrimaryKey:
+			err = &storage.ConflictError{Address: address}
+		case codeConstraintCheck:
+			err = fmt.Errorf("%w: %v", &storage.ValidationError{Field: "address", Message: checkViolated}, err)
+		case codeConstraintForeignKey:
+			err = &storage.NotFoundError{Address: address}
+		}
+	}
+
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// isBusy reports whether err is SQLITE_BUSY or SQLITE_LOCKED, including
+// their extended codes, meaning the operation may succeed when retried.
+func isBusy(err error) bool {
+	code, ok := errorCode(err)
+	if !ok {
+		return false
+	}
+	primary := code & 0xff
+	return primary == codeBusy || primary == codeLocked
+}
@@ -0,0 +1,138 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/auth"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/tracing"
+)
+
+func (st *Storage) CreateKey(ctx context.Context, key auth.Key, hash []byte) (err error) {
+	const op = "storage.sqlite.CreateKey"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	err = st.retryBusy(ctx, func() error {
+		_, err := st.db.ExecContext(ctx, `
+		INSERT INTO api_keys (id, name, key_hash, scopes, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+			key.ID, key.Name, hash, joinScopes(key.Scopes), key.CreatedAt)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (st *Storage) GetKey(ctx context.Context, id string) (_ auth.Key, _ []byte, err error) {
+	const op = "storage.sqlite.GetKey"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	row := st.db.QueryRowContext(ctx, `
+	SELECT id, name, key_hash, scopes, created_at, revoked_at
+	FROM api_keys
+	WHERE id = ?`, id)
+
+	var hash []byte
+	key, err := scanKey(row, &hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return auth.Key{}, nil, fmt.Errorf("%s: %w", op, auth.ErrKeyNotFound)
+	}
+	if err != nil {
+		return auth.Key{}, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return key, hash, nil
+}
+
+func (st *Storage) ListKeys(ctx context.Context) (_ []auth.Key, err error) {
+	const op = "storage.sqlite.ListKeys"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := st.db.QueryContext(ctx, `
+	SELECT id, name, key_hash, scopes, created_at, revoked_at
+	FROM api_keys
+	ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	keys := []auth.Key{}
+	for rows.Next() {
+		var hash []byte
+		key, err := scanKey(rows, &hash)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return keys, nil
+}
+
+func (st *Storage) RevokeKey(ctx context.Context, id string, at time.Time) (err error) {
+	const op = "storage.sqlite.RevokeKey"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	var affected int64
+	err = st.retryBusy(ctx, func() error {
+		res, err := st.db.ExecContext(ctx, `
+		UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?`, at, id)
+		if err != nil {
+			return err
+		}
+		affected, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, auth.ErrKeyNotFound)
+	}
+	return nil
+}
+
+func scanKey(row interface{ Scan(...any) error }, hash *[]byte) (auth.Key, error) {
+	var (
+		key       auth.Key
+		scopes    string
+		revokedAt sql.NullTime
+	)
+	if err := row.Scan(&key.ID, &key.Name, hash, &scopes, &key.CreatedAt, &revokedAt); err != nil {
+		return auth.Key{}, err
+	}
+
+	for _, s := range strings.Fields(scopes) {
+		key.Scopes = append(key.Scopes, auth.Scope(s))
+	}
+	key.CreatedAt = key.CreatedAt.UTC()
+	if revokedAt.Valid {
+		t := revokedAt.Time.UTC()
+		key.RevokedAt = &t
+	}
+	return key, nil
+}
+
+func joinScopes(scopes []auth.Scope) string {
+	names := make([]string, len(scopes))
+	for i, s := range scopes {
+		names[i] = string(s)
+	}
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,48 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_APIKeys(t *testing.T) {
+	ctx := context.Background()
+
+	st, err := New(filepath.Join(t.TempDir(), "storage.db"))
+	require.NoError(t, err)
+	defer st.Close()
+
+	svc := auth.NewService(st)
+
+	token, key, err := svc.Issue(ctx, "payouts", []auth.Scope{auth.ScopeTransfersWrite, auth.ScopeBalanceRead})
+	require.NoError(t, err)
+
+	p, err := svc.Authenticate(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, p.KeyID)
+	assert.Equal(t, []auth.Scope{auth.ScopeTransfersWrite, auth.ScopeBalanceRead}, p.Scopes)
+
+	var stored []byte
+	require.NoError(t, st.db.QueryRow(`SELECT key_hash FROM api_keys WHERE id = ?`, key.ID).Scan(&stored))
+	assert.Len(t, stored, 32)
+	assert.NotContains(t, string(stored), token)
+
+	require.NoError(t, svc.Revoke(ctx, key.ID))
+	require.NoError(t, svc.Revoke(ctx, key.ID))
+	assert.ErrorIs(t, svc.Revoke(ctx, "missing"), auth.ErrKeyNotFound)
+
+	_, err = svc.Authenticate(ctx, token)
+	assert.ErrorIs(t, err, auth.ErrInvalidKey)
+
+	keys, err := svc.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, "payouts", keys[0].Name)
+	assert.Equal(t, key.CreatedAt, keys[0].CreatedAt)
+	assert.NotNil(t, keys[0].RevokedAt)
+}
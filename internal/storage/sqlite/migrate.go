@@ -0,0 +1,301 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/tracing"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var (
+	ErrSchemaTooNew   = errors.New("database schema is newer than this binary")
+	ErrSchemaOutdated = errors.New("database schema has pending migrations")
+)
+
+// migrationLockTimeout is how long a migration waits for another process
+// holding the write lock before giving up.
+const migrationLockTimeout = 30 * time.Second
+
+// migrationHooks run after the up script of their version, in the same
+// transaction, for steps that cannot be written in SQL.
+var migrationHooks = map[int]func(ctx context.Context, conn *sql.Conn) error{
+	8: chainBackfill,
+}
+
+// Migration is a numbered schema change with its rollback.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// loadMigrations reads the embedded NNNN_name.up.sql and NNNN_name.down.sql
+// files ordered by version.
+func loadMigrations() ([]Migration, error) {
+	const op = "storage.sqlite.loadMigrations"
+
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		prefix, rest, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("%s: invalid migration file name %q", op, name)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("%s: invalid migration version in %q", op, name)
+		}
+
+		body, err := migrationFiles.ReadFile("migrations/" + name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: strings.TrimSuffix(rest, "."+direction+".sql")}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("%s: migration %d must have both up and down files", op, m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("%s: migration versions must be sequential, missing %d", op, i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// LatestVersion returns the schema version this binary was built with.
+func LatestVersion() int {
+	migrations, err := loadMigrations()
+	if err != nil || len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion returns the version recorded in the schema_version table,
+// or 0 when no migration has been applied.
+func (st *Storage) SchemaVersion(ctx context.Context) (_ int, err error) {
+	const op = "storage.sqlite.SchemaVersion"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	var exists int
+	err = st.db.QueryRowContext(ctx, `
+	SELECT COUNT(*)
+	FROM sqlite_master
+	WHERE type = 'table' AND name = 'schema_version'
+	`).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if exists == 0 {
+		return 0, nil
+	}
+
+	var version int
+	err = st.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return version, nil
+}
+
+// CheckSchema returns an error unless the database is at the latest version.
+func (st *Storage) CheckSchema(ctx context.Context) (err error) {
+	const op = "storage.sqlite.CheckSchema"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	version, err := st.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	latest := LatestVersion()
+	switch {
+	case version > latest:
+		return fmt.Errorf("%s: %w: database version %d, binary supports %d", op, ErrSchemaTooNew, version, latest)
+	case version < latest:
+		return fmt.Errorf("%s: %w: database version %d, latest %d", op, ErrSchemaOutdated, version, latest)
+	}
+
+	return nil
+}
+
+// Migrate applies all pending migrations.
+func (st *Storage) Migrate(ctx context.Context) error {
+	return st.MigrateTo(ctx, LatestVersion())
+}
+
+// MigrateTo applies up or down migrations until the schema reaches target.
+// Each step runs in its own immediate transaction, so concurrent migrators
+// are serialized by the SQLite write lock and re-read the version after
+// acquiring it. A database newer than the binary is never touched.
+func (st *Storage) MigrateTo(ctx context.Context, target int) (err error) {
+	const op = "storage.sqlite.MigrateTo"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	if target < 0 || target > len(migrations) {
+		return fmt.Errorf("%s: unknown target version %d", op, target)
+	}
+
+	for {
+		done, err := st.migrateStep(ctx, migrations, target)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// migrateStep applies at most one migration towards target and reports
+// whether the target has been reached.
+func (st *Storage) migrateStep(ctx context.Context, migrations []Migration, target int) (done bool, err error) {
+	conn, err := st.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("PRAGMA busy_timeout = %d", migrationLockTimeout.Milliseconds()))
+	if err != nil {
+		return false, err
+	}
+	// The connection goes back to the pool, where requests expect the
+	// usual busy timeout; if it cannot be restored the pool discards it.
+	defer func() {
+		_, resetErr := conn.ExecContext(context.Background(), fmt.Sprintf("PRAGMA busy_timeout = %d", busyTimeout.Milliseconds()))
+		if resetErr != nil {
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return false, fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			conn.ExecContext(context.Background(), "ROLLBACK")
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return false, err
+	}
+
+	var current int
+	err = conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&current)
+	if err != nil {
+		return false, err
+	}
+
+	if current > len(migrations) {
+		return false, fmt.Errorf("%w: database version %d, binary supports %d", ErrSchemaTooNew, current, len(migrations))
+	}
+
+	switch {
+	case current < target:
+		m := migrations[current]
+		if err = applyMigration(ctx, conn, m.Up); err != nil {
+			return false, fmt.Errorf("migration %d_%s up: %w", m.Version, m.Name, err)
+		}
+		if hook := migrationHooks[m.Version]; hook != nil {
+			if err = hook(ctx, conn); err != nil {
+				return false, fmt.Errorf("migration %d_%s up: %w", m.Version, m.Name, err)
+			}
+		}
+		_, err = conn.ExecContext(ctx, `
+		INSERT INTO schema_version (version, name, applied_at)
+		VALUES (?, ?, ?)
+		`, m.Version, m.Name, time.Now().UTC())
+	case current > target:
+		m := migrations[current-1]
+		if err = applyMigration(ctx, conn, m.Down); err != nil {
+			return false, fmt.Errorf("migration %d_%s down: %w", m.Version, m.Name, err)
+		}
+		_, err = conn.ExecContext(ctx, `DELETE FROM schema_version WHERE version = ?`, m.Version)
+	default:
+		done = true
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if _, err = conn.ExecContext(ctx, "COMMIT"); err != nil {
+		return false, err
+	}
+
+	return done, nil
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, script string) error {
+	_, err := conn.ExecContext(ctx, script)
+	return err
+}
@@ -0,0 +1,143 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version)
+		assert.NotEmpty(t, m.Name)
+		assert.NotEmpty(t, m.Up)
+		assert.NotEmpty(t, m.Down)
+	}
+	assert.Equal(t, migrations[len(migrations)-1].Version, LatestVersion())
+}
+
+func TestStorage_Migrate(t *testing.T) {
+	t.Run("Fresh database is at the latest version", func(t *testing.T) {
+		st := newTestRepository(t).(*Storage)
+
+		version, err := st.SchemaVersion(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, LatestVersion(), version)
+		assert.NoError(t, st.CheckSchema(context.Background()))
+	})
+
+	t.Run("Legacy database keeps its data", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "legacy.db")
+		st, err := Open(path)
+		require.NoError(t, err)
+
+		_, err = st.db.Exec(`
+		CREATE TABLE wallet (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			address TEXT NOT NULL UNIQUE CHECK(LENGTH(address) == 64),
+			balance REAL DEFAULT 0.00
+		);
+		CREATE TABLE transactions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			from_address TEXT NOT NULL,
+			to_address TEXT NOT NULL CHECK(LENGTH(to_address) == 64),
+			amount REAL NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`)
+		require.NoError(t, err)
+		_, err = st.db.Exec(`INSERT INTO wallet (address, balance) VALUES (?, ?)`, generateTestAddress(t, "a"), 42.0)
+		require.NoError(t, err)
+		require.NoError(t, st.Close())
+
+		st, err = New(path)
+		require.NoError(t, err)
+		defer st.Close()
+
+		balance, err := st.GetBalance(context.Background(), generateTestAddress(t, "a"))
+		require.NoError(t, err)
+		assert.Equal(t, 42.0, balance)
+		assert.NoError(t, st.CheckSchema(context.Background()))
+	})
+
+	t.Run("Down and up again", func(t *testing.T) {
+		st := newTestRepository(t).(*Storage)
+
+		require.NoError(t, st.MigrateTo(context.Background(), 0))
+		version, err := st.SchemaVersion(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 0, version)
+		assert.ErrorIs(t, st.CheckSchema(context.Background()), ErrSchemaOutdated)
+
+		require.NoError(t, st.Migrate(context.Background()))
+		require.NoError(t, st.CreateWallet(context.Background(), generateTestAddress(t, "a"), 10))
+	})
+
+	t.Run("Pooled connection keeps the busy timeout", func(t *testing.T) {
+		st := newTestRepository(t).(*Storage)
+		// With a single connection the migration's is the one reused.
+		st.db.SetMaxOpenConns(1)
+
+		require.NoError(t, st.MigrateTo(context.Background(), 0))
+		require.NoError(t, st.Migrate(context.Background()))
+
+		var timeout int64
+		require.NoError(t, st.db.QueryRow(`PRAGMA busy_timeout`).Scan(&timeout))
+		assert.Equal(t, busyTimeout.Milliseconds(), timeout)
+	})
+
+	t.Run("Newer database is rejected", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "storage.db")
+		st, err := New(path)
+		require.NoError(t, err)
+
+		_, err = st.db.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, 'future', CURRENT_TIMESTAMP)`, LatestVersion()+1)
+		require.NoError(t, err)
+		require.NoError(t, st.Close())
+
+		_, err = New(path)
+		assert.ErrorIs(t, err, ErrSchemaTooNew)
+
+		st, err = Open(path)
+		require.NoError(t, err)
+		defer st.Close()
+		assert.ErrorIs(t, st.CheckSchema(context.Background()), ErrSchemaTooNew)
+		assert.ErrorIs(t, st.MigrateTo(context.Background(), 0), ErrSchemaTooNew)
+	})
+
+	t.Run("Concurrent migrations", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "storage.db")
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 5)
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				st, err := New(path)
+				if err == nil {
+					st.Close()
+				}
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			assert.NoError(t, err)
+		}
+
+		st, err := Open(path)
+		require.NoError(t, err)
+		defer st.Close()
+		assert.NoError(t, st.CheckSchema(context.Background()))
+	})
+}
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS wallet (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    address TEXT NOT NULL UNIQUE CHECK(LENGTH(address) == 64),
+    balance REAL DEFAULT 0.00
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    from_address TEXT NOT NULL,
+    to_address TEXT NOT NULL CHECK(LENGTH(to_address) == 64),
+    amount REAL NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (from_address) REFERENCES wallet(address),
+    FOREIGN KEY (to_address) REFERENCES wallet(address)
+);
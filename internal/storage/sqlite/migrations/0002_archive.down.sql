@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS carried_balances;
+DROP INDEX IF EXISTS idx_transactions_to_address;
+DROP INDEX IF EXISTS idx_transactions_from_address;
+DROP INDEX IF EXISTS idx_transactions_created_at;
@@ -0,0 +1,12 @@
+CREATE INDEX IF NOT EXISTS idx_transactions_created_at ON transactions (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_transactions_from_address ON transactions (from_address);
+CREATE INDEX IF NOT EXISTS idx_transactions_to_address ON transactions (to_address);
+
+-- Balance of every wallet before the oldest transaction still in the
+-- transactions table, updated whenever transactions are archived.
+CREATE TABLE IF NOT EXISTS carried_balances (
+    address TEXT PRIMARY KEY REFERENCES wallet(address),
+    balance REAL NOT NULL,
+    archived_through INTEGER NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,5 @@
+-- Latest nonce used by each wallet in a signed transfer.
+CREATE TABLE IF NOT EXISTS wallet_nonces (
+    address TEXT PRIMARY KEY,
+    nonce INTEGER NOT NULL
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS chain_checkpoints;
+DROP TABLE IF EXISTS chain_head;
+DROP INDEX IF EXISTS idx_transactions_unhashed;
+ALTER TABLE transactions DROP COLUMN hash;
+ALTER TABLE transactions DROP COLUMN prev_hash;
@@ -0,0 +1,22 @@
+-- Every transaction carries the SHA-256 of its contents and of the
+-- previous transaction, see internal/hashchain.
+ALTER TABLE transactions ADD COLUMN prev_hash TEXT;
+ALTER TABLE transactions ADD COLUMN hash TEXT;
+CREATE INDEX IF NOT EXISTS idx_transactions_unhashed ON transactions (id) WHERE hash IS NULL;
+
+-- Newest transaction of the chain, kept apart from the transactions table
+-- so archiving and deleting the newest rows cannot move it.
+CREATE TABLE IF NOT EXISTS chain_head (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    last_id INTEGER NOT NULL,
+    hash TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS chain_checkpoints (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    last_id INTEGER NOT NULL,
+    hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    public_key TEXT NOT NULL,
+    signature TEXT NOT NULL
+);
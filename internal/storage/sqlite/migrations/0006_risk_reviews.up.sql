@@ -0,0 +1,16 @@
+-- Transfers held by a risk rule until a reviewer decides on them, see
+-- internal/risk.
+CREATE TABLE IF NOT EXISTS risk_reviews (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    from_address TEXT NOT NULL,
+    to_address TEXT NOT NULL,
+    amount REAL NOT NULL,
+    rule TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    status TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    decided_at TIMESTAMP,
+    decided_by TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_risk_reviews_status ON risk_reviews (status, id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS screening_hits;
+DROP TABLE IF EXISTS screening_entries;
@@ -0,0 +1,21 @@
+-- Screening list entries added through the admin API; entries from list
+-- files are not stored. See internal/screening.
+CREATE TABLE IF NOT EXISTS screening_entries (
+    list TEXT NOT NULL,
+    address TEXT NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (list, address)
+);
+
+-- Audit trail of transfers rejected because of a blocked address.
+CREATE TABLE IF NOT EXISTS screening_hits (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    from_address TEXT NOT NULL,
+    to_address TEXT NOT NULL,
+    amount REAL NOT NULL,
+    address TEXT NOT NULL,
+    source TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
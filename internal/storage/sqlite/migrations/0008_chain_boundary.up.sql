@@ -0,0 +1,8 @@
+-- Transactions up to last_id were hashed once by the backfill that runs
+-- with this migration, see chainBackfill. Every later transaction is hashed
+-- when it is recorded, so one without a hash breaks the chain.
+CREATE TABLE IF NOT EXISTS chain_boundary (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    last_id INTEGER NOT NULL,
+    backfilled_at TIMESTAMP NOT NULL
+);
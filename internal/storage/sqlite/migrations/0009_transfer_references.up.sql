@@ -0,0 +1,7 @@
+-- References of executed transfers, such as the rows of a CSV import. A
+-- reference is written in the same transaction as its transfer, so it runs
+-- at most once.
+CREATE TABLE IF NOT EXISTS transfer_references (
+    reference TEXT PRIMARY KEY,
+    transaction_id INTEGER NOT NULL
+);
@@ -0,0 +1,55 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/tracing"
+	"github.com/Petro-vich/transaction_processing_go/internal/signing"
+)
+
+func (st *Storage) UseNonce(ctx context.Context, address string, nonce int64) (err error) {
+	const op = "storage.sqlite.UseNonce"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	var affected int64
+	err = st.retryBusy(ctx, func() error {
+		res, err := st.db.ExecContext(ctx, `
+		INSERT INTO wallet_nonces (address, nonce) VALUES (?, ?)
+		ON CONFLICT (address) DO UPDATE SET nonce = excluded.nonce
+		WHERE excluded.nonce > wallet_nonces.nonce`, address, nonce)
+		if err != nil {
+			return err
+		}
+		affected, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, signing.ErrNonceReused)
+	}
+	return nil
+}
+
+func (st *Storage) LastNonce(ctx context.Context, address string) (_ int64, err error) {
+	const op = "storage.sqlite.LastNonce"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	var nonce int64
+	err = st.db.QueryRowContext(ctx, `SELECT nonce FROM wallet_nonces WHERE address = ?`, address).Scan(&nonce)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return nonce, nil
+}
@@ -0,0 +1,170 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/tracing"
+	"github.com/Petro-vich/transaction_processing_go/internal/risk"
+)
+
+const reviewColumns = `id, from_address, to_address, amount, rule, reason, status, created_at, decided_at, decided_by, error`
+
+func (st *Storage) CreateReview(ctx context.Context, r risk.Review) (_ risk.Review, err error) {
+	const op = "storage.sqlite.CreateReview"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	err = st.retryBusy(ctx, func() error {
+		res, err := st.db.ExecContext(ctx, `
+		INSERT INTO risk_reviews (from_address, to_address, amount, rule, reason, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			r.From, r.To, r.Amount, r.Rule, r.Reason, r.Status, r.CreatedAt)
+		if err != nil {
+			return err
+		}
+		r.ID, err = res.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return risk.Review{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return r, nil
+}
+
+func (st *Storage) GetReview(ctx context.Context, id int64) (_ risk.Review, err error) {
+	const op = "storage.sqlite.GetReview"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	r, err := scanReview(st.db.QueryRowContext(ctx, `SELECT `+reviewColumns+` FROM risk_reviews WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return risk.Review{}, fmt.Errorf("%s: %w", op, risk.ErrReviewNotFound)
+	}
+	if err != nil {
+		return risk.Review{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return r, nil
+}
+
+// ListReviews returns up to count reviews with status, newest first; every
+// status when it is empty and every review when count is negative.
+func (st *Storage) ListReviews(ctx context.Context, status string, count int) (_ []risk.Review, err error) {
+	const op = "storage.sqlite.ListReviews"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := st.db.QueryContext(ctx, `
+	SELECT `+reviewColumns+`
+	FROM risk_reviews
+	WHERE ? = '' OR status = ?
+	ORDER BY id DESC
+	LIMIT ?`, status, status, count)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	reviews := []risk.Review{}
+	for rows.Next() {
+		r, err := scanReview(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		reviews = append(reviews, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return reviews, nil
+}
+
+func (st *Storage) DecideReview(ctx context.Context, id int64, status, by string, at time.Time) (_ risk.Review, err error) {
+	const op = "storage.sqlite.DecideReview"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	var affected int64
+	err = st.retryBusy(ctx, func() error {
+		res, err := st.db.ExecContext(ctx, `
+		UPDATE risk_reviews SET status = ?, decided_by = ?, decided_at = ?
+		WHERE id = ? AND status = ?`, status, by, at, id, risk.StatusPending)
+		if err != nil {
+			return err
+		}
+		affected, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return risk.Review{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	r, err := st.GetReview(ctx, id)
+	if err != nil {
+		return risk.Review{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return risk.Review{}, fmt.Errorf("%s: %w", op, risk.ErrReviewDecided)
+	}
+	return r, nil
+}
+
+func (st *Storage) CompleteReview(ctx context.Context, id int64) (err error) {
+	const op = "storage.sqlite.CompleteReview"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	err = st.retryBusy(ctx, func() error {
+		_, err := st.db.ExecContext(ctx, `
+		UPDATE risk_reviews SET status = ? WHERE id = ? AND status = ?`, risk.StatusApproved, id, risk.StatusExecuting)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (st *Storage) FailReview(ctx context.Context, id int64, message string) (err error) {
+	const op = "storage.sqlite.FailReview"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	err = st.retryBusy(ctx, func() error {
+		_, err := st.db.ExecContext(ctx, `
+		UPDATE risk_reviews SET status = ?, error = ? WHERE id = ?`, risk.StatusFailed, message, id)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func scanReview(row interface{ Scan(...any) error }) (risk.Review, error) {
+	var (
+		r         risk.Review
+		decidedAt sql.NullTime
+	)
+	err := row.Scan(&r.ID, &r.From, &r.To, &r.Amount, &r.Rule, &r.Reason, &r.Status,
+		&r.CreatedAt, &decidedAt, &r.DecidedBy, &r.Error)
+	if err != nil {
+		return risk.Review{}, err
+	}
+
+	r.CreatedAt = r.CreatedAt.UTC()
+	if decidedAt.Valid {
+		t := decidedAt.Time.UTC()
+		r.DecidedAt = &t
+	}
+	return r, nil
+}
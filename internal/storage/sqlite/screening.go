@@ -0,0 +1,141 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/tracing"
+	"github.com/Petro-vich/transaction_processing_go/internal/screening"
+)
+
+func (st *Storage) AddScreeningEntry(ctx context.Context, e screening.Entry) (err error) {
+	const op = "storage.sqlite.AddScreeningEntry"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	err = st.retryBusy(ctx, func() error {
+		_, err := st.db.ExecContext(ctx, `
+		INSERT INTO screening_entries (list, address, note, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (list, address) DO UPDATE SET
+			note = excluded.note, created_by = excluded.created_by, created_at = excluded.created_at`,
+			e.List, e.Address, e.Note, e.CreatedBy, e.CreatedAt)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (st *Storage) RemoveScreeningEntry(ctx context.Context, list, address string) (err error) {
+	const op = "storage.sqlite.RemoveScreeningEntry"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	var affected int64
+	err = st.retryBusy(ctx, func() error {
+		res, err := st.db.ExecContext(ctx, `
+		DELETE FROM screening_entries WHERE list = ? AND address = ?`, list, address)
+		if err != nil {
+			return err
+		}
+		affected, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, screening.ErrEntryNotFound)
+	}
+	return nil
+}
+
+func (st *Storage) ListScreeningEntries(ctx context.Context) (_ []screening.Entry, err error) {
+	const op = "storage.sqlite.ListScreeningEntries"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := st.db.QueryContext(ctx, `
+	SELECT list, address, note, created_by, created_at
+	FROM screening_entries
+	ORDER BY list, address`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	entries := []screening.Entry{}
+	for rows.Next() {
+		e := screening.Entry{Source: screening.SourceAPI}
+		if err := rows.Scan(&e.List, &e.Address, &e.Note, &e.CreatedBy, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		e.CreatedAt = e.CreatedAt.UTC()
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return entries, nil
+}
+
+func (st *Storage) RecordScreeningHit(ctx context.Context, h screening.Hit) (_ screening.Hit, err error) {
+	const op = "storage.sqlite.RecordScreeningHit"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	err = st.retryBusy(ctx, func() error {
+		res, err := st.db.ExecContext(ctx, `
+		INSERT INTO screening_hits (from_address, to_address, amount, address, source, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+			h.From, h.To, h.Amount, h.Address, h.Source, h.CreatedAt)
+		if err != nil {
+			return err
+		}
+		h.ID, err = res.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return screening.Hit{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return h, nil
+}
+
+// ListScreeningHits returns up to count hits, newest first; every hit when
+// count is negative.
+func (st *Storage) ListScreeningHits(ctx context.Context, count int) (_ []screening.Hit, err error) {
+	const op = "storage.sqlite.ListScreeningHits"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := st.db.QueryContext(ctx, `
+	SELECT id, from_address, to_address, amount, address, source, created_at
+	FROM screening_hits
+	ORDER BY id DESC
+	LIMIT ?`, count)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	hits := []screening.Hit{}
+	for rows.Next() {
+		var h screening.Hit
+		if err := rows.Scan(&h.ID, &h.From, &h.To, &h.Amount, &h.Address, &h.Source, &h.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		h.CreatedAt = h.CreatedAt.UTC()
+		hits = append(hits, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return hits, nil
+}
@@ -1,73 +1,127 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/Petro-vich/transaction_processing_go/internal/address"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/flock"
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/tracing"
 	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
 	"github.com/Petro-vich/transaction_processing_go/internal/storage"
-	_ "github.com/mattn/go-sqlite3"
+)
+
+// busyTimeout is how long a connection waits for a lock held by another
+// connection before failing with SQLITE_BUSY.
+const busyTimeout = 5 * time.Second
+
+// Write transactions that still fail with SQLITE_BUSY after busyTimeout are
+// retried up to maxBusyRetries times, waiting attempt*busyRetryDelay between tries.
+const (
+	maxBusyRetries = 3
+	busyRetryDelay = 50 * time.Millisecond
 )
 
 type Storage struct {
-	db *sql.DB
+	db      *sql.DB
+	lock    *flock.Lock
+	archive *archiveSet
 }
 
+// New opens the database and applies pending migrations.
 func New(filepath string) (*Storage, error) {
 	const op = "storage.sqlite.New"
-	db, err := sql.Open("sqlite3", filepath)
+
+	st, err := Open(filepath)
 	if err != nil {
+		return nil, err
+	}
+
+	if err := st.Migrate(context.Background()); err != nil {
+		st.Close()
 		return nil, fmt.Errorf("%s, %w", op, err)
 	}
 
-	defer func() {
+	return st, nil
+}
+
+// Open opens the database without touching its schema. A shared lock is
+// held on the lock file next to the database until Close, so Restore can
+// tell that the database is in use.
+func Open(filepath string) (*Storage, error) {
+	const op = "storage.sqlite.Open"
+
+	var lock *flock.Lock
+	if path, ok := LockPath(filepath); ok {
+		var err error
+		lock, err = flock.TryRLock(path)
 		if err != nil {
-			db.Close()
+			return nil, fmt.Errorf("%s: %w", op, err)
 		}
-	}()
+	}
 
-	_, err = db.Exec(`
-    CREATE TABLE IF NOT EXISTS wallet (
-        id INTEGER PRIMARY KEY AUTOINCREMENT, 
-        address TEXT NOT NULL UNIQUE CHECK(LENGTH(address) == 64),
-        balance REAL DEFAULT 0.00
-    )
-`)
+	db, err := sql.Open(driverName, dsn(filepath))
 	if err != nil {
+		unlock(lock)
 		return nil, fmt.Errorf("%s, %w", op, err)
 	}
 
-	_, err = db.Exec(`
-    CREATE TABLE IF NOT EXISTS transactions (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        from_address TEXT NOT NULL, 
-        to_address TEXT NOT NULL CHECK(LENGTH(to_address) == 64),
-        amount REAL NOT NULL,
-				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-				FOREIGN KEY (from_address) REFERENCES wallet(address),
-		    FOREIGN KEY (to_address) REFERENCES wallet(address) 
-)
-`)
-	if err != nil {
+	if err := db.Ping(); err != nil {
+		db.Close()
+		unlock(lock)
 		return nil, fmt.Errorf("%s, %w", op, err)
 	}
 
-	return &Storage{db: db}, nil
+	return &Storage{db: db, lock: lock}, nil
+}
+
+// LockPath returns the path of the lock file guarding the database at
+// path. In-memory databases have no lock file.
+func LockPath(path string) (string, bool) {
+	path = strings.TrimPrefix(path, "file:")
+	path, _, _ = strings.Cut(path, "?")
+	if path == "" || path == ":memory:" {
+		return "", false
+	}
+	return path + ".lock", true
 }
 
-func (st *Storage) CreateWallet(adr string, amount float64) error {
+func unlock(lock *flock.Lock) {
+	if lock != nil {
+		lock.Unlock()
+	}
+}
+
+func (st *Storage) CreateWallet(ctx context.Context, adr string, amount float64) (err error) {
 	const op = "storage.sqlite.CreateWallet"
 
-	if amount <= 0 {
-		return fmt.Errorf("%s balanc must be positiv", op)
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	if amount < 0 {
+		return fmt.Errorf("%s: %w", op, &storage.ValidationError{
+			Field:   "amount",
+			Message: "balance must not be negative",
+		})
 	}
 
 	if len(adr) != 64 {
-		return fmt.Errorf("%s: invalid address length (expected 64, got %d)", op, len(adr))
+		return fmt.Errorf("%s: %w", op, &storage.ValidationError{
+			Field:   "address",
+			Message: fmt.Sprintf("invalid address length (expected 64, got %d)", len(adr)),
+		})
+	}
+	if !address.IsCanonical(adr) {
+		return fmt.Errorf("%s: %w", op, &storage.ValidationError{
+			Field:   "address",
+			Message: "address must be lowercase hex",
+		})
 	}
-	stmt, err := st.db.Prepare(`
+	stmt, err := st.db.PrepareContext(ctx, `
 	INSERT INTO wallet (address, balance)
 	VALUES (?, ?)
 	`)
@@ -75,17 +129,25 @@ func (st *Storage) CreateWallet(adr string, amount float64) error {
 		return fmt.Errorf("%s, %w", op, err)
 	}
 
-	_, err = stmt.Exec(adr, amount)
+	defer stmt.Close()
+
+	err = st.retryBusy(ctx, func() error {
+		_, err := stmt.ExecContext(ctx, adr, amount)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("%s, %w", op, err)
+		return translateError(op, adr, err)
 	}
 	return nil
 }
 
-func (st *Storage) GetBalance(address string) (float64, error) {
+func (st *Storage) GetBalance(ctx context.Context, address string) (_ float64, err error) {
 	const op = "storage.sqlite.GetBalance"
 
-	stmt, err := st.db.Prepare(`
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	stmt, err := st.db.PrepareContext(ctx, `
 	SELECT balance
 	FROM wallet
 	WHERE address = ?
@@ -94,11 +156,12 @@ func (st *Storage) GetBalance(address string) (float64, error) {
 		return 0, fmt.Errorf("%s, %w", op, err)
 
 	}
+	defer stmt.Close()
 
 	var balance float64
-	err = stmt.QueryRow(address).Scan(&balance)
+	err = stmt.QueryRowContext(ctx, address).Scan(&balance)
 	if errors.Is(err, sql.ErrNoRows) {
-		return 0, storage.ErrAddressNotExist
+		return 0, fmt.Errorf("%s: %w", op, &storage.NotFoundError{Address: address})
 	}
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
@@ -107,94 +170,301 @@ func (st *Storage) GetBalance(address string) (float64, error) {
 	return balance, nil
 }
 
-func (st *Storage) SendMoney(from string, to string, amount float64) error {
+func (st *Storage) SendMoney(ctx context.Context, from string, to string, amount float64) (err error) {
+	const op = "storage.sqlite.SendMoney"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	return st.send(ctx, op, "", from, to, amount)
+}
+
+func (st *Storage) SendMoneyWithReference(ctx context.Context, reference, from, to string, amount float64) (err error) {
+	const op = "storage.sqlite.SendMoneyWithReference"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	return st.send(ctx, op, reference, from, to, amount)
+}
+
+// send validates a transfer and runs it while the database is busy. An
+// empty reference is not stored.
+func (st *Storage) send(ctx context.Context, op, reference, from, to string, amount float64) error {
+	if amount <= 0 {
+		return fmt.Errorf("%s: %w", op, &storage.ValidationError{
+			Field:   "amount",
+			Message: "amount must be positive",
+		})
+	}
+
+	if from == to {
+		return fmt.Errorf("%s: %w", op, &storage.ValidationError{
+			Field:   "to",
+			Message: "sender and recipient must differ",
+		})
+	}
+
+	err := st.retryBusy(ctx, func() error {
+		return st.sendMoney(ctx, reference, from, to, amount)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (st *Storage) HasReference(ctx context.Context, reference string) (_ bool, err error) {
+	const op = "storage.sqlite.HasReference"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	var used bool
+	err = st.db.QueryRowContext(ctx, `
+	SELECT EXISTS (SELECT 1 FROM transfer_references WHERE reference = ?)
+	`, reference).Scan(&used)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return used, nil
+}
+
+// sendMoney moves amount in a single immediate transaction, which also
+// stores reference unless it is empty. The sender is
+// debited with a conditional update, so the balance check and the debit
+// cannot be interleaved with another transfer. Every step is traced, so a
+// slow transfer shows whether it waited for the lock, the balance check or
+// the commit.
+func (st *Storage) sendMoney(ctx context.Context, reference, from, to string, amount float64) error {
 	const op = "storage.sqlite.SendMoney"
 
-	tx, err := st.db.Begin()
+	var tx *sql.Tx
+	err := step(ctx, op+".begin", func(context.Context) (err error) {
+		tx, err = st.db.BeginTx(ctx, nil)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("%s, %w", op, err)
+		return fmt.Errorf("begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	balanceFrom, err := st.GetBalance(from)
-	if err == storage.ErrAddressNotExist {
+	err = step(ctx, op+".debit", func(ctx context.Context) error {
+		return debit(ctx, tx, from, amount)
+	})
+	if err != nil {
 		return err
-	} else if err != nil {
-		return fmt.Errorf("%s: failed to get balance for to address: %w", op, err)
 	}
 
-	if balanceFrom-amount < 0 {
-		return storage.ErrInsufficient
+	err = step(ctx, op+".credit", func(ctx context.Context) error {
+		return credit(ctx, tx, to, amount)
+	})
+	if err != nil {
+		return err
 	}
 
-	_, err = st.GetBalance(to)
-	if err == storage.ErrAddressNotExist {
+	var id int64
+	err = step(ctx, op+".record", func(ctx context.Context) (err error) {
+		id, err = record(ctx, tx, from, to, amount)
+		return err
+	})
+	if err != nil {
 		return err
-	} else if err != nil {
-		return fmt.Errorf("%s: failed to get balance for to address: %w", op, err)
 	}
 
-	_, err = tx.Exec(`
+	if reference != "" {
+		err = step(ctx, op+".reference", func(ctx context.Context) error {
+			return recordReference(ctx, tx, reference, id)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = step(ctx, op+".commit", func(context.Context) error {
+		return tx.Commit()
+	})
+	if err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// debit takes amount from the balance of from unless it is lower.
+func debit(ctx context.Context, tx *sql.Tx, from string, amount float64) error {
+	res, err := tx.ExecContext(ctx, `
 	UPDATE wallet SET balance = balance - ?
-	WHERE address = ?
-	`, amount, from)
+	WHERE address = ? AND balance >= ?
+	`, amount, from, amount)
 	if err != nil {
-		return fmt.Errorf("%s: failed to update from balance: %w", op, err)
+		return fmt.Errorf("failed to update from balance: %w", err)
 	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to update from balance: %w", err)
+	} else if n == 0 {
+		var balance float64
+		err := tx.QueryRowContext(ctx, `SELECT balance FROM wallet WHERE address = ?`, from).Scan(&balance)
+		if errors.Is(err, sql.ErrNoRows) {
+			return &storage.NotFoundError{Address: from}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get balance for from address: %w", err)
+		}
+		return &storage.InsufficientFundsError{
+			Address:   from,
+			Available: balance,
+			Requested: amount,
+		}
+	}
+	return nil
+}
 
-	_, err = tx.Exec(`
+// credit adds amount to the balance of to.
+func credit(ctx context.Context, tx *sql.Tx, to string, amount float64) error {
+	res, err := tx.ExecContext(ctx, `
 		UPDATE wallet SET balance = balance + ?
 		WHERE address = ?
 	`, amount, to)
 	if err != nil {
-		return fmt.Errorf("%s: failed to update to balance: %w", op, err)
+		return fmt.Errorf("failed to update to balance: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to update to balance: %w", err)
+	} else if n == 0 {
+		return &storage.NotFoundError{Address: to}
 	}
+	return nil
+}
 
-	_, err = tx.Exec(`
+// record inserts the transaction and links it into the hash chain. It is
+// read back before hashing, so the hash covers the values as stored.
+func record(ctx context.Context, tx *sql.Tx, from string, to string, amount float64) (int64, error) {
+	res, err := tx.ExecContext(ctx, `
 	INSERT INTO transactions (from_address, to_address, amount, created_at)
 	VALUES (?, ?, ?, ?)
 	`, from, to, amount, time.Now())
 	if err != nil {
-		return fmt.Errorf("%s: failed to insert transaction: %w", op, err)
+		return 0, fmt.Errorf("failed to insert transaction: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert transaction: %w", err)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("%s: commit transaction: %w", op, err)
+	inserted, err := scanTransactions(ctx, tx, `
+	SELECT id, from_address, to_address, amount, created_at
+	FROM transactions
+	WHERE id = ?
+	`, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read inserted transaction: %w", err)
 	}
+	if len(inserted) == 0 {
+		return 0, fmt.Errorf("inserted transaction %d not found", id)
+	}
+
+	head, err := chainHead(ctx, tx)
+	if err != nil {
+		return 0, fmt.Errorf("read chain head: %w", err)
+	}
+	if head, err = linkTransaction(ctx, tx, head, inserted[0]); err != nil {
+		return 0, err
+	}
+	return id, saveChainHead(ctx, tx, head)
+}
 
+// recordReference stores the reference of transaction id. The reference is
+// the primary key, so a reference executed before fails the transfer.
+func recordReference(ctx context.Context, tx *sql.Tx, reference string, id int64) error {
+	_, err := tx.ExecContext(ctx, `
+	INSERT INTO transfer_references (reference, transaction_id) VALUES (?, ?)
+	`, reference, id)
+	if code, ok := errorCode(err); ok && (code == codeConstraintPrimaryKey || code == codeConstraintUnique) {
+		return &storage.ReferenceUsedError{Reference: reference}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to insert reference: %w", err)
+	}
 	return nil
 }
 
-func (st *Storage) GetLast(count int) ([]transaction.Request, error) {
+// retryBusy runs fn and retries it with a growing delay while it fails with
+// SQLITE_BUSY. Once the retries are exhausted the error wraps storage.ErrBusy.
+func (st *Storage) retryBusy(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 0; attempt <= maxBusyRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt) * busyRetryDelay):
+			}
+		}
+
+		err = fn()
+		if err == nil || !isBusy(err) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("%w: %v", storage.ErrBusy, err)
+}
+
+func (st *Storage) GetLast(ctx context.Context, count int) (_ []transaction.Request, err error) {
 	const op = "storage.sqlite.GetLast"
 
-	rows, err := st.db.Query(`
-	SELECT * 
-	FROM transactions
-	ORDER BY created_at DESC
-	LIMIT ?
-	`, count)
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	transactions, err := st.queryTransactions(ctx, count, "")
 	if err != nil {
-		return nil, fmt.Errorf("%s, %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	return transactions, nil
+}
 
-	transactions := []transaction.Request{}
+// GetHistory returns up to count transactions sent or received by address,
+// newest first, including archived ones.
+func (st *Storage) GetHistory(ctx context.Context, address string, count int) (_ []transaction.Request, err error) {
+	const op = "storage.sqlite.GetHistory"
 
-	for rows.Next() {
-		tr := transaction.Request{}
-		err := rows.Scan(&tr.Id, &tr.From, &tr.To, &tr.Amount, &tr.Created_at)
-		if err != nil {
-			return nil, err
-		}
-		transactions = append(transactions, tr)
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	var exists int
+	err = st.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM wallet WHERE address = ?`, address).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if exists == 0 {
+		return nil, fmt.Errorf("%s: %w", op, &storage.NotFoundError{Address: address})
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("%s: rows error: %w", op, err)
+	transactions, err := st.queryTransactions(ctx, count, "WHERE from_address = ? OR to_address = ?", address, address)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 	return transactions, nil
 }
 
+// TotalFunds returns the sum of all wallet balances.
+func (st *Storage) TotalFunds(ctx context.Context) (_ float64, err error) {
+	const op = "storage.sqlite.TotalFunds"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	var total float64
+	err = st.db.QueryRowContext(ctx, `SELECT COALESCE(SUM(balance), 0) FROM wallet`).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return total, nil
+}
+
 func (st *Storage) IsEmpty() bool {
 	res, err := st.db.Query(`
 	SELECT *
@@ -206,3 +476,39 @@ func (st *Storage) IsEmpty() bool {
 	defer res.Close()
 	return !res.Next()
 }
+
+// withParams appends query parameters to a database path or URI.
+func withParams(path string, params ...string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + strings.Join(params, "&")
+}
+
+func (st *Storage) Close() error {
+	if st.archive != nil {
+		st.archive.close()
+	}
+	err := st.db.Close()
+	unlock(st.lock)
+	return err
+}
+
+// Ping checks that the database can still be reached.
+func (st *Storage) Ping(ctx context.Context) (err error) {
+	const op = "storage.sqlite.Ping"
+
+	ctx, span := startSpan(ctx, op)
+	defer func() { tracing.End(span, err) }()
+
+	if err := st.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Stats returns the statistics of the connection pool.
+func (st *Storage) Stats() sql.DBStats {
+	return st.db.Stats()
+}
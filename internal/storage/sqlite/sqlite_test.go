@@ -1,11 +1,28 @@
 package sqlite
 
 import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/Petro-vich/transaction_processing_go/internal/risk"
+	"github.com/Petro-vich/transaction_processing_go/internal/screening"
+	"github.com/Petro-vich/transaction_processing_go/internal/signing"
 	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage/storagetest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 func setupTestDB(t *testing.T) *Storage {
@@ -31,11 +48,11 @@ func TestStorage_CreateWallet(t *testing.T) {
 		address := generateTestAddress(t, "a")
 		amount := 100.0
 
-		err := st.CreateWallet(address, amount)
+		err := st.CreateWallet(context.Background(), address, amount)
 		assert.NoError(t, err)
 
 		// Проверяем, что кошелек создан
-		balance, err := st.GetBalance(address)
+		balance, err := st.GetBalance(context.Background(), address)
 		assert.NoError(t, err)
 		assert.Equal(t, amount, balance)
 	})
@@ -44,18 +61,49 @@ func TestStorage_CreateWallet(t *testing.T) {
 		st := setupTestDB(t)
 		defer st.db.Close()
 
-		err := st.CreateWallet("short_address", 100.0)
+		err := st.CreateWallet(context.Background(), "short_address", 100.0)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "invalid address length")
 	})
 
+	t.Run("Check constraint", func(t *testing.T) {
+		st := setupTestDB(t)
+		defer st.db.Close()
+
+		_, driverErr := st.db.Exec(`INSERT INTO wallet (address, balance) VALUES ('short', 0)`)
+		require.Error(t, driverErr)
+
+		err := translateError("op", "short", driverErr)
+		var validation *storage.ValidationError
+		require.ErrorAs(t, err, &validation)
+		assert.Equal(t, checkViolated, validation.Message)
+		assert.Contains(t, err.Error(), driverErr.Error(), "the driver text is kept for the log")
+	})
+
 	t.Run("Negative amount", func(t *testing.T) {
 		st := setupTestDB(t)
 		defer st.db.Close()
 
-		err := st.CreateWallet(generateTestAddress(t, "a"), -10.0)
+		err := st.CreateWallet(context.Background(), generateTestAddress(t, "a"), -10.0)
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "balanc must be positiv")
+		assert.ErrorIs(t, err, storage.ErrValidation)
+		assert.Contains(t, err.Error(), "balance must not be negative")
+	})
+
+	t.Run("Duplicate address", func(t *testing.T) {
+		st := setupTestDB(t)
+		defer st.db.Close()
+
+		address := generateTestAddress(t, "a")
+		err := st.CreateWallet(context.Background(), address, 100.0)
+		assert.NoError(t, err)
+
+		err = st.CreateWallet(context.Background(), address, 100.0)
+		assert.ErrorIs(t, err, storage.ErrConflict)
+
+		var conflict *storage.ConflictError
+		assert.ErrorAs(t, err, &conflict)
+		assert.Equal(t, address, conflict.Address)
 	})
 }
 
@@ -67,10 +115,10 @@ func TestStorage_GetBalance(t *testing.T) {
 		address := generateTestAddress(t, "a")
 		amount := 50.0
 
-		err := st.CreateWallet(address, amount)
+		err := st.CreateWallet(context.Background(), address, amount)
 		assert.NoError(t, err)
 
-		balance, err := st.GetBalance(address)
+		balance, err := st.GetBalance(context.Background(), address)
 		assert.NoError(t, err)
 		assert.Equal(t, amount, balance)
 	})
@@ -79,7 +127,7 @@ func TestStorage_GetBalance(t *testing.T) {
 		st := setupTestDB(t)
 		defer st.db.Close()
 
-		balance, err := st.GetBalance(generateTestAddress(t, "a"))
+		balance, err := st.GetBalance(context.Background(), generateTestAddress(t, "a"))
 		assert.ErrorIs(t, err, storage.ErrAddressNotExist)
 		assert.Equal(t, 0.0, balance)
 	})
@@ -94,19 +142,19 @@ func TestStorage_SendMoney(t *testing.T) {
 		toAddr := generateTestAddress(t, "b")
 		amount := 30.0
 
-		err := st.CreateWallet(fromAddr, 100.0)
+		err := st.CreateWallet(context.Background(), fromAddr, 100.0)
 		assert.NoError(t, err)
-		err = st.CreateWallet(toAddr, 50.0)
+		err = st.CreateWallet(context.Background(), toAddr, 50.0)
 		assert.NoError(t, err)
 
-		err = st.SendMoney(fromAddr, toAddr, amount)
+		err = st.SendMoney(context.Background(), fromAddr, toAddr, amount)
 		assert.NoError(t, err)
 
-		fromBalance, err := st.GetBalance(fromAddr)
+		fromBalance, err := st.GetBalance(context.Background(), fromAddr)
 		assert.NoError(t, err)
 		assert.Equal(t, 70.0, fromBalance)
 
-		toBalance, err := st.GetBalance(toAddr)
+		toBalance, err := st.GetBalance(context.Background(), toAddr)
 		assert.NoError(t, err)
 		assert.Equal(t, 80.0, toBalance)
 	})
@@ -118,13 +166,19 @@ func TestStorage_SendMoney(t *testing.T) {
 		fromAddr := generateTestAddress(t, "a")
 		toAddr := generateTestAddress(t, "b")
 
-		err := st.CreateWallet(fromAddr, 20.0)
+		err := st.CreateWallet(context.Background(), fromAddr, 20.0)
 		assert.NoError(t, err)
-		err = st.CreateWallet(toAddr, 50.0)
+		err = st.CreateWallet(context.Background(), toAddr, 50.0)
 		assert.NoError(t, err)
 
-		err = st.SendMoney(fromAddr, toAddr, 30.0)
+		err = st.SendMoney(context.Background(), fromAddr, toAddr, 30.0)
 		assert.ErrorIs(t, err, storage.ErrInsufficient)
+
+		var insufficient *storage.InsufficientFundsError
+		assert.ErrorAs(t, err, &insufficient)
+		assert.Equal(t, fromAddr, insufficient.Address)
+		assert.Equal(t, 20.0, insufficient.Available)
+		assert.Equal(t, 30.0, insufficient.Requested)
 	})
 
 	t.Run("Non-existent from address", func(t *testing.T) {
@@ -132,11 +186,39 @@ func TestStorage_SendMoney(t *testing.T) {
 		defer st.db.Close()
 
 		toAddr := generateTestAddress(t, "b")
-		err := st.CreateWallet(toAddr, 50.0)
+		err := st.CreateWallet(context.Background(), toAddr, 50.0)
 		assert.NoError(t, err)
 
-		err = st.SendMoney(generateTestAddress(t, "a"), toAddr, 10.0)
+		err = st.SendMoney(context.Background(), generateTestAddress(t, "a"), toAddr, 10.0)
 		assert.ErrorIs(t, err, storage.ErrAddressNotExist)
+
+		var notFound *storage.NotFoundError
+		assert.ErrorAs(t, err, &notFound)
+		assert.Equal(t, generateTestAddress(t, "a"), notFound.Address)
+	})
+
+	t.Run("Non-existent to address", func(t *testing.T) {
+		st := setupTestDB(t)
+		defer st.db.Close()
+
+		fromAddr := generateTestAddress(t, "a")
+		err := st.CreateWallet(context.Background(), fromAddr, 50.0)
+		assert.NoError(t, err)
+
+		err = st.SendMoney(context.Background(), fromAddr, generateTestAddress(t, "b"), 10.0)
+		assert.ErrorIs(t, err, storage.ErrAddressNotExist)
+	})
+
+	t.Run("Same sender and recipient", func(t *testing.T) {
+		st := setupTestDB(t)
+		defer st.db.Close()
+
+		fromAddr := generateTestAddress(t, "a")
+		err := st.CreateWallet(context.Background(), fromAddr, 50.0)
+		assert.NoError(t, err)
+
+		err = st.SendMoney(context.Background(), fromAddr, fromAddr, 10.0)
+		assert.ErrorIs(t, err, storage.ErrValidation)
 	})
 }
 
@@ -149,15 +231,15 @@ func TestStorage_GetLast(t *testing.T) {
 		toAddr := generateTestAddress(t, "b")
 		amount := 30.0
 
-		err := st.CreateWallet(fromAddr, 100.0)
+		err := st.CreateWallet(context.Background(), fromAddr, 100.0)
 		assert.NoError(t, err)
-		err = st.CreateWallet(toAddr, 50.0)
+		err = st.CreateWallet(context.Background(), toAddr, 50.0)
 		assert.NoError(t, err)
 
-		err = st.SendMoney(fromAddr, toAddr, amount)
+		err = st.SendMoney(context.Background(), fromAddr, toAddr, amount)
 		assert.NoError(t, err)
 
-		transactions, err := st.GetLast(1)
+		transactions, err := st.GetLast(context.Background(), 1)
 		assert.NoError(t, err)
 		assert.Len(t, transactions, 1)
 		assert.Equal(t, fromAddr, transactions[0].From)
@@ -169,7 +251,7 @@ func TestStorage_GetLast(t *testing.T) {
 		st := setupTestDB(t)
 		defer st.db.Close()
 
-		transactions, err := st.GetLast(0)
+		transactions, err := st.GetLast(context.Background(), 0)
 		assert.NoError(t, err)
 		assert.Empty(t, transactions)
 	})
@@ -187,9 +269,206 @@ func TestStorage_IsEmpty(t *testing.T) {
 		st := setupTestDB(t)
 		defer st.db.Close()
 
-		err := st.CreateWallet(generateTestAddress(t, "a"), 100.0)
+		err := st.CreateWallet(context.Background(), generateTestAddress(t, "a"), 100.0)
 		assert.NoError(t, err)
 
 		assert.False(t, st.IsEmpty())
 	})
-}
\ No newline at end of file
+}
+
+func TestStorage_Ping(t *testing.T) {
+	st := setupTestDB(t)
+	assert.NoError(t, st.Ping(context.Background()))
+
+	require.NoError(t, st.db.Close())
+	assert.Error(t, st.Ping(context.Background()))
+}
+
+func newTestRepository(t *testing.T) storage.Repository {
+	st, err := New(filepath.Join(t.TempDir(), "storage.db"))
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+func TestStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, newTestRepository)
+}
+
+func TestStorage_Concurrent(t *testing.T) {
+	storagetest.RunConcurrent(t, newTestRepository)
+}
+
+func TestStorage_TotalFunds(t *testing.T) {
+	storagetest.RunFunds(t, func(t *testing.T) storagetest.FundsStore {
+		return newTestRepository(t).(*Storage)
+	})
+}
+
+func TestStorage_Nonces(t *testing.T) {
+	storagetest.RunNonces(t, func(t *testing.T) signing.NonceStore {
+		return newTestRepository(t).(*Storage)
+	})
+}
+
+func TestStorage_Reviews(t *testing.T) {
+	storagetest.RunReviews(t, func(t *testing.T) risk.ReviewStore {
+		return newTestRepository(t).(*Storage)
+	})
+}
+
+func TestStorage_Screening(t *testing.T) {
+	storagetest.RunScreening(t, func(t *testing.T) screening.Store {
+		return newTestRepository(t).(*Storage)
+	})
+}
+
+// TestSendMoney_Stress runs random transfers through several connection
+// pools opened on the same file, as separate service instances would.
+func TestSendMoney_Stress(t *testing.T) {
+	if testing.Short() {
+		t.Skip("stress test skipped in short mode")
+	}
+
+	path := filepath.Join(t.TempDir(), "storage.db")
+
+	const pools, workers, transfers, wallets = 3, 12, 40, 5
+
+	handles := make([]*Storage, pools)
+	for i := range handles {
+		st, err := New(path)
+		require.NoError(t, err)
+		t.Cleanup(func() { st.Close() })
+		handles[i] = st
+	}
+
+	addresses := make([]string, wallets)
+	for i := range addresses {
+		addresses[i] = storagetest.Address(fmt.Sprintf("%x", i+1))
+		require.NoError(t, handles[0].CreateWallet(context.Background(), addresses[i], 100))
+	}
+
+	var wg sync.WaitGroup
+	var succeeded atomic.Int64
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			st := handles[w%pools]
+			rnd := rand.New(rand.NewPCG(uint64(w), 0))
+			for i := 0; i < transfers; i++ {
+				from := rnd.IntN(wallets)
+				to := (from + 1 + rnd.IntN(wallets-1)) % wallets
+				amount := float64(rnd.IntN(80) + 1)
+
+				err := st.SendMoney(context.Background(), addresses[from], addresses[to], amount)
+				if err == nil {
+					succeeded.Add(1)
+					continue
+				}
+				assert.ErrorIs(t, err, storage.ErrInsufficient)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	total := 0.0
+	for _, adr := range addresses {
+		balance, err := handles[0].GetBalance(context.Background(), adr)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, balance, 0.0)
+		total += balance
+	}
+	assert.Equal(t, float64(wallets*100), total)
+
+	transactions, err := handles[0].GetLast(context.Background(), workers*transfers)
+	require.NoError(t, err)
+	assert.Len(t, transactions, int(succeeded.Load()))
+}
+
+func TestSendMoney_WaitsForWriteLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.db")
+
+	st, err := New(path)
+	require.NoError(t, err)
+	defer st.Close()
+
+	require.NoError(t, st.CreateWallet(context.Background(), generateTestAddress(t, "a"), 100))
+	require.NoError(t, st.CreateWallet(context.Background(), generateTestAddress(t, "b"), 100))
+
+	other, err := Open(path)
+	require.NoError(t, err)
+	defer other.Close()
+
+	conn, err := other.db.Conn(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.ExecContext(context.Background(), "BEGIN IMMEDIATE")
+	require.NoError(t, err)
+
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		conn.ExecContext(context.Background(), "ROLLBACK")
+		close(released)
+	}()
+
+	err = st.SendMoney(context.Background(), generateTestAddress(t, "a"), generateTestAddress(t, "b"), 10)
+	require.NoError(t, err)
+	<-released
+
+	balance, err := st.GetBalance(context.Background(), generateTestAddress(t, "a"))
+	require.NoError(t, err)
+	assert.Equal(t, 90.0, balance)
+}
+
+func TestStorage_WALMode(t *testing.T) {
+	st := newTestRepository(t).(*Storage)
+
+	var mode string
+	require.NoError(t, st.db.QueryRow("PRAGMA journal_mode").Scan(&mode))
+	assert.Equal(t, "wal", mode)
+}
+
+func TestStorage_Tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	st := newTestRepository(t).(*Storage)
+	ctx := context.Background()
+	require.NoError(t, st.CreateWallet(ctx, generateTestAddress(t, "a"), 100))
+	require.NoError(t, st.CreateWallet(ctx, generateTestAddress(t, "b"), 100))
+	assert.Empty(t, recorder.Ended(), "calls outside a trace are not recorded")
+
+	ctx, parent := otel.Tracer("test").Start(ctx, "POST /api/send")
+	require.NoError(t, st.SendMoney(ctx, generateTestAddress(t, "a"), generateTestAddress(t, "b"), 10))
+	assert.ErrorIs(t, st.SendMoney(ctx, generateTestAddress(t, "a"), generateTestAddress(t, "b"), 500), storage.ErrInsufficient)
+	parent.End()
+
+	var names []string
+	for _, span := range recorder.Ended() {
+		assert.Equal(t, parent.SpanContext().TraceID(), span.SpanContext().TraceID())
+		names = append(names, span.Name())
+	}
+	assert.Equal(t, []string{
+		"storage.sqlite.SendMoney.begin",
+		"storage.sqlite.SendMoney.debit",
+		"storage.sqlite.SendMoney.credit",
+		"storage.sqlite.SendMoney.record",
+		"storage.sqlite.SendMoney.commit",
+		"storage.sqlite.SendMoney",
+		"storage.sqlite.SendMoney.begin",
+		"storage.sqlite.SendMoney.debit",
+		"storage.sqlite.SendMoney",
+		"POST /api/send",
+	}, names)
+
+	failed := recorder.Ended()[8]
+	assert.Equal(t, codes.Error, failed.Status().Code)
+	assert.Contains(t, failed.Status().Description, "insufficient funds")
+}
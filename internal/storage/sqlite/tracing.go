@@ -0,0 +1,34 @@
+package sqlite
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/lib/tracing"
+)
+
+var tracer = otel.Tracer("github.com/Petro-vich/transaction_processing_go/internal/storage/sqlite")
+
+// startSpan starts the span of the storage operation op as a child of the
+// span in ctx. Without one, as for probes, scrapes and startup, nothing is
+// recorded.
+func startSpan(ctx context.Context, op string) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return tracer.Start(ctx, op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemNameSQLite),
+	)
+}
+
+// step runs fn in a child span named name, a step of a larger operation.
+func step(ctx context.Context, name string, fn func(ctx context.Context) error) (err error) {
+	ctx, span := startSpan(ctx, name)
+	defer func() { tracing.End(span, err) }()
+
+	return fn(ctx)
+}
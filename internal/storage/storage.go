@@ -1,19 +1,33 @@
 package storage
 
 import (
-	"errors"
+	"context"
 
 	"github.com/Petro-vich/transaction_processing_go/internal/models/transaction"
 )
 
-var (
-	ErrAddressNotExist = errors.New("the address does not exist")
-	ErrInsufficient    = errors.New("insufficient funds")
-)
-
 type Repository interface {
-	CreateWallet(address string, amount float64) error
-	GetBalance(address string) (float64, error)
-	SendMoney(from, to string, amount float64) error
-	GetLast(count int) ([]transaction.Request, error)
+	CreateWallet(ctx context.Context, address string, amount float64) error
+	GetBalance(ctx context.Context, address string) (float64, error)
+	SendMoney(ctx context.Context, from, to string, amount float64) error
+	// SendMoneyWithReference is SendMoney for a transfer identified by
+	// reference, which is stored in the same transaction. A reference
+	// that was already executed fails with ErrReferenceUsed.
+	SendMoneyWithReference(ctx context.Context, reference, from, to string, amount float64) error
+	// HasReference reports whether a transfer with reference was executed.
+	HasReference(ctx context.Context, reference string) (bool, error)
+	GetLast(ctx context.Context, count int) ([]transaction.Request, error)
+	GetHistory(ctx context.Context, address string, count int) ([]transaction.Request, error)
+}
+
+// Unwrap returns the innermost repository of a chain of decorators,
+// each of which exposes the repository it wraps with Unwrap.
+func Unwrap(repo Repository) Repository {
+	for {
+		u, ok := repo.(interface{ Unwrap() Repository })
+		if !ok {
+			return repo
+		}
+		repo = u.Unwrap()
+	}
 }
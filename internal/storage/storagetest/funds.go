@@ -0,0 +1,38 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/metrics"
+	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// FundsStore is a repository summing the balances of its wallets.
+type FundsStore interface {
+	storage.Repository
+	metrics.FundsSource
+}
+
+// FundsFactory returns an empty funds store. Cleanup should be registered on t.
+type FundsFactory func(t *testing.T) FundsStore
+
+// RunFunds executes the shared behavior tests of metrics.FundsSource.
+func RunFunds(t *testing.T, newStore FundsFactory) {
+	store := newStore(t)
+	ctx := context.Background()
+
+	total, err := store.TotalFunds(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+
+	require.NoError(t, store.CreateWallet(ctx, Address("a"), 100))
+	require.NoError(t, store.CreateWallet(ctx, Address("b"), 50.5))
+	require.NoError(t, store.SendMoney(ctx, Address("a"), Address("b"), 30))
+
+	total, err = store.TotalFunds(ctx)
+	require.NoError(t, err)
+	assert.InDelta(t, 150.5, total, 1e-9, "transfers keep the total")
+}
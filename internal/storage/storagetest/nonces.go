@@ -0,0 +1,67 @@
+package storagetest
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/signing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NonceFactory returns an empty nonce store. Cleanup should be registered on t.
+type NonceFactory func(t *testing.T) signing.NonceStore
+
+// RunNonces executes the shared behavior tests of signing.NonceStore.
+func RunNonces(t *testing.T, newStore NonceFactory) {
+	t.Run("Increasing nonces", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+
+		last, err := store.LastNonce(ctx, Address("a"))
+		require.NoError(t, err)
+		assert.Zero(t, last)
+
+		require.NoError(t, store.UseNonce(ctx, Address("a"), 1))
+		require.NoError(t, store.UseNonce(ctx, Address("a"), 5))
+		require.NoError(t, store.UseNonce(ctx, Address("b"), 1))
+
+		last, err = store.LastNonce(ctx, Address("a"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), last)
+	})
+
+	t.Run("Reused nonces", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+
+		require.NoError(t, store.UseNonce(ctx, Address("a"), 5))
+		assert.ErrorIs(t, store.UseNonce(ctx, Address("a"), 5), signing.ErrNonceReused)
+		assert.ErrorIs(t, store.UseNonce(ctx, Address("a"), 3), signing.ErrNonceReused)
+
+		last, err := store.LastNonce(ctx, Address("a"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), last)
+	})
+
+	t.Run("Concurrent replay", func(t *testing.T) {
+		store := newStore(t)
+
+		var wg sync.WaitGroup
+		var accepted atomic.Int32
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if store.UseNonce(context.Background(), Address("a"), 1) == nil {
+					accepted.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), accepted.Load())
+	})
+}
@@ -0,0 +1,141 @@
+package storagetest
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/risk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ReviewFactory returns an empty review store. Cleanup should be registered on t.
+type ReviewFactory func(t *testing.T) risk.ReviewStore
+
+// RunReviews executes the shared behavior tests of risk.ReviewStore.
+func RunReviews(t *testing.T, newStore ReviewFactory) {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	pending := func(to string) risk.Review {
+		return risk.Review{
+			From:      Address("a"),
+			To:        Address(to),
+			Amount:    25,
+			Rule:      "round_trip",
+			Reason:    "recipient sent 5 to the sender within 1h0m0s",
+			Status:    risk.StatusPending,
+			CreatedAt: created,
+		}
+	}
+
+	t.Run("Create and list", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+
+		first, err := store.CreateReview(ctx, pending("b"))
+		require.NoError(t, err)
+		second, err := store.CreateReview(ctx, pending("c"))
+		require.NoError(t, err)
+		assert.Greater(t, second.ID, first.ID)
+
+		got, err := store.GetReview(ctx, first.ID)
+		require.NoError(t, err)
+		assert.Equal(t, first, got)
+
+		reviews, err := store.ListReviews(ctx, risk.StatusPending, 10)
+		require.NoError(t, err)
+		assert.Equal(t, []risk.Review{second, first}, reviews)
+
+		reviews, err = store.ListReviews(ctx, "", 1)
+		require.NoError(t, err)
+		assert.Equal(t, []risk.Review{second}, reviews)
+
+		reviews, err = store.ListReviews(ctx, risk.StatusApproved, 10)
+		require.NoError(t, err)
+		assert.Empty(t, reviews)
+
+		_, err = store.GetReview(ctx, second.ID+1)
+		assert.ErrorIs(t, err, risk.ErrReviewNotFound)
+	})
+
+	t.Run("Decide", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+
+		r, err := store.CreateReview(ctx, pending("b"))
+		require.NoError(t, err)
+
+		decided := created.Add(time.Hour)
+		got, err := store.DecideReview(ctx, r.ID, risk.StatusApproved, "alice", decided)
+		require.NoError(t, err)
+		assert.Equal(t, risk.StatusApproved, got.Status)
+		assert.Equal(t, "alice", got.DecidedBy)
+		require.NotNil(t, got.DecidedAt)
+		assert.True(t, decided.Equal(*got.DecidedAt))
+
+		_, err = store.DecideReview(ctx, r.ID, risk.StatusRejected, "bob", decided)
+		assert.ErrorIs(t, err, risk.ErrReviewDecided)
+		_, err = store.DecideReview(ctx, r.ID+1, risk.StatusRejected, "bob", decided)
+		assert.ErrorIs(t, err, risk.ErrReviewNotFound)
+
+		require.NoError(t, store.FailReview(ctx, r.ID, "insufficient funds"))
+		got, err = store.GetReview(ctx, r.ID)
+		require.NoError(t, err)
+		assert.Equal(t, risk.StatusFailed, got.Status)
+		assert.Equal(t, "insufficient funds", got.Error)
+		assert.Equal(t, "alice", got.DecidedBy)
+	})
+
+	t.Run("Complete", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+
+		executing, err := store.CreateReview(ctx, pending("b"))
+		require.NoError(t, err)
+		_, err = store.DecideReview(ctx, executing.ID, risk.StatusExecuting, "alice", created)
+		require.NoError(t, err)
+		require.NoError(t, store.CompleteReview(ctx, executing.ID))
+
+		got, err := store.GetReview(ctx, executing.ID)
+		require.NoError(t, err)
+		assert.Equal(t, risk.StatusApproved, got.Status)
+
+		// Only an executing review is completed.
+		rejected, err := store.CreateReview(ctx, pending("c"))
+		require.NoError(t, err)
+		_, err = store.DecideReview(ctx, rejected.ID, risk.StatusRejected, "bob", created)
+		require.NoError(t, err)
+		require.NoError(t, store.CompleteReview(ctx, rejected.ID))
+
+		got, err = store.GetReview(ctx, rejected.ID)
+		require.NoError(t, err)
+		assert.Equal(t, risk.StatusRejected, got.Status)
+
+		reviews, err := store.ListReviews(ctx, risk.StatusExecuting, -1)
+		require.NoError(t, err)
+		assert.Empty(t, reviews)
+	})
+
+	t.Run("Concurrent decisions", func(t *testing.T) {
+		store := newStore(t)
+		r, err := store.CreateReview(context.Background(), pending("b"))
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		var decided atomic.Int32
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := store.DecideReview(context.Background(), r.ID, risk.StatusApproved, "alice", created); err == nil {
+					decided.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), decided.Load())
+	})
+}
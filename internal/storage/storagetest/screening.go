@@ -0,0 +1,78 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/screening"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ScreeningFactory returns an empty screening store. Cleanup should be registered on t.
+type ScreeningFactory func(t *testing.T) screening.Store
+
+// RunScreening executes the shared behavior tests of screening.Store.
+func RunScreening(t *testing.T, newStore ScreeningFactory) {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	entry := func(list, prefix, note string) screening.Entry {
+		return screening.Entry{
+			List:      list,
+			Address:   Address(prefix),
+			Note:      note,
+			Source:    screening.SourceAPI,
+			CreatedBy: "compliance",
+			CreatedAt: created,
+		}
+	}
+
+	t.Run("Entries", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+
+		require.NoError(t, store.AddScreeningEntry(ctx, entry(screening.ListBlock, "b", "sanctioned")))
+		require.NoError(t, store.AddScreeningEntry(ctx, entry(screening.ListBlock, "a", "")))
+		require.NoError(t, store.AddScreeningEntry(ctx, entry(screening.ListAllow, "a", "")))
+		require.NoError(t, store.AddScreeningEntry(ctx, entry(screening.ListBlock, "b", "updated")))
+
+		entries, err := store.ListScreeningEntries(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []screening.Entry{
+			entry(screening.ListAllow, "a", ""),
+			entry(screening.ListBlock, "a", ""),
+			entry(screening.ListBlock, "b", "updated"),
+		}, entries)
+
+		require.NoError(t, store.RemoveScreeningEntry(ctx, screening.ListBlock, Address("a")))
+		assert.ErrorIs(t, store.RemoveScreeningEntry(ctx, screening.ListBlock, Address("a")), screening.ErrEntryNotFound)
+
+		entries, err = store.ListScreeningEntries(ctx)
+		require.NoError(t, err)
+		assert.Len(t, entries, 2)
+	})
+
+	t.Run("Hits", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+
+		hits, err := store.ListScreeningHits(ctx, 10)
+		require.NoError(t, err)
+		assert.Empty(t, hits)
+
+		hit := screening.Hit{From: Address("a"), To: Address("b"), Amount: 5, Address: Address("b"), Source: "lists/ofac.txt", CreatedAt: created}
+		first, err := store.RecordScreeningHit(ctx, hit)
+		require.NoError(t, err)
+		second, err := store.RecordScreeningHit(ctx, hit)
+		require.NoError(t, err)
+		assert.Greater(t, second.ID, first.ID)
+
+		hits, err = store.ListScreeningHits(ctx, 10)
+		require.NoError(t, err)
+		assert.Equal(t, []screening.Hit{second, first}, hits)
+
+		hits, err = store.ListScreeningHits(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []screening.Hit{second}, hits)
+	})
+}
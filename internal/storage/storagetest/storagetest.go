@@ -0,0 +1,454 @@
+// Package storagetest contains behavior tests shared by every
+// storage.Repository implementation.
+package storagetest
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Petro-vich/transaction_processing_go/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns an empty repository. Cleanup should be registered on t.
+type Factory func(t *testing.T) storage.Repository
+
+// Address returns a valid 64 character address starting with prefix.
+func Address(prefix string) string {
+	return prefix + strings.Repeat("0", 64-len(prefix))
+}
+
+// Run executes the shared behavior tests against repositories created by newRepo.
+func Run(t *testing.T, newRepo Factory) {
+	t.Run("CreateWallet", func(t *testing.T) { testCreateWallet(t, newRepo) })
+	t.Run("GetBalance", func(t *testing.T) { testGetBalance(t, newRepo) })
+	t.Run("SendMoney", func(t *testing.T) { testSendMoney(t, newRepo) })
+	t.Run("SendMoneyWithReference", func(t *testing.T) { testSendMoneyWithReference(t, newRepo) })
+	t.Run("GetLast", func(t *testing.T) { testGetLast(t, newRepo) })
+	t.Run("GetHistory", func(t *testing.T) { testGetHistory(t, newRepo) })
+	t.Run("CancelledContext", func(t *testing.T) { testCancelledContext(t, newRepo) })
+}
+
+func testCreateWallet(t *testing.T, newRepo Factory) {
+	t.Run("Successful wallet creation", func(t *testing.T) {
+		repo := newRepo(t)
+
+		require.NoError(t, repo.CreateWallet(context.Background(), Address("a"), 100))
+
+		balance, err := repo.GetBalance(context.Background(), Address("a"))
+		require.NoError(t, err)
+		assert.Equal(t, 100.0, balance)
+	})
+
+	t.Run("Invalid address length", func(t *testing.T) {
+		repo := newRepo(t)
+
+		err := repo.CreateWallet(context.Background(), "short_address", 100)
+		assert.ErrorIs(t, err, storage.ErrValidation)
+		assert.Contains(t, err.Error(), "invalid address length")
+	})
+
+	t.Run("Address not in stored form", func(t *testing.T) {
+		repo := newRepo(t)
+
+		for _, adr := range []string{strings.Repeat("z", 64), strings.ToUpper(Address("a"))} {
+			err := repo.CreateWallet(context.Background(), adr, 100)
+			assert.ErrorIs(t, err, storage.ErrValidation, adr)
+		}
+	})
+
+	t.Run("Zero balance", func(t *testing.T) {
+		repo := newRepo(t)
+
+		require.NoError(t, repo.CreateWallet(context.Background(), Address("a"), 0))
+
+		balance, err := repo.GetBalance(context.Background(), Address("a"))
+		require.NoError(t, err)
+		assert.Equal(t, 0.0, balance)
+	})
+
+	t.Run("Negative amount", func(t *testing.T) {
+		repo := newRepo(t)
+
+		assert.ErrorIs(t, repo.CreateWallet(context.Background(), Address("a"), -10), storage.ErrValidation)
+	})
+
+	t.Run("Duplicate address", func(t *testing.T) {
+		repo := newRepo(t)
+
+		require.NoError(t, repo.CreateWallet(context.Background(), Address("a"), 100))
+
+		err := repo.CreateWallet(context.Background(), Address("a"), 50)
+		var conflict *storage.ConflictError
+		require.ErrorAs(t, err, &conflict)
+		assert.Equal(t, Address("a"), conflict.Address)
+
+		balance, err := repo.GetBalance(context.Background(), Address("a"))
+		require.NoError(t, err)
+		assert.Equal(t, 100.0, balance)
+	})
+}
+
+func testGetBalance(t *testing.T, newRepo Factory) {
+	t.Run("Non-existent wallet", func(t *testing.T) {
+		repo := newRepo(t)
+
+		balance, err := repo.GetBalance(context.Background(), Address("a"))
+		var notFound *storage.NotFoundError
+		require.ErrorAs(t, err, &notFound)
+		assert.ErrorIs(t, err, storage.ErrAddressNotExist)
+		assert.Equal(t, Address("a"), notFound.Address)
+		assert.Equal(t, 0.0, balance)
+	})
+}
+
+func testSendMoney(t *testing.T, newRepo Factory) {
+	setup := func(t *testing.T) storage.Repository {
+		repo := newRepo(t)
+		require.NoError(t, repo.CreateWallet(context.Background(), Address("a"), 100))
+		require.NoError(t, repo.CreateWallet(context.Background(), Address("b"), 50))
+		return repo
+	}
+
+	assertBalances := func(t *testing.T, repo storage.Repository, a, b float64) {
+		t.Helper()
+		balance, err := repo.GetBalance(context.Background(), Address("a"))
+		require.NoError(t, err)
+		assert.Equal(t, a, balance)
+
+		balance, err = repo.GetBalance(context.Background(), Address("b"))
+		require.NoError(t, err)
+		assert.Equal(t, b, balance)
+	}
+
+	t.Run("Successful transaction", func(t *testing.T) {
+		repo := setup(t)
+
+		require.NoError(t, repo.SendMoney(context.Background(), Address("a"), Address("b"), 30))
+		assertBalances(t, repo, 70, 80)
+	})
+
+	t.Run("Whole balance", func(t *testing.T) {
+		repo := setup(t)
+
+		require.NoError(t, repo.SendMoney(context.Background(), Address("a"), Address("b"), 100))
+		assertBalances(t, repo, 0, 150)
+	})
+
+	t.Run("Insufficient funds", func(t *testing.T) {
+		repo := setup(t)
+
+		err := repo.SendMoney(context.Background(), Address("a"), Address("b"), 100.5)
+		var insufficient *storage.InsufficientFundsError
+		require.ErrorAs(t, err, &insufficient)
+		assert.ErrorIs(t, err, storage.ErrInsufficient)
+		assert.Equal(t, Address("a"), insufficient.Address)
+		assert.Equal(t, 100.0, insufficient.Available)
+		assert.Equal(t, 100.5, insufficient.Requested)
+		assertBalances(t, repo, 100, 50)
+	})
+
+	t.Run("Non-existent from address", func(t *testing.T) {
+		repo := setup(t)
+
+		err := repo.SendMoney(context.Background(), Address("c"), Address("b"), 10)
+		var notFound *storage.NotFoundError
+		require.ErrorAs(t, err, &notFound)
+		assert.Equal(t, Address("c"), notFound.Address)
+	})
+
+	t.Run("Non-existent to address", func(t *testing.T) {
+		repo := setup(t)
+
+		err := repo.SendMoney(context.Background(), Address("a"), Address("c"), 10)
+		var notFound *storage.NotFoundError
+		require.ErrorAs(t, err, &notFound)
+		assert.Equal(t, Address("c"), notFound.Address)
+		assertBalances(t, repo, 100, 50)
+	})
+
+	t.Run("Insufficient funds is reported before unknown recipient", func(t *testing.T) {
+		repo := setup(t)
+
+		err := repo.SendMoney(context.Background(), Address("a"), Address("c"), 1000)
+		assert.ErrorIs(t, err, storage.ErrInsufficient)
+	})
+
+	t.Run("Invalid amount", func(t *testing.T) {
+		repo := setup(t)
+
+		assert.ErrorIs(t, repo.SendMoney(context.Background(), Address("a"), Address("b"), 0), storage.ErrValidation)
+		assert.ErrorIs(t, repo.SendMoney(context.Background(), Address("a"), Address("b"), -5), storage.ErrValidation)
+		assertBalances(t, repo, 100, 50)
+	})
+
+	t.Run("Same sender and recipient", func(t *testing.T) {
+		repo := setup(t)
+
+		assert.ErrorIs(t, repo.SendMoney(context.Background(), Address("a"), Address("a"), 10), storage.ErrValidation)
+	})
+
+	t.Run("Failed transfer is not recorded", func(t *testing.T) {
+		repo := setup(t)
+
+		_ = repo.SendMoney(context.Background(), Address("a"), Address("b"), 1000)
+		_ = repo.SendMoney(context.Background(), Address("a"), Address("c"), 10)
+
+		transactions, err := repo.GetLast(context.Background(), 10)
+		require.NoError(t, err)
+		assert.Empty(t, transactions)
+	})
+}
+
+func testSendMoneyWithReference(t *testing.T, newRepo Factory) {
+	t.Run("Reference runs once", func(t *testing.T) {
+		repo := newRepo(t)
+		require.NoError(t, repo.CreateWallet(context.Background(), Address("a"), 100))
+		require.NoError(t, repo.CreateWallet(context.Background(), Address("b"), 50))
+
+		used, err := repo.HasReference(context.Background(), "pay-1")
+		require.NoError(t, err)
+		assert.False(t, used)
+
+		require.NoError(t, repo.SendMoneyWithReference(context.Background(), "pay-1", Address("a"), Address("b"), 30))
+		used, err = repo.HasReference(context.Background(), "pay-1")
+		require.NoError(t, err)
+		assert.True(t, used)
+
+		err = repo.SendMoneyWithReference(context.Background(), "pay-1", Address("a"), Address("b"), 30)
+		var usedErr *storage.ReferenceUsedError
+		require.ErrorAs(t, err, &usedErr)
+		assert.ErrorIs(t, err, storage.ErrReferenceUsed)
+		assert.Equal(t, "pay-1", usedErr.Reference)
+
+		balance, err := repo.GetBalance(context.Background(), Address("a"))
+		require.NoError(t, err)
+		assert.Equal(t, 70.0, balance)
+		txs, err := repo.GetLast(context.Background(), 10)
+		require.NoError(t, err)
+		assert.Len(t, txs, 1)
+
+		require.NoError(t, repo.SendMoneyWithReference(context.Background(), "pay-2", Address("a"), Address("b"), 30))
+	})
+
+	t.Run("Failed transfer keeps the reference free", func(t *testing.T) {
+		repo := newRepo(t)
+		require.NoError(t, repo.CreateWallet(context.Background(), Address("a"), 100))
+		require.NoError(t, repo.CreateWallet(context.Background(), Address("b"), 50))
+
+		err := repo.SendMoneyWithReference(context.Background(), "pay-1", Address("a"), Address("b"), 150)
+		require.ErrorIs(t, err, storage.ErrInsufficient)
+
+		used, err := repo.HasReference(context.Background(), "pay-1")
+		require.NoError(t, err)
+		assert.False(t, used)
+
+		require.NoError(t, repo.SendMoneyWithReference(context.Background(), "pay-1", Address("a"), Address("b"), 100))
+	})
+}
+
+func testGetLast(t *testing.T, newRepo Factory) {
+	t.Run("Newest first", func(t *testing.T) {
+		repo := newRepo(t)
+		require.NoError(t, repo.CreateWallet(context.Background(), Address("a"), 100))
+		require.NoError(t, repo.CreateWallet(context.Background(), Address("b"), 100))
+
+		require.NoError(t, repo.SendMoney(context.Background(), Address("a"), Address("b"), 1))
+		require.NoError(t, repo.SendMoney(context.Background(), Address("b"), Address("a"), 2))
+		require.NoError(t, repo.SendMoney(context.Background(), Address("a"), Address("b"), 3))
+
+		transactions, err := repo.GetLast(context.Background(), 2)
+		require.NoError(t, err)
+		require.Len(t, transactions, 2)
+
+		assert.Equal(t, 3.0, transactions[0].Amount)
+		assert.Equal(t, Address("a"), transactions[0].From)
+		assert.Equal(t, Address("b"), transactions[0].To)
+		assert.False(t, transactions[0].Created_at.IsZero())
+		assert.Equal(t, 2.0, transactions[1].Amount)
+		assert.Greater(t, transactions[0].Id, transactions[1].Id)
+
+		all, err := repo.GetLast(context.Background(), 10)
+		require.NoError(t, err)
+		assert.Len(t, all, 3)
+	})
+
+	t.Run("Zero count", func(t *testing.T) {
+		repo := newRepo(t)
+
+		transactions, err := repo.GetLast(context.Background(), 0)
+		require.NoError(t, err)
+		assert.NotNil(t, transactions)
+		assert.Empty(t, transactions)
+	})
+}
+
+func testGetHistory(t *testing.T, newRepo Factory) {
+	t.Run("Transactions of one wallet, newest first", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		for _, p := range []string{"a", "b", "c"} {
+			require.NoError(t, repo.CreateWallet(ctx, Address(p), 100))
+		}
+
+		require.NoError(t, repo.SendMoney(ctx, Address("a"), Address("b"), 1))
+		require.NoError(t, repo.SendMoney(ctx, Address("b"), Address("c"), 2))
+		require.NoError(t, repo.SendMoney(ctx, Address("c"), Address("a"), 3))
+		require.NoError(t, repo.SendMoney(ctx, Address("b"), Address("a"), 4))
+
+		history, err := repo.GetHistory(ctx, Address("a"), 10)
+		require.NoError(t, err)
+		require.Len(t, history, 3)
+		assert.Equal(t, 4.0, history[0].Amount)
+		assert.Equal(t, 3.0, history[1].Amount)
+		assert.Equal(t, 1.0, history[2].Amount)
+
+		history, err = repo.GetHistory(ctx, Address("a"), 1)
+		require.NoError(t, err)
+		require.Len(t, history, 1)
+		assert.Equal(t, 4.0, history[0].Amount)
+	})
+
+	t.Run("Wallet without transactions", func(t *testing.T) {
+		repo := newRepo(t)
+		require.NoError(t, repo.CreateWallet(context.Background(), Address("a"), 100))
+
+		history, err := repo.GetHistory(context.Background(), Address("a"), 10)
+		require.NoError(t, err)
+		assert.NotNil(t, history)
+		assert.Empty(t, history)
+	})
+
+	t.Run("Non-existent wallet", func(t *testing.T) {
+		repo := newRepo(t)
+
+		_, err := repo.GetHistory(context.Background(), Address("a"), 10)
+		assert.ErrorIs(t, err, storage.ErrAddressNotExist)
+	})
+}
+
+func testCancelledContext(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	require.NoError(t, repo.CreateWallet(context.Background(), Address("a"), 100))
+	require.NoError(t, repo.CreateWallet(context.Background(), Address("b"), 100))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := repo.GetBalance(ctx, Address("a"))
+	assert.ErrorIs(t, err, context.Canceled)
+
+	err = repo.SendMoney(ctx, Address("a"), Address("b"), 10)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = repo.GetLast(ctx, 10)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	err = repo.CreateWallet(ctx, Address("c"), 10)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	balance, err := repo.GetBalance(context.Background(), Address("a"))
+	require.NoError(t, err)
+	assert.Equal(t, 100.0, balance)
+}
+
+// RunConcurrent moves funds between wallets from many goroutines and checks
+// that no balance goes negative and no funds are created or lost.
+func RunConcurrent(t *testing.T, newRepo Factory) {
+	t.Run("Transfers", func(t *testing.T) { testConcurrentTransfers(t, newRepo) })
+	t.Run("Overdraw", func(t *testing.T) { testConcurrentOverdraw(t, newRepo) })
+}
+
+func testConcurrentTransfers(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+
+	addresses := []string{Address("a"), Address("b"), Address("c"), Address("d")}
+	for _, adr := range addresses {
+		require.NoError(t, repo.CreateWallet(context.Background(), adr, 100))
+	}
+
+	const workers, transfers = 8, 25
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < transfers; i++ {
+				from := addresses[(w+i)%len(addresses)]
+				to := addresses[(w+i+1)%len(addresses)]
+				err := repo.SendMoney(context.Background(), from, to, 30)
+				if err == nil {
+					mu.Lock()
+					succeeded++
+					mu.Unlock()
+					continue
+				}
+				assert.ErrorIs(t, err, storage.ErrInsufficient)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	total := 0.0
+	for _, adr := range addresses {
+		balance, err := repo.GetBalance(context.Background(), adr)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, balance, 0.0)
+		total += balance
+	}
+	assert.Equal(t, 400.0, total)
+
+	transactions, err := repo.GetLast(context.Background(), workers*transfers)
+	require.NoError(t, err)
+	assert.Len(t, transactions, succeeded)
+}
+
+// testConcurrentOverdraw starts many transfers that each fit the balance on
+// their own but not together. Exactly one of them may succeed.
+func testConcurrentOverdraw(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	require.NoError(t, repo.CreateWallet(context.Background(), Address("a"), 100))
+	require.NoError(t, repo.CreateWallet(context.Background(), Address("b"), 100))
+
+	const senders = 16
+
+	var wg sync.WaitGroup
+	errs := make([]error, senders)
+	start := make(chan struct{})
+
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			errs[i] = repo.SendMoney(context.Background(), Address("a"), Address("b"), 60)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assert.ErrorIs(t, err, storage.ErrInsufficient)
+	}
+	assert.Equal(t, 1, succeeded)
+
+	balance, err := repo.GetBalance(context.Background(), Address("a"))
+	require.NoError(t, err)
+	assert.Equal(t, 40.0, balance)
+
+	balance, err = repo.GetBalance(context.Background(), Address("b"))
+	require.NoError(t, err)
+	assert.Equal(t, 160.0, balance)
+}